@@ -9,12 +9,14 @@ import (
 
 // An embeddable controller which implements the default context.
 // This controller is capable of handling:
-// (DevContext), (SessionContext), (FlashContext)
+// (DevContext), (SessionContext), (FlashContext), (CsrfContext)
 type App struct {
 	Dev     *filters.DevContext
 	Session *filters.SessionContext
 	Flash   *filters.FlashContext
+	Csrf    *filters.CsrfContext
 	Auth    *filters.AuthContext
+	Events  *filters.EventContext
 
 	Out web.Renderer
 }
@@ -83,6 +85,42 @@ func (ac *App) SetAuthContext(context *filters.AuthContext) error {
 	return nil
 }
 
+// Returns a 403 result if the current user has not been granted `permission`; nil otherwise.
+// The admin panel as a whole is protected by the `admin-panel` permission; actions
+// check their own permission on top of that.
+func (ac *App) Forbidden(permission string) *web.Result {
+	if ac.Auth != nil && ac.Auth.Can(permission) {
+		return nil
+	}
+
+	return &web.Result{
+		Status: 403,
+		Body:   []byte("YOU ARE NOT AUTHORIZED TO VIEW THIS PAGE."),
+	}
+}
+
+// Sets the EventContext which publishes administrative actions to the trackers.
+func (ac *App) SetEventContext(context *filters.EventContext) error {
+	if context == nil {
+		return errors.New("No EventContext was supplied to this controller!")
+	}
+
+	ac.Events = context
+
+	return nil
+}
+
+// Sets the CsrfContext which provides the token forms must include.
+func (ac *App) SetCsrfContext(context *filters.CsrfContext) error {
+	if context == nil {
+		return errors.New("No CsrfContext was supplied to this controller!")
+	}
+
+	ac.Csrf = context
+
+	return nil
+}
+
 func (ac *App) TestContext(chain []web.ChainableContext) error {
 	return testContext(chain)
 }
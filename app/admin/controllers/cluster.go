@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/drbawb/babou/app/models"
+	"github.com/drbawb/babou/bridge"
+	"github.com/drbawb/babou/lib/web"
+)
+
+// Shows the other nodes in the pack and the traffic through this node's event bridge.
+type ClusterController struct {
+	*App
+
+	acceptHeader string
+}
+
+func (cc *ClusterController) Dispatch(action, accept string) (web.Controller, web.Action) {
+	newCc := &ClusterController{acceptHeader: accept}
+	newCc.App = &App{}
+
+	switch action {
+	case "index":
+		return newCc, newCc.Index
+	case "bridge":
+		return newCc, newCc.Bridge
+	}
+
+	panic("unreachable")
+}
+
+func (cc *ClusterController) Index() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := cc.Forbidden(models.PERM_VIEW_CLUSTER); denied != nil {
+		return denied
+	}
+
+	context := &struct {
+		NodeId  string
+		Members []bridge.Member
+	}{
+		Members: cc.Events.Members(""),
+	}
+
+	if membership := cc.Events.Membership(); membership != nil {
+		context.NodeId = membership.NodeId()
+	}
+
+	res.Body = []byte(cc.Out.RenderWith("bootstrap", "cluster", "index", context, cc.Csrf))
+	return res
+}
+
+// Shows the event bridge's counters, queue depths, and recent messages.
+// Responds with JSON if requested; e.g: for command line tools.
+func (cc *ClusterController) Bridge() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := cc.Forbidden(models.PERM_VIEW_CLUSTER); denied != nil {
+		return denied
+	}
+
+	context := &struct {
+		Stats   *bridge.Stats
+		Traffic []bridge.TapEvent
+	}{
+		Stats:   cc.Events.BridgeStats(),
+		Traffic: cc.Events.RecentTraffic(),
+	}
+
+	if strings.Contains(cc.acceptHeader, "application/json") {
+		jsonResponse, err := json.Marshal(context)
+		if err != nil {
+			res.Status = 500
+			res.Body = []byte("error formatting json for resp.")
+			return res
+		}
+
+		res.Body = jsonResponse
+		return res
+	}
+
+	res.Body = []byte(cc.Out.RenderWith("bootstrap", "cluster", "bridge", context, cc.Csrf))
+	return res
+}
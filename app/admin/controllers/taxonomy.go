@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/drbawb/babou/app/models"
+	"github.com/drbawb/babou/lib/web"
+)
+
+// Lets staff moderate user tags and manage the catalog's categories.
+type TaxonomyController struct {
+	*App
+}
+
+func (tc *TaxonomyController) Dispatch(action, accept string) (web.Controller, web.Action) {
+	newTc := &TaxonomyController{}
+	newTc.App = &App{}
+
+	switch action {
+	case "index":
+		return newTc, newTc.Index
+	case "approveTag":
+		return newTc, newTc.ApproveTag
+	case "deleteTag":
+		return newTc, newTc.DeleteTag
+	case "aliasTag":
+		return newTc, newTc.AliasTag
+	case "createCategory":
+		return newTc, newTc.CreateCategory
+	case "deleteCategory":
+		return newTc, newTc.DeleteCategory
+	}
+
+	panic("unreachable")
+}
+
+// Lists pending tags, aliases, and categories.
+func (tc *TaxonomyController) Index() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := tc.Forbidden(models.PERM_MODERATE_TAGS); denied != nil {
+		return denied
+	}
+
+	pending, err := models.PendingTags()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	aliases, err := models.TagAliases()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	categories, err := models.AllCategories()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	context := &struct {
+		PendingTags []*models.Tag
+		Aliases     []*models.Tag
+		Categories  []*models.Category
+
+		CanManageCategories bool
+	}{
+		PendingTags: pending,
+		Aliases:     aliases,
+		Categories:  categories,
+
+		CanManageCategories: tc.Auth.Can(models.PERM_MANAGE_CATEGORIES),
+	}
+
+	res.Body = []byte(tc.Out.RenderWith("bootstrap", "taxonomy", "index", context, tc.Csrf))
+	return res
+}
+
+// Approves a pending tag so that it is listed for browsing.
+func (tc *TaxonomyController) ApproveTag() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := tc.Forbidden(models.PERM_MODERATE_TAGS); denied != nil {
+		return denied
+	}
+
+	tagId, err := strconv.Atoi(tc.Dev.Params.All["id"])
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	if err := models.ApproveTag(tagId); err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	res.Body = []byte(fmt.Sprintf("tag [%d] has been approved.", tagId))
+	return res
+}
+
+// Deletes a tag; it is removed from every torrent.
+func (tc *TaxonomyController) DeleteTag() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := tc.Forbidden(models.PERM_MODERATE_TAGS); denied != nil {
+		return denied
+	}
+
+	tagId, err := strconv.Atoi(tc.Dev.Params.All["id"])
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	if err := models.DeleteTag(tagId); err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	res.Body = []byte(fmt.Sprintf("tag [%d] has been deleted.", tagId))
+	return res
+}
+
+// Makes a tag an alias of the tag named by the `target` parameter.
+func (tc *TaxonomyController) AliasTag() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := tc.Forbidden(models.PERM_MODERATE_TAGS); denied != nil {
+		return denied
+	}
+
+	tagId, err := strconv.Atoi(tc.Dev.Params.All["id"])
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	target := tc.Dev.Params.All["target"]
+	if err := models.AliasTag(tagId, target); err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	res.Body = []byte(fmt.Sprintf("tag [%d] is now an alias of [%s].", tagId, target))
+	return res
+}
+
+// Creates a category from the `name`, `slug`, and `description` parameters.
+func (tc *TaxonomyController) CreateCategory() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := tc.Forbidden(models.PERM_MANAGE_CATEGORIES); denied != nil {
+		return denied
+	}
+
+	category, err := models.CreateCategory(
+		tc.Dev.Params.All["name"],
+		tc.Dev.Params.All["slug"],
+		tc.Dev.Params.All["description"])
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	res.Body = []byte(fmt.Sprintf("category [%s] has been created.", category.Name))
+	return res
+}
+
+// Deletes a category; its torrents are left without a category.
+func (tc *TaxonomyController) DeleteCategory() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := tc.Forbidden(models.PERM_MANAGE_CATEGORIES); denied != nil {
+		return denied
+	}
+
+	categoryId, err := strconv.Atoi(tc.Dev.Params.All["id"])
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	if err := models.DeleteCategory(categoryId); err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	res.Body = []byte(fmt.Sprintf("category [%d] has been deleted.", categoryId))
+	return res
+}
@@ -1,20 +1,23 @@
 package controllers
 
 import (
-	"github.com/drbawb/babou/app/filters"
 	"github.com/drbawb/babou/app/models"
+	"github.com/drbawb/babou/bridge"
 
-	"errors"
+	"encoding/hex"
 	"fmt"
 	"github.com/drbawb/babou/lib/web"
 	"strconv"
+	"time"
 )
 
 var renderer web.Renderer = web.NewMustacheRenderer("app/admin/views")
 
+// The number of failed logins shown to staff.
+const FAILED_LOGINS_SHOWN int = 200
+
 type UsersController struct {
 	*App
-	Auth *filters.AuthContext
 }
 
 func (au *UsersController) Dispatch(action, accept string) (web.Controller, web.Action) {
@@ -26,6 +29,26 @@ func (au *UsersController) Dispatch(action, accept string) (web.Controller, web.
 		return newAu, newAu.Index
 	case "delete":
 		return newAu, newAu.Delete
+	case "ban":
+		return newAu, newAu.Ban
+	case "resetSecret":
+		return newAu, newAu.ResetSecret
+	case "grantRole":
+		return newAu, newAu.GrantRole
+	case "revokeRole":
+		return newAu, newAu.RevokeRole
+	case "requireTotp":
+		return newAu, newAu.RequireTotp
+	case "disableTotp":
+		return newAu, newAu.DisableTotp
+	case "failedLogins":
+		return newAu, newAu.FailedLogins
+	case "tree":
+		return newAu, newAu.Tree
+	case "grantInvites":
+		return newAu, newAu.GrantInvites
+	case "prune":
+		return newAu, newAu.Prune
 	}
 
 	panic("unreachable")
@@ -33,6 +56,9 @@ func (au *UsersController) Dispatch(action, accept string) (web.Controller, web.
 
 func (au *UsersController) Index() *web.Result {
 	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_USERS); denied != nil {
+		return denied
+	}
 
 	usersList, err := models.AllUsers()
 	if err != nil {
@@ -41,19 +67,46 @@ func (au *UsersController) Index() *web.Result {
 		return res
 	}
 
+	userRoles, err := models.RolesByUser()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	roles, err := models.AllRoles()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	type userRow struct {
+		*models.User
+		Roles []string
+	}
+
+	rows := make([]*userRow, 0, len(usersList))
+	for _, user := range usersList {
+		rows = append(rows, &userRow{User: user, Roles: userRoles[user.UserId]})
+	}
+
 	context := &struct {
-		Users []*models.User
+		Users    []*userRow
+		AllRoles []*models.Role
 	}{
-		Users: usersList,
+		Users:    rows,
+		AllRoles: roles,
 	}
 
 	///res.Body = []byte(fmt.Sprintf("len context.Users: %d", len(context.Users)))
-	res.Body = []byte(au.Out.RenderWith("bootstrap", "user", "index", context))
+	res.Body = []byte(au.Out.RenderWith("bootstrap", "user", "index", context, au.Csrf))
 	return res
 }
 
 func (au *UsersController) Delete() *web.Result {
 	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_USERS); denied != nil {
+		return denied
+	}
 
 	userToDestroy := &models.User{}
 
@@ -75,6 +128,10 @@ func (au *UsersController) Delete() *web.Result {
 		return res
 	}
 
+	au.Events.SendMessage(bridge.DeleteUser(
+		userToDestroy.UserId,
+		hex.EncodeToString(userToDestroy.Secret)))
+
 	res.Body = []byte(fmt.Sprintf(
 		"user [%s] has been judged.",
 		userToDestroy.Username))
@@ -82,13 +139,309 @@ func (au *UsersController) Delete() *web.Result {
 	return res
 }
 
-func (uc *UsersController) SetAuthContext(context *filters.AuthContext) error {
-	if context == nil {
-		return errors.New("No AuthContext was supplied to this controller!")
+// Bans a user; trackers will drop the user's peers.
+func (au *UsersController) Ban() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_USERS); denied != nil {
+		return denied
+	}
+
+	userToBan, err := au.selectUser()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	if err = userToBan.Ban(); err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	au.Events.SendMessage(bridge.DisableUser(
+		userToBan.UserId,
+		hex.EncodeToString(userToBan.Secret),
+		au.Dev.Params.All["reason"]))
+
+	res.Body = []byte(fmt.Sprintf(
+		"user [%s] has been banned.",
+		userToBan.Username))
+
+	return res
+}
+
+// Issues a user a new secret; their old .torrent files will stop working.
+func (au *UsersController) ResetSecret() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_USERS); denied != nil {
+		return denied
+	}
+
+	user, err := au.selectUser()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	oldSecret, _, err := user.ResetSecret(0)
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	au.Events.SendMessage(bridge.UpdateUserKey(
+		user.UserId,
+		hex.EncodeToString(oldSecret),
+		time.Time{}))
+
+	models.LogSecurityEvent(user.UserId, models.SECURITY_PASSKEY_REVOKED,
+		"reset by staff", au.Dev.Request.RemoteAddr)
+
+	res.Body = []byte(fmt.Sprintf(
+		"user [%s] has been issued a new passkey.",
+		user.Username))
+
+	return res
+}
+
+// Grants the user identified by the `id` route parameter the role named by the `role` parameter.
+func (au *UsersController) GrantRole() *web.Result {
+	return au.changeRole(true)
+}
+
+// Revokes the role named by the `role` parameter from the user identified by the `id` route parameter.
+func (au *UsersController) RevokeRole() *web.Result {
+	return au.changeRole(false)
+}
+
+func (au *UsersController) changeRole(grant bool) *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_ROLES); denied != nil {
+		return denied
+	}
+
+	user, err := au.selectUser()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	role := au.Dev.Params.All["role"]
+	if grant {
+		err = user.GrantRole(role)
+	} else {
+		err = user.RevokeRole(role)
+	}
+
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	verb := "revoked from"
+	if grant {
+		verb = "granted to"
+	}
+
+	res.Body = []byte(fmt.Sprintf(
+		"role [%s] has been %s user [%s].",
+		role, verb, user.Username))
+
+	return res
+}
+
+// Requires (or stops requiring) two-factor authentication for everyone with the role named by the `role` parameter.
+// The `state` route parameter is either "on" or "off"
+func (au *UsersController) RequireTotp() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_ROLES); denied != nil {
+		return denied
+	}
+
+	role := au.Dev.Params.All["role"]
+	required := au.Dev.Params.All["state"] == "on"
+	if err := models.SetRoleRequiresTotp(role, required); err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	res.Body = []byte(fmt.Sprintf(
+		"role [%s] requires two-factor authentication: %t",
+		role, required))
+
+	return res
+}
+
+// Turns off two-factor authentication for a user who has lost their device and recovery codes.
+func (au *UsersController) DisableTotp() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_USERS); denied != nil {
+		return denied
+	}
+
+	user, err := au.selectUser()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	if err := user.DisableTotp(); err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	models.LogSecurityEvent(user.UserId, models.SECURITY_TOTP_DISABLED, "disabled by staff", au.Dev.Request.RemoteAddr)
+
+	res.Body = []byte(fmt.Sprintf(
+		"two-factor authentication has been disabled for user [%s].",
+		user.Username))
+
+	return res
+}
+
+// Shows the most recent failed logins; newest first.
+func (au *UsersController) FailedLogins() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_USERS); denied != nil {
+		return denied
+	}
+
+	attempts, err := models.FailedLogins(FAILED_LOGINS_SHOWN)
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	context := &struct {
+		Attempts []*models.LoginAttempt
+	}{
+		Attempts: attempts,
+	}
+
+	res.Body = []byte(au.Out.RenderWith("bootstrap", "user", "logins", context, au.Csrf))
+	return res
+}
+
+// Shows the branch of the invite tree rooted at a user.
+func (au *UsersController) Tree() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_USERS); denied != nil {
+		return denied
 	}
 
-	uc.Auth = context
-	uc.Auth.Required = false
+	user, err := au.selectUser()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	nodes, err := user.InviteTree()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	type treeRow struct {
+		*models.InviteNode
+		Indent int // in pixels
+	}
+
+	rows := make([]*treeRow, 0, len(nodes))
+	for _, node := range nodes {
+		rows = append(rows, &treeRow{InviteNode: node, Indent: node.Depth * 20})
+	}
+
+	context := &struct {
+		Root  *models.User
+		Nodes []*treeRow
+	}{
+		Root:  user,
+		Nodes: rows,
+	}
+
+	res.Body = []byte(au.Out.RenderWith("bootstrap", "user", "tree", context, au.Csrf))
+	return res
+}
+
+// Gives a user more invites to send; the `count` route parameter is the number of invites.
+func (au *UsersController) GrantInvites() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_USERS); denied != nil {
+		return denied
+	}
+
+	user, err := au.selectUser()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	count, err := strconv.Atoi(au.Dev.Params.All["count"])
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	if err := user.GrantInvites(count); err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	res.Body = []byte(fmt.Sprintf(
+		"user [%s] now has %d invites.",
+		user.Username, user.Invites))
+
+	return res
+}
+
+// Bans a user along with everyone they invited; trackers will drop all of their peers.
+func (au *UsersController) Prune() *web.Result {
+	res := &web.Result{Status: 200}
+	if denied := au.Forbidden(models.PERM_MANAGE_USERS); denied != nil {
+		return denied
+	}
+
+	user, err := au.selectUser()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	pruned, err := user.PruneBranch()
+	if err != nil {
+		res.Body = []byte(err.Error())
+		return res
+	}
+
+	reason := au.Dev.Params.All["reason"]
+	if reason == "" {
+		reason = fmt.Sprintf("invite tree of [%s] pruned", user.Username)
+	}
+
+	for _, bannedUser := range pruned {
+		au.Events.SendMessage(bridge.DisableUser(
+			bannedUser.UserId,
+			hex.EncodeToString(bannedUser.Secret),
+			reason))
+	}
+
+	res.Body = []byte(fmt.Sprintf(
+		"user [%s] and %d of their invitees have been banned.",
+		user.Username, len(pruned)-1))
+
+	return res
+}
+
+// Selects the user identified by the `id` route parameter.
+func (au *UsersController) selectUser() (*models.User, error) {
+	userId, err := strconv.Atoi(au.Dev.Params.All["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{}
+	if err := user.SelectId(userId); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return user, nil
 }
@@ -10,11 +10,17 @@ import (
 )
 
 // Attaches routes to the parentRouter and returns it.
-func LoadRoutes(parentRouter *mux.Router) (*mux.Router, error) {
+//
+// The event chain is shared with the parent application so that
+// administrative actions are published on the same event bridge.
+func LoadRoutes(parentRouter *mux.Router, eventChain *filters.EventContext) (*mux.Router, error) {
 	// Shorthand for controllers
 	admin := &controllers.UsersController{}
+	cluster := &controllers.ClusterController{}
+	taxonomy := &controllers.TaxonomyController{}
 	defaultChain := filters.BuildDefaultChain().
-		Chain(filters.AuthChain(true))
+		Chain(filters.AuthChain(true)).
+		Chain(eventChain)
 
 	parentRouter.HandleFunc("/users",
 		defaultChain.
@@ -23,8 +29,116 @@ func LoadRoutes(parentRouter *mux.Router) (*mux.Router, error) {
 	parentRouter.HandleFunc("/users/judge/{id}",
 		defaultChain.
 			Resolve(admin, "delete")).
-		Methods("GET").
+		Methods("POST").
 		Name("judgeUser")
 
+	parentRouter.HandleFunc("/users/ban/{id}",
+		defaultChain.
+			Resolve(admin, "ban")).
+		Methods("POST").
+		Name("banUser")
+
+	parentRouter.HandleFunc("/users/passkey/{id}",
+		defaultChain.
+			Resolve(admin, "resetSecret")).
+		Methods("POST").
+		Name("resetUserSecret")
+
+	parentRouter.HandleFunc("/users/roles/{id}/grant/{role}",
+		defaultChain.
+			Resolve(admin, "grantRole")).
+		Methods("POST").
+		Name("grantUserRole")
+
+	parentRouter.HandleFunc("/users/roles/{id}/revoke/{role}",
+		defaultChain.
+			Resolve(admin, "revokeRole")).
+		Methods("POST").
+		Name("revokeUserRole")
+
+	parentRouter.HandleFunc("/users/2fa/{id}/disable",
+		defaultChain.
+			Resolve(admin, "disableTotp")).
+		Methods("POST").
+		Name("disableUserTotp")
+
+	parentRouter.HandleFunc("/roles/{role}/2fa/{state}",
+		defaultChain.
+			Resolve(admin, "requireTotp")).
+		Methods("POST").
+		Name("requireRoleTotp")
+
+	parentRouter.HandleFunc("/logins",
+		defaultChain.
+			Resolve(admin, "failedLogins")).
+		Methods("GET").
+		Name("adminFailedLogins")
+
+	parentRouter.HandleFunc("/users/tree/{id}",
+		defaultChain.
+			Resolve(admin, "tree")).
+		Methods("GET").
+		Name("userInviteTree")
+
+	parentRouter.HandleFunc("/users/invites/{id}/{count}",
+		defaultChain.
+			Resolve(admin, "grantInvites")).
+		Methods("POST").
+		Name("grantUserInvites")
+
+	parentRouter.HandleFunc("/users/prune/{id}",
+		defaultChain.
+			Resolve(admin, "prune")).
+		Methods("POST").
+		Name("pruneUserTree")
+
+	parentRouter.HandleFunc("/cluster",
+		defaultChain.
+			Resolve(cluster, "index")).
+		Methods("GET").
+		Name("adminCluster")
+
+	parentRouter.HandleFunc("/bridge",
+		defaultChain.
+			Resolve(cluster, "bridge")).
+		Methods("GET").
+		Name("adminBridge")
+
+	parentRouter.HandleFunc("/tags",
+		defaultChain.
+			Resolve(taxonomy, "index")).
+		Methods("GET").
+		Name("adminTaxonomy")
+
+	parentRouter.HandleFunc("/tags/approve/{id}",
+		defaultChain.
+			Resolve(taxonomy, "approveTag")).
+		Methods("POST").
+		Name("approveTag")
+
+	parentRouter.HandleFunc("/tags/delete/{id}",
+		defaultChain.
+			Resolve(taxonomy, "deleteTag")).
+		Methods("POST").
+		Name("deleteTag")
+
+	parentRouter.HandleFunc("/tags/alias/{id}",
+		defaultChain.
+			Resolve(taxonomy, "aliasTag")).
+		Methods("POST").
+		Name("aliasTag")
+
+	parentRouter.HandleFunc("/categories",
+		defaultChain.
+			Resolve(taxonomy, "createCategory")).
+		Methods("POST").
+		Name("createCategory")
+
+	parentRouter.HandleFunc("/categories/delete/{id}",
+		defaultChain.
+			Resolve(taxonomy, "deleteCategory")).
+		Methods("POST").
+		Name("deleteCategory")
+
 	return parentRouter, nil
 }
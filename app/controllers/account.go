@@ -0,0 +1,519 @@
+package controllers
+
+import (
+	filters "github.com/drbawb/babou/app/filters"
+	models "github.com/drbawb/babou/app/models"
+	totp "github.com/drbawb/babou/lib/totp"
+	web "github.com/drbawb/babou/lib/web"
+
+	"github.com/drbawb/babou/bridge"
+
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Lets a user manage their own account.
+type AccountController struct {
+	*App
+	auth   *filters.AuthContext
+	events *filters.EventContext
+
+	passkeyGrace time.Duration // How long a reset passkey keeps working.
+	baseURL      string        // Invite links are built from it; never from the request's Host.
+
+	actionMap map[string]web.Action
+}
+
+// Returns a routable instance of AccountController
+// Passkeys reset from this controller remain valid for `passkeyGrace`
+// unless the user revokes them immediately. Invite links point at `baseURL`
+func NewAccountController(passkeyGrace time.Duration, baseURL string) *AccountController {
+	return &AccountController{passkeyGrace: passkeyGrace, baseURL: baseURL}
+}
+
+func (ac *AccountController) Dispatch(action, accept string) (web.Controller, web.Action) {
+	newAc := &AccountController{
+		passkeyGrace: ac.passkeyGrace,
+		baseURL:      ac.baseURL,
+		actionMap:    make(map[string]web.Action),
+		App:          &App{},
+	}
+
+	newAc.actionMap["index"] = newAc.Index
+	newAc.actionMap["resetPasskey"] = newAc.ResetPasskey
+
+	newAc.actionMap["twoFactor"] = newAc.TwoFactor
+	newAc.actionMap["enableTwoFactor"] = newAc.EnableTwoFactor
+	newAc.actionMap["disableTwoFactor"] = newAc.DisableTwoFactor
+	newAc.actionMap["regenerateRecoveryCodes"] = newAc.RegenerateRecoveryCodes
+
+	newAc.actionMap["sessions"] = newAc.Sessions
+	newAc.actionMap["revokeSession"] = newAc.RevokeSession
+	newAc.actionMap["revokeOtherSessions"] = newAc.RevokeOtherSessions
+
+	newAc.actionMap["invites"] = newAc.Invites
+	newAc.actionMap["createInvite"] = newAc.CreateInvite
+
+	return newAc, newAc.actionMap[action]
+}
+
+// Displays the user's announce URL and their security history.
+func (ac *AccountController) Index() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	output := &web.Result{Status: 200}
+
+	history, err := models.SecurityHistory(user.UserId)
+	if err != nil {
+		output.Body = []byte(err.Error())
+		return output
+	}
+
+	outData := &struct {
+		Username     string
+		AnnounceURL  string
+		GraceHours   int
+		SecurityLogs []*models.SecurityEvent
+	}{
+		Username:     user.Username,
+		AnnounceURL:  user.AnnounceURL(),
+		GraceHours:   int(ac.passkeyGrace / time.Hour),
+		SecurityLogs: history,
+	}
+
+	output.Body = []byte(web.RenderWith("bootstrap", "account", "index", outData, ac.Flash, ac.Csrf))
+
+	return output
+}
+
+// Issues the user a new passkey.
+//
+// Their old passkey keeps working for the configured grace period so
+// they have time to download their .torrent files again; unless they ask
+// for it to be revoked immediately. (e.g: because it was leaked.)
+func (ac *AccountController) ResetPasskey() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	result := &web.Result{Status: 302}
+	result.Redirect = &web.RedirectPath{NamedRoute: "accountIndex"}
+
+	grace := ac.passkeyGrace
+	action := models.SECURITY_PASSKEY_RESET
+	if ac.Dev.Params.All["revoke"] != "" {
+		grace = 0
+		action = models.SECURITY_PASSKEY_REVOKED
+	}
+
+	oldSecret, graceUntil, err := user.ResetSecret(grace)
+	if err != nil {
+		ac.Flash.AddFlash("There was an error resetting your passkey; please try again later.")
+		return result
+	}
+
+	detail := "old passkey revoked"
+	if !graceUntil.IsZero() {
+		detail = fmt.Sprintf("old passkey valid until %s", graceUntil.UTC().Format(time.RFC1123))
+	}
+
+	ac.events.SendMessage(bridge.UpdateUserKey(
+		user.UserId,
+		hex.EncodeToString(oldSecret),
+		graceUntil))
+
+	models.LogSecurityEvent(user.UserId, action, detail, ac.Dev.Request.RemoteAddr)
+
+	if grace > 0 {
+		ac.Flash.AddFlash(fmt.Sprintf(
+			"Your passkey has been reset. Your old .torrent files will work for %d more hours.",
+			int(grace/time.Hour)))
+	} else {
+		ac.Flash.AddFlash("Your passkey has been reset. Your old .torrent files have stopped working.")
+	}
+
+	return result
+}
+
+// Shows whether two-factor authentication is enabled.
+// If it is not: starts enrolling the user and shows the secret for their authenticator app.
+func (ac *AccountController) TwoFactor() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	output := &web.Result{Status: 200}
+
+	required, err := user.RequiresTotp()
+	if err != nil {
+		output.Body = []byte(err.Error())
+		return output
+	}
+
+	outData := &struct {
+		Username string
+		Enabled  bool
+		Required bool
+
+		Secret string
+		URI    string
+	}{
+		Username: user.Username,
+		Enabled:  user.TotpEnabled,
+		Required: required,
+	}
+
+	if !user.TotpEnabled {
+		secret := user.PendingTotpSecret()
+		if secret == nil {
+			if secret, err = user.BeginTotp(); err != nil {
+				output.Body = []byte(err.Error())
+				return output
+			}
+		}
+
+		issuer := ac.Dev.Request.Host
+		if host, _, err := net.SplitHostPort(issuer); err == nil {
+			issuer = host
+		}
+
+		outData.Secret = totp.EncodeSecret(secret)
+		outData.URI = totp.URI(issuer, user.Username, secret)
+	}
+
+	output.Body = []byte(web.RenderWith("bootstrap", "account", "two_factor", outData, ac.Flash, ac.Csrf))
+
+	return output
+}
+
+// Enables two-factor authentication once the user enters a code from their authenticator app.
+// Shows the user their recovery codes.
+func (ac *AccountController) EnableTwoFactor() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	codes, err := user.EnableTotp(ac.Dev.Params.All["code"])
+	if err != nil {
+		ac.Flash.AddFlash(err.Error())
+		return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "accountTwoFactor"}}
+	}
+
+	models.LogSecurityEvent(user.UserId, models.SECURITY_TOTP_ENABLED, "", ac.Dev.Request.RemoteAddr)
+
+	return ac.showRecoveryCodes(user, codes)
+}
+
+// Disables two-factor authentication; the user must enter a current code.
+// Users whose roles require two-factor authentication cannot disable it.
+func (ac *AccountController) DisableTwoFactor() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	result := &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "accountTwoFactor"}}
+
+	if required, err := user.RequiresTotp(); err != nil || required {
+		ac.Flash.AddFlash("Your account requires two-factor authentication; it cannot be disabled.")
+		return result
+	}
+
+	if !ac.checkSecondFactor(user) {
+		return result
+	}
+
+	if err := user.DisableTotp(); err != nil {
+		ac.Flash.AddFlash("There was an error disabling two-factor authentication; please try again later.")
+		return result
+	}
+
+	models.LogSecurityEvent(user.UserId, models.SECURITY_TOTP_DISABLED, "", ac.Dev.Request.RemoteAddr)
+	ac.Flash.AddFlash("Two-factor authentication has been disabled.")
+
+	return result
+}
+
+// Replaces the user's recovery codes; the user must enter a current code.
+func (ac *AccountController) RegenerateRecoveryCodes() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	if !user.TotpEnabled || !ac.checkSecondFactor(user) {
+		return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "accountTwoFactor"}}
+	}
+
+	codes, err := user.RegenerateRecoveryCodes()
+	if err != nil {
+		ac.Flash.AddFlash("There was an error generating your recovery codes; please try again later.")
+		return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "accountTwoFactor"}}
+	}
+
+	models.LogSecurityEvent(user.UserId, models.SECURITY_RECOVERY_RESET, "", ac.Dev.Request.RemoteAddr)
+
+	return ac.showRecoveryCodes(user, codes)
+}
+
+// Checks the `code` parameter against the user's authenticator app or recovery codes.
+// Flashes an error if it does not match.
+func (ac *AccountController) checkSecondFactor(user *models.User) bool {
+	code := ac.Dev.Params.All["code"]
+
+	ok, err := user.CheckTotp(code)
+	if err == nil && !ok {
+		ok, err = user.UseRecoveryCode(code)
+	}
+
+	if err != nil || !ok {
+		ac.Flash.AddFlash(models.ErrTotpInvalid.Error())
+		return false
+	}
+
+	return true
+}
+
+// Recovery codes are only stored as hashes; so they are shown once, right away.
+func (ac *AccountController) showRecoveryCodes(user *models.User, codes []string) *web.Result {
+	output := &web.Result{Status: 200}
+	outData := &struct {
+		Username string
+		Codes    []string
+	}{
+		Username: user.Username,
+		Codes:    codes,
+	}
+
+	output.Body = []byte(web.RenderWith("bootstrap", "account", "recovery_codes", outData, ac.Flash, ac.Csrf))
+
+	return output
+}
+
+// Lists the browsers the user is logged in with.
+func (ac *AccountController) Sessions() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	output := &web.Result{Status: 200}
+
+	active, err := models.ActiveSessions(user.UserId)
+	if err != nil {
+		output.Body = []byte(err.Error())
+		return output
+	}
+
+	type sessionRow struct {
+		*models.Session
+		IsCurrent bool
+	}
+
+	currentId := ac.auth.CurrentSessionId()
+	rows := make([]*sessionRow, 0, len(active))
+	for _, session := range active {
+		rows = append(rows, &sessionRow{Session: session, IsCurrent: session.SessionId == currentId})
+	}
+
+	outData := &struct {
+		Username string
+		Sessions []*sessionRow
+	}{
+		Username: user.Username,
+		Sessions: rows,
+	}
+
+	output.Body = []byte(web.RenderWith("bootstrap", "account", "sessions", outData, ac.Flash, ac.Csrf))
+
+	return output
+}
+
+// Logs the user out of the browser identified by the `id` route parameter.
+func (ac *AccountController) RevokeSession() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	result := &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "accountSessions"}}
+
+	sessionId, err := strconv.Atoi(ac.Dev.Params.All["id"])
+	if err != nil {
+		ac.Flash.AddFlash("That session could not be found.")
+		return result
+	}
+
+	revoked, err := (&models.Session{}).Delete(user.UserId, sessionId)
+	if err != nil {
+		ac.Flash.AddFlash("There was an error logging out that session; please try again later.")
+		return result
+	} else if !revoked {
+		ac.Flash.AddFlash("That session could not be found.")
+		return result
+	}
+
+	models.LogSecurityEvent(user.UserId, models.SECURITY_SESSION_REVOKED,
+		fmt.Sprintf("session %d", sessionId), ac.Dev.Request.RemoteAddr)
+
+	if sessionId == ac.auth.CurrentSessionId() {
+		result.Redirect.NamedRoute = "homeIndex"
+	}
+	ac.Flash.AddFlash("That session has been logged out.")
+
+	return result
+}
+
+// Logs the user out of every browser except this one.
+func (ac *AccountController) RevokeOtherSessions() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	result := &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "accountSessions"}}
+
+	revoked, err := (&models.Session{}).DeleteOthers(user.UserId, ac.auth.CurrentSessionId())
+	if err != nil {
+		ac.Flash.AddFlash("There was an error logging out your other sessions; please try again later.")
+		return result
+	}
+
+	models.LogSecurityEvent(user.UserId, models.SECURITY_SESSION_REVOKED,
+		fmt.Sprintf("%d other sessions", revoked), ac.Dev.Request.RemoteAddr)
+	ac.Flash.AddFlash(fmt.Sprintf("%d other sessions have been logged out.", revoked))
+
+	return result
+}
+
+// Displays the invites a user has left and the invites they have sent.
+func (ac *AccountController) Invites() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	output := &web.Result{Status: 200}
+
+	sent, err := user.SentInvites()
+	if err != nil {
+		output.Body = []byte(err.Error())
+		return output
+	}
+
+	type inviteRow struct {
+		*models.Invite
+		Link string
+	}
+
+	rows := make([]*inviteRow, 0, len(sent))
+	for _, invite := range sent {
+		row := &inviteRow{Invite: invite}
+		if !invite.Used && !invite.Expired() {
+			row.Link = ac.baseURL + "/register?invite=" + invite.Code
+		}
+
+		rows = append(rows, row)
+	}
+
+	outData := &struct {
+		Username  string
+		Remaining int
+		Invites   []*inviteRow
+	}{
+		Username:  user.Username,
+		Remaining: user.Invites,
+		Invites:   rows,
+	}
+
+	output.Body = []byte(web.RenderWith("bootstrap", "account", "invites", outData, ac.Flash, ac.Csrf))
+
+	return output
+}
+
+// Spends one of the user's invites on the email address they entered.
+func (ac *AccountController) CreateInvite() *web.Result {
+	redirect, user := ac.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	result := &web.Result{Status: 302}
+	result.Redirect = &web.RedirectPath{NamedRoute: "accountInvites"}
+
+	invite, err := user.CreateInvite(ac.Dev.Params.All["email"])
+	if err != nil {
+		ac.Flash.AddFlash(err.Error())
+		return result
+	}
+
+	ac.Flash.AddFlash(fmt.Sprintf(
+		"Your invite for %s has been created; send them the link below before it expires.",
+		invite.Email))
+
+	return result
+}
+
+// Tests if the user is logged in.
+// If not: returns a web.Result that would redirect them to the homepage.
+func (ac *AccountController) RedirectOnAuthFail() (*web.Result, *models.User) {
+	user, err := ac.auth.CurrentUser()
+	if err != nil {
+		result := &web.Result{Status: 302}
+		result.Redirect = &web.RedirectPath{NamedRoute: "homeIndex"}
+
+		return result, nil
+	}
+
+	return nil, user
+}
+
+// Setup contexts
+
+func (ac *AccountController) SetAuthContext(context *filters.AuthContext) error {
+	ac.auth = context
+	return nil
+}
+
+func (ac *AccountController) SetEventContext(context *filters.EventContext) error {
+	ac.events = context
+	return nil
+}
+
+// Tests that the current chain is sufficient for this route.
+func (ac *AccountController) TestContext(chain []web.ChainableContext) error {
+	if err := ac.App.TestContext(chain); err != nil {
+		return err
+	}
+
+	authFlag, eventFlag := false, false
+	for i := 0; i < len(chain); i++ {
+		if _, ok := chain[i].(filters.AuthChainLink); ok {
+			authFlag = true
+		}
+
+		if _, ok := chain[i].(filters.EventChainLink); ok {
+			eventFlag = true
+		}
+	}
+
+	if !authFlag {
+		return errors.New("Auth chain missing from account route.")
+	}
+
+	if !eventFlag {
+		return errors.New("Event chain missing from account route.")
+	}
+
+	return nil
+}
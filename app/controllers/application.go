@@ -9,11 +9,12 @@ import (
 
 // An embeddable controller which implements the default context.
 // This controller is capable of handling:
-// (DevContext), (SessionContext), (FlashContext)
+// (DevContext), (SessionContext), (FlashContext), (CsrfContext)
 type App struct {
 	Dev     *filters.DevContext
 	Session *filters.SessionContext
 	Flash   *filters.FlashContext
+	Csrf    *filters.CsrfContext
 }
 
 // Default dispatcher
@@ -67,6 +68,17 @@ func (ac *App) SetFlashContext(context *filters.FlashContext) error {
 	return nil
 }
 
+// Sets the CsrfContext which provides the token forms must include.
+func (ac *App) SetCsrfContext(context *filters.CsrfContext) error {
+	if context == nil {
+		return errors.New("No CsrfContext was supplied to this controller!")
+	}
+
+	ac.Csrf = context
+
+	return nil
+}
+
 func (ac *App) TestContext(chain []web.ChainableContext) error {
 	return testContext(chain)
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	filters "github.com/drbawb/babou/app/filters"
+	models "github.com/drbawb/babou/app/models"
 	web "github.com/drbawb/babou/lib/web"
 )
 
@@ -41,7 +42,7 @@ func (hc *HomeController) Dispatch(action, accept string) (web.Controller, web.A
 // Will display a public welcome page if the user is not logged in
 // Otherwise it will redirect the user to the /news page.
 func (hc *HomeController) Index() *web.Result {
-	if hc.auth.Can("homeIndex") {
+	if hc.auth.Can(models.PERM_BROWSE) {
 		return hc.blog()
 	} else {
 		return hc.homePage()
@@ -58,7 +59,7 @@ func (hc *HomeController) homePage() *web.Result {
 		"bootstrap",
 		"home",
 		"index",
-		outData, hc.Flash))
+		outData, hc.Flash, hc.Csrf))
 	return output
 }
 
@@ -86,7 +87,7 @@ func (hc *HomeController) blog() *web.Result {
 		Articles: testArticles,
 	}
 
-	output.Body = []byte(web.RenderWith("bootstrap", "home", "news", outData))
+	output.Body = []byte(web.RenderWith("bootstrap", "home", "news", outData, hc.Csrf))
 
 	return output
 }
@@ -109,7 +110,7 @@ func (hc *HomeController) Faq() *web.Result {
 		Username: user.Username,
 	}
 
-	output.Body = []byte(web.RenderWith("bootstrap", "home", "faq", outData))
+	output.Body = []byte(web.RenderWith("bootstrap", "home", "faq", outData, hc.Csrf))
 
 	return output
 }
@@ -3,18 +3,41 @@ package controllers
 import (
 	errors "errors"
 	fmt "fmt"
+	strings "strings"
+	time "time"
 
 	filters "github.com/drbawb/babou/app/filters"
 	models "github.com/drbawb/babou/app/models"
+	lib "github.com/drbawb/babou/lib"
+	mailer "github.com/drbawb/babou/lib/mailer"
 	web "github.com/drbawb/babou/lib/web"
 )
 
 // Implements babou/app.Controller interface.
 // Maps an action to results or returns 404 otherwise.
 
+// How long a user has to enter their second factor after their password.
+const LOGIN_TOTP_TIMEOUT = 5 * time.Minute
+
 const (
 	ACCT_CREATION_ERROR = `There was an unexpected error while creating your account. Please try again later or
 	contact our administrative staff.`
+
+	VERIFY_EMAIL_MAIL = `Hello %s,
+
+Please follow this link to verify your email address:
+
+%s
+
+If you did not register an account you can ignore this message.`
+
+	PASSWORD_RESET_MAIL = `Hello %s,
+
+Someone asked to reset the password of your account. To choose a new password follow this link:
+
+%s
+
+The link works once, for %d minutes. If you did not ask to reset your password you can ignore this message.`
 )
 
 type LoginController struct {
@@ -23,6 +46,10 @@ type LoginController struct {
 	*App
 	auth *filters.AuthContext
 
+	registration lib.RegistrationMode // Who may create an account.
+	mail         mailer.Mailer        // Sends verification and password reset links.
+	baseURL      string               // Links in mail are built from it; never from the request's Host.
+
 	actionMap map[string]web.Action
 }
 
@@ -33,6 +60,9 @@ type LoginController struct {
 func (lc *LoginController) Dispatch(action, accept string) (web.Controller, web.Action) {
 	newLc := &LoginController{
 		safeInstance: true,
+		registration: lc.registration,
+		mail:         lc.mail,
+		baseURL:      lc.baseURL,
 		actionMap:    make(map[string]web.Action),
 		App:          &App{},
 	}
@@ -47,6 +77,18 @@ func (lc *LoginController) Dispatch(action, accept string) (web.Controller, web.
 	//session
 	newLc.actionMap["session"] = newLc.Session
 	newLc.actionMap["logout"] = newLc.Logout
+	newLc.actionMap["twoFactor"] = newLc.TwoFactor
+	newLc.actionMap["verifyTwoFactor"] = newLc.VerifyTwoFactor
+
+	//email verification
+	newLc.actionMap["verify"] = newLc.Verify
+	newLc.actionMap["resendVerification"] = newLc.ResendVerification
+
+	//password reset
+	newLc.actionMap["forgotPassword"] = newLc.ForgotPassword
+	newLc.actionMap["sendPasswordReset"] = newLc.SendPasswordReset
+	newLc.actionMap["editPassword"] = newLc.EditPassword
+	newLc.actionMap["resetPassword"] = newLc.ResetPassword
 
 	return newLc, newLc.actionMap[action]
 }
@@ -58,7 +100,7 @@ func (lc *LoginController) Index() *web.Result {
 	output.Status = 200
 	outData := &web.ViewData{Context: &struct{}{}}
 
-	output.Body = []byte(web.RenderWith("bootstrap", "login", "index", outData, lc.Flash))
+	output.Body = []byte(web.RenderWith("bootstrap", "login", "index", outData, lc.Flash, lc.Csrf))
 
 	return output
 }
@@ -71,10 +113,16 @@ func (lc *LoginController) Session() *web.Result {
 		NamedRoute: "homeIndex", //redirect to login page.
 	}
 
+	username := lc.Dev.Params.All["username"]
+	if throttled := lc.throttle(username); throttled != nil {
+		return throttled
+	}
+
 	// check credentials and get user.
 	user := &models.User{}
-	err := user.SelectUsername(lc.Dev.Params.All["username"])
+	err := user.SelectUsername(username)
 	if err != nil {
+		models.RecordLoginAttempt(username, lc.Dev.Request.RemoteAddr, false)
 		lc.Flash.AddFlash(fmt.Sprintf("Error logging you in: %s", err.Error()))
 		output.Status = 302
 
@@ -87,6 +135,7 @@ func (lc *LoginController) Session() *web.Result {
 
 	err = user.CheckHash(lc.Dev.Params.All["password"])
 	if err != nil {
+		models.RecordLoginAttempt(username, lc.Dev.Request.RemoteAddr, false)
 		fmt.Printf("error logging you in.")
 		lc.Flash.AddFlash(fmt.Sprintf("Error logging you in: %s", err.Error()))
 		output.Status = 302
@@ -97,14 +146,176 @@ func (lc *LoginController) Session() *web.Result {
 		return output
 	}
 
-	session, _ := lc.App.Session.GetSession()
+	if user.IsBanned {
+		models.RecordLoginAttempt(username, lc.Dev.Request.RemoteAddr, false)
+		lc.Flash.AddFlash(models.ErrUserBanned.Error())
+		output.Status = 302
 
-	session.Values["user_id"] = user.UserId
+		redirectPath.NamedRoute = "loginIndex"
+		output.Redirect = redirectPath
+		return output
+	}
 
-	output.Status = 302
-	output.Redirect = redirectPath
+	if !user.EmailVerified {
+		lc.Flash.AddFlash("Please verify your email address before logging in; check your inbox for the link we sent you.")
+		output.Status = 302
 
-	lc.auth.WriteSessionFor(user)
+		redirectPath.NamedRoute = "loginIndex"
+		output.Redirect = redirectPath
+		return output
+	}
+
+	// ask for a second factor before the user is logged in.
+	if user.TotpEnabled {
+		session, err := lc.App.Session.GetSession()
+		if err != nil {
+			lc.Flash.AddFlash("There was an error logging you in; please try again later.")
+			output.Status = 302
+
+			redirectPath.NamedRoute = "loginIndex"
+			output.Redirect = redirectPath
+			return output
+		}
+
+		session.Values["pending_user_id"] = user.UserId
+		session.Values["pending_since"] = time.Now().Unix()
+
+		output.Status = 302
+		redirectPath.NamedRoute = "loginTwoFactor"
+		output.Redirect = redirectPath
+		return output
+	}
+
+	return lc.startSession(user)
+}
+
+// Displays a form asking for a code from the user's authenticator app.
+// The user must have entered their password first.
+func (lc *LoginController) TwoFactor() *web.Result {
+	if user := lc.pendingUser(); user == nil {
+		lc.Flash.AddFlash("Please login again.")
+		return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "loginIndex"}}
+	}
+
+	output := &web.Result{Status: 200}
+	outData := &web.ViewData{Context: &struct{}{}}
+
+	output.Body = []byte(web.RenderWith("bootstrap", "login", "two_factor", outData, lc.Flash, lc.Csrf))
+
+	return output
+}
+
+// Logs the user in if they entered a code from their authenticator app or
+// one of their recovery codes.
+func (lc *LoginController) VerifyTwoFactor() *web.Result {
+	user := lc.pendingUser()
+	if user == nil {
+		lc.Flash.AddFlash("Please login again.")
+		return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "loginIndex"}}
+	}
+
+	if throttled := lc.throttle(user.Username); throttled != nil {
+		return throttled
+	}
+
+	code := lc.Dev.Params.All["code"]
+
+	ok, err := user.CheckTotp(code)
+	if err == nil && !ok {
+		if ok, err = user.UseRecoveryCode(code); ok {
+			models.LogSecurityEvent(user.UserId, models.SECURITY_RECOVERY_USED,
+				"used to login", lc.Dev.Request.RemoteAddr)
+		}
+	}
+
+	if err != nil || !ok {
+		models.RecordLoginAttempt(user.Username, lc.Dev.Request.RemoteAddr, false)
+		lc.Flash.AddFlash(models.ErrTotpInvalid.Error())
+		return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "loginTwoFactor"}}
+	}
+
+	session, err := lc.App.Session.GetSession()
+	if err != nil {
+		lc.Flash.AddFlash("There was an error logging you in; please try again later.")
+		return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "loginIndex"}}
+	}
+
+	delete(session.Values, "pending_user_id")
+	delete(session.Values, "pending_since")
+
+	return lc.startSession(user)
+}
+
+// Refuses a login attempt if there have been too many failed attempts for
+// the username or from the user's address; they must wait a while.
+// Returns nil if the attempt may go ahead.
+func (lc *LoginController) throttle(username string) *web.Result {
+	next, locked, err := models.NextLoginAttempt(username, lc.Dev.Request.RemoteAddr)
+	if err != nil {
+		fmt.Printf("Error checking failed logins for [%s]: %s \n", username, err.Error())
+		return nil
+	} else if next.IsZero() {
+		return nil
+	}
+
+	wait := next.Sub(time.Now())
+	if locked {
+		lc.Flash.AddFlash(fmt.Sprintf(
+			"There have been too many failed logins; logins are locked for %d minutes.",
+			int(wait.Minutes())+1))
+	} else {
+		lc.Flash.AddFlash(fmt.Sprintf(
+			"There have been several failed logins; please wait %d seconds before trying again.",
+			int(wait.Seconds())+1))
+	}
+
+	return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "loginIndex"}}
+}
+
+// Returns the user who entered their password but still needs to enter a
+// second factor; or nil if there is no such user, they took too long, or
+// they have been banned since.
+func (lc *LoginController) pendingUser() *models.User {
+	session, err := lc.App.Session.GetSession()
+	if err != nil {
+		fmt.Printf("Error reading pending login from session: %s \n", err.Error())
+		return nil
+	}
+
+	userId, ok := session.Values["pending_user_id"].(int)
+	since, _ := session.Values["pending_since"].(int64)
+	if !ok || time.Since(time.Unix(since, 0)) > LOGIN_TOTP_TIMEOUT {
+		return nil
+	}
+
+	user := &models.User{}
+	if err := user.SelectId(userId); err != nil || user.IsBanned {
+		return nil
+	}
+
+	return user
+}
+
+// Logs a user in and redirects them to the homepage.
+// Users whose roles require two-factor authentication are sent to set it up.
+func (lc *LoginController) startSession(user *models.User) *web.Result {
+	output := &web.Result{Status: 302}
+	output.Redirect = &web.RedirectPath{NamedRoute: "homeIndex"}
+
+	if err := lc.auth.WriteSessionFor(user); err != nil {
+		lc.Flash.AddFlash("There was an error logging you in; please try again later.")
+		output.Redirect.NamedRoute = "loginIndex"
+		return output
+	}
+
+	models.RecordLoginAttempt(user.Username, lc.Dev.Request.RemoteAddr, true)
+
+	if !user.TotpEnabled {
+		if required, _ := user.RequiresTotp(); required {
+			lc.Flash.AddFlash("Your account requires two-factor authentication; please set it up to continue.")
+			output.Redirect.NamedRoute = "accountTwoFactor"
+		}
+	}
 
 	return output
 }
@@ -140,60 +351,302 @@ func (lc *LoginController) Logout() *web.Result {
 }
 
 // Displays the registration form.
+//
+// An invite link [/register?invite=code] remembers the code in the
+// session so the invitee does not have to type it.
 func (lc *LoginController) New() *web.Result {
 	output := &web.Result{}
 
-	output.Status = 200
-	outData := &web.ViewData{Context: &struct{}{}} // render the registration form.
+	if code := lc.Dev.Params.All["invite"]; code != "" {
+		if session, err := lc.App.Session.GetSession(); err != nil {
+			fmt.Printf("Error remembering invite code: %s \n", err.Error())
+		} else {
+			session.Values["invite_code"] = code
+		}
+	}
 
-	output.Body = []byte(web.RenderWith("bootstrap", "login", "new", outData, lc.Flash))
+	output.Status = 200
+	outData := &web.ViewData{Context: &struct {
+		InviteOnly bool
+		Closed     bool
+		InviteCode string
+	}{
+		InviteOnly: lc.registration == lib.REGISTRATION_INVITE,
+		Closed:     lc.registration == lib.REGISTRATION_CLOSED,
+		InviteCode: lc.rememberedInvite(),
+	}} // render the registration form.
+
+	output.Body = []byte(web.RenderWith("bootstrap", "login", "new", outData, lc.Flash, lc.Csrf))
 
 	return output
 }
 
 // Handles the results from the registration form submission.
 func (lc *LoginController) Create() *web.Result {
+	redirectPath := &web.RedirectPath{
+		NamedRoute: "loginNew", //redirect to registration page.
+	}
 
 	username, password := lc.Dev.Params.All["username"], lc.Dev.Params.All["password"]
 	// redirect to login#New() w/ flash message saying passwords don't match.
 	if lc.Dev.Params.All["password"] != lc.Dev.Params.All["confirm-password"] {
 		fmt.Printf("redirecting to new page; password mismatch")
 		lc.Flash.AddFlash("the password and confirmation you entered do not match. Please double-check your supplied passwords.")
-		redirectPath := &web.RedirectPath{
-			NamedRoute: "loginNew", //redirect to login page.
-		}
 
 		return &web.Result{Status: 302, Body: nil, Redirect: redirectPath}
 	}
 
-	status, err := models.NewUser(username, password)
+	if !strings.Contains(lc.Dev.Params.All["email"], "@") {
+		lc.Flash.AddFlash("Please enter your email address; we will send you a link to verify it.")
+		return &web.Result{Status: 302, Body: nil, Redirect: redirectPath}
+	}
+
+	invite, err := lc.inviteForRegistration()
 	if err != nil {
-		return &web.Result{Status: 500, Body: []byte(ACCT_CREATION_ERROR)}
+		lc.Flash.AddFlash(err.Error())
+		return &web.Result{Status: 302, Body: nil, Redirect: redirectPath}
 	}
 
-	redirectPath := &web.RedirectPath{
-		NamedRoute: "loginIndex", //redirect to login page.
+	status, err := models.NewUser(username, password, lc.Dev.Params.All["email"], invite)
+	if err != nil {
+		return &web.Result{Status: 500, Body: []byte(ACCT_CREATION_ERROR)}
 	}
 
 	// Redirect back to registration page if there was an error creating account.
 	if status == models.USERNAME_TAKEN {
 		lc.Flash.AddFlash("The username you chose was already taken")
-		redirectPath.NamedRoute = "loginNew"
+	} else if status == models.INVITE_INVALID {
+		lc.Flash.AddFlash(models.ErrInviteInvalid.Error())
+	} else if status == models.INVITE_EMAIL_MISMATCH {
+		lc.Flash.AddFlash("Your invite was sent to a different email address; please register with that address.")
 	} else if status != 0 {
 		lc.Flash.AddFlash("There was an error validating your new user account; please try again or contact our administrative staff.")
-		redirectPath.NamedRoute = "loginNew"
 	} else {
-		//TODO: show message if account activation is required.
-		lc.Flash.AddFlash("Your account was created sucesfully. You may now login.")
+		if session, err := lc.App.Session.GetSession(); err != nil {
+			fmt.Printf("Error forgetting invite code: %s \n", err.Error())
+		} else {
+			delete(session.Values, "invite_code")
+		}
+
+		newUser := &models.User{}
+		if err := newUser.SelectUsername(username); err != nil {
+			return &web.Result{Status: 500, Body: []byte(ACCT_CREATION_ERROR)}
+		}
+
+		if err := lc.sendVerification(newUser); err != nil {
+			lc.Flash.AddFlash("Your account was created but we could not send your verification email; please request a new one.")
+		} else {
+			lc.Flash.AddFlash("Your account was created sucesfully. Please follow the link we emailed you to verify your address.")
+		}
+
+		redirectPath.NamedRoute = "loginIndex"
 	}
 
 	return &web.Result{Status: 302, Body: nil, Redirect: redirectPath}
 }
 
+// Returns the invite a new user must register with; nil if registration is open.
+// Returns an error if the user may not register.
+//
+// The very first account can always be created so that a new site has an administrator.
+func (lc *LoginController) inviteForRegistration() (*models.Invite, error) {
+	switch lc.registration {
+	case lib.REGISTRATION_OPEN:
+		return nil, nil
+	case lib.REGISTRATION_CLOSED:
+		return nil, errors.New("Registration is closed.")
+	}
+
+	if total, err := models.TotalUsers(); err == nil && total == 0 {
+		return nil, nil
+	}
+
+	code := lc.Dev.Params.All["invite"]
+	if code == "" {
+		code = lc.rememberedInvite()
+	}
+
+	if code == "" {
+		return nil, errors.New("You need an invite code to register.")
+	}
+
+	return models.SelectInvite(code)
+}
+
+// Returns the invite code remembered from an invite link; if any.
+func (lc *LoginController) rememberedInvite() string {
+	session, err := lc.App.Session.GetSession()
+	if err != nil {
+		fmt.Printf("Error reading invite code from session: %s \n", err.Error())
+		return ""
+	}
+
+	code, _ := session.Values["invite_code"].(string)
+
+	return code
+}
+
+// Verifies a user's email address with the token they were mailed.
+func (lc *LoginController) Verify() *web.Result {
+	redirectPath := &web.RedirectPath{NamedRoute: "loginIndex"}
+
+	user, err := models.RedeemToken(models.TOKEN_VERIFY_EMAIL, lc.Dev.Params.All["token"])
+	if err != nil {
+		lc.Flash.AddFlash(err.Error())
+		return &web.Result{Status: 302, Redirect: redirectPath}
+	}
+
+	if err := user.VerifyEmail(); err != nil {
+		lc.Flash.AddFlash("There was an error verifying your email address; please try again later.")
+		return &web.Result{Status: 302, Redirect: redirectPath}
+	}
+
+	lc.Flash.AddFlash("Your email address has been verified. You may now login.")
+	return &web.Result{Status: 302, Redirect: redirectPath}
+}
+
+// Sends a new verification link to an unverified address.
+// Responds the same way whether or not the address belongs to anyone.
+func (lc *LoginController) ResendVerification() *web.Result {
+	redirectPath := &web.RedirectPath{NamedRoute: "loginIndex"}
+
+	user := &models.User{}
+	if err := user.SelectEmail(lc.Dev.Params.All["email"]); err == nil && !user.EmailVerified {
+		if err := lc.sendVerification(user); err != nil {
+			lc.Flash.AddFlash("There was an error sending your verification link; please try again later.")
+			return &web.Result{Status: 302, Redirect: redirectPath}
+		}
+	}
+
+	lc.Flash.AddFlash("If that address is waiting to be verified we have sent it a new link.")
+	return &web.Result{Status: 302, Redirect: redirectPath}
+}
+
+// Displays a form where a user can ask for a password reset link.
+func (lc *LoginController) ForgotPassword() *web.Result {
+	output := &web.Result{Status: 200}
+	outData := &web.ViewData{Context: &struct{}{}}
+
+	output.Body = []byte(web.RenderWith("bootstrap", "login", "forgot", outData, lc.Flash, lc.Csrf))
+
+	return output
+}
+
+// Mails a password reset link to the address the user entered.
+// Responds the same way whether or not the address belongs to anyone.
+func (lc *LoginController) SendPasswordReset() *web.Result {
+	user := &models.User{}
+	if err := user.SelectEmail(lc.Dev.Params.All["email"]); err == nil && !user.IsBanned {
+		token, err := user.IssueToken(models.TOKEN_RESET_PASSWORD, models.RESET_PASSWORD_LIFETIME)
+		if err == nil {
+			err = lc.mail.Send(&mailer.Message{
+				To:      []string{user.Email},
+				Subject: "Reset your password",
+				Body: fmt.Sprintf(PASSWORD_RESET_MAIL,
+					user.Username,
+					lc.linkTo("/password/reset/"+token),
+					int(models.RESET_PASSWORD_LIFETIME/time.Minute)),
+			})
+		}
+
+		if err != nil {
+			lc.Flash.AddFlash("There was an error sending your password reset link; please try again later.")
+			return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "passwordForgot"}}
+		}
+	}
+
+	lc.Flash.AddFlash("If that address belongs to an account we have sent it a link to reset your password.")
+	return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "loginIndex"}}
+}
+
+// Displays a form where a user can choose a new password; if their reset link still works.
+func (lc *LoginController) EditPassword() *web.Result {
+	token := lc.Dev.Params.All["token"]
+	if _, err := models.PeekToken(models.TOKEN_RESET_PASSWORD, token); err != nil {
+		lc.Flash.AddFlash(err.Error())
+		return &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "passwordForgot"}}
+	}
+
+	output := &web.Result{Status: 200}
+	outData := &web.ViewData{Context: &struct{ Token string }{Token: token}}
+
+	output.Body = []byte(web.RenderWith("bootstrap", "login", "reset", outData, lc.Flash, lc.Csrf))
+
+	return output
+}
+
+// Sets a new password with a reset link; the link is used up.
+// The user is logged out everywhere.
+func (lc *LoginController) ResetPassword() *web.Result {
+	token := lc.Dev.Params.All["token"]
+	password := lc.Dev.Params.All["password"]
+
+	if password == "" || password != lc.Dev.Params.All["confirm-password"] {
+		lc.Flash.AddFlash("the password and confirmation you entered do not match. Please double-check your supplied passwords.")
+
+		result := &web.Result{Status: 302, Redirect: &web.RedirectPath{NamedRoute: "passwordEdit"}}
+		result.Redirect.Params = []string{"token", token}
+		return result
+	}
+
+	redirectPath := &web.RedirectPath{NamedRoute: "loginIndex"}
+
+	user, err := models.RedeemToken(models.TOKEN_RESET_PASSWORD, token)
+	if err != nil {
+		lc.Flash.AddFlash(err.Error())
+		return &web.Result{Status: 302, Redirect: redirectPath}
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		lc.Flash.AddFlash("There was an error changing your password; please try again later.")
+		return &web.Result{Status: 302, Redirect: redirectPath}
+	}
+
+	userSession := &models.Session{}
+	if err := userSession.DeleteFor(user); err != nil {
+		fmt.Printf("Error deleting sessions of user %d: %s \n", user.UserId, err.Error())
+	}
+
+	// the user proved they own the address.
+	if !user.EmailVerified {
+		user.VerifyEmail()
+	}
+
+	models.LogSecurityEvent(user.UserId, models.SECURITY_PASSWORD_RESET,
+		"reset by email", lc.Dev.Request.RemoteAddr)
+
+	lc.Flash.AddFlash("Your password has been changed. You may now login.")
+	return &web.Result{Status: 302, Redirect: redirectPath}
+}
+
+// Mails a user a link to verify their email address.
+func (lc *LoginController) sendVerification(user *models.User) error {
+	token, err := user.IssueToken(models.TOKEN_VERIFY_EMAIL, models.VERIFY_EMAIL_LIFETIME)
+	if err != nil {
+		return err
+	}
+
+	return lc.mail.Send(&mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf(VERIFY_EMAIL_MAIL, user.Username, lc.linkTo("/verify/"+token)),
+	})
+}
+
+// Returns an absolute link to a path on this site.
+// Links are built from the configured base URL; a request's Host header
+// is chosen by the client and would let it redirect another user's token.
+func (lc *LoginController) linkTo(path string) string {
+	return lc.baseURL + path
+}
+
 // Returns a LoginController instance that is not safe across requests.
 // This is useful for routing as well as context-testing.
-func NewLoginController() *LoginController {
-	lc := &LoginController{}
+//
+// `registration` decides who may create an account and `mail` sends
+// verification and password reset links; which point at `baseURL`
+func NewLoginController(registration lib.RegistrationMode, mail mailer.Mailer, baseURL string) *LoginController {
+	lc := &LoginController{registration: registration, mail: mail, baseURL: baseURL}
 	lc.safeInstance = false
 
 	return lc
@@ -4,6 +4,7 @@ import (
 	filters "github.com/drbawb/babou/app/filters"
 	models "github.com/drbawb/babou/app/models"
 
+	"github.com/drbawb/babou/lib/search"
 	libTorrent "github.com/drbawb/babou/lib/torrent"
 	web "github.com/drbawb/babou/lib/web"
 
@@ -12,6 +13,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -39,15 +41,24 @@ func (tc *TorrentController) Dispatch(action, accept string) (web.Controller, we
 
 	//add your actions here.
 	newTc.actionMap["index"] = newTc.Index
+	newTc.actionMap["search"] = newTc.Search
 	newTc.actionMap["latestEpisodes"] = newTc.Episodes
 	newTc.actionMap["latestSeries"] = newTc.Series
 
 	newTc.actionMap["new"] = newTc.New
 	newTc.actionMap["create"] = newTc.Create
 
+	newTc.actionMap["show"] = newTc.Show
 	newTc.actionMap["download"] = newTc.Download
+	newTc.actionMap["magnet"] = newTc.Magnet
 
 	newTc.actionMap["delete"] = newTc.Delete
+	newTc.actionMap["disable"] = newTc.Disable
+
+	newTc.actionMap["tags"] = newTc.Tags
+	newTc.actionMap["addTag"] = newTc.AddTag
+	newTc.actionMap["voteTag"] = newTc.VoteTag
+	newTc.actionMap["tagIndex"] = newTc.TagIndex
 
 	return newTc, newTc.actionMap[action]
 }
@@ -59,21 +70,65 @@ func (tc *TorrentController) Index() *web.Result {
 		return redirect
 	}
 
+	if denied := tc.RedirectUnless(models.PERM_BROWSE, "homeIndex"); denied != nil {
+		return denied
+	}
+
+	filter, category, tag, result := tc.catalogFilter()
+	if result != nil {
+		return result
+	}
+
+	categories, err := models.AllCategories()
+	if err != nil {
+		fmt.Printf("Error listing categories: %s \n", err.Error())
+	}
+
 	output := &web.Result{Status: 200}
 	outData := &struct {
 		Username    string
 		TorrentList []*models.Torrent
+		Pager       *web.Pagination
+
+		Categories []*categoryLink
+		Category   *models.Category
+		Tag        *models.Tag
 	}{
 		Username: user.Username,
+		Pager:    tc.paginate(models.TorrentSorts...),
+
+		Categories: categoryLinks(categories, category, tag),
+		Category:   category,
+		Tag:        tag,
 	}
 
+	// filters in the path [e.g: /tags/drama] are kept by the pager's path.
+	query := tc.Dev.Request.URL.Query()
+	for _, key := range []string{"category", "tag"} {
+		if value := query.Get(key); value != "" {
+			outData.Pager.Keep(key, value)
+		}
+	}
+
+	total, err := models.CountTorrents(filter)
+	if err != nil {
+		output.Body = []byte(err.Error())
+		return output
+	}
+	outData.Pager.Total = total
+
 	allTorrents := &models.Torrent{}
-	torrentList, err := allTorrents.SelectSummaryPage()
+	torrentList, err := allTorrents.SelectSummaryPage(filter, pageOf(outData.Pager))
 	if err != nil {
 		output.Body = []byte(err.Error())
 		return output
 	}
 
+	if len(torrentList) > 0 {
+		outData.Pager.SetLastId(torrentList[len(torrentList)-1].ID)
+	}
+
+	tc.setMagnets(torrentList, user)
 	for _, t := range torrentList {
 		stats := tc.events.ReadStats(t.InfoHash)
 		if stats == nil {
@@ -86,19 +141,174 @@ func (tc *TorrentController) Index() *web.Result {
 
 	outData.TorrentList = torrentList
 
-	output.Body = []byte(web.RenderWith("bootstrap", "torrent", "index", outData, tc.Flash))
+	output.Body = []byte(web.RenderWith("bootstrap", "torrent", "index", outData, tc.Flash, tc.Csrf))
 
 	return output
 }
 
+// Sets the magnet link of each torrent in a listing; if the user may download them.
+// The links announce to the user's trackers. (See `models.Torrent.SetMagnet`)
+func (tc *TorrentController) setMagnets(torrents []*models.Torrent, user *models.User) {
+	if !tc.auth.Can(models.PERM_DOWNLOAD) {
+		return
+	}
+
+	for _, t := range torrents {
+		t.SetMagnet(user)
+	}
+}
+
+// A link which filters the catalog by a category.
+type categoryLink struct {
+	Name      string
+	URL       string
+	IsCurrent bool
+}
+
+// Links to each category; the first link is to every category.
+// The links keep the tag the catalog is filtered by.
+func categoryLinks(categories []*models.Category, current *models.Category, tag *models.Tag) []*categoryLink {
+	links := []*categoryLink{&categoryLink{Name: "All", URL: "/torrents", IsCurrent: current == nil}}
+	if tag != nil {
+		links[0].URL = "/tags/" + url.QueryEscape(tag.Name)
+	}
+
+	for _, category := range categories {
+		link := &categoryLink{
+			Name:      category.Name,
+			URL:       "/categories/" + category.Slug,
+			IsCurrent: current != nil && current.CategoryId == category.CategoryId,
+		}
+
+		if tag != nil {
+			link.URL = links[0].URL + "?category=" + category.Slug
+		}
+
+		links = append(links, link)
+	}
+
+	return links
+}
+
+// Reads the category and tag the catalog is filtered by from the
+// `category` and `tag` parameters. Either may be nil if it was not given.
+//
+// Returns a redirect to the unfiltered catalog if either does not exist.
+func (tc *TorrentController) catalogFilter() (*models.TorrentFilter, *models.Category, *models.Tag, *web.Result) {
+	filter := &models.TorrentFilter{}
+	var category *models.Category
+	var tag *models.Tag
+
+	notFound := func(err error) (*models.TorrentFilter, *models.Category, *models.Tag, *web.Result) {
+		tc.Flash.AddFlash(err.Error())
+		return nil, nil, nil, &web.Result{
+			Status:   302,
+			Redirect: &web.RedirectPath{NamedRoute: "torrentIndex"},
+		}
+	}
+
+	if slug := tc.Dev.Params.All["category"]; slug != "" {
+		category = &models.Category{}
+		if err := category.SelectSlug(slug); err != nil {
+			return notFound(err)
+		}
+
+		filter.CategoryId = category.CategoryId
+	}
+
+	if name := tc.Dev.Params.All["tag"]; name != "" {
+		tag = &models.Tag{}
+		if err := tag.SelectName(name); err != nil {
+			return notFound(err)
+		}
+
+		filter.TagId = tag.TagId
+	}
+
+	return filter, category, tag, nil
+}
+
+// Searches the catalog. See `lib/search` for the query syntax.
+//
+// The TV search form may restrict a query to series or episode names
+// with `search_by`. Responds with JSON if the client accepts it.
+func (tc *TorrentController) Search() *web.Result {
+	redirect, user := tc.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	if denied := tc.RedirectUnless(models.PERM_BROWSE, "homeIndex"); denied != nil {
+		return denied
+	}
+
+	query := search.Parse(tc.Dev.Params.All["q"], models.SearchFields...)
+	switch searchBy := tc.Dev.Params.All["search_by"]; searchBy {
+	case "series", "episode":
+		query = query.Within(searchBy)
+	}
+
+	pager := tc.paginate(models.SearchSorts...)
+	pager.Keep("q", query.String())
+
+	outData := &struct {
+		Username    string
+		Query       string
+		TorrentList []*models.Torrent
+		Pager       *web.Pagination
+	}{
+		Username:    user.Username,
+		Query:       query.String(),
+		TorrentList: make([]*models.Torrent, 0),
+		Pager:       pager,
+	}
+
+	result := &web.Result{Status: 200}
+	if !query.IsEmpty() {
+		results, total, err := models.SearchTorrents(query, pageOf(pager))
+		if err != nil {
+			result.Status = 500
+			result.Body = []byte("Error searching the catalog; please try again later.")
+			return result
+		}
+
+		outData.TorrentList, pager.Total = results, total
+		tc.setMagnets(outData.TorrentList, user)
+	}
+
+	if strings.Contains(tc.acceptHeader, "application/json") {
+		jsonResponse, err := json.Marshal(&struct {
+			Query   string            `json:"query"`
+			Total   int               `json:"total"`
+			Page    int               `json:"page"`
+			Results []*models.Torrent `json:"results"`
+		}{outData.Query, pager.Total, pager.Page, outData.TorrentList})
+		if err != nil {
+			result.Status = 500
+			result.Body = []byte("error formatting json for resp.")
+			return result
+		}
+
+		result.Body = jsonResponse
+	} else {
+		result.Body = []byte(web.RenderWith("bootstrap", "torrent", "search", outData, tc.Flash, tc.Csrf))
+	}
+
+	return result
+}
+
 func (tc *TorrentController) Episodes() *web.Result {
+	pager := tc.paginate(models.SORT_DATE)
+	pager.Total, _ = models.CountEpisodes()
 
 	outData := &struct {
 		EpisodeList  []*models.EpisodeBundle
 		ShowEpisodes bool
+		Pager        *web.Pagination
 	}{
-		EpisodeList:  models.LatestEpisodes(),
+		EpisodeList:  models.LatestEpisodes(pageOf(pager)),
 		ShowEpisodes: true,
+		Pager:        pager,
 	}
 
 	// Respond with?
@@ -120,19 +330,24 @@ func (tc *TorrentController) Episodes() *web.Result {
 			"torrent",
 			"tv",
 			outData,
-			tc.Flash))
+			tc.Flash, tc.Csrf))
 	}
 
 	return result
 }
 
 func (tc *TorrentController) Series() *web.Result {
+	pager := tc.paginate(models.SORT_DATE)
+	pager.Total, _ = models.CountSeries()
+
 	outData := &struct {
 		SeriesList []*models.SeriesBundle
 		ShowSeries bool
+		Pager      *web.Pagination
 	}{
-		SeriesList: models.LatestSeries(),
+		SeriesList: models.LatestSeries(pageOf(pager)),
 		ShowSeries: true,
+		Pager:      pager,
 	}
 
 	// Respond with?
@@ -154,47 +369,80 @@ func (tc *TorrentController) Series() *web.Result {
 			"torrent",
 			"tv",
 			outData,
-			tc.Flash))
+			tc.Flash, tc.Csrf))
 	}
 
 	return result
 }
 
+// Reads the page of a listing requested by the user.
+func (tc *TorrentController) paginate(sorts ...string) *web.Pagination {
+	return web.Paginate(tc.Dev.Request.URL.Path, tc.Dev.Params.All, sorts...)
+}
+
+// Selects the rows of a listing shown on the page requested by the user.
+func pageOf(pager *web.Pagination) *models.Page {
+	return &models.Page{
+		Sort:       pager.Sort,
+		Descending: pager.Descending,
+		Offset:     pager.Offset(),
+		Limit:      pager.PerPage,
+		After:      pager.After,
+	}
+}
+
 // Displays a form where a user can upload a new torrent.
 func (tc *TorrentController) New() *web.Result {
-	//TODO: permission check; for now any authenticated user can add torrents.
 	redirect, user := tc.RedirectOnAuthFail()
 	if user == nil {
 		return redirect
 	}
 
+	if denied := tc.RedirectUnless(models.PERM_UPLOAD, "torrentIndex"); denied != nil {
+		return denied
+	}
+
 	output := &web.Result{Status: 200}
+	categories, err := models.AllCategories()
+	if err != nil {
+		fmt.Printf("Error listing categories: %s \n", err.Error())
+	}
+
 	outData := &struct {
 		Username    string
 		AnnounceURL string
+		Categories  []*models.Category
+		CanTag      bool
 	}{
 		Username:    user.Username,
 		AnnounceURL: user.AnnounceURL(),
+		Categories:  categories,
+		CanTag:      tc.auth.Can(models.PERM_TAG_TORRENTS),
 	}
 
 	// Display new torrent form.
-	output.Body = []byte(web.RenderWith("bootstrap", "torrent", "new", outData, tc.Flash))
+	output.Body = []byte(web.RenderWith("bootstrap", "torrent", "new", outData, tc.Flash, tc.Csrf))
 
 	return output
 }
 
 func (tc *TorrentController) Create() *web.Result {
-	//TODO: permission check; for now any authenticated user can add torrents.
 	redirect, user := tc.RedirectOnAuthFail()
 	if user == nil {
 		return redirect
 	}
 
+	if denied := tc.RedirectUnless(models.PERM_UPLOAD, "torrentIndex"); denied != nil {
+		return denied
+	}
+
 	formFiles := tc.Dev.Params.Files
 	if formFiles["metainfo"] == nil {
 		tc.Flash.AddFlash("File upload appears to be missing.")
+		return tc.RedirectOnUploadFail()
 	} else if len(formFiles["metainfo"]) <= 0 || len(formFiles["metainfo"]) > 1 {
 		tc.Flash.AddFlash("You are only allowed to upload one torrent at a time.")
+		return tc.RedirectOnUploadFail()
 	} else {
 		file := formFiles["metainfo"][0]
 		if !strings.HasSuffix(file.Filename, ".torrent") {
@@ -208,9 +456,30 @@ func (tc *TorrentController) Create() *web.Result {
 			tc.Flash.AddFlash("Error reading your torrent; please try your upload again")
 			return tc.RedirectOnUploadFail()
 		}
+		defer torrentFile.Close()
+
+		torrent, err := libTorrent.ReadFile(torrentFile)
+		if errs, ok := err.(libTorrent.ValidationErrors); ok {
+			for _, reason := range errs {
+				tc.Flash.AddFlash(reason)
+			}
+
+			return tc.RedirectOnUploadFail()
+		} else if err != nil {
+			tc.Flash.AddFlash("Error reading your torrent; please try your upload again")
+			return tc.RedirectOnUploadFail()
+		}
 
-		torrent := libTorrent.ReadFile(torrentFile)
-		torrentRecord := &models.Torrent{}
+		if exists, err := models.TorrentExists(torrent.InfoHash, torrent.InfoHashV2); exists {
+			tc.Flash.AddFlash("This torrent has already been uploaded.")
+			return tc.RedirectOnUploadFail()
+		} else if err != nil {
+			fmt.Printf("Error looking up torrent [%s]: %s \n", torrent.InfoHash, err.Error())
+			tc.Flash.AddFlash("Error reading your torrent; please try your upload again")
+			return tc.RedirectOnUploadFail()
+		}
+
+		torrentRecord := &models.Torrent{UploadedBy: user.UserId}
 
 		if err := torrentRecord.Populate(torrent.Info); err != nil {
 			tc.Flash.AddFlash("Error reading your torrent file.")
@@ -231,6 +500,8 @@ func (tc *TorrentController) Create() *web.Result {
 
 			if err := sBundle.Persist(); err != nil {
 				fmt.Printf("Error saving bundle: %s", err.Error())
+			} else if err := torrentRecord.SetBundle(sBundle.ID); err != nil {
+				fmt.Printf("Error linking torrent to bundle: %s", err.Error())
 			}
 		case "episode":
 			fmt.Printf("Episode attributes bundle")
@@ -247,6 +518,8 @@ func (tc *TorrentController) Create() *web.Result {
 
 			if err := eBundle.PersistWithSeries(sBundle); err != nil {
 				fmt.Printf("Error saving episode bundle: %s", err.Error())
+			} else if err := torrentRecord.SetBundle(eBundle.ID); err != nil {
+				fmt.Printf("Error linking torrent to bundle: %s", err.Error())
 			}
 
 		default:
@@ -254,19 +527,134 @@ func (tc *TorrentController) Create() *web.Result {
 
 		}
 
-		tc.Flash.AddFlash(fmt.Sprintf(`Your torrents URL is: http://tracker.fatalsyntax.com/torrents/download/%d -- 
-			please save this because babou cannot find things right now.`, torrentRecord.ID))
+		if categoryId, err := strconv.Atoi(tc.Dev.Params.All["category_id"]); err == nil && categoryId > 0 {
+			if err := torrentRecord.SetCategory(categoryId); err != nil {
+				tc.Flash.AddFlash("Your torrent was uploaded but could not be placed in that category.")
+			}
+		}
+
+		tags := models.SplitTags(tc.Dev.Params.All["tags"])
+		if len(tags) > models.MAX_TAGS_PER_ADD {
+			tags = tags[:models.MAX_TAGS_PER_ADD]
+		}
+
+		if len(tags) > 0 && tc.auth.Can(models.PERM_TAG_TORRENTS) {
+			approve := tc.auth.Can(models.PERM_MODERATE_TAGS)
+			for _, name := range tags {
+				if err := torrentRecord.AddTag(name, user.UserId, approve); err != nil {
+					tc.Flash.AddFlash(fmt.Sprintf("Could not add the tag [%s]: %s", name, err.Error()))
+				}
+			}
+		}
+
+		// Issue redirect to the new torrent's page.
+		return &web.Result{
+			Status: 302,
+			Redirect: &web.RedirectPath{
+				NamedRoute: "torrentShow",
+				Params:     []string{"torrentId", strconv.Itoa(torrentRecord.ID)},
+			},
+		}
 	}
+}
 
-	// Issue redirect to index page.
-	output := &web.Result{
+// Shows a torrent: its metadata, series and episode, files, and live statistics.
+// Responds with JSON if the client accepts it.
+func (tc *TorrentController) Show() *web.Result {
+	redirect, user := tc.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	if denied := tc.RedirectUnless(models.PERM_BROWSE, "homeIndex"); denied != nil {
+		return denied
+	}
+
+	result := &web.Result{
 		Redirect: &web.RedirectPath{
 			NamedRoute: "torrentIndex",
 		},
 		Status: 302,
 	}
 
-	return output
+	torrentId, err := strconv.Atoi(tc.Dev.Params.All["torrentId"])
+	if err != nil {
+		tc.Flash.AddFlash("invalid torrent id.")
+		return result
+	}
+
+	record := &models.Torrent{}
+	if err := record.SelectDetail(torrentId); err != nil {
+		tc.Flash.AddFlash("Could not find the torrent with the specified ID")
+		return result
+	}
+
+	tc.setMagnets([]*models.Torrent{record}, user)
+
+	// the trackers' latest report is fresher than the catalog's.
+	if stats := tc.events.ReadStats(record.InfoHash); stats != nil {
+		record.Seeding = stats.Seeding
+		record.Leeching = stats.Leeching
+	}
+
+	files, err := record.Files()
+	if err != nil {
+		fmt.Printf("Error listing files of torrent [%d]: %s \n", record.ID, err.Error())
+		files = make([]libTorrent.File, 0)
+	}
+
+	series, episode, err := record.Bundles()
+	if err != nil {
+		fmt.Printf("Error reading bundles of torrent [%d]: %s \n", record.ID, err.Error())
+	}
+
+	result = &web.Result{Status: 200}
+	if strings.Contains(tc.acceptHeader, "application/json") {
+		jsonResponse, err := json.Marshal(&struct {
+			Torrent     *models.Torrent       `json:"torrent"`
+			Series      *models.SeriesBundle  `json:"series,omitempty"`
+			Episode     *models.EpisodeBundle `json:"episode,omitempty"`
+			Files       []libTorrent.File     `json:"files"`
+			DownloadURL string                `json:"downloadUrl"`
+		}{record, series, episode, files, fmt.Sprintf("/torrents/download/%d", record.ID)})
+		if err != nil {
+			result.Status = 500
+			result.Body = []byte("error formatting json for resp.")
+			return result
+		}
+
+		result.Body = jsonResponse
+		return result
+	}
+
+	fileTree, err := libTorrent.FileTree(files)
+	if err != nil {
+		fmt.Printf("Error arranging files of torrent [%d]: %s \n", record.ID, err.Error())
+		tc.Flash.AddFlash("This torrent's file list is invalid: " + err.Error())
+	}
+
+	outData := &struct {
+		Username  string
+		Torrent   *models.Torrent
+		Series    *models.SeriesBundle
+		Episode   *models.EpisodeBundle
+		FileTree  []*libTorrent.TreeEntry
+		FileCount int
+
+		CanDownload bool
+	}{
+		Username:  user.Username,
+		Torrent:   record,
+		Series:    series,
+		Episode:   episode,
+		FileTree:  fileTree,
+		FileCount: len(files),
+
+		CanDownload: tc.auth.Can(models.PERM_DOWNLOAD),
+	}
+
+	result.Body = []byte(web.RenderWith("bootstrap", "torrent", "show", outData, tc.Flash, tc.Csrf))
+	return result
 }
 
 func (tc *TorrentController) Download() *web.Result {
@@ -275,6 +663,10 @@ func (tc *TorrentController) Download() *web.Result {
 		return redirect
 	}
 
+	if denied := tc.RedirectUnless(models.PERM_DOWNLOAD, "torrentIndex"); denied != nil {
+		return denied
+	}
+
 	output := &web.Result{
 		Status: 200,
 	}
@@ -290,7 +682,7 @@ func (tc *TorrentController) Download() *web.Result {
 	}
 
 	record.SelectId(int(torrentId))
-	outFile, err := record.WriteFile(user.Secret, user.SecretHash)
+	outFile, err := record.WriteFile(user.Secret, user.SignedSecret())
 	if err != nil {
 		result := &web.Result{}
 		tc.Flash.AddFlash("Could not find the torrent with the specified ID")
@@ -315,25 +707,320 @@ func (tc *TorrentController) Download() *web.Result {
 	return output
 }
 
+// Redirects to a magnet link for the torrent which announces to the user's trackers.
+// Responds with the link as JSON if the client accepts it.
+func (tc *TorrentController) Magnet() *web.Result {
+	redirect, user := tc.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	if denied := tc.RedirectUnless(models.PERM_DOWNLOAD, "torrentIndex"); denied != nil {
+		return denied
+	}
+
+	record, result := tc.selectTorrent()
+	if record == nil {
+		return result
+	}
+
+	magnet := record.MagnetURI(user.AnnounceURLs())
+	if strings.Contains(tc.acceptHeader, "application/json") {
+		jsonResponse, err := json.Marshal(&struct {
+			Magnet string `json:"magnet"`
+		}{magnet})
+		if err != nil {
+			return &web.Result{Status: 500, Body: []byte("error formatting json for resp.")}
+		}
+
+		return &web.Result{Status: 200, Body: jsonResponse}
+	}
+
+	return &web.Result{
+		Status:   302,
+		Redirect: &web.RedirectPath{URL: magnet},
+	}
+}
+
+// Deletes a torrent and tells the tracker(s) to stop serving it.
 func (tc *TorrentController) Delete() *web.Result {
+	record, result := tc.selectForModeration(models.PERM_DELETE_ANY_TORRENT)
+	if record == nil {
+		return result
+	}
+
+	if err := record.Delete(); err != nil {
+		tc.Flash.AddFlash(fmt.Sprintf("Error deleting torrent: %s", err.Error()))
+		return result
+	}
+
+	tc.events.SendMessage(bridge.DeleteTorrent(record.InfoHash, tc.Dev.Params.All["reason"]))
+	tc.Flash.AddFlash(fmt.Sprintf("Torrent [%s] has been deleted.", record.Name))
+
+	return result
+}
+
+// Disables a torrent and tells the tracker(s) to stop serving it.
+func (tc *TorrentController) Disable() *web.Result {
+	record, result := tc.selectForModeration(models.PERM_MODERATE_TORRENTS)
+	if record == nil {
+		return result
+	}
+
+	if err := record.Disable(); err != nil {
+		tc.Flash.AddFlash(fmt.Sprintf("Error disabling torrent: %s", err.Error()))
+		return result
+	}
+
+	tc.events.SendMessage(bridge.DisableTorrent(record.InfoHash, tc.Dev.Params.All["reason"]))
+	tc.Flash.AddFlash(fmt.Sprintf("Torrent [%s] has been disabled.", record.Name))
+
+	return result
+}
+
+// Lists a torrent's tags along with their scores.
+// Responds with JSON if the client accepts it.
+func (tc *TorrentController) Tags() *web.Result {
 	redirect, user := tc.RedirectOnAuthFail()
 	if user == nil {
 		return redirect
 	}
 
-	output := &web.Result{
-		Status: 200,
+	if denied := tc.RedirectUnless(models.PERM_BROWSE, "homeIndex"); denied != nil {
+		return denied
 	}
 
-	fmt.Printf("sending pretend delete event to tracker(s) \n")
-	payload := &bridge.DeleteTorrentMessage{}
-	payload.InfoHash = "0xDEADBEEF"
-	payload.Reason = "No logs on FLAC torrent."
-	msg := &bridge.Message{Type: bridge.DELETE_TORRENT, Payload: payload}
+	record, result := tc.selectTorrent()
+	if record == nil {
+		return result
+	}
 
-	tc.events.SendMessage(msg)
+	tags, err := record.Tags(user.UserId)
+	if err != nil {
+		fmt.Printf("Error listing tags of torrent [%d]: %s \n", record.ID, err.Error())
+		return &web.Result{Status: 500, Body: []byte("Error listing tags; please try again later.")}
+	}
 
-	return output
+	result = &web.Result{Status: 200}
+	if strings.Contains(tc.acceptHeader, "application/json") {
+		jsonResponse, err := json.Marshal(tags)
+		if err != nil {
+			result.Status = 500
+			result.Body = []byte("error formatting json for resp.")
+			return result
+		}
+
+		result.Body = jsonResponse
+		return result
+	}
+
+	outData := &struct {
+		Username string
+		Torrent  *models.Torrent
+		Tags     []*models.TorrentTag
+		CanTag   bool
+	}{
+		Username: user.Username,
+		Torrent:  record,
+		Tags:     tags,
+		CanTag:   tc.auth.Can(models.PERM_TAG_TORRENTS),
+	}
+
+	result.Body = []byte(web.RenderWith("bootstrap", "torrent", "tags", outData, tc.Flash, tc.Csrf))
+	return result
+}
+
+// Adds the tags in the `tags` parameter to a torrent.
+// Tags added by moderators are approved immediately.
+func (tc *TorrentController) AddTag() *web.Result {
+	redirect, user := tc.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	record, result := tc.selectTorrent()
+	if record == nil {
+		return result
+	}
+
+	result = tc.redirectToTags(record)
+	if !tc.auth.Can(models.PERM_TAG_TORRENTS) {
+		tc.Flash.AddFlash("You are not allowed to tag torrents.")
+		return result
+	}
+
+	names := models.SplitTags(tc.Dev.Params.All["tags"])
+	if len(names) == 0 {
+		tc.Flash.AddFlash("Please enter a tag.")
+		return result
+	} else if len(names) > models.MAX_TAGS_PER_ADD {
+		tc.Flash.AddFlash(fmt.Sprintf("You may only add %d tags at once.", models.MAX_TAGS_PER_ADD))
+		return result
+	}
+
+	approve := tc.auth.Can(models.PERM_MODERATE_TAGS)
+	for _, name := range names {
+		if err := record.AddTag(name, user.UserId, approve); err == models.ErrTagInvalid {
+			tc.Flash.AddFlash(fmt.Sprintf("[%s] is not a valid tag. %s", name, err.Error()))
+		} else if err != nil {
+			fmt.Printf("Error tagging torrent [%d]: %s \n", record.ID, err.Error())
+			tc.Flash.AddFlash(fmt.Sprintf("Error adding tag [%s]; please try again later.", name))
+		}
+	}
+
+	return result
+}
+
+// Records the current user's vote [`up` or `down`] on one of a torrent's tags.
+func (tc *TorrentController) VoteTag() *web.Result {
+	redirect, user := tc.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	record, result := tc.selectTorrent()
+	if record == nil {
+		return result
+	}
+
+	result = tc.redirectToTags(record)
+	if !tc.auth.Can(models.PERM_TAG_TORRENTS) {
+		tc.Flash.AddFlash("You are not allowed to vote on tags.")
+		return result
+	}
+
+	tagId, err := strconv.Atoi(tc.Dev.Params.All["tagId"])
+	if err != nil {
+		tc.Flash.AddFlash("invalid tag id.")
+		return result
+	}
+
+	var vote int
+	switch tc.Dev.Params.All["vote"] {
+	case "up":
+		vote = models.TAG_VOTE_UP
+	case "down":
+		vote = models.TAG_VOTE_DOWN
+	default:
+		tc.Flash.AddFlash("A vote must be up or down.")
+		return result
+	}
+
+	removed, err := record.VoteTag(tagId, user.UserId, vote)
+	if err == models.ErrTagNotFound {
+		tc.Flash.AddFlash(err.Error())
+	} else if err != nil {
+		fmt.Printf("Error voting on tag [%d] of torrent [%d]: %s \n", tagId, record.ID, err.Error())
+		tc.Flash.AddFlash("Error recording your vote; please try again later.")
+	} else if removed {
+		tc.Flash.AddFlash("The tag has been voted off of this torrent.")
+	}
+
+	return result
+}
+
+// Lists the tags which can be browsed. Responds with JSON if the client accepts it.
+func (tc *TorrentController) TagIndex() *web.Result {
+	redirect, user := tc.RedirectOnAuthFail()
+	if user == nil {
+		return redirect
+	}
+
+	if denied := tc.RedirectUnless(models.PERM_BROWSE, "homeIndex"); denied != nil {
+		return denied
+	}
+
+	tags, err := models.BrowsableTags()
+	if err != nil {
+		fmt.Printf("Error listing tags: %s \n", err.Error())
+		return &web.Result{Status: 500, Body: []byte("Error listing tags; please try again later.")}
+	}
+
+	result := &web.Result{Status: 200}
+	if strings.Contains(tc.acceptHeader, "application/json") {
+		jsonResponse, err := json.Marshal(tags)
+		if err != nil {
+			result.Status = 500
+			result.Body = []byte("error formatting json for resp.")
+			return result
+		}
+
+		result.Body = jsonResponse
+		return result
+	}
+
+	outData := &struct {
+		Username string
+		Tags     []*models.Tag
+	}{
+		Username: user.Username,
+		Tags:     tags,
+	}
+
+	result.Body = []byte(web.RenderWith("bootstrap", "torrent", "tag_index", outData, tc.Flash, tc.Csrf))
+	return result
+}
+
+// Loads the torrent identified by the `torrentId` route parameter.
+// Returns a redirect to the torrent index if there is no such torrent.
+func (tc *TorrentController) selectTorrent() (*models.Torrent, *web.Result) {
+	result := &web.Result{
+		Redirect: &web.RedirectPath{
+			NamedRoute: "torrentIndex",
+		},
+		Status: 302,
+	}
+
+	torrentId, err := strconv.Atoi(tc.Dev.Params.All["torrentId"])
+	if err != nil {
+		tc.Flash.AddFlash("invalid torrent id.")
+		return nil, result
+	}
+
+	record := &models.Torrent{}
+	if err := record.SelectId(torrentId); err != nil {
+		tc.Flash.AddFlash("Could not find the torrent with the specified ID")
+		return nil, result
+	}
+
+	return record, result
+}
+
+// Redirects to the page listing a torrent's tags.
+func (tc *TorrentController) redirectToTags(record *models.Torrent) *web.Result {
+	return &web.Result{
+		Status: 302,
+		Redirect: &web.RedirectPath{
+			NamedRoute: "torrentTags",
+			Params:     []string{"torrentId", strconv.Itoa(record.ID)},
+		},
+	}
+}
+
+// Loads the torrent identified by the `torrentId` route parameter
+// if the current user has been granted `permission`.
+//
+// Always returns a redirect to the torrent index; the torrent will be
+// nil if the caller should return that redirect immediately.
+func (tc *TorrentController) selectForModeration(permission string) (*models.Torrent, *web.Result) {
+	redirect, user := tc.RedirectOnAuthFail()
+	if user == nil {
+		return nil, redirect
+	}
+
+	result := &web.Result{
+		Redirect: &web.RedirectPath{
+			NamedRoute: "torrentIndex",
+		},
+		Status: 302,
+	}
+
+	if !tc.auth.Can(permission) {
+		tc.Flash.AddFlash("You are not allowed to moderate torrents.")
+		return nil, result
+	}
+
+	return tc.selectTorrent()
 }
 
 // Tests if the user is logged in.
@@ -352,6 +1039,21 @@ func (tc *TorrentController) RedirectOnAuthFail() (*web.Result, *models.User) {
 	}
 }
 
+// Tests if the current user has been granted a permission.
+// If not: returns a web.Result that would redirect them to the named route.
+func (tc *TorrentController) RedirectUnless(permission, namedRoute string) *web.Result {
+	if tc.auth.Can(permission) {
+		return nil
+	}
+
+	tc.Flash.AddFlash("You are not allowed to do that.")
+
+	return &web.Result{
+		Status:   302,
+		Redirect: &web.RedirectPath{NamedRoute: namedRoute},
+	}
+}
+
 func (tc *TorrentController) RedirectOnUploadFail() *web.Result {
 	result := &web.Result{}
 
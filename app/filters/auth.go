@@ -32,6 +32,9 @@ type AuthContext struct {
 	response http.ResponseWriter
 
 	session SessionChainLink
+
+	user        *models.User         // loaded by the first call to `CurrentUser()`
+	permissions models.PermissionSet // loaded by the first call to `Can()`
 }
 
 // Returns an uninitialized AuthContext suitable for use in a context chain
@@ -45,47 +48,31 @@ func AuthChain(required bool) *AuthContext {
 	return context
 }
 
+// Logs the current user out of this browser; their other sessions are untouched.
 func (ac *AuthContext) DeleteCurrentSession() error {
 	session, _ := ac.session.GetSession()
 
-	var userId int
-	if session.Values["user_id"] == nil {
+	userId, ok := session.Values["user_id"].(int)
+	if !ok {
 		return errors.New("You are not currently logged in.")
-	} else {
-		userId = session.Values["user_id"].(int)
 	}
 
-	user := &models.User{}
-	if err := user.SelectId(userId); err != nil {
+	sessionId, _ := session.Values["session_id"].(int)
+	if _, err := (&models.Session{}).Delete(userId, sessionId); err != nil {
 		return err
 	}
 
-	if err := ac.deleteSessionFor(user); err != nil {
-		return err
-	}
-
-	session.Values["user_id"] = nil
-	return nil
-}
-
-// Delete a session when the user logs out.
-// This will fail all future permission checks for that user.
-func (ac *AuthContext) deleteSessionFor(user *models.User) error {
-	if user == nil || ac.isInit == false {
-		return errors.New("This auth-context is not ready to delete a user's session.")
-	}
-
-	userSession := &models.Session{}
-	err := userSession.DeleteFor(user)
-	if err != nil {
-		return err
-	}
+	delete(session.Values, "user_id")
+	delete(session.Values, "session_id")
+	ac.user = nil
 
 	return nil
 }
 
 // Only doing this b/c AC has access to request/response
 // Some way I can make this private to `login` controller?
+//
+// Starts a new session for the user and logs them in to this browser.
 func (ac *AuthContext) WriteSessionFor(user *models.User) error {
 	if user == nil || ac.isInit == false {
 		return errors.New("This auth-context is not ready to write a user session.")
@@ -93,48 +80,90 @@ func (ac *AuthContext) WriteSessionFor(user *models.User) error {
 
 	fmt.Printf("writing a session for user: %s w/ IP: %s \n", user.Username, ac.request.RemoteAddr)
 	userSession := &models.Session{}
-	err := userSession.WriteFor(user, ac.request.RemoteAddr)
+	err := userSession.WriteFor(user, ac.request.RemoteAddr, ac.request.UserAgent())
 	if err != nil {
 		fmt.Printf("[auth-context] error saving user session: %s \n", err.Error())
 		return err
 	}
 
+	session, _ := ac.session.GetSession()
+	session.ID = "" // a new session key after logging in; so a key set before login is useless.
+	session.Values["user_id"] = user.UserId
+	session.Values["session_id"] = userSession.SessionId
+	ac.user = nil
+
 	return nil
-	//fmt.Printf("Writing a sessino for user: %s w/ remote IP: %s", user.Username, ac.request.RemoteAddr
+}
+
+// Returns the ID of the current user's session; or zero if nobody is logged in.
+func (ac *AuthContext) CurrentSessionId() int {
+	if _, err := ac.CurrentUser(); err != nil {
+		return 0
+	}
+
+	session, _ := ac.session.GetSession()
+	sessionId, _ := session.Values["session_id"].(int)
+
+	return sessionId
 }
 
 // Returns the currently authenticated user
+//
+// The user's session is checked [and its last use recorded] once per request;
+// a session which has expired or been revoked logs the user out.
 func (ac *AuthContext) CurrentUser() (*models.User, error) {
-	session, _ := ac.session.GetSession()
-	userId := session.Values["user_id"]
+	if ac.user != nil {
+		return ac.user, nil
+	}
 
-	if userId == nil {
+	session, _ := ac.session.GetSession()
+	userId, ok := session.Values["user_id"].(int)
+	if !ok {
 		return nil, errors.New("No current user.")
 	}
 
+	sessionId, _ := session.Values["session_id"].(int)
+	if err := (&models.Session{}).Touch(userId, sessionId, ac.request.RemoteAddr); err != nil {
+		delete(session.Values, "user_id")
+		delete(session.Values, "session_id")
+		return nil, err
+	}
+
 	user := &models.User{}
-	if err := user.SelectId(userId.(int)); err != nil {
+	if err := user.SelectId(userId); err != nil {
 		return nil, err
 	}
 
+	// banned users are logged out of every session they still have.
+	if user.IsBanned {
+		delete(session.Values, "user_id")
+		delete(session.Values, "session_id")
+		return nil, models.ErrUserBanned
+	}
+
+	ac.user = user
 	return user, nil
 }
 
-// Checks if a user can perform a specified action:
+// Checks if the current user has been granted a permission through one of their roles.
+// Permissions are listed in `app/models/role.go`
+//
+// Returns false if nobody is logged in. The user's permissions are loaded once per request.
 func (ac *AuthContext) Can(permission string) bool {
-	// if the user has a session: it will return true for every check.
-	// otherwise it will return false.
-	session, err := ac.session.GetSession()
-	if err != nil {
-		fmt.Printf("Error authorizing: %s", err.Error())
-		return false
-	}
+	if ac.permissions == nil {
+		user, err := ac.CurrentUser()
+		if err != nil {
+			return false
+		}
 
-	if session.Values["user_id"] != nil {
-		return true
-	} else {
-		return false
+		ac.permissions, err = user.Permissions()
+		if err != nil {
+			fmt.Printf("Error authorizing: %s \n", err.Error())
+			return false
+		}
 	}
+
+	return ac.permissions.Has(permission)
 }
 
 // Requires authentication based on request/response
@@ -152,7 +181,7 @@ func (ac *AuthContext) AfterAttach(w http.ResponseWriter, r *http.Request) error
 	user, err := ac.CurrentUser()
 	if err != nil || user == nil {
 		return errors.New("YOU MUST BE LOGGED IN TO VIEW THIS PAGE.")
-	} else if !user.IsAdmin {
+	} else if !ac.Can(models.PERM_ADMIN_PANEL) {
 		return errors.New("YOU ARE NOT AUTHORIZED TO VIEW THIS PAGE.")
 	} else {
 		return nil
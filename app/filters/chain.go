@@ -29,9 +29,11 @@ type contextChain struct {
 // this includes a ParamterChainLink, FlashChainLink, and SessionChainLink.
 // The latter are lazily loaded when requested by a controller.
 // (This implements the chain tested by the default application controller's `testContext` method.)
+//
+// Every default route is also protected by a CsrfContext.
 func BuildDefaultChain() *contextChain {
-	chain := &contextChain{list: make([]web.ChainableContext, 0, 3)}
-	chain.Chain(&DevContext{}, &SessionContext{}, &FlashContext{})
+	chain := &contextChain{list: make([]web.ChainableContext, 0, 4)}
+	chain.Chain(&DevContext{}, &SessionContext{}, &FlashContext{}, &CsrfContext{})
 
 	return chain
 }
@@ -143,12 +145,15 @@ func handleResult(result *web.Result, response http.ResponseWriter, request *htt
 //TODO: still needs to be in a library >_>
 func handleRedirect(redirect *web.RedirectPath, response http.ResponseWriter, request *http.Request) {
 	if redirect.NamedRoute != "" {
-		url, err := web.Router.Get(redirect.NamedRoute).URL()
+		url, err := web.Router.Get(redirect.NamedRoute).URL(redirect.Params...)
 		if err != nil {
 			http.Error(response, string("While trying to redirect you to another page the server encountered an error. Please reload the homepage"),
 				500)
+			return
 		}
 
 		http.Redirect(response, request, url.Path, 302)
+	} else if redirect.URL != "" {
+		http.Redirect(response, request, redirect.URL, 302)
 	}
 }
@@ -0,0 +1,171 @@
+package filters
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	web "github.com/drbawb/babou/lib/web"
+)
+
+const (
+	CSRF_FIELD       string = "csrf_token"   // the form field holding the token.
+	CSRF_HEADER      string = "X-CSRF-Token" // or the header; for scripts.
+	CSRF_SESSION_KEY string = "csrf_token"
+	CSRF_TOKEN_SIZE  int    = 32 // bytes
+)
+
+type CsrfChainLink interface {
+	web.FormTokenContext
+	Token() string
+}
+
+// A controller which renders its own forms can accept a CsrfContext to
+// include the token. (Forms built with {{#FormFor}} include it automatically
+// when the CsrfContext is passed to `RenderWith`)
+type CsrfAware interface {
+	SetCsrfContext(*CsrfContext) error
+}
+
+// Protects a route from cross-site request forgery.
+//
+// Every session is issued a random token. Requests which change state
+// [POST, PUT, PATCH, DELETE] must send the token back as the `csrf_token`
+// form field or the `X-CSRF-Token` header; otherwise they are refused during
+// the AFTER-ATTACH resolution phase and never reach the controller.
+type CsrfContext struct {
+	isInit bool
+
+	request *http.Request
+	session SessionChainLink
+}
+
+// Returns an uninitialized CsrfContext suitable for use in a context chain.
+func CsrfChain() *CsrfContext {
+	return &CsrfContext{isInit: false}
+}
+
+// Returns this session's token; issuing one if the session does not have one yet.
+func (cc *CsrfContext) Token() string {
+	if cc == nil || !cc.isInit {
+		return ""
+	}
+
+	session, err := cc.session.GetSession()
+	if err != nil {
+		return ""
+	}
+
+	if token, ok := session.Values[CSRF_SESSION_KEY].(string); ok && token != "" {
+		return token
+	}
+
+	raw := make([]byte, CSRF_TOKEN_SIZE)
+	if n, err := rand.Read(raw); n != len(raw) || err != nil {
+		fmt.Printf("Error generating CSRF token: %v \n", err)
+		return ""
+	}
+
+	token := hex.EncodeToString(raw)
+	session.Values[CSRF_SESSION_KEY] = token
+
+	return token
+}
+
+// Returns the name and value of the hidden field which carries the token.
+func (cc *CsrfContext) FormToken() (string, string) {
+	token := cc.Token()
+	if token == "" {
+		return "", ""
+	}
+
+	return CSRF_FIELD, token
+}
+
+// Adds the token to a view:
+//
+//	{{CsrfToken}} is the token itself.
+//	{{#CsrfField}}{{/CsrfField}} is a hidden input for forms which are not built with {{#FormFor}}
+func (cc *CsrfContext) GetViewHelpers() []interface{} {
+	name, token := cc.FormToken()
+
+	return []interface{}{&struct {
+		CsrfToken string
+		CsrfField func(params []string, data string) string
+	}{
+		CsrfToken: token,
+		CsrfField: func(params []string, data string) string {
+			if name == "" {
+				return ""
+			}
+
+			return web.HiddenField(name, token)
+		},
+	}}
+}
+
+// Refuses requests which change state unless they carry this session's token.
+func (cc *CsrfContext) AfterAttach(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return nil
+	}
+
+	sent := r.Header.Get(CSRF_HEADER)
+	if sent == "" {
+		sent = r.FormValue(CSRF_FIELD)
+	}
+
+	session, err := cc.session.GetSession()
+	if err == nil && sent != "" {
+		expected, _ := session.Values[CSRF_SESSION_KEY].(string)
+		if expected != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) == 1 {
+			return nil
+		}
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+	return errors.New("This form has expired; please go back, reload the page, and try again.")
+}
+
+// This context requires a chain with a SessionChainLink.
+func (cc *CsrfContext) TestContext(route web.Controller, chain []web.ChainableContext) error {
+	for i := 0; i < len(chain); i++ {
+		if _, ok := chain[i].(SessionChainLink); ok {
+			return nil
+		}
+	}
+
+	return errors.New(fmt.Sprintf("The route :: %T :: does not have a SessionAware context in it's context chain.", route))
+}
+
+// Returns a clean instance of CsrfContext that can be used safely for a single request.
+func (cc *CsrfContext) NewInstance() web.ChainableContext {
+	return &CsrfContext{isInit: false}
+}
+
+// Finds the session in the chain and hands this context to a CsrfAware controller.
+func (cc *CsrfContext) ApplyContext(controller web.Controller, response http.ResponseWriter, request *http.Request, chain []web.ChainableContext) {
+	cc.request = request
+
+	for i := 0; i < len(chain); i++ {
+		if v, ok := chain[i].(SessionChainLink); ok {
+			cc.session = v
+			break
+		}
+	}
+
+	cc.isInit = cc.session != nil
+
+	if v, ok := controller.(CsrfAware); ok {
+		if err := v.SetCsrfContext(cc); err != nil {
+			fmt.Printf("Error setting CSRF context: %s \n", err.Error())
+		}
+	}
+}
+
+// No-op
+func (cc *CsrfContext) CloseContext() {}
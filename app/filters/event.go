@@ -5,13 +5,15 @@ import (
 	"fmt"
 	"net/http"
 
+	models "github.com/drbawb/babou/app/models"
 	bridge "github.com/drbawb/babou/bridge"
 	web "github.com/drbawb/babou/lib/web"
 )
 
 const (
-	EVENT_TIMEOUT  int    = 5
-	EVENT_CTX_NAME string = "web-event-ctx"
+	EVENT_TIMEOUT     int    = 5
+	EVENT_CTX_NAME    string = "web-event-ctx"
+	EVENT_RECORD_SIZE int    = 50 // messages kept for the bridge's debug page
 )
 
 type EventChainLink interface {
@@ -32,6 +34,7 @@ type EventContext struct {
 
 	bridge   *bridge.Bridge
 	memStats map[string]*bridge.TorrentStatMessage
+	recorder *bridge.Recorder
 }
 
 // Sends a properly typed message over the bridge.
@@ -48,6 +51,42 @@ func (ec *EventContext) ReadStats(infoHash string) *bridge.TorrentStatMessage {
 	return ec.memStats[infoHash]
 }
 
+// Returns the counters and queue depths of the web server's event bridge.
+func (ec *EventContext) BridgeStats() *bridge.Stats {
+	return ec.bridge.Stats()
+}
+
+// Returns the most recent messages through the event bridge; newest first.
+func (ec *EventContext) RecentTraffic() []bridge.TapEvent {
+	return ec.recorder.Recent()
+}
+
+// Returns this node's view of the pack; or nil if it has not joined the pack.
+func (ec *EventContext) Membership() *bridge.Membership {
+	return ec.bridge.Membership()
+}
+
+// Returns the trackers in the pack which are currently sending heartbeats.
+// Empty if this node has not joined the pack.
+func (ec *EventContext) LiveTrackers() []bridge.Member {
+	return ec.Members(bridge.ROLE_TRACKER)
+}
+
+// Returns the live members of the pack with the given role; or every member
+// [alive or dead] this node has heard from if the role is empty.
+func (ec *EventContext) Members(role string) []bridge.Member {
+	membership := ec.Membership()
+	if membership == nil {
+		return make([]bridge.Member, 0)
+	}
+
+	if role == "" {
+		return membership.Members()
+	}
+
+	return membership.Live(role)
+}
+
 // Returns an uninitialized AuthContext suitable for use in a context chain
 // TODO: Synchronized so long as this is the only subscriber writing
 // to the event context's internal structures.
@@ -56,6 +95,7 @@ func EventChain(serverBridge *bridge.Bridge) *EventContext {
 		isInit:   false,
 		bridge:   serverBridge,
 		memStats: make(map[string]*bridge.TorrentStatMessage),
+		recorder: serverBridge.Record(EVENT_RECORD_SIZE),
 	}
 
 	//TODO: factor out
@@ -70,9 +110,16 @@ func EventChain(serverBridge *bridge.Bridge) *EventContext {
 			case msg := <-messages:
 				switch msg.Type {
 				case bridge.TORRENT_STAT_TUPLE:
-					stats := msg.Payload.(bridge.TorrentStatMessage)
+					stats, ok := msg.Payload.(bridge.TorrentStatMessage)
+					if !ok {
+						fmt.Printf("[ec] Dropping malformed stats: %v \n", msg.Payload)
+						continue
+					}
+
 					fmt.Printf("[ec] Writing stats for %v \n", stats)
-					context.memStats[stats.InfoHash] = &stats
+					context.writeStats(&stats)
+				case bridge.NODE_HEARTBEAT, bridge.NODE_LEAVE:
+					// membership is tracked by the bridge itself.
 				default:
 					fmt.Printf(
 						"Event bridge has no handler for messages of type: %v \n",
@@ -87,6 +134,22 @@ func EventChain(serverBridge *bridge.Bridge) *EventContext {
 	return context
 }
 
+// Caches a torrent's stats and persists them so the catalog can be sorted by them.
+// The database is only written when the size of the swarm changes.
+func (ec *EventContext) writeStats(stats *bridge.TorrentStatMessage) {
+	last := ec.memStats[stats.InfoHash]
+	ec.memStats[stats.InfoHash] = stats
+
+	if last != nil && last.Seeding == stats.Seeding && last.Leeching == stats.Leeching {
+		return
+	}
+
+	err := models.WriteTorrentStats(stats.InfoHash, stats.Seeding, stats.Leeching)
+	if err != nil {
+		fmt.Printf("[ec] Error persisting stats for %s: %s \n", stats.InfoHash, err.Error())
+	}
+}
+
 // Just need a supported controller and a link to the event bridge
 func (ec *EventContext) TestContext(route web.Controller, chain []web.ChainableContext) error {
 	_, ok := route.(EventController)
@@ -0,0 +1,62 @@
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	ratelimit "github.com/drbawb/babou/lib/ratelimit"
+	web "github.com/drbawb/babou/lib/web"
+)
+
+// Limits how often a single address may request the routes it is chained to.
+//
+// Any route can be rate limited; the controller does not need to know about it.
+// Requests over the limit are answered with `429 Too Many Requests` during the
+// AFTER-ATTACH resolution phase and never reach the controller.
+type RateLimitContext struct {
+	limiter *ratelimit.Limiter
+}
+
+// Returns a context which allows `limit` requests per address within `window`
+//
+// Each call returns a context with its own counters; so routes which should
+// share a limit must share the same context.
+func RateLimitChain(limit int, window time.Duration) *RateLimitContext {
+	return &RateLimitContext{limiter: ratelimit.NewLimiter(limit, window)}
+}
+
+// Counts this request against the remote address; stops the request if
+// the address is over its limit.
+func (rc *RateLimitContext) AfterAttach(w http.ResponseWriter, r *http.Request) error {
+	ok, wait := rc.limiter.Allow(ratelimit.Host(r.RemoteAddr))
+	if ok {
+		return nil
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	return errors.New(fmt.Sprintf("Too many requests; please try again in %d seconds.", seconds))
+}
+
+// Any route can be rate limited.
+func (rc *RateLimitContext) TestContext(route web.Controller, chain []web.ChainableContext) error {
+	return nil
+}
+
+// Returns the routable instance; the limiter is shared by every request
+// to the routes this context is chained to.
+func (rc *RateLimitContext) NewInstance() web.ChainableContext {
+	return rc
+}
+
+// No-op
+func (rc *RateLimitContext) ApplyContext(controller web.Controller, response http.ResponseWriter, request *http.Request, chain []web.ChainableContext) {
+}
+
+// No-op
+func (rc *RateLimitContext) CloseContext() {}
@@ -91,15 +91,27 @@ func (sc *SessionContext) SetRequestPair(w http.ResponseWriter, r *http.Request)
 	sc.response = w
 }
 
-// Sets the session store to the specified store; or fetches one from the
-// default database-backed session store.
-//
-// TODO: Should be configurable; must be shared among cooperative frontends.
+// The key babou shipped with before session keys were configurable.
+// It is public knowledge; it only signs the random session IDs of server-side stores.
+const INSECURE_SESSION_KEY string = "3d1fd34f389d799a2539ff554d922683"
+
+var defaultStore sessions.Store
+
+// Sets the store used by every SessionContext which is not given one.
+// This is chosen by the server's configuration when it starts. [see: lib/session]
+func SetDefaultStore(store sessions.Store) {
+	defaultStore = store
+}
+
+// Sets the session store to the specified store; or the default store if it is nil.
+// Without a default store sessions are kept in the database.
 func (sc *SessionContext) SetStore(store sessions.Store) {
-	if store == nil {
-		sc.store = dbStore.NewDatabaseStore([]byte("3d1fd34f389d799a2539ff554d922683"))
-	} else {
+	if store != nil {
 		sc.store = store
+	} else if defaultStore != nil {
+		sc.store = defaultStore
+	} else {
+		sc.store = dbStore.NewDatabaseStore([]byte(INSECURE_SESSION_KEY))
 	}
 }
 
@@ -93,6 +93,25 @@ func (elem *Attribute) SelectTorrent(torrentId int) error {
 }
 
 func (attributes *Attribute) WriteFor(torrentId int) error {
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		if err := attributes.writeFor(txn, torrentId); err != nil {
+			return err
+		}
+
+		return txn.Commit()
+	}
+
+	return db.ExecuteFn(dba)
+}
+
+// Writes the attributes for a torrent within `txn`.
+func (attributes *Attribute) writeFor(txn *sql.Tx, torrentId int) error {
 	insert := `INSERT INTO attributes (
 		torrent_id, 
 		name, artist_name, album_name, release_year,
@@ -105,30 +124,16 @@ func (attributes *Attribute) WriteFor(torrentId int) error {
 		$9, $10
 	)`
 
-	dba := func(dbConn *sql.DB) error {
-		insertStmt, err := dbConn.Prepare(insert)
-		if err != nil {
-			return err
-		}
-
-		encodeBuf := bytes.NewBuffer(make([]byte, 0))
-		encoder := gob.NewEncoder(encodeBuf)
-
-		encoder.Encode(attributes.ArtistName)
-
-		_, err = insertStmt.Exec(torrentId,
-			attributes.Name, encodeBuf.Bytes(), attributes.AlbumName, attributes.ReleaseYear,
-			attributes.MusicFormat, attributes.DiscNumber, attributes.Discs,
-			attributes.AlbumDescription, attributes.ReleaseDescription,
-		)
-
-		if err != nil {
-			return err
-		}
+	encodeBuf := bytes.NewBuffer(make([]byte, 0))
+	encoder := gob.NewEncoder(encodeBuf)
 
-		return nil
+	encoder.Encode(attributes.ArtistName)
 
-	}
+	_, err := txn.Exec(insert, torrentId,
+		attributes.Name, encodeBuf.Bytes(), attributes.AlbumName, attributes.ReleaseYear,
+		attributes.MusicFormat, attributes.DiscNumber, attributes.Discs,
+		attributes.AlbumDescription, attributes.ReleaseDescription,
+	)
 
-	return db.ExecuteFn(dba)
+	return err
 }
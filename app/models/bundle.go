@@ -130,12 +130,11 @@ func (sb *SeriesBundle) PersistWith(tx *sql.Tx) error {
 	return nil
 }
 
-// Selects the latest series' of television.
+// Selects a page of the latest series' of television.
 //
-// This will select 100 series at a time which have a torrent or episode(s)
-// associated with them.
-//
-func LatestSeries() []*SeriesBundle {
+// Only series which have a torrent or episode(s) associated with them
+// are listed. Pages are always sorted by date.
+func LatestSeries(page *Page) []*SeriesBundle {
 	seriesByID := make(map[int]*SeriesBundle)
 	seriesList := make([]*SeriesBundle, 0)
 
@@ -143,21 +142,28 @@ func LatestSeries() []*SeriesBundle {
 	// If no episodes are avail., the series itself is selected.
 	// (This would happen if, for e.g, the series is related to a multi-file torrent.)
 	loadSeriesBundles := `
+	WITH page AS (
+		SELECT series.attributes_bundle_id, series.modified
+		FROM attributes_bundle AS series
+		WHERE ` + listedSeries + `
+		ORDER BY series.modified ` + page.direction() + `, series.attributes_bundle_id
+		LIMIT $1 OFFSET $2
+	)
 	SELECT
 		episode.parent_id, series.attributes_bundle_id, tor.torrent_id, series.bundle, episode.bundle
-	FROM attributes_bundle AS series
+	FROM page
+	INNER JOIN attributes_bundle AS series
+		ON series.attributes_bundle_id = page.attributes_bundle_id
 	LEFT JOIN attributes_bundle AS episode
 		ON series.attributes_bundle_id = episode.parent_id
 	INNER JOIN torrents AS tor
 		ON tor.attributes_bundle_id = episode.attributes_bundle_id
 		OR tor.attributes_bundle_id = series.attributes_bundle_id
-	WHERE series.category = 'series'
-	ORDER BY series.modified DESC
-	LIMIT 100
+	ORDER BY page.modified ` + page.direction() + `, page.attributes_bundle_id
 	`
 
 	dba := func(dbConn *sql.DB) error {
-		rows, err := dbConn.Query(loadSeriesBundles)
+		rows, err := dbConn.Query(loadSeriesBundles, page.Limit, page.Offset)
 		if err != nil {
 			return err
 		}
@@ -235,6 +241,41 @@ func LatestSeries() []*SeriesBundle {
 	return seriesList
 }
 
+// Series which are listed by `LatestSeries`; those with a torrent of their own
+// or at least one episode with a torrent.
+const listedSeries string = `series.category = 'series'
+		AND EXISTS (
+			SELECT 1 FROM torrents AS tor
+			LEFT JOIN attributes_bundle AS episode
+				ON tor.attributes_bundle_id = episode.attributes_bundle_id
+			WHERE tor.attributes_bundle_id = series.attributes_bundle_id
+			OR episode.parent_id = series.attributes_bundle_id
+		)`
+
+// Returns the number of series listed by `LatestSeries`
+func CountSeries() (int, error) {
+	return countBundles(`SELECT count(*) FROM attributes_bundle AS series WHERE ` + listedSeries)
+}
+
+// Returns the number of episodes listed by `LatestEpisodes`
+func CountEpisodes() (int, error) {
+	return countBundles(`SELECT count(*) FROM attributes_bundle WHERE category = 'episode'`)
+}
+
+func countBundles(query string) (int, error) {
+	var count int
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(query).Scan(&count)
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		log.Printf("Error counting bundles: %s \n", err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
+
 func (eb *EpisodeBundle) PersistWithSeries(series *SeriesBundle) error {
 
 	insertEb := `
@@ -280,9 +321,9 @@ func (eb *EpisodeBundle) PersistWithSeries(series *SeriesBundle) error {
 
 }
 
-// TODO: Pagination
-// Select the latest episodes, regardless of series.
-func LatestEpisodes() []*EpisodeBundle {
+// Select a page of the latest episodes, regardless of series.
+// Pages are always sorted by date.
+func LatestEpisodes(page *Page) []*EpisodeBundle {
 	episodes := make([]*EpisodeBundle, 0)
 
 	loadBundles := `
@@ -290,12 +331,12 @@ func LatestEpisodes() []*EpisodeBundle {
 		bundle
 	FROM attributes_bundle
 	WHERE category = 'episode'
-	ORDER BY modified DESC
-	LIMIT 100
+	ORDER BY modified ` + page.direction() + `, attributes_bundle_id
+	LIMIT $1 OFFSET $2
 	`
 
 	dba := func(dbConn *sql.DB) error {
-		rows, err := dbConn.Query(loadBundles)
+		rows, err := dbConn.Query(loadBundles, page.Limit, page.Offset)
 		if err != nil {
 			return err
 		}
@@ -397,3 +438,57 @@ func (sb *SeriesBundle) NumberOfEpisodes() int {
 		return len(sb.Episodes)
 	}
 }
+
+// Returns the series and episode which describe a torrent selected by
+// `SelectDetail`. Either [or both] may be nil.
+func (t *Torrent) Bundles() (*SeriesBundle, *EpisodeBundle, error) {
+	if t.bundleId <= 0 {
+		return nil, nil, nil
+	}
+
+	selectBundles := `
+	SELECT
+		b.attributes_bundle_id, b.category, b.bundle,
+		COALESCE(p.attributes_bundle_id, 0), p.bundle
+	FROM attributes_bundle b
+	LEFT JOIN attributes_bundle p ON p.attributes_bundle_id = b.parent_id
+	WHERE b.attributes_bundle_id = $1
+	`
+
+	var series *SeriesBundle
+	var episode *EpisodeBundle
+	dba := func(dbConn *sql.DB) error {
+		var bundleId, parentId int
+		var category BundleType
+		var bundle, parent hstore.Hstore
+
+		row := dbConn.QueryRow(selectBundles, t.bundleId)
+		if err := row.Scan(&bundleId, &category, &bundle, &parentId, &parent); err != nil {
+			return err
+		}
+
+		switch category {
+		case BUNDLE_SERIES:
+			series = &SeriesBundle{ID: bundleId, TorrentID: t.ID}
+			return series.FromBundle(bundle.Map)
+		case BUNDLE_EPISODE:
+			episode = &EpisodeBundle{ID: bundleId, TorrentID: t.ID}
+			if err := episode.FromBundle(bundle.Map); err != nil {
+				log.Printf("Error reading episode bundle [%d]: %s \n", bundleId, err.Error())
+			}
+
+			if parentId > 0 {
+				series = &SeriesBundle{ID: parentId}
+				return series.FromBundle(parent.Map)
+			}
+		}
+
+		return nil
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, nil, err
+	}
+
+	return series, episode, nil
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/drbawb/babou/lib/db"
+)
+
+var ErrCategoryNotFound = errors.New("There is no such category.")
+
+// Slugs appear in URLs; e.g: /categories/tv
+var categorySlug = regexp.MustCompile(`^[a-z0-9-]{1,64}$`)
+
+// A category defined by the staff. Every torrent may belong to one.
+type Category struct {
+	CategoryId  int    `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	Position    int    `json:"-"`
+}
+
+// Returns every category in the order they should be listed.
+func AllCategories() ([]*Category, error) {
+	selectCategories := `SELECT category_id, name, slug, COALESCE(description, ''), position
+	FROM "categories" ORDER BY position, name`
+
+	categories := make([]*Category, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectCategories)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			category := &Category{}
+			err := rows.Scan(&category.CategoryId, &category.Name, &category.Slug,
+				&category.Description, &category.Position)
+			if err != nil {
+				return err
+			}
+
+			categories = append(categories, category)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// Selects a category by its slug.
+// Returns `ErrCategoryNotFound` if there is no such category.
+func (c *Category) SelectSlug(slug string) error {
+	return c.selectWhere(`slug = $1`, slug)
+}
+
+// Selects a category by its ID.
+// Returns `ErrCategoryNotFound` if there is no such category.
+func (c *Category) SelectId(categoryId int) error {
+	return c.selectWhere(`category_id = $1`, categoryId)
+}
+
+func (c *Category) selectWhere(condition string, arg interface{}) error {
+	selectCategory := `SELECT category_id, name, slug, COALESCE(description, ''), position
+	FROM "categories" WHERE ` + condition
+
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(selectCategory, arg).Scan(
+			&c.CategoryId, &c.Name, &c.Slug, &c.Description, &c.Position)
+	}
+
+	err := db.ExecuteFn(dba)
+	if err == sql.ErrNoRows {
+		return ErrCategoryNotFound
+	}
+
+	return err
+}
+
+// Creates a category; it is listed after the existing categories.
+func CreateCategory(name, slug, description string) (*Category, error) {
+	category := &Category{
+		Name:        strings.TrimSpace(name),
+		Slug:        strings.ToLower(strings.TrimSpace(slug)),
+		Description: strings.TrimSpace(description),
+	}
+
+	if category.Name == "" {
+		return nil, errors.New("Please enter a name for the category.")
+	}
+
+	if !categorySlug.MatchString(category.Slug) {
+		return nil, errors.New("A category's slug may only contain lower case letters, numbers, and dashes.")
+	}
+
+	insertCategory := `INSERT INTO "categories"(name, slug, description, position)
+	SELECT $1, $2, $3, COALESCE(max(position), 0) + 1 FROM "categories"
+	RETURNING category_id, position`
+
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(insertCategory, category.Name, category.Slug, category.Description).Scan(
+			&category.CategoryId, &category.Position)
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// Deletes a category; its torrents are left without a category.
+func DeleteCategory(categoryId int) error {
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(`DELETE FROM "categories" WHERE category_id = $1`, categoryId)
+		return err
+	}
+
+	return db.ExecuteFn(dba)
+}
+
+// Places the torrent in a category. A category ID of zero removes it from its category.
+func (t *Torrent) SetCategory(categoryId int) error {
+	updateCategory := `UPDATE "torrents" SET category_id = NULLIF($2, 0) WHERE torrent_id = $1`
+
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(updateCategory, t.ID, categoryId)
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return err
+	}
+
+	t.CategoryId = categoryId
+	return nil
+}
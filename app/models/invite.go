@@ -0,0 +1,334 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drbawb/babou/lib/db"
+)
+
+// How long an invite code can be used after it is sent.
+const INVITE_LIFETIME time.Duration = 7 * 24 * time.Hour
+
+var ErrNoInvites = errors.New("You do not have any invites left to send.")
+var ErrInviterBanned = errors.New("Banned users cannot send invites.")
+var ErrInviteInvalid = errors.New("That invite code is invalid, has expired, or has already been used.")
+
+// An invite code sent by a user to an email address.
+type Invite struct {
+	InviteId  int
+	Code      string
+	Email     string
+	InviterId int
+
+	InviteeId   int    // Zero until the invite is used.
+	InviteeName string // Empty until the invite is used.
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Used      bool
+
+	expired bool // as of when the invite was read; by the database's clock.
+}
+
+// Returns true if the invite can no longer be used because it is too old.
+func (i *Invite) Expired() bool {
+	return !i.Used && i.expired
+}
+
+// A user's place in the invite tree.
+type InviteNode struct {
+	UserId    int
+	Username  string
+	IsBanned  bool
+	InvitedBy int
+	Depth     int // Zero for the root of the tree.
+}
+
+// Spends one of this user's invites on an invite code for `email`.
+// Returns `ErrNoInvites` if the user has none left, or `ErrInviterBanned`
+// if they have been banned.
+func (u *User) CreateInvite(email string) (*Invite, error) {
+	if u.IsBanned {
+		return nil, ErrInviterBanned
+	}
+
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") {
+		return nil, errors.New("Please enter the email address of the person you are inviting.")
+	}
+
+	code, err := genInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &Invite{
+		Code:      code,
+		Email:     email,
+		InviterId: u.UserId,
+	}
+
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		res, err := txn.Exec(`UPDATE "users" SET invites = invites - 1
+		WHERE user_id = $1 AND invites > 0 AND NOT is_banned`, u.UserId)
+		if err != nil {
+			return err
+		}
+
+		if spent, err := res.RowsAffected(); err != nil {
+			return err
+		} else if spent == 0 {
+			return ErrNoInvites
+		}
+
+		err = txn.QueryRow(`INSERT INTO "invites"(code, email, inviter_id, expires_at)
+		VALUES($1, $2, $3, now() + $4::interval) RETURNING invite_id, created_at, expires_at`,
+			invite.Code, invite.Email, invite.InviterId, db.Interval(INVITE_LIFETIME)).
+			Scan(&invite.InviteId, &invite.CreatedAt, &invite.ExpiresAt)
+		if err != nil {
+			return err
+		}
+
+		return txn.Commit()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	u.Invites--
+	return invite, nil
+}
+
+// Returns the invites this user has sent; newest first.
+func (u *User) SentInvites() ([]*Invite, error) {
+	selectInvites := `SELECT i.invite_id, i.code, i.email, i.inviter_id,
+	COALESCE(i.invitee_id, 0), COALESCE(invitee.username, ''),
+	i.created_at, i.expires_at, i.used_at IS NOT NULL, i.expires_at <= now()
+	FROM "invites" i
+	LEFT JOIN "users" invitee ON invitee.user_id = i.invitee_id
+	WHERE i.inviter_id = $1
+	ORDER BY i.created_at DESC`
+
+	invites := make([]*Invite, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectInvites, u.UserId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			invite := &Invite{}
+			err := rows.Scan(
+				&invite.InviteId,
+				&invite.Code,
+				&invite.Email,
+				&invite.InviterId,
+				&invite.InviteeId,
+				&invite.InviteeName,
+				&invite.CreatedAt,
+				&invite.ExpiresAt,
+				&invite.Used,
+				&invite.expired)
+			if err != nil {
+				return err
+			}
+
+			invites = append(invites, invite)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// Gives this user more invites to send.
+func (u *User) GrantInvites(count int) error {
+	if count <= 0 {
+		return errors.New("The number of invites to grant must be positive.")
+	}
+
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(`UPDATE "users" SET invites = invites + $2 WHERE user_id = $1`, u.UserId, count)
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return err
+	}
+
+	u.Invites += count
+	return nil
+}
+
+// Selects an invite by its code.
+// Returns `ErrInviteInvalid` unless the invite can still be used.
+func SelectInvite(code string) (*Invite, error) {
+	selectInvite := `SELECT invite_id, code, email, inviter_id, created_at, expires_at
+	FROM "invites"
+	WHERE code = $1 AND used_at IS NULL AND expires_at > now()`
+
+	invite := &Invite{}
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(selectInvite, strings.TrimSpace(code)).Scan(
+			&invite.InviteId,
+			&invite.Code,
+			&invite.Email,
+			&invite.InviterId,
+			&invite.CreatedAt,
+			&invite.ExpiresAt)
+	}
+
+	err := db.ExecuteFn(dba)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// Marks an invite as used by a new user.
+// Returns false if someone else used the invite first or it has expired.
+func claimInvite(txn *sql.Tx, invite *Invite, inviteeId int) (bool, error) {
+	res, err := txn.Exec(`UPDATE "invites" SET invitee_id = $2, used_at = now()
+	WHERE invite_id = $1 AND used_at IS NULL AND expires_at > now()`, invite.InviteId, inviteeId)
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return claimed == 1, nil
+}
+
+// Returns the branch of the invite tree rooted at this user.
+// Users are listed depth-first; each user follows the user who invited them.
+func (u *User) InviteTree() ([]*InviteNode, error) {
+	selectTree := `WITH RECURSIVE branch(user_id, username, is_banned, invited_by, depth, path) AS (
+		SELECT user_id, username, is_banned, COALESCE(invited_by, 0), 0, ARRAY[user_id]
+		FROM "users" WHERE user_id = $1
+	UNION ALL
+		SELECT u.user_id, u.username, u.is_banned, u.invited_by, b.depth + 1, b.path || u.user_id
+		FROM "users" u JOIN branch b ON u.invited_by = b.user_id
+	)
+	SELECT user_id, username, is_banned, invited_by, depth FROM branch ORDER BY path`
+
+	nodes := make([]*InviteNode, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectTree, u.UserId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			node := &InviteNode{}
+			if err := rows.Scan(&node.UserId, &node.Username, &node.IsBanned, &node.InvitedBy, &node.Depth); err != nil {
+				return err
+			}
+
+			nodes = append(nodes, node)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// Bans this user and everyone they invited, recursively; and takes away
+// their unused invites.
+//
+// Returns the users who were banned so that trackers can be told to drop them.
+func (u *User) PruneBranch() ([]*User, error) {
+	branch := `WITH RECURSIVE branch(user_id) AS (
+		SELECT user_id FROM "users" WHERE user_id = $1
+	UNION
+		SELECT u.user_id FROM "users" u JOIN branch b ON u.invited_by = b.user_id
+	)`
+
+	pruned := make([]*User, 0)
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		_, err = txn.Exec(branch+`
+		DELETE FROM "invites" WHERE used_at IS NULL
+		AND inviter_id IN (SELECT user_id FROM branch)`, u.UserId)
+		if err != nil {
+			return err
+		}
+
+		rows, err := txn.Query(branch+`
+		UPDATE "users" SET is_banned = true, invites = 0
+		WHERE user_id IN (SELECT user_id FROM branch)
+		RETURNING user_id, username, secret`, u.UserId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			user := &User{IsBanned: true, isInit: true}
+			if err := rows.Scan(&user.UserId, &user.Username, &user.Secret); err != nil {
+				return err
+			}
+
+			pruned = append(pruned, user)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		return txn.Commit()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		fmt.Printf("Error pruning the invite tree of user %d: %s \n", u.UserId, err.Error())
+		return nil, err
+	}
+
+	u.IsBanned = true
+	return pruned, nil
+}
+
+// Generates a random invite code.
+func genInviteCode() (string, error) {
+	code := make([]byte, 16)
+	if n, err := rand.Read(code); n != len(code) || err != nil {
+		return "", errors.New("Error generating an invite code.")
+	}
+
+	return hex.EncodeToString(code), nil
+}
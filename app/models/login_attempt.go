@@ -0,0 +1,139 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drbawb/babou/lib/db"
+	"github.com/drbawb/babou/lib/ratelimit"
+)
+
+// A recorded attempt to login.
+type LoginAttempt struct {
+	AttemptId  int
+	Username   string
+	RemoteAddr string
+	Succeeded  bool
+	CreatedAt  time.Time
+}
+
+// Records an attempt to login as `username` from `remoteAddr`
+// The remote address may include a port; it will be stripped.
+func RecordLoginAttempt(username, remoteAddr string, succeeded bool) error {
+	insertAttempt := `INSERT INTO "login_attempts"(username, remote_addr, succeeded)
+	VALUES($1, $2, $3)`
+
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(insertAttempt,
+			strings.ToLower(username), ratelimit.Host(remoteAddr), succeeded)
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		fmt.Printf("Error recording login attempt for [%s]: %s \n", username, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the earliest time another attempt to login as `username` from
+// `remoteAddr` will be accepted; or the zero time if it may be made now.
+//
+// Failures are counted for the username [since its last successful login]
+// and for the address; whichever has failed more decides the delay.
+// The second return value is true if either of them is locked out.
+func NextLoginAttempt(username, remoteAddr string) (time.Time, bool, error) {
+	// The age of the last failure is measured by the database's clock, then
+	// placed on ours; timestamps are never compared across the two.
+	byUsername := `SELECT count(*), COALESCE(extract(epoch FROM now() - max(created_at)), 0) FROM "login_attempts"
+	WHERE username = $1 AND NOT succeeded AND created_at > now() - $2::interval
+	AND created_at > COALESCE(
+		(SELECT max(created_at) FROM "login_attempts" WHERE username = $1 AND succeeded),
+		now() - $2::interval)`
+
+	byAddress := `SELECT count(*), COALESCE(extract(epoch FROM now() - max(created_at)), 0) FROM "login_attempts"
+	WHERE remote_addr = $1 AND NOT succeeded AND created_at > now() - $2::interval`
+
+	window := db.Interval(ratelimit.FAILURE_WINDOW)
+
+	var next time.Time
+	var locked bool
+	dba := func(dbConn *sql.DB) error {
+		checks := []struct {
+			query string
+			key   string
+		}{
+			{byUsername, strings.ToLower(username)},
+			{byAddress, ratelimit.Host(remoteAddr)},
+		}
+
+		for _, check := range checks {
+			var failures int
+			var lastAge float64
+			if err := dbConn.QueryRow(check.query, check.key, window).Scan(&failures, &lastAge); err != nil {
+				return err
+			}
+
+			last := time.Now().Add(-time.Duration(lastAge * float64(time.Second)))
+			if at := ratelimit.NextAttempt(failures, last); at.After(next) {
+				next = at
+			}
+
+			locked = locked || ratelimit.IsLockout(failures)
+		}
+
+		return nil
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return time.Time{}, false, err
+	}
+
+	if !next.After(time.Now()) {
+		return time.Time{}, false, nil
+	}
+
+	return next, locked, nil
+}
+
+// Returns the most recent failed logins; newest first.
+func FailedLogins(limit int) ([]*LoginAttempt, error) {
+	selectAttempts := `SELECT attempt_id, username, remote_addr, succeeded, created_at
+	FROM "login_attempts" WHERE NOT succeeded
+	ORDER BY created_at DESC LIMIT $1`
+
+	attempts := make([]*LoginAttempt, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectAttempts, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			attempt := &LoginAttempt{}
+			err := rows.Scan(
+				&attempt.AttemptId,
+				&attempt.Username,
+				&attempt.RemoteAddr,
+				&attempt.Succeeded,
+				&attempt.CreatedAt)
+			if err != nil {
+				return err
+			}
+
+			attempts = append(attempts, attempt)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
@@ -0,0 +1,24 @@
+package models
+
+// Selects one page of a listing.
+//
+// Rows are skipped by `Offset` unless `After` is set; listings which support
+// keyset paging then start with the row following the one with that ID.
+// Listings ignore a `Sort` they do not support.
+type Page struct {
+	Sort       string
+	Descending bool
+
+	Offset int
+	Limit  int
+	After  int
+}
+
+// The order for an ORDER BY clause.
+func (p *Page) direction() string {
+	if p.Descending {
+		return "DESC"
+	}
+
+	return "ASC"
+}
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/drbawb/babou/lib/db"
+)
+
+// Roles that are created by the migrations.
+// Staff can create others; these are the ones babou relies on.
+const (
+	ROLE_USER      string = "user" // granted to every new user.
+	ROLE_UPLOADER  string = "uploader"
+	ROLE_MODERATOR string = "moderator"
+	ROLE_ADMIN     string = "admin"
+)
+
+// The permission catalog.
+// Controllers check these with `AuthContext.Can()`
+const (
+	PERM_BROWSE             string = "browse"
+	PERM_DOWNLOAD           string = "download"
+	PERM_UPLOAD             string = "upload"
+	PERM_MODERATE_TORRENTS  string = "moderate-torrents"
+	PERM_DELETE_ANY_TORRENT string = "delete-any-torrent"
+	PERM_VIEW_PEERS         string = "view-peers"
+	PERM_ADMIN_PANEL        string = "admin-panel"
+	PERM_MANAGE_USERS       string = "manage-users"
+	PERM_MANAGE_ROLES       string = "manage-roles"
+	PERM_VIEW_CLUSTER       string = "view-cluster"
+	PERM_TAG_TORRENTS       string = "tag-torrents"
+	PERM_MODERATE_TAGS      string = "moderate-tags"
+	PERM_MANAGE_CATEGORIES  string = "manage-categories"
+)
+
+// The permissions a user has been granted through all of their roles.
+type PermissionSet map[string]bool
+
+// Returns true if the set includes `permission`
+func (ps PermissionSet) Has(permission string) bool {
+	return ps[permission]
+}
+
+// A named group of permissions.
+type Role struct {
+	RoleId      int
+	Name        string
+	Description string
+
+	RequiresTotp bool // Users with this role must enable two-factor authentication.
+
+	Permissions []string
+}
+
+// Returns every role along with the permissions it grants.
+func AllRoles() ([]*Role, error) {
+	selectRoles := `SELECT r.role_id, r.name, COALESCE(r.description, ''), r.requires_2fa, COALESCE(p.name, '')
+	FROM "roles" r
+	LEFT JOIN "role_permissions" rp ON rp.role_id = r.role_id
+	LEFT JOIN "permissions" p ON p.permission_id = rp.permission_id
+	ORDER BY r.role_id, p.name`
+
+	roles := make([]*Role, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectRoles)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var role *Role
+		for rows.Next() {
+			next := &Role{Permissions: make([]string, 0)}
+			var permission string
+			if err := rows.Scan(&next.RoleId, &next.Name, &next.Description, &next.RequiresTotp, &permission); err != nil {
+				return err
+			}
+
+			if role == nil || role.RoleId != next.RoleId {
+				role = next
+				roles = append(roles, role)
+			}
+
+			if permission != "" {
+				role.Permissions = append(role.Permissions, permission)
+			}
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Returns the names of every user's roles keyed by their user ID.
+func RolesByUser() (map[int][]string, error) {
+	selectRoles := `SELECT ur.user_id, r.name
+	FROM "user_roles" ur
+	JOIN "roles" r ON r.role_id = ur.role_id
+	ORDER BY ur.user_id, r.role_id`
+
+	roles := make(map[int][]string)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectRoles)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var userId int
+			var name string
+			if err := rows.Scan(&userId, &name); err != nil {
+				return err
+			}
+
+			roles[userId] = append(roles[userId], name)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Returns the names of the roles this user has been granted.
+func (u *User) Roles() ([]string, error) {
+	selectRoles := `SELECT r.name
+	FROM "user_roles" ur
+	JOIN "roles" r ON r.role_id = ur.role_id
+	WHERE ur.user_id = $1
+	ORDER BY r.role_id`
+
+	roles := make([]string, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectRoles, u.UserId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+
+			roles = append(roles, name)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Returns every permission this user has been granted through their roles.
+// Banned users have no permissions; nor do users who have not enabled
+// two-factor authentication when one of their roles requires it.
+func (u *User) Permissions() (PermissionSet, error) {
+	permissions := make(PermissionSet)
+	if u.IsBanned {
+		return permissions, nil
+	}
+
+	if !u.TotpEnabled {
+		if required, err := u.RequiresTotp(); err != nil {
+			return nil, err
+		} else if required {
+			return permissions, nil
+		}
+	}
+
+	selectPermissions := `SELECT DISTINCT p.name
+	FROM "user_roles" ur
+	JOIN "role_permissions" rp ON rp.role_id = ur.role_id
+	JOIN "permissions" p ON p.permission_id = rp.permission_id
+	WHERE ur.user_id = $1`
+
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectPermissions, u.UserId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+
+			permissions[name] = true
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Grants a user [$1] a role by name [$2]; granting a role twice has no effect.
+const insertUserRole string = `INSERT INTO "user_roles"(user_id, role_id)
+	SELECT $1, role_id FROM "roles" r WHERE r.name = $2
+	AND NOT EXISTS (SELECT 1 FROM "user_roles" ur WHERE ur.user_id = $1 AND ur.role_id = r.role_id)`
+
+// Grants this user a role by name. Granting a role twice has no effect.
+func (u *User) GrantRole(role string) error {
+	return u.changeRole(insertUserRole, role)
+}
+
+// Revokes a role from this user by name.
+func (u *User) RevokeRole(role string) error {
+	deleteRole := `DELETE FROM "user_roles"
+	WHERE user_id = $1 AND role_id = (SELECT role_id FROM "roles" WHERE name = $2)`
+
+	return u.changeRole(deleteRole, role)
+}
+
+func (u *User) changeRole(query, role string) error {
+	if !u.isInit {
+		return errors.New("User must be selected before changing their roles.")
+	}
+
+	dba := func(dbConn *sql.DB) error {
+		var exists bool
+		err := dbConn.QueryRow(`SELECT EXISTS(SELECT 1 FROM "roles" WHERE name = $1)`, role).Scan(&exists)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return errors.New(fmt.Sprintf("There is no role named [%s]", role))
+		}
+
+		_, err = dbConn.Exec(query, u.UserId, role)
+		return err
+	}
+
+	return db.ExecuteFn(dba)
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/drbawb/babou/lib/db"
+	"github.com/drbawb/babou/lib/search"
+)
+
+// Search results are sorted by relevance unless another sort is requested.
+const SORT_RELEVANCE string = "relevance"
+
+// The sorts search results support; the first is their default.
+var SearchSorts = append([]string{SORT_RELEVANCE}, TorrentSorts...)
+
+// Fields a search may filter; e.g: `format:mkv`
+var SearchFields = []string{"name", "file", "series", "episode", "format", "resolution", "tag", "category"}
+
+type searchField struct {
+	column string
+	exact  bool // formats and resolutions must match exactly; others match any part.
+
+	condition string // if set: the condition used instead; `%s` is the filter's placeholder.
+}
+
+// The [normalized] column each field filter is compared with.
+var searchFields = map[string]searchField{
+	"name":       {`search_normalize(t.name)`, false, ""},
+	"file":       {`search_normalize(t.file_list)`, false, ""},
+	"series":     {`search_normalize(COALESCE(s.bundle -> 'name', CASE WHEN b.category = 'series' THEN b.bundle -> 'name' END))`, false, ""},
+	"episode":    {`search_normalize(CASE WHEN b.category = 'episode' THEN b.bundle -> 'name' END)`, false, ""},
+	"format":     {`lower(b.bundle -> 'format')`, true, ""},
+	"resolution": {`lower(b.bundle -> 'resolution')`, true, ""},
+	"category":   {`c.slug`, true, ""},
+	"tag": {"", true, `EXISTS (SELECT 1 FROM "torrent_tags" tt
+		JOIN "tags" g ON g.tag_id = tt.tag_id OR g.alias_of = tt.tag_id
+		WHERE tt.torrent_id = t.torrent_id AND g.name = %s)`},
+}
+
+// Searches the catalog. Returns a page of the results along with the
+// number of torrents which matched.
+//
+// Words are matched against each torrent's `search_vector` [so "wires" finds
+// "wire"] while phrases must appear in its `search_text` verbatim.
+// Results are ranked by how well they matched unless another sort is requested.
+func SearchTorrents(query *search.Query, page *Page) ([]*Torrent, int, error) {
+	args := []interface{}{page.Limit, page.Offset}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{"true"}
+	rank := "0"
+	if words := strings.Join(query.Included(), " "); words != "" {
+		tsquery := fmt.Sprintf("plainto_tsquery('english', %s)", arg(words))
+		conditions = append(conditions, "t.search_vector @@ "+tsquery)
+		rank = fmt.Sprintf("ts_rank_cd(t.search_vector, %s)", tsquery)
+	}
+
+	for _, phrase := range query.Phrases() {
+		conditions = append(conditions, "t.search_text LIKE "+arg(likeContains(phrase)))
+	}
+
+	for _, term := range query.Terms {
+		field, isField := searchFields[term.Field]
+
+		var condition string
+		switch {
+		case isField && field.condition != "":
+			text := strings.ToLower(term.Text)
+			if term.Field == "tag" {
+				text, _ = NormalizeTag(term.Text)
+			}
+			condition = fmt.Sprintf(field.condition, arg(text))
+		case isField && field.exact:
+			condition = field.column + " = " + arg(strings.ToLower(term.Text))
+		case isField:
+			condition = field.column + " LIKE " + arg(likeContains(term.Text))
+		case term.Field != "":
+			continue // not a field babou can search.
+		case term.Excluded && term.IsPhrase:
+			condition = "t.search_text LIKE " + arg(likeContains(term.Text))
+		case term.Excluded:
+			condition = fmt.Sprintf("t.search_vector @@ plainto_tsquery('english', %s)", arg(term.Text))
+		default:
+			continue // matched above.
+		}
+
+		if term.Excluded {
+			condition = fmt.Sprintf("NOT COALESCE(%s, false)", condition)
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	order := rank
+	if column, ok := torrentSortColumns[page.Sort]; ok {
+		order = "t." + column
+	}
+
+	selectResults := fmt.Sprintf(`SELECT t.torrent_id, t.name, t.info_hash, t.info_hash_v2, COALESCE(t.created_by, ''), t.created_at,
+		t.size, t.seeders, t.leechers, t.snatches,
+		COALESCE(c.category_id, 0), COALESCE(c.name, ''), COALESCE(c.slug, ''), count(*) OVER ()
+	FROM "torrents" t
+	LEFT JOIN "attributes_bundle" b ON b.attributes_bundle_id = t.attributes_bundle_id
+	LEFT JOIN "attributes_bundle" s ON s.attributes_bundle_id = b.parent_id
+	LEFT JOIN "categories" c ON c.category_id = t.category_id
+	WHERE %s
+	ORDER BY %s %s, t.torrent_id %s
+	LIMIT $1 OFFSET $2`, strings.Join(conditions, " AND "), order, page.direction(), page.direction())
+
+	results := make([]*Torrent, 0, page.Limit)
+	var total int
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectResults, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			t := &Torrent{isInit: true}
+			err := rows.Scan(&t.ID, &t.Name, &t.InfoHash, &t.InfoHashV2, &t.CreatedBy, &t.CreatedAt,
+				&t.Size, &t.Seeding, &t.Leeching, &t.Snatches,
+				&t.CategoryId, &t.CategoryName, &t.CategorySlug, &total)
+			if err != nil {
+				return err
+			}
+
+			results = append(results, t)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		fmt.Printf("Error searching for [%s]: %s \n", query.String(), err.Error())
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
+
+// Builds a LIKE pattern which matches text containing `text`
+func likeContains(text string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + escaper.Replace(search.Normalize(text)) + "%"
+}
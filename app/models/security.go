@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/drbawb/babou/lib/db"
+)
+
+// Actions recorded in a user's security history.
+const (
+	SECURITY_PASSKEY_RESET   string = "passkey_reset"   // the old passkey works until its grace period ends
+	SECURITY_PASSKEY_REVOKED string = "passkey_revoked" // the old passkey stopped working immediately
+	SECURITY_PASSWORD_RESET  string = "password_reset"  // the password was changed with an emailed link
+	SECURITY_TOTP_ENABLED    string = "2fa_enabled"
+	SECURITY_TOTP_DISABLED   string = "2fa_disabled"
+	SECURITY_RECOVERY_USED   string = "recovery_code_used" // a recovery code was used to log in
+	SECURITY_RECOVERY_RESET  string = "recovery_codes_reset"
+	SECURITY_SESSION_REVOKED string = "session_revoked" // the user logged out another browser
+)
+
+// An entry in a user's security history.
+type SecurityEvent struct {
+	EventId    int
+	UserId     int
+	Action     string
+	Detail     string
+	RemoteAddr string
+	CreatedAt  time.Time
+}
+
+// Records an event in a user's security history.
+// The remote address may include a port; it will be stripped.
+func LogSecurityEvent(userId int, action, detail, remoteAddr string) error {
+	insertEvent := `INSERT INTO "security_events"(user_id, action, detail, remote_addr)
+	VALUES($1, $2, $3, $4)`
+
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(insertEvent, userId, action, detail, remoteAddr)
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		fmt.Printf("Error logging security event [%s] for user %d: %s \n", action, userId, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns a user's security history; newest first.
+func SecurityHistory(userId int) ([]*SecurityEvent, error) {
+	selectEvents := `SELECT event_id, user_id, action, COALESCE(detail, ''), COALESCE(remote_addr, ''), created_at
+	FROM "security_events" WHERE user_id = $1
+	ORDER BY created_at DESC`
+
+	events := make([]*SecurityEvent, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectEvents, userId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			event := &SecurityEvent{}
+			err := rows.Scan(
+				&event.EventId,
+				&event.UserId,
+				&event.Action,
+				&event.Detail,
+				&event.RemoteAddr,
+				&event.CreatedAt)
+			if err != nil {
+				return err
+			}
+
+			events = append(events, event)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -5,21 +5,37 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/drbawb/babou/lib/db"
+	"github.com/drbawb/babou/lib/session"
 )
 
 const (
 	SESSIONS_TABLE string = "sessions"
 )
 
+var ErrSessionExpired = errors.New("Your session has expired; please login again.")
+var ErrUserBanned = errors.New("Your account has been banned.")
+
+// A user's login on one device.
+// A user has one session for every browser they are logged in with.
 type Session struct {
-	sessionId  int
-	userId     int
-	loginIp    int
-	lastSeenIp int
+	SessionId  int
+	UserId     int
+	LoginIp    string
+	LastSeenIp string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
 }
 
+// Columns read by `ActiveSessions`
+const selectSessionColumns string = `SELECT session_id, user_id, COALESCE(host(login_ip), ''),
+	COALESCE(host(last_seen_ip), ''), COALESCE(user_agent, ''), created_at, last_seen_at
+	FROM "` + SESSIONS_TABLE + `"`
+
+// Deletes every session a user has; logging them out everywhere.
 func (s *Session) DeleteFor(user *User) error {
 	if user == nil {
 		return errors.New("No user to delete a session for")
@@ -41,61 +57,197 @@ func (s *Session) DeleteFor(user *User) error {
 	return db.ExecuteFn(dba)
 }
 
-func (s *Session) WriteFor(user *User, ipAddr string) error {
-	//user.lazyLoad()
-	//ensure user is populated or able to be populated
+// Deletes one of a user's sessions; logging them out of that device.
+// Returns false if the user has no such session.
+func (s *Session) Delete(userId, sessionId int) (bool, error) {
+	deleteSession := `DELETE FROM "` + SESSIONS_TABLE + `"
+	WHERE user_id = $1 AND session_id = $2`
 
-	//check if session exists; if so: update with last_seen_at and last_seen_ip
-	updateSession := `UPDATE "` + SESSIONS_TABLE + `" 
-		SET login_ip = $2
-	WHERE user_id = $1`
+	var deleted int64
+	dba := func(dbConn *sql.DB) error {
+		result, err := dbConn.Exec(deleteSession, userId, sessionId)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = result.RowsAffected()
+		return err
+	}
 
-	insertSession := `INSERT INTO "` + SESSIONS_TABLE + `"(user_id, login_ip) 
-	VALUES($1, $2)`
+	if err := db.ExecuteFn(dba); err != nil {
+		return false, err
+	}
 
-	// try parse IP
-	host, _, err := net.SplitHostPort(ipAddr)
-	if err != nil {
-		fmt.Printf("Error parsing IP from remoteAddr: %s", err.Error())
+	return deleted > 0, nil
+}
+
+// Deletes every one of a user's sessions except `sessionId`; logging out their other devices.
+func (s *Session) DeleteOthers(userId, sessionId int) (int64, error) {
+	deleteSessions := `DELETE FROM "` + SESSIONS_TABLE + `"
+	WHERE user_id = $1 AND session_id <> $2`
+
+	var deleted int64
+	dba := func(dbConn *sql.DB) error {
+		result, err := dbConn.Exec(deleteSessions, userId, sessionId)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = result.RowsAffected()
 		return err
 	}
 
-	ip := net.ParseIP(host)
-	if ip == nil {
-		ipAddr = "::1"
-	} else {
-		ipAddr = ip.String()
+	if err := db.ExecuteFn(dba); err != nil {
+		return 0, err
 	}
 
+	return deleted, nil
+}
+
+// Starts a new session for a user who has just logged in.
+// Populates this session with its ID.
+func (s *Session) WriteFor(user *User, ipAddr, userAgent string) error {
+	insertSession := `INSERT INTO "` + SESSIONS_TABLE + `"(user_id, login_ip, last_seen_ip, user_agent)
+	VALUES($1, $2, $2, $3) RETURNING session_id, created_at, last_seen_at`
+
+	ipAddr = parseIp(ipAddr)
+
+	dba := func(dbConn *sql.DB) error {
+		err := dbConn.QueryRow(insertSession, user.UserId, ipAddr, userAgent).
+			Scan(&s.SessionId, &s.CreatedAt, &s.LastSeenAt)
+		if err != nil {
+			fmt.Printf("error inserting user's sessions: %s \n", err.Error())
+			return err
+		}
+
+		return nil
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return err
+	}
+
+	s.UserId = user.UserId
+	s.LoginIp, s.LastSeenIp, s.UserAgent = ipAddr, ipAddr, userAgent
+
+	return nil
+}
+
+// Records that a session has been used from `ipAddr`
+// Returns `ErrSessionExpired` if the session has been revoked or has expired.
+func (s *Session) Touch(userId, sessionId int, ipAddr string) error {
+	timeouts := session.CurrentTimeouts()
+
+	touchSession := `UPDATE "` + SESSIONS_TABLE + `"
+	SET last_seen_at = now(), last_seen_ip = $3
+	WHERE user_id = $1 AND session_id = $2
+	AND created_at > now() - $4::interval AND last_seen_at > now() - $5::interval`
+
+	var touched int64
 	dba := func(dbConn *sql.DB) error {
-		result, err := dbConn.Exec(updateSession, user.UserId, ipAddr)
+		result, err := dbConn.Exec(touchSession, userId, sessionId, parseIp(ipAddr),
+			db.Interval(timeouts.Lifetime), db.Interval(timeouts.IdleTimeout))
 		if err != nil {
-			fmt.Printf("error updating user's sessions: %s \n", err.Error())
 			return err
 		}
 
-		rowsUpdated, err := result.RowsAffected()
+		touched, err = result.RowsAffected()
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return err
+	}
+
+	if touched == 0 {
+		return ErrSessionExpired
+	}
+
+	s.SessionId, s.UserId = sessionId, userId
+	return nil
+}
+
+// Returns a user's sessions which have not expired; most recently used first.
+func ActiveSessions(userId int) ([]*Session, error) {
+	timeouts := session.CurrentTimeouts()
+
+	selectSessions := selectSessionColumns + `
+	WHERE user_id = $1 AND created_at > now() - $2::interval AND last_seen_at > now() - $3::interval
+	ORDER BY last_seen_at DESC`
+
+	sessions := make([]*Session, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectSessions, userId,
+			db.Interval(timeouts.Lifetime), db.Interval(timeouts.IdleTimeout))
 		if err != nil {
-			fmt.Printf("Error checking # rows affected by user session update: %s", err.Error())
 			return err
 		}
-		// First update previous session record if it can be found.
-		if rowsUpdated > 0 {
-			fmt.Printf("session update be OK <3 \n")
-			return nil
+		defer rows.Close()
+
+		for rows.Next() {
+			s := &Session{}
+			err := rows.Scan(
+				&s.SessionId,
+				&s.UserId,
+				&s.LoginIp,
+				&s.LastSeenIp,
+				&s.UserAgent,
+				&s.CreatedAt,
+				&s.LastSeenAt)
+			if err != nil {
+				return err
+			}
+
+			sessions = append(sessions, s)
 		}
 
-		// Then insert a new one.
-		fmt.Printf("session can no be update. hmm. maybe ok maybe i insert.")
-		result, err = dbConn.Exec(insertSession, user.UserId, "::1")
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Deletes every session which has expired; returns the number deleted.
+func PruneSessions() (int64, error) {
+	timeouts := session.CurrentTimeouts()
+
+	deleteSessions := `DELETE FROM "` + SESSIONS_TABLE + `"
+	WHERE created_at < now() - $1::interval OR last_seen_at < now() - $2::interval`
+
+	var pruned int64
+	dba := func(dbConn *sql.DB) error {
+		result, err := dbConn.Exec(deleteSessions,
+			db.Interval(timeouts.Lifetime), db.Interval(timeouts.IdleTimeout))
 		if err != nil {
-			fmt.Printf("error inserting user's sessions: %s", err.Error())
 			return err
 		}
 
-		return nil
+		pruned, err = result.RowsAffected()
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return 0, err
+	}
+
+	return pruned, nil
+}
+
+// Returns the IP address of a remote address; or the loopback address if it cannot be parsed.
+func parseIp(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "::1"
 	}
 
-	err = db.ExecuteFn(dba)
-	return err
+	return ip.String()
 }
@@ -0,0 +1,372 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/drbawb/babou/lib/db"
+)
+
+const (
+	MAX_TAG_LENGTH      int = 32
+	MAX_TAGS_PER_ADD    int = 10 // tags a user may add to a torrent at once.
+	TAG_REMOVAL_SCORE   int = -3 // a torrent's tag is removed when its score falls this low.
+	TAG_VOTE_UP         int = 1
+	TAG_VOTE_DOWN       int = -1
+	TAG_SEPARATORS          = ", "
+	tagSpaceReplacement     = "."
+)
+
+var ErrTagNotFound = errors.New("There is no such tag.")
+var ErrTagInvalid = errors.New(fmt.Sprintf(
+	"Tags may only contain letters, numbers, dots, dashes, and plus signs; and be at most %d characters long.",
+	MAX_TAG_LENGTH))
+
+// Tags are lower case; words are separated by dots. e.g: science.fiction
+var tagName = regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]*$`)
+
+// A tag which may be added to torrents.
+type Tag struct {
+	TagId      int    `json:"id"`
+	Name       string `json:"name"`
+	AliasOf    int    `json:"-"` // zero unless this tag is an alias.
+	AliasName  string `json:"aliasOf,omitempty"`
+	IsApproved bool   `json:"isApproved"`
+	Torrents   int    `json:"torrents"` // the number of torrents with this tag; when listed.
+}
+
+// A tag on a particular torrent along with its votes.
+type TorrentTag struct {
+	TorrentId  int    `json:"-"`
+	TagId      int    `json:"id"`
+	Name       string `json:"name"`
+	IsApproved bool   `json:"isApproved"`
+	Score      int    `json:"score"`
+	UserVote   int    `json:"-"` // the current user's vote; zero if they have not voted.
+}
+
+// Converts a tag as a user typed it into the form it is stored in.
+// e.g: "Science Fiction" becomes "science.fiction"
+func NormalizeTag(name string) (string, error) {
+	name = strings.Join(strings.Fields(strings.ToLower(name)), tagSpaceReplacement)
+	if len(name) > MAX_TAG_LENGTH || !tagName.MatchString(name) {
+		return "", ErrTagInvalid
+	}
+
+	return name, nil
+}
+
+// Splits a list of tags separated by commas or spaces.
+func SplitTags(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return strings.ContainsRune(TAG_SEPARATORS, r)
+	})
+}
+
+// Selects a tag by name. An alias selects the tag it is an alias of.
+// Returns `ErrTagNotFound` if there is no such tag.
+func (tag *Tag) SelectName(name string) error {
+	selectTag := `SELECT t.tag_id, t.name, t.is_approved
+	FROM "tags" a
+	JOIN "tags" t ON t.tag_id = COALESCE(a.alias_of, a.tag_id)
+	WHERE a.name = $1`
+
+	name, err := NormalizeTag(name)
+	if err != nil {
+		return ErrTagNotFound
+	}
+
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(selectTag, name).Scan(&tag.TagId, &tag.Name, &tag.IsApproved)
+	}
+
+	err = db.ExecuteFn(dba)
+	if err == sql.ErrNoRows {
+		return ErrTagNotFound
+	}
+
+	return err
+}
+
+// Returns the approved tags along with the number of torrents they are on.
+// Aliases are not listed; nor are tags which are not on any torrents.
+func BrowsableTags() ([]*Tag, error) {
+	return selectTags(`SELECT t.tag_id, t.name, 0, '', t.is_approved, count(tt.torrent_id)
+	FROM "tags" t
+	JOIN "torrent_tags" tt ON tt.tag_id = t.tag_id
+	WHERE t.is_approved AND t.alias_of IS NULL
+	GROUP BY t.tag_id, t.name, t.is_approved
+	ORDER BY t.name`)
+}
+
+// Returns the tags which are waiting to be approved; most used first.
+func PendingTags() ([]*Tag, error) {
+	return selectTags(`SELECT t.tag_id, t.name, 0, '', t.is_approved, count(tt.torrent_id)
+	FROM "tags" t
+	LEFT JOIN "torrent_tags" tt ON tt.tag_id = t.tag_id
+	WHERE NOT t.is_approved AND t.alias_of IS NULL
+	GROUP BY t.tag_id, t.name, t.is_approved
+	ORDER BY count(tt.torrent_id) DESC, t.name`)
+}
+
+// Returns every alias along with the tag it is an alias of.
+func TagAliases() ([]*Tag, error) {
+	return selectTags(`SELECT a.tag_id, a.name, t.tag_id, t.name, a.is_approved, 0
+	FROM "tags" a
+	JOIN "tags" t ON t.tag_id = a.alias_of
+	ORDER BY a.name`)
+}
+
+func selectTags(query string) ([]*Tag, error) {
+	tags := make([]*Tag, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			tag := &Tag{}
+			err := rows.Scan(&tag.TagId, &tag.Name, &tag.AliasOf, &tag.AliasName, &tag.IsApproved, &tag.Torrents)
+			if err != nil {
+				return err
+			}
+
+			tags = append(tags, tag)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Approves a pending tag so that it is listed for browsing.
+func ApproveTag(tagId int) error {
+	return execTag(`UPDATE "tags" SET is_approved = true WHERE tag_id = $1`, tagId)
+}
+
+// Deletes a tag; it is removed from every torrent.
+func DeleteTag(tagId int) error {
+	return execTag(`DELETE FROM "tags" WHERE tag_id = $1`, tagId)
+}
+
+func execTag(query string, tagId int) error {
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(query, tagId)
+		return err
+	}
+
+	return db.ExecuteFn(dba)
+}
+
+// Makes a tag an alias of the tag named `target`
+//
+// Torrents with the tag [and any of its aliases] are tagged with the target
+// instead. Votes on the tag are discarded.
+func AliasTag(tagId int, target string) error {
+	targetTag := &Tag{}
+	if err := targetTag.SelectName(target); err != nil {
+		return err
+	}
+
+	if targetTag.TagId == tagId {
+		return errors.New("A tag cannot be an alias of itself.")
+	}
+
+	moveTorrents := `INSERT INTO "torrent_tags"(torrent_id, tag_id, added_by, created_at)
+	SELECT tt.torrent_id, $2, tt.added_by, tt.created_at FROM "torrent_tags" tt
+	WHERE tt.tag_id = $1 AND NOT EXISTS (
+		SELECT 1 FROM "torrent_tags" WHERE torrent_id = tt.torrent_id AND tag_id = $2
+	)`
+
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		if _, err := txn.Exec(moveTorrents, tagId, targetTag.TagId); err != nil {
+			return err
+		}
+
+		if _, err := txn.Exec(`DELETE FROM "torrent_tags" WHERE tag_id = $1`, tagId); err != nil {
+			return err
+		}
+
+		// aliases of the tag now point at the target.
+		_, err = txn.Exec(`UPDATE "tags" SET alias_of = $2, is_approved = true
+		WHERE tag_id = $1 OR alias_of = $1`, tagId, targetTag.TagId)
+		if err != nil {
+			return err
+		}
+
+		return txn.Commit()
+	}
+
+	return db.ExecuteFn(dba)
+}
+
+// Tags the torrent. A tag which does not exist yet is created; it is
+// approved if `approve` is set [e.g: the user is a moderator.]
+// Aliases add the tag they are an alias of. The user's vote is counted
+// in favour of the tag.
+func (t *Torrent) AddTag(name string, userId int, approve bool) error {
+	name, err := NormalizeTag(name)
+	if err != nil {
+		return err
+	}
+
+	// 9.3 has no ON CONFLICT; racing inserts of the same tag fail on its unique name.
+	insertTag := `INSERT INTO "tags"(name, is_approved, created_by)
+	SELECT $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM "tags" WHERE name = $1)`
+
+	selectTag := `SELECT COALESCE(alias_of, tag_id) FROM "tags" WHERE name = $1`
+
+	insertTorrentTag := `INSERT INTO "torrent_tags"(torrent_id, tag_id, added_by)
+	SELECT $1, $2, $3 WHERE NOT EXISTS (
+		SELECT 1 FROM "torrent_tags" WHERE torrent_id = $1 AND tag_id = $2
+	)`
+
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		if _, err := txn.Exec(insertTag, name, approve, userId); err != nil {
+			return err
+		}
+
+		var tagId int
+		if err := txn.QueryRow(selectTag, name).Scan(&tagId); err != nil {
+			return err
+		}
+
+		if _, err := txn.Exec(insertTorrentTag, t.ID, tagId, userId); err != nil {
+			return err
+		}
+
+		if err := voteTag(txn, t.ID, tagId, userId, TAG_VOTE_UP); err != nil {
+			return err
+		}
+
+		return txn.Commit()
+	}
+
+	return db.ExecuteFn(dba)
+}
+
+// Returns the torrent's tags; best scoring first.
+// `userId` is the user whose votes are included.
+func (t *Torrent) Tags(userId int) ([]*TorrentTag, error) {
+	selectTags := `SELECT g.tag_id, g.name, g.is_approved,
+		COALESCE(sum(v.vote), 0), COALESCE(max(CASE WHEN v.user_id = $2 THEN v.vote END), 0)
+	FROM "torrent_tags" tt
+	JOIN "tags" g ON g.tag_id = tt.tag_id
+	LEFT JOIN "tag_votes" v ON v.torrent_id = tt.torrent_id AND v.tag_id = tt.tag_id
+	WHERE tt.torrent_id = $1
+	GROUP BY g.tag_id, g.name, g.is_approved
+	ORDER BY 4 DESC, g.name`
+
+	tags := make([]*TorrentTag, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectTags, t.ID, userId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			tag := &TorrentTag{TorrentId: t.ID}
+			if err := rows.Scan(&tag.TagId, &tag.Name, &tag.IsApproved, &tag.Score, &tag.UserVote); err != nil {
+				return err
+			}
+
+			tags = append(tags, tag)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Records a user's vote on one of the torrent's tags; replacing their
+// previous vote. Returns true if the tag's score fell low enough that
+// it was removed from the torrent.
+func (t *Torrent) VoteTag(tagId, userId, vote int) (bool, error) {
+	if vote != TAG_VOTE_UP && vote != TAG_VOTE_DOWN {
+		return false, errors.New("A vote must be up or down.")
+	}
+
+	removeTag := `DELETE FROM "torrent_tags" WHERE torrent_id = $1 AND tag_id = $2
+	AND (SELECT sum(vote) FROM "tag_votes" WHERE torrent_id = $1 AND tag_id = $2) <= $3`
+
+	var removed bool
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		var tagged bool
+		err = txn.QueryRow(`SELECT EXISTS(SELECT 1 FROM "torrent_tags" WHERE torrent_id = $1 AND tag_id = $2)`,
+			t.ID, tagId).Scan(&tagged)
+		if err != nil {
+			return err
+		} else if !tagged {
+			return ErrTagNotFound
+		}
+
+		if err := voteTag(txn, t.ID, tagId, userId, vote); err != nil {
+			return err
+		}
+
+		res, err := txn.Exec(removeTag, t.ID, tagId, TAG_REMOVAL_SCORE)
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected, err := res.RowsAffected(); err != nil {
+			return err
+		} else {
+			removed = rowsAffected > 0
+		}
+
+		return txn.Commit()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return false, err
+	}
+
+	return removed, nil
+}
+
+func voteTag(txn *sql.Tx, torrentId, tagId, userId, vote int) error {
+	deleteVote := `DELETE FROM "tag_votes" WHERE torrent_id = $1 AND tag_id = $2 AND user_id = $3`
+	insertVote := `INSERT INTO "tag_votes"(torrent_id, tag_id, user_id, vote) VALUES($1, $2, $3, $4)`
+
+	if _, err := txn.Exec(deleteVote, torrentId, tagId, userId); err != nil {
+		return err
+	}
+
+	_, err := txn.Exec(insertVote, torrentId, tagId, userId, vote)
+	return err
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/drbawb/babou/lib/db"
+)
+
+// What a token may be used for, and how long it may be used.
+const (
+	TOKEN_VERIFY_EMAIL   string = "verify-email"
+	TOKEN_RESET_PASSWORD string = "reset-password"
+
+	VERIFY_EMAIL_LIFETIME   time.Duration = 48 * time.Hour
+	RESET_PASSWORD_LIFETIME time.Duration = 1 * time.Hour
+)
+
+var ErrTokenInvalid = errors.New("That link is invalid, has expired, or has already been used.")
+
+// Issues a single-use token that can be mailed to this user.
+// Any unused tokens issued earlier for the same purpose stop working.
+//
+// Only a hash of the token is stored; the token itself is returned once.
+func (u *User) IssueToken(purpose string, lifetime time.Duration) (string, error) {
+	token := make([]byte, 32)
+	if n, err := rand.Read(token); n != len(token) || err != nil {
+		return "", errors.New("Error generating a token.")
+	}
+
+	encoded := hex.EncodeToString(token)
+
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		_, err = txn.Exec(`UPDATE "user_tokens" SET used_at = now()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, u.UserId, purpose)
+		if err != nil {
+			return err
+		}
+
+		_, err = txn.Exec(`INSERT INTO "user_tokens"(user_id, purpose, token_hash, expires_at)
+		VALUES($1, $2, $3, now() + $4::interval)`, u.UserId, purpose, hashToken(encoded), db.Interval(lifetime))
+		if err != nil {
+			return err
+		}
+
+		return txn.Commit()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return "", err
+	}
+
+	return encoded, nil
+}
+
+// Returns the user a token was issued to without using it up.
+// Returns `ErrTokenInvalid` unless the token can still be used.
+func PeekToken(purpose, token string) (*User, error) {
+	var userId int
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(`SELECT user_id FROM "user_tokens"
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()`,
+			hashToken(token), purpose).Scan(&userId)
+	}
+
+	return selectTokenUser(userId, db.ExecuteFn(dba))
+}
+
+// Uses up a token and returns the user it was issued to.
+// Returns `ErrTokenInvalid` unless the token can still be used.
+func RedeemToken(purpose, token string) (*User, error) {
+	var userId int
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(`UPDATE "user_tokens" SET used_at = now()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id`, hashToken(token), purpose).Scan(&userId)
+	}
+
+	return selectTokenUser(userId, db.ExecuteFn(dba))
+}
+
+func selectTokenUser(userId int, err error) (*User, error) {
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	user := &User{}
+	if err := user.SelectId(userId); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -6,36 +6,83 @@ import (
 
 	"github.com/chuckpreslar/codex"
 
+	"github.com/drbawb/babou/lib/store"
 	"github.com/drbawb/babou/lib/torrent"
 
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// Columns the catalog can be sorted by.
+const (
+	SORT_DATE     string = "date"
+	SORT_NAME     string = "name"
+	SORT_SIZE     string = "size"
+	SORT_SEEDERS  string = "seeders"
+	SORT_SNATCHES string = "snatches"
+)
+
+// The sorts the catalog supports; the first is its default.
+var TorrentSorts = []string{SORT_DATE, SORT_NAME, SORT_SIZE, SORT_SEEDERS, SORT_SNATCHES}
+
+var torrentSortColumns = map[string]string{
+	SORT_DATE:     "created_at",
+	SORT_NAME:     "name",
+	SORT_SIZE:     "size",
+	SORT_SEEDERS:  "seeders",
+	SORT_SNATCHES: "snatches",
+}
+
 // Define record structure.
-// Tags aren't used anywhere . . .
+// Field tags aren't used anywhere . . .
 //
 // Mostly use them as references, might use them
 // for some sort of ORM in the future.
+// JSON tags are used when the catalog is served as JSON.
 type Torrent struct {
-	ID       int    `field:"torrent_id"`
-	Name     string `field:"name"`
-	InfoHash string `field:"info_hash"`
+	ID       int    `field:"torrent_id" json:"id"`
+	Name     string `field:"name" json:"name"`
+	InfoHash string `field:"info_hash" json:"infoHash"` // v2 torrents: their truncated v2 info hash.
+
+	InfoHashV2  string `field:"info_hash_v2" json:"infoHashV2,omitempty"` // v2 and hybrid torrents only.
+	PieceLayers []byte `field:"piece_layers" json:"-"`                    // bencoded; v2 and hybrid torrents only.
+
+	CreatedBy    string `field:"created_by" json:"createdBy"`
+	CreationDate int    `field:"creation_date" json:"creationDate"`
+
+	Encoding        string `field:"encoding" json:"-"`
+	EncodedInfo     []byte `field:"info_bencoded" json:"-"`
+	EncodedMetainfo []byte `field:"metainfo_bencoded" json:"-"` // every other top-level key; see `LoadTorrent`
 
-	CreatedBy    string `field:"created_by"`
-	CreationDate int    `field:"creation_date"`
+	IsDisabled bool `field:"is_disabled" json:"isDisabled"`
 
-	Encoding    string `field:"encoding"`
-	EncodedInfo []byte `field:"info_bencoded"`
+	CreatedAt time.Time `field:"created_at" json:"createdAt"`
+	Size      int64     `field:"size" json:"size"`
+	Snatches  int       `field:"snatches" json:"snatches"`
+	FileList  string    `field:"file_list" json:"-"` // one path per line; indexed for searching.
+
+	CategoryId   int    `field:"category_id" json:"categoryId,omitempty"`
+	CategoryName string `json:"category,omitempty"` // only selected for the catalog.
+	CategorySlug string `json:"-"`
+
+	UploadedBy int    `field:"uploaded_by" json:"-"`
+	Uploader   string `json:"uploader,omitempty"` // only selected by SelectDetail.
+
+	Magnet string `json:"magnet,omitempty"` // only set by SetMagnet; it includes the user's secret.
+
+	bundleId int
 
 	lazyAttributes *Attribute `	table:"attributes" 
 								has-one:"torrents" 
 								through:"torrent_id"`
 
-	Seeding  int
-	Leeching int
+	Seeding  int `json:"seeders"`
+	Leeching int `json:"leechers"`
 
+	files  []torrent.File // read from the metainfo by Populate; written with the torrent.
 	isInit bool
 }
 
@@ -53,6 +100,12 @@ func (t *Torrent) SelectId(id int) error {
 		"creation_date",
 		"encoding",
 		"info_bencoded",
+		"is_disabled",
+		"category_id",
+		"info_hash_v2",
+		"piece_layers",
+		"metainfo_bencoded",
+		"size",
 	)
 
 	// Filter results.
@@ -64,11 +117,14 @@ func (t *Torrent) SelectId(id int) error {
 	}
 
 	dba := func(dbConn *sql.DB) error {
+		var categoryId sql.NullInt64
 		row := dbConn.QueryRow(torrentsFilter)
 		err := row.Scan(&t.ID, &t.Name, &t.InfoHash, &t.CreatedBy, &t.CreationDate,
-			&t.Encoding, &t.EncodedInfo)
+			&t.Encoding, &t.EncodedInfo, &t.IsDisabled, &categoryId, &t.InfoHashV2, &t.PieceLayers,
+			&t.EncodedMetainfo, &t.Size)
 
 		if err == nil {
+			t.CategoryId = int(categoryId.Int64)
 			t.isInit = true
 		}
 
@@ -80,28 +136,71 @@ func (t *Torrent) SelectId(id int) error {
 
 // Looks up a torrent based on its info hash,
 // this is a 20-byte SHA which is encoded as a string [2-chars per byte.]
+//
+// Hybrid torrents may also be looked up by their truncated v2 info hash.
 func (t *Torrent) SelectHash(hash string) error {
-	torrents := codex.Table("torrents")
-	torrentsProjection := torrents.Project(
-		"torrent_id",
-		"name",
-		"info_hash",
-		"created_by",
-		"creation_date",
-		"encoding",
-		"info_bencoded",
-	)
+	selectHash := `SELECT torrent_id, name, info_hash, created_by, creation_date,
+		encoding, info_bencoded, is_disabled, category_id, info_hash_v2, piece_layers, metainfo_bencoded, size
+	FROM "torrents"
+	WHERE info_hash = $1 OR (info_hash_v2 <> '' AND substr(info_hash_v2, 1, 40) = $1)
+	ORDER BY info_hash = $1 DESC
+	LIMIT 1`
+
+	dba := func(dbConn *sql.DB) error {
+		var categoryId sql.NullInt64
+		row := dbConn.QueryRow(selectHash, hash)
+		err := row.Scan(&t.ID, &t.Name, &t.InfoHash, &t.CreatedBy, &t.CreationDate,
+			&t.Encoding, &t.EncodedInfo, &t.IsDisabled, &categoryId, &t.InfoHashV2, &t.PieceLayers,
+			&t.EncodedMetainfo, &t.Size)
+
+		if err == nil {
+			t.CategoryId = int(categoryId.Int64)
+			t.isInit = true
+		}
 
-	torrentsFilter, err := torrentsProjection.Where(
-		torrents("info_hash").Eq(hash)).ToSql()
-	if err != nil {
 		return err
 	}
 
+	return db.ExecuteFn(dba)
+}
+
+// Tests if a torrent with either info hash has been uploaded.
+// `infoHashV2` is empty for v1 torrents.
+func TorrentExists(infoHash, infoHashV2 string) (bool, error) {
+	selectExists := `SELECT EXISTS(SELECT 1 FROM "torrents"
+		WHERE info_hash = $1 OR ($2 <> '' AND info_hash_v2 = $2))`
+
+	var exists bool
 	dba := func(dbConn *sql.DB) error {
-		row := dbConn.QueryRow(torrentsFilter)
-		err := row.Scan(&t.ID, &t.Name, &t.InfoHash, &t.CreatedBy, &t.CreationDate,
-			&t.Encoding, &t.EncodedInfo)
+		return dbConn.QueryRow(selectExists, infoHash, infoHashV2).Scan(&exists)
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Selects everything shown on a torrent's page: the torrent along with
+// its upload date, size, statistics, category, and uploader.
+func (t *Torrent) SelectDetail(id int) error {
+	selectDetail := `SELECT t.torrent_id, t.name, t.info_hash, t.info_hash_v2, COALESCE(t.created_by, ''),
+		COALESCE(t.creation_date, 0), COALESCE(t.encoding, ''), t.info_bencoded, t.is_disabled,
+		t.created_at, t.size, t.seeders, t.leechers, t.snatches,
+		COALESCE(c.category_id, 0), COALESCE(c.name, ''), COALESCE(c.slug, ''),
+		COALESCE(u.user_id, 0), COALESCE(u.username, ''), COALESCE(t.attributes_bundle_id, 0)
+	FROM "torrents" t
+	LEFT JOIN "categories" c ON c.category_id = t.category_id
+	LEFT JOIN "users" u ON u.user_id = t.uploaded_by
+	WHERE t.torrent_id = $1`
+
+	dba := func(dbConn *sql.DB) error {
+		err := dbConn.QueryRow(selectDetail, id).Scan(&t.ID, &t.Name, &t.InfoHash, &t.InfoHashV2, &t.CreatedBy,
+			&t.CreationDate, &t.Encoding, &t.EncodedInfo, &t.IsDisabled,
+			&t.CreatedAt, &t.Size, &t.Seeding, &t.Leeching, &t.Snatches,
+			&t.CategoryId, &t.CategoryName, &t.CategorySlug,
+			&t.UploadedBy, &t.Uploader, &t.bundleId)
 
 		if err == nil {
 			t.isInit = true
@@ -113,39 +212,191 @@ func (t *Torrent) SelectHash(hash string) error {
 	return db.ExecuteFn(dba)
 }
 
-// Selects an excerpt of torrents. Only fetches an ID, InfoHash, and CreatedBy
-func (t *Torrent) SelectSummaryPage() ([]*Torrent, error) {
-	summaryList := make([]*Torrent, 0, 100)
+// Restricts the catalog to a category and/or a tag. Zero matches any.
+type TorrentFilter struct {
+	CategoryId int
+	TagId      int
+}
 
-	torrents := codex.Table("torrents")
-	torrentsProjection := torrents.Project(
-		"torrent_id",
-		"name",
-		"info_hash",
-		"created_by",
-	)
+// The conditions of a WHERE clause selecting the filtered torrents.
+// `arg` adds a parameter to the query and returns its placeholder.
+func (f *TorrentFilter) conditions(arg func(interface{}) string) []string {
+	conditions := []string{"true"}
+	if f == nil {
+		return conditions
+	}
 
-	torrentsFilter, err := torrentsProjection.Limit(100).ToSql()
-	if err != nil {
-		return nil, err
+	if f.CategoryId > 0 {
+		conditions = append(conditions, "t.category_id = "+arg(f.CategoryId))
 	}
 
+	if f.TagId > 0 {
+		conditions = append(conditions, fmt.Sprintf(
+			`EXISTS (SELECT 1 FROM "torrent_tags" tt WHERE tt.torrent_id = t.torrent_id AND tt.tag_id = %s)`,
+			arg(f.TagId)))
+	}
+
+	return conditions
+}
+
+// Selects a page of the catalog. Only fetches a summary of each torrent:
+// its ID, name, InfoHash, CreatedBy, upload date, size, category, and statistics.
+//
+// The catalog supports keyset paging: if `page.After` is the ID of a torrent
+// which no longer exists the page is selected by its offset instead.
+func (t *Torrent) SelectSummaryPage(filter *TorrentFilter, page *Page) ([]*Torrent, error) {
+	column, ok := torrentSortColumns[page.Sort]
+	if !ok {
+		column = torrentSortColumns[TorrentSorts[0]]
+	}
+
+	comparison := ">"
+	if page.Descending {
+		comparison = "<"
+	}
+
+	args := []interface{}{page.Limit, page.Offset}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := filter.conditions(arg)
+	if page.After > 0 {
+		args[1] = 0
+		conditions = append(conditions, fmt.Sprintf(
+			`(t.%s, t.torrent_id) %s (SELECT %s, torrent_id FROM "torrents" WHERE torrent_id = %s)`,
+			column, comparison, column, arg(page.After)))
+	}
+
+	selectPage := fmt.Sprintf(`SELECT t.torrent_id, t.name, t.info_hash, t.info_hash_v2, COALESCE(t.created_by, ''), t.created_at,
+		t.size, t.seeders, t.leechers, t.snatches,
+		COALESCE(c.category_id, 0), COALESCE(c.name, ''), COALESCE(c.slug, '')
+	FROM "torrents" t
+	LEFT JOIN "categories" c ON c.category_id = t.category_id
+	WHERE %s
+	ORDER BY t.%s %s, t.torrent_id %s
+	LIMIT $1 OFFSET $2`, strings.Join(conditions, " AND "), column, page.direction(), page.direction())
+
+	summaryList := make([]*Torrent, 0, page.Limit)
 	dba := func(dbConn *sql.DB) error {
-		rows, err := dbConn.Query(torrentsFilter)
+		rows, err := dbConn.Query(selectPage, args...)
 		if err != nil {
 			return err
 		}
+		defer rows.Close()
 
 		for rows.Next() {
 			t := &Torrent{isInit: true}
-			_ = rows.Scan(&t.ID, &t.Name, &t.InfoHash, &t.CreatedBy)
+			err := rows.Scan(&t.ID, &t.Name, &t.InfoHash, &t.InfoHashV2, &t.CreatedBy, &t.CreatedAt,
+				&t.Size, &t.Seeding, &t.Leeching, &t.Snatches,
+				&t.CategoryId, &t.CategoryName, &t.CategorySlug)
+			if err != nil {
+				return err
+			}
+
 			summaryList = append(summaryList, t)
 		}
 
-		return nil
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	if page.After > 0 && len(summaryList) == 0 && page.Offset > 0 {
+		return t.SelectSummaryPage(filter, &Page{
+			Sort:       page.Sort,
+			Descending: page.Descending,
+			Offset:     page.Offset,
+			Limit:      page.Limit,
+		})
+	}
+
+	return summaryList, nil
+}
+
+// Returns the number of torrents in the [filtered] catalog.
+func CountTorrents(filter *TorrentFilter) (int, error) {
+	args := make([]interface{}, 0)
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	countTorrents := `SELECT count(*) FROM "torrents" t WHERE ` + strings.Join(filter.conditions(arg), " AND ")
+
+	var count int
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(countTorrents, args...).Scan(&count)
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Records the swarm statistics reported by a tracker so the catalog
+// can be sorted by them. Every web node writes the same statistics;
+// so writing them is idempotent. (Snatches are counted by `RecordSnatch`)
+func WriteTorrentStats(infoHash string, seeders, leechers int) error {
+	updateStats := `UPDATE "torrents" SET seeders = $2, leechers = $3 WHERE info_hash = $1`
+
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(updateStats, infoHash, seeders, leechers)
+		return err
+	}
+
+	return db.ExecuteFn(dba)
+}
+
+// Counts a snatch of the torrent by a user; called by the tracker when a
+// peer announces that it completed the torrent. Each user is only counted
+// once per torrent. Returns true if the snatch was counted.
+func RecordSnatch(infoHash string, userId int) (bool, error) {
+	insertSnatch := `INSERT INTO "torrent_snatches"(torrent_id, user_id)
+	SELECT t.torrent_id, $2 FROM "torrents" t
+	WHERE t.info_hash = $1 AND NOT EXISTS(
+		SELECT 1 FROM "torrent_snatches" s WHERE s.torrent_id = t.torrent_id AND s.user_id = $2)`
+
+	updateSnatches := `UPDATE "torrents" SET snatches = snatches + 1 WHERE info_hash = $1`
+
+	var counted bool
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		res, err := txn.Exec(insertSnatch, infoHash, userId)
+		if err != nil {
+			return err
+		}
+
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return err
+		} else if inserted == 0 {
+			return nil
+		}
+
+		if _, err := txn.Exec(updateSnatches, infoHash); err != nil {
+			return err
+		}
+
+		counted = true
+		return txn.Commit()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return false, err
 	}
 
-	return summaryList, db.ExecuteFn(dba)
+	return counted, nil
 }
 
 func (t *Torrent) Attributes() (*Attribute, error) {
@@ -174,14 +425,22 @@ func (t *Torrent) Write() error {
 		t.CreatedBy,
 		t.CreationDate,
 		t.Encoding,
-		encodeBytesForPG(t.EncodedInfo),
+		t.Size,
+		t.FileList,
+		t.InfoHashV2,
+		encodeBytesForPG(t.PieceLayers),
+		encodeBytesForPG(t.EncodedMetainfo),
 	).Into(
 		"name",
 		"info_hash",
 		"created_by",
 		"creation_date",
 		"encoding",
-		"info_bencoded",
+		"size",
+		"file_list",
+		"info_hash_v2",
+		"piece_layers",
+		"metainfo_bencoded",
 	).Returning("torrent_id").ToSql()
 
 	if err != nil {
@@ -194,26 +453,50 @@ func (t *Torrent) Write() error {
 		"created_by",
 		"creation_date",
 		"encoding",
-		"info_bencoded",
+		"size",
+		"file_list",
+		"info_hash_v2",
+		"piece_layers",
+		"metainfo_bencoded",
 	).To(
 		t.Name,
 		t.InfoHash,
 		t.CreatedBy,
 		t.CreationDate,
 		t.Encoding,
-		encodeBytesForPG(t.EncodedInfo),
+		t.Size,
+		t.FileList,
+		t.InfoHashV2,
+		encodeBytesForPG(t.PieceLayers),
+		encodeBytesForPG(t.EncodedMetainfo),
 	).Where(torrents("torrent_id").Eq(t.ID)).ToSql()
 
 	if err != nil {
 		return err
 	}
 
+	// stores outside the database keep the info dict before its row is written;
+	// should the row fail the dict is only an unreferenced file.
+	infoStore := store.Default()
+	txStore, infoInTxn := infoStore.(store.TxStore)
+	if len(t.EncodedInfo) > 0 && !infoInTxn {
+		if err := infoStore.Put(t.InfoHash, t.EncodedInfo); err != nil {
+			return err
+		}
+	}
+
 	dba := func(dbConn *sql.DB) error {
 		noRowsUpdated := true
 
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
 		//try update then insert
 		if t.ID > 0 {
-			res, err := dbConn.Exec(updateTorrent)
+			res, err := txn.Exec(updateTorrent)
 			if err != nil {
 				return err
 			}
@@ -231,7 +514,7 @@ func (t *Torrent) Write() error {
 		//row not updated; do an insert.
 		if noRowsUpdated {
 			fmt.Printf("performing insert for torrent \n")
-			err := dbConn.QueryRow(torrentsInsert).Scan(&t.ID)
+			err := txn.QueryRow(torrentsInsert).Scan(&t.ID)
 			if err != nil {
 				return err
 			}
@@ -241,17 +524,148 @@ func (t *Torrent) Write() error {
 				t.lazyAttributes = &Attribute{}
 			}
 
-			err = t.lazyAttributes.WriteFor(t.ID)
+			err = t.lazyAttributes.writeFor(txn, t.ID)
 			if err != nil {
 				return err
 			}
+
+			if err := t.writeFiles(txn); err != nil {
+				return err
+			}
+
+			if t.UploadedBy > 0 {
+				_, err := txn.Exec(`UPDATE "torrents" SET uploaded_by = $2 WHERE torrent_id = $1`,
+					t.ID, t.UploadedBy)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// the database store keeps the info dict on the row written above.
+		if len(t.EncodedInfo) > 0 && infoInTxn {
+			if err := txStore.PutTx(txn, t.InfoHash, t.EncodedInfo); err != nil {
+				return err
+			}
+		}
+
+		return txn.Commit()
+	}
+
+	return db.ExecuteFn(dba)
+}
+
+// Deletes the torrent along with its attributes.
+func (t *Torrent) Delete() error {
+	deleteAttributes := `DELETE FROM "attributes" WHERE torrent_id = $1`
+	deleteTorrent := `DELETE FROM "torrents" WHERE torrent_id = $1`
+
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := txn.Exec(deleteAttributes, t.ID); err != nil {
+			_ = txn.Rollback()
+			return err
+		}
+
+		if _, err := txn.Exec(deleteTorrent, t.ID); err != nil {
+			_ = txn.Rollback()
+			return err
 		}
 
+		return txn.Commit()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return err
+	}
+
+	if t.InfoHash == "" {
+		return nil
+	}
+
+	return store.Default().Delete(t.InfoHash)
+}
+
+// Returns the info hash of every torrent.
+func AllInfoHashes() ([]string, error) {
+	infoHashes := make([]string, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(`SELECT info_hash FROM "torrents" ORDER BY info_hash`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var infoHash string
+			if err := rows.Scan(&infoHash); err != nil {
+				return err
+			}
+
+			infoHashes = append(infoHashes, infoHash)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return infoHashes, nil
+}
+
+// Links the torrent to the series or episode bundle describing it.
+func (t *Torrent) SetBundle(bundleId int) error {
+	updateBundle := `UPDATE "torrents" SET attributes_bundle_id = $2 WHERE torrent_id = $1`
+
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(updateBundle, t.ID, bundleId)
+		return err
+	}
+
+	return db.ExecuteFn(dba)
+}
+
+// Disables the torrent. A disabled torrent stays in the catalog
+// but will no longer be served by the tracker.
+func (t *Torrent) Disable() error {
+	disableTorrent := `UPDATE "torrents" SET is_disabled = true WHERE torrent_id = $1`
+
+	dba := func(dbConn *sql.DB) error {
+		if _, err := dbConn.Exec(disableTorrent, t.ID); err != nil {
+			return err
+		}
+
+		t.IsDisabled = true
 		return nil
 	}
 
 	return db.ExecuteFn(dba)
+}
 
+// The torrent's size for display; e.g: "4.7 GiB"
+func (t *Torrent) DisplaySize() string {
+	return torrent.FormatSize(t.Size)
+}
+
+// Builds a magnet link for the torrent which announces to `trackers`
+func (t *Torrent) MagnetURI(trackers []string) string {
+	return torrent.MagnetURI(t.InfoHash, t.InfoHashV2, t.Name, t.Size, trackers)
+}
+
+// Sets the magnet link shown in listings for the user viewing them.
+func (t *Torrent) SetMagnet(user *User) {
+	t.Magnet = t.MagnetURI(user.AnnounceURLs())
+}
+
+// The date the torrent was uploaded for display.
+func (t *Torrent) UploadDate() string {
+	return t.CreatedAt.Format("2006-01-02")
 }
 
 // Transforms a []byte into a Postgres hex-escaped string.
@@ -275,7 +689,26 @@ func (t *Torrent) Populate(torrentFile *torrent.TorrentFile) error {
 	t.CreatedBy = torrentFile.CreatedBy
 	t.CreationDate = int(torrentFile.CreationDate)
 	t.Encoding = torrentFile.Encoding
-	t.InfoHash = fmt.Sprintf("%x", torrentFile.EncodeInfo())
+	t.InfoHash = torrentFile.InfoHash()
+	t.InfoHashV2 = torrentFile.EncodeInfoV2ToString()
+	t.Size = torrentFile.TotalLength()
+
+	pieceLayers, err := torrentFile.BencodePieceLayers()
+	if err != nil {
+		return err
+	}
+	t.PieceLayers = pieceLayers
+
+	if t.EncodedMetainfo, err = torrentFile.BencodeMetainfo(); err != nil {
+		return err
+	}
+
+	t.files = torrentFile.Files()
+	paths := make([]string, 0, len(t.files))
+	for _, file := range t.files {
+		paths = append(paths, file.Path)
+	}
+	t.FileList = strings.Join(paths, "\n")
 
 	encodedInfo, err := torrentFile.BencodeInfoDict()
 	if err != nil {
@@ -289,6 +722,16 @@ func (t *Torrent) Populate(torrentFile *torrent.TorrentFile) error {
 	return nil
 }
 
+// Returns the torrent's bencoded info dict. Torrents selected from the
+// database store already have it; others read it from the torrent store.
+func (t *Torrent) infoDict() ([]byte, error) {
+	if len(t.EncodedInfo) > 0 {
+		return t.EncodedInfo, nil
+	}
+
+	return store.Default().Get(t.InfoHash)
+}
+
 func (t *Torrent) WriteFile(secret, hash []byte) ([]byte, error) {
 	file, err := t.LoadTorrent()
 	if err != nil {
@@ -299,19 +742,39 @@ func (t *Torrent) WriteFile(secret, hash []byte) ([]byte, error) {
 	return outBytes, err
 }
 
+// Rebuilds the torrent's metainfo file as it was uploaded; without its trackers.
+// Torrents uploaded before their top-level dict was stored only keep the
+// fields which have their own columns.
 func (t *Torrent) LoadTorrent() (*torrent.TorrentFile, error) {
 	file := &torrent.TorrentFile{}
-	file.Comment = "downloaded from babou development instance"
 	file.CreatedBy = t.CreatedBy
 	file.CreationDate = int64(t.CreationDate)
 	file.Encoding = t.Encoding
 
-	infoMap, err := torrent.DecodeInfoDict(t.EncodedInfo)
+	var err error
+	if len(t.EncodedMetainfo) > 0 {
+		if file, err = torrent.DecodeMetainfo(t.EncodedMetainfo); err != nil {
+			return nil, err
+		}
+	}
+
+	encodedInfo, err := t.infoDict()
+	if err != nil {
+		return nil, err
+	}
+
+	infoMap, err := torrent.DecodeInfoDict(encodedInfo)
 	if err != nil {
 		return nil, err
 	}
 
 	file.Info = infoMap
 
+	if len(t.PieceLayers) > 0 {
+		if file.PieceLayers, err = torrent.DecodePieceLayers(t.PieceLayers); err != nil {
+			return nil, err
+		}
+	}
+
 	return file, nil
 }
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/drbawb/babou/lib/db"
+	"github.com/drbawb/babou/lib/torrent"
+)
+
+// Returns the files in the torrent in the order they appear in its metainfo.
+//
+// Torrents uploaded before files were stored have no rows in `torrent_files`;
+// their files are read from the stored info dict instead.
+func (t *Torrent) Files() ([]torrent.File, error) {
+	selectFiles := `SELECT path, length FROM "torrent_files" WHERE torrent_id = $1 ORDER BY position`
+
+	files := make([]torrent.File, 0)
+	dba := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(selectFiles, t.ID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			file := torrent.File{}
+			if err := rows.Scan(&file.Path, &file.Length); err != nil {
+				return err
+			}
+
+			files = append(files, file)
+		}
+
+		return rows.Err()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 && t.InfoHash != "" {
+		metainfo, err := t.LoadTorrent()
+		if err != nil {
+			return nil, err
+		}
+
+		return metainfo.Files(), nil
+	}
+
+	return files, nil
+}
+
+// Writes the files read from the torrent's metainfo by `Populate` within `txn`
+func (t *Torrent) writeFiles(txn *sql.Tx) error {
+	insertFile := `INSERT INTO "torrent_files"(torrent_id, position, path, length) VALUES($1, $2, $3, $4)`
+
+	stmt, err := txn.Prepare(insertFile)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for position, file := range t.files {
+		if _, err := stmt.Exec(t.ID, position, file.Path, file.Length); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/drbawb/babou/lib/db"
+	"github.com/drbawb/babou/lib/totp"
+)
+
+// The number of recovery codes issued when two-factor authentication is enabled.
+const RECOVERY_CODE_COUNT int = 10
+
+var ErrTotpInvalid = errors.New("That code is incorrect or has already been used.")
+
+// Starts enrolling this user in two-factor authentication.
+// Returns a new secret for their authenticator app; it is not checked at
+// login until they confirm it with `EnableTotp`
+func (u *User) BeginTotp() ([]byte, error) {
+	if u.TotpEnabled {
+		return nil, errors.New("Two-factor authentication is already enabled.")
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(`UPDATE "users" SET totp_secret = $2, totp_last_counter = 0
+		WHERE user_id = $1 AND NOT totp_enabled`, u.UserId, secret)
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	u.totpSecret = secret
+	return secret, nil
+}
+
+// Returns the secret this user is enrolling with, or nil if they have not started.
+func (u *User) PendingTotpSecret() []byte {
+	if u.TotpEnabled {
+		return nil
+	}
+
+	return u.totpSecret
+}
+
+// Finishes enrolling this user with a code from their authenticator app.
+// Returns their recovery codes; they are not stored and cannot be shown again.
+func (u *User) EnableTotp(code string) ([]string, error) {
+	if u.TotpEnabled || len(u.totpSecret) == 0 {
+		return nil, errors.New("Two-factor authentication has not been set up.")
+	}
+
+	if ok, err := u.CheckTotp(code); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrTotpInvalid
+	}
+
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(`UPDATE "users" SET totp_enabled = true WHERE user_id = $1`, u.UserId)
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	u.TotpEnabled = true
+	return u.RegenerateRecoveryCodes()
+}
+
+// Turns off two-factor authentication and forgets the user's secret and recovery codes.
+func (u *User) DisableTotp() error {
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		_, err = txn.Exec(`UPDATE "users" SET totp_secret = NULL, totp_enabled = false, totp_last_counter = 0
+		WHERE user_id = $1`, u.UserId)
+		if err != nil {
+			return err
+		}
+
+		if _, err := txn.Exec(`DELETE FROM "recovery_codes" WHERE user_id = $1`, u.UserId); err != nil {
+			return err
+		}
+
+		return txn.Commit()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return err
+	}
+
+	u.TotpEnabled, u.totpSecret = false, nil
+	return nil
+}
+
+// Checks a code from the user's authenticator app.
+// Each code is accepted once; a code for an earlier time-step than the last
+// accepted code is refused as well.
+func (u *User) CheckTotp(code string) (bool, error) {
+	if len(u.totpSecret) == 0 {
+		return false, nil
+	}
+
+	counter, ok := totp.Verify(u.totpSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	var accepted int64
+	dba := func(dbConn *sql.DB) error {
+		res, err := dbConn.Exec(`UPDATE "users" SET totp_last_counter = $2
+		WHERE user_id = $1 AND totp_last_counter < $2`, u.UserId, counter)
+		if err != nil {
+			return err
+		}
+
+		accepted, err = res.RowsAffected()
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return false, err
+	}
+
+	return accepted == 1, nil
+}
+
+// Uses up one of the user's recovery codes.
+// Returns false if the code does not match an unused recovery code.
+func (u *User) UseRecoveryCode(code string) (bool, error) {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+
+	var used int64
+	dba := func(dbConn *sql.DB) error {
+		res, err := dbConn.Exec(`UPDATE "recovery_codes" SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, u.UserId, hashToken(code))
+		if err != nil {
+			return err
+		}
+
+		used, err = res.RowsAffected()
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return false, err
+	}
+
+	return used > 0, nil
+}
+
+// Replaces the user's recovery codes with new ones.
+// Returns the new codes; only their hashes are stored.
+func (u *User) RegenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, RECOVERY_CODE_COUNT)
+	for i := 0; i < RECOVERY_CODE_COUNT; i++ {
+		raw := make([]byte, 5)
+		if n, err := rand.Read(raw); n != len(raw) || err != nil {
+			return nil, errors.New("Error generating recovery codes.")
+		}
+
+		code := hex.EncodeToString(raw)
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	dba := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		if _, err := txn.Exec(`DELETE FROM "recovery_codes" WHERE user_id = $1`, u.UserId); err != nil {
+			return err
+		}
+
+		for _, code := range codes {
+			_, err := txn.Exec(`INSERT INTO "recovery_codes"(user_id, code_hash) VALUES($1, $2)`,
+				u.UserId, hashToken(strings.Replace(code, "-", "", -1)))
+			if err != nil {
+				return err
+			}
+		}
+
+		return txn.Commit()
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Returns true if one of the user's roles requires two-factor authentication.
+func (u *User) RequiresTotp() (bool, error) {
+	var required bool
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(`SELECT EXISTS(SELECT 1 FROM "user_roles" ur
+		JOIN "roles" r ON r.role_id = ur.role_id
+		WHERE ur.user_id = $1 AND r.requires_2fa)`, u.UserId).Scan(&required)
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return false, err
+	}
+
+	return required, nil
+}
+
+// Requires [or stops requiring] the users of a role to enable two-factor authentication.
+// Until they do so they hold no permissions.
+func SetRoleRequiresTotp(role string, required bool) error {
+	var updated int64
+	dba := func(dbConn *sql.DB) error {
+		res, err := dbConn.Exec(`UPDATE "roles" SET requires_2fa = $2 WHERE name = $1`, role, required)
+		if err != nil {
+			return err
+		}
+
+		updated, err = res.RowsAffected()
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return errors.New("There is no role named [" + role + "]")
+	}
+
+	return nil
+}
@@ -8,29 +8,41 @@ import (
 	bcrypt "code.google.com/p/go.crypto/bcrypt"
 
 	"encoding/hex"
+	"strings"
 
-	hmac "crypto/hmac"
 	rand "crypto/rand"
-	sha256 "crypto/sha256"
+	time "time"
 
 	db "github.com/drbawb/babou/lib/db"
+	torrent "github.com/drbawb/babou/lib/torrent"
 )
 
 // `User` model for `users`
 type User struct {
 	UserId   int
 	Username string
-	IsAdmin  bool
+	IsBanned bool
 
-	Email    string
-	emailSql sql.NullString
+	Invites   int // Invites this user has left to send.
+	InvitedBy int // The user who invited this user; zero if they registered without an invite.
+
+	Email         string
+	EmailVerified bool
+	emailSql      sql.NullString
 
 	passwordHash string
 	passwordSalt string
 
+	TotpEnabled bool   // Two-factor authentication is checked at login.
+	totpSecret  []byte // Set once the user starts enrolling.
+
 	Secret     []byte
 	SecretHash []byte
 
+	// Set when the user was selected by a secret that is being rotated out;
+	// the secret stops working at this time. Zero otherwise.
+	SecretExpires time.Time
+
 	isInit bool
 }
 
@@ -41,11 +53,13 @@ const (
 	USERNAME_TAKEN        UserModelError = 1 << iota
 	USERNAME_INVALID_CHAR                = 1 << iota
 	FAIL_GEN_SECRET                      = 1 << iota
+	INVITE_INVALID                       = 1 << iota
+	INVITE_EMAIL_MISMATCH                = 1 << iota
 )
 
 func AllUsers() ([]*User, error) {
 	usersList := make([]*User, 0)
-	selectUsers := `SELECT user_id, username, email, passwordhash, passwordsalt, secret, secret_hash
+	selectUsers := `SELECT user_id, username, email, invites, passwordhash, passwordsalt, secret, secret_hash
 	FROM "users"`
 
 	dba := func(dbConn *sql.DB) error {
@@ -60,6 +74,7 @@ func AllUsers() ([]*User, error) {
 				&u.UserId,
 				&u.Username,
 				&u.emailSql,
+				&u.Invites,
 				&u.passwordHash,
 				&u.passwordSalt,
 				&u.Secret,
@@ -85,29 +100,51 @@ func AllUsers() ([]*User, error) {
 	return usersList, err //safe to use pointer.
 }
 
+// Columns read by `SelectId`, `SelectUsername`, and `SelectEmail`
+const selectUserColumns string = `SELECT user_id, username, email, email_verified, is_banned,
+	invites, COALESCE(invited_by, 0), passwordhash, passwordsalt, secret, secret_hash,
+	totp_secret, totp_enabled
+	FROM "users"`
+
 // Select user by ID number and populate the current `user` struct with the record data.
 // Returns an error if there was a problem. fetching the user information from the database.
 func (u *User) SelectId(id int) error {
-	selectUserById := `SELECT user_id, username, is_admin, passwordhash, passwordsalt, secret, secret_hash
-	FROM "users" WHERE user_id = $1`
+	return u.selectWhere(`user_id = $1`, id)
+}
 
+// Select user by email address and populate the current `user` struct with the record data.
+// Email addresses are compared without regard to case.
+func (u *User) SelectEmail(email string) error {
+	return u.selectWhere(`lower(email) = lower($1)`, strings.TrimSpace(email))
+}
+
+func (u *User) selectWhere(condition string, value interface{}) error {
 	dba := func(dbConn *sql.DB) error {
-		row := dbConn.QueryRow(selectUserById, id)
-		err := row.Scan(&u.UserId, &u.Username, &u.IsAdmin, &u.passwordHash, &u.passwordSalt, &u.Secret, &u.SecretHash)
+		row := dbConn.QueryRow(selectUserColumns+" WHERE "+condition, value)
+		err := row.Scan(
+			&u.UserId,
+			&u.Username,
+			&u.emailSql,
+			&u.EmailVerified,
+			&u.IsBanned,
+			&u.Invites,
+			&u.InvitedBy,
+			&u.passwordHash,
+			&u.passwordSalt,
+			&u.Secret,
+			&u.SecretHash,
+			&u.totpSecret,
+			&u.TotpEnabled)
 		if err != nil {
 			return err
 		}
 
+		u.Email = u.emailSql.String
 		u.isInit = true
 		return nil
 	}
 
-	err := db.ExecuteFn(dba)
-	if err != nil {
-		return err
-	}
-
-	return nil //safe to use pointer.
+	return db.ExecuteFn(dba)
 }
 
 func (u *User) Delete() error {
@@ -124,39 +161,130 @@ func (u *User) Delete() error {
 	return db.ExecuteFn(dba)
 }
 
-// Select user by username and populate the current `user` struct with the record data.
-// Returns an error if there was a problem. fetching the user information from the database.
-func (u *User) SelectUsername(username string) error {
-	selectUserById := `SELECT user_id, username, passwordhash, passwordsalt, secret, secret_hash
-	FROM "users" WHERE username = $1`
+// Bans the user. A banned user's secret will no longer be
+// accepted by the tracker.
+func (u *User) Ban() error {
+	banUserById := `UPDATE "users" SET is_banned = true, invites = 0 WHERE user_id = $1`
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(banUserById, u.UserId)
+		if err != nil {
+			return err
+		}
+
+		u.IsBanned, u.Invites = true, 0
+		return nil
+	}
 
+	return db.ExecuteFn(dba)
+}
+
+// Replaces the user's announce secret and its hash.
+// Returns the previous secret so that trackers can be told to forget it,
+// and the end of its grace period as stored. [zero if it was revoked]
+//
+// The previous secret keeps working for the grace period so the user has time
+// to download their .torrent files again; a grace period of zero revokes it immediately.
+func (u *User) ResetSecret(grace time.Duration) ([]byte, time.Time, error) {
+	updateSecret := `UPDATE "users" SET secret = $1, secret_hash = $2,
+	previous_secret = $3, previous_secret_expires = now() + $4::interval
+	WHERE user_id = $5
+	RETURNING extract(epoch FROM previous_secret_expires - now())`
+
+	announceSecret, announceHash, err := genSecret()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	oldSecret := u.Secret
+
+	// (NULL when the old secret is revoked immediately.)
+	var previousSecret []byte
+	var previousGrace *string
+	if grace > 0 {
+		interval := db.Interval(grace)
+		previousSecret, previousGrace = oldSecret, &interval
+	}
+
+	var remaining *float64
 	dba := func(dbConn *sql.DB) error {
-		row := dbConn.QueryRow(selectUserById, username)
-		err := row.Scan(&u.UserId, &u.Username, &u.passwordHash, &u.passwordSalt, &u.Secret, &u.SecretHash)
+		err := dbConn.QueryRow(updateSecret,
+			announceSecret, announceHash, previousSecret, previousGrace, u.UserId).Scan(&remaining)
 		if err != nil {
 			return err
 		}
 
-		u.isInit = true
+		u.Secret, u.SecretHash = announceSecret, announceHash
 		return nil
 	}
 
-	err := db.ExecuteFn(dba)
+	if err := db.ExecuteFn(dba); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	// the expiry is measured by the database's clock, then placed on ours.
+	var graceUntil time.Time
+	if remaining != nil {
+		graceUntil = time.Now().Add(time.Duration(*remaining * float64(time.Second)))
+	}
+
+	return oldSecret, graceUntil, nil
+}
+
+// Select user by username and populate the current `user` struct with the record data.
+// Returns an error if there was a problem. fetching the user information from the database.
+func (u *User) SelectUsername(username string) error {
+	return u.selectWhere(`username = $1`, username)
+}
+
+// Marks the user's email address as verified.
+func (u *User) VerifyEmail() error {
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(`UPDATE "users" SET email_verified = true WHERE user_id = $1`, u.UserId)
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return err
+	}
+
+	u.EmailVerified = true
+	return nil
+}
+
+// Replaces the user's password.
+func (u *User) SetPassword(password string) error {
+	passwordHash, passwordSalt, err := genHash(password)
 	if err != nil {
 		return err
 	}
 
-	return nil //safe to use pointer.
+	dba := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(`UPDATE "users" SET passwordhash = $2, passwordsalt = $3 WHERE user_id = $1`,
+			u.UserId, passwordHash, passwordSalt)
+		return err
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return err
+	}
+
+	u.passwordHash, u.passwordSalt = passwordHash, string(passwordSalt)
+	return nil
 }
 
 // Selects a user by their secret key. This is used by the tracker
-// to authorize a user.
+// to authorize a user. Banned users will not be found.
 //
 // The secret is expected to be a UTF8 string representing a byte array
 // using 2-characters per byte. (As per the standard encoding/hex package.)
+//
+// A secret which is being rotated out is found until its grace period ends;
+// `SecretExpires` is set to the end of the grace period in that case.
 func (u *User) SelectSecret(secret string) error {
-	selectUserBySecret := `SELECT user_id,username,passwordhash,passwordsalt,secret,secret_hash
-	FROM "users" WHERE secret = $1`
+	selectUserBySecret := `SELECT user_id,username,passwordhash,passwordsalt,secret,secret_hash,
+	CASE WHEN secret = $1 THEN NULL ELSE extract(epoch FROM previous_secret_expires - now()) END
+	FROM "users" WHERE is_banned = false
+	AND (secret = $1 OR (previous_secret = $1 AND previous_secret_expires > now()))`
 
 	secretHex, err := hex.DecodeString(secret)
 	if err != nil {
@@ -164,12 +292,19 @@ func (u *User) SelectSecret(secret string) error {
 	}
 
 	dba := func(dbConn *sql.DB) error {
+		var remaining *float64
+
 		row := dbConn.QueryRow(selectUserBySecret, secretHex)
-		err := row.Scan(&u.UserId, &u.Username, &u.passwordHash, &u.passwordSalt, &u.Secret, &u.SecretHash)
+		err := row.Scan(&u.UserId, &u.Username, &u.passwordHash, &u.passwordSalt, &u.Secret, &u.SecretHash, &remaining)
 		if err != nil {
 			return err
 		}
 
+		// the expiry is measured by the database's clock, then placed on ours.
+		if remaining != nil {
+			u.SecretExpires = time.Now().Add(time.Duration(*remaining * float64(time.Second)))
+		}
+
 		u.isInit = true
 		return nil
 	}
@@ -200,8 +335,11 @@ func (u *User) CheckHash(password string) error {
 // The first return parameter is an error-code that represents a non-fatal
 // problem that could be presented to the user.
 //
+// If the user was invited the invite is used up; it must have been sent to `email`.
+// The invite may be nil if registration is open.
+//
 // The second return parameter is a fatal error passed up from the database layer.
-func NewUser(username, password string) (UserModelError, error) {
+func NewUser(username, password, email string, invite *Invite) (UserModelError, error) {
 	var outStatus UserModelError
 
 	fn := func(database *sql.DB) error {
@@ -210,6 +348,16 @@ func NewUser(username, password string) (UserModelError, error) {
 			return nil
 		}
 
+		var invitedBy sql.NullInt64
+		if invite != nil {
+			if !strings.EqualFold(invite.Email, email) {
+				outStatus = INVITE_EMAIL_MISMATCH
+				return nil
+			}
+
+			invitedBy = sql.NullInt64{Int64: int64(invite.InviterId), Valid: true}
+		}
+
 		passwordHash, passwordSalt, err := genHash(password)
 		if err != nil {
 			return err
@@ -220,21 +368,42 @@ func NewUser(username, password string) (UserModelError, error) {
 			return err
 		}
 
-		stmt, err := database.Prepare("INSERT INTO users(username,passwordhash,passwordsalt,secret,secret_hash) VALUES($1,$2, $3, $4, $5)")
-		fmt.Printf("user registered; [DEBUG] \n secret: %s \n hash: %s \n\n", fmt.Sprintf("%x", announceSecret), fmt.Sprintf("%x", announceHash))
-
+		txn, err := database.Begin()
 		if err != nil {
-			return errors.New(fmt.Sprintf("Error preparing statement: %s", err.Error()))
+			return err
 		}
-
-		res, err := stmt.Exec(username, string(passwordHash), passwordSalt, announceSecret, announceHash)
+		defer txn.Rollback() // no-op once committed.
+
+		var userId int
+		err = txn.QueryRow(`INSERT INTO users(username,passwordhash,passwordsalt,secret,secret_hash,email,invited_by)
+		VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING user_id`,
+			username,
+			string(passwordHash),
+			passwordSalt,
+			announceSecret,
+			announceHash,
+			sql.NullString{String: email, Valid: email != ""},
+			invitedBy).Scan(&userId)
 
 		if err != nil {
 			return errors.New(fmt.Sprintf("Error executing statement: %s", err.Error()))
 		}
 
-		fmt.Printf("result was: %s", res) //use result to silence compiler for now.
-		return nil
+		if _, err := txn.Exec(insertUserRole, userId, ROLE_USER); err != nil {
+			return errors.New(fmt.Sprintf("Error granting the default role: %s", err.Error()))
+		}
+
+		if invite != nil {
+			claimed, err := claimInvite(txn, invite, userId)
+			if err != nil {
+				return err
+			} else if !claimed {
+				outStatus = INVITE_INVALID
+				return nil
+			}
+		}
+
+		return txn.Commit()
 	}
 
 	err := db.ExecuteFn(fn)
@@ -279,13 +448,36 @@ func CountUsers(username string) int {
 	return userCount
 }
 
-//TODO: needs to use sites base url.
+// Returns the number of registered users.
+func TotalUsers() (int, error) {
+	var total int
+	dba := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(`SELECT COUNT(*) FROM "users"`).Scan(&total)
+	}
+
+	if err := db.ExecuteFn(dba); err != nil {
+		return -1, err
+	}
+
+	return total, nil
+}
+
+// Returns the user's primary announce URL; signed with the tracker's current key.
 func (u *User) AnnounceURL() string {
-	outStr := ""
+	return torrent.AnnounceURL(u.Secret, u.SignedSecret())
+}
 
-	outStr = fmt.Sprintf("http://tracker.fatalsyntax.com:4200/%s/%s/announce", hex.EncodeToString(u.Secret), hex.EncodeToString(u.SecretHash))
+// Returns every announce URL of the user; tier by tier, starting with `AnnounceURL`
+func (u *User) AnnounceURLs() []string {
+	return torrent.AnnounceURLs(u.Secret, u.SignedSecret())
+}
 
-	return outStr
+// Signs the user's secret with the tracker's current key.
+//
+// The signature stored in `SecretHash` was made with whichever key was current
+// when the secret was issued, and stops working once that key is rotated out.
+func (u *User) SignedSecret() []byte {
+	return torrent.SignSecret(u.Secret)
 }
 
 // Takes a password and returns a hash and salt.
@@ -320,9 +512,6 @@ func genHash(password string) (string, []byte, error) {
 // to lookup the user.
 // Returns: secret, secret's hash, and any error encountered.
 func genSecret() ([]byte, []byte, error) {
-	//TODO: store shared tracker secret in configuration.
-	sharedKey := []byte("f75778f7425be4db0369d09af37a6c2b9ab3dea0e53e7bd57412e4b060e607f7")
-
 	randomSecret := make([]byte, 64)
 	n, err := rand.Read(randomSecret)
 	if err != nil {
@@ -332,8 +521,5 @@ func genSecret() ([]byte, []byte, error) {
 	}
 
 	// The secret and its hash will be sent with each tracker request
-	mac := hmac.New(sha256.New, sharedKey)
-	mac.Write(randomSecret)
-
-	return randomSecret, mac.Sum(nil), nil
+	return randomSecret, torrent.SignSecret(randomSecret), nil
 }
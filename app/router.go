@@ -5,28 +5,45 @@ import (
 
 	controllers "github.com/drbawb/babou/app/controllers"
 	filters "github.com/drbawb/babou/app/filters"
+	mailer "github.com/drbawb/babou/lib/mailer"
 	web "github.com/drbawb/babou/lib/web"
 
 	mux "github.com/gorilla/mux"
 	log "log"
 	http "net/http"
+	time "time"
+)
+
+// Requests allowed per address to the login, registration, and password forms.
+const (
+	AUTH_RATE_LIMIT  int           = 20
+	AUTH_RATE_WINDOW time.Duration = time.Minute
 )
 
 func LoadRoutes(s *Server) *mux.Router {
 	r := mux.NewRouter()
 	web.Router = r
 
+	mail, err := mailer.New(s.AppSettings.Mail)
+	if err != nil {
+		log.Fatalf("Error setting up the mailer: %s \n", err.Error())
+	}
+
 	// Shorthand for controllers
 
 	home := controllers.NewHomeController()
-	login := controllers.NewLoginController()
+	login := controllers.NewLoginController(s.AppSettings.Registration, mail, s.AppSettings.WebBaseURL)
 	torrent := controllers.NewTorrentController()
+	account := controllers.NewAccountController(s.AppSettings.PasskeyGrace, s.AppSettings.WebBaseURL)
 
 	eventChain := filters.EventChain(s.AppBridge)
 
+	// Forms which check credentials or send mail share a limit per address.
+	authLimit := filters.RateLimitChain(AUTH_RATE_LIMIT, AUTH_RATE_WINDOW)
+
 	// Handle admin routes
 	adminPanel := r.PathPrefix("/admin").Subrouter()
-	adminPanel, err := admin.LoadRoutes(adminPanel)
+	adminPanel, err = admin.LoadRoutes(adminPanel, eventChain)
 	if err != nil {
 		log.Fatalf("Error loading sub-application: /admin, because: %s \n", err.Error())
 	}
@@ -55,17 +72,82 @@ func LoadRoutes(s *Server) *mux.Router {
 	r.HandleFunc("/login",
 		filters.BuildDefaultChain().
 			Chain(filters.AuthChain(false)).
+			Chain(authLimit).
 			Resolve(login, "session")).
 		Methods("POST").
 		Name("loginSession")
 
+	// Asks for a code from the user's authenticator app; after their password.
+	r.HandleFunc("/login/2fa",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Resolve(login, "twoFactor")).
+		Methods("GET").
+		Name("loginTwoFactor")
+
+	r.HandleFunc("/login/2fa",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(authLimit).
+			Resolve(login, "verifyTwoFactor")).
+		Methods("POST").
+		Name("loginVerifyTwoFactor")
+
 	r.HandleFunc("/logout",
 		filters.BuildDefaultChain().
 			Chain(filters.AuthChain(false)).
 			Resolve(login, "logout")).
-		Methods("GET").
+		Methods("POST").
 		Name("loginDelete")
 
+	// Verifies an email address with a mailed token.
+	r.HandleFunc("/verify/{token}",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Resolve(login, "verify")).
+		Methods("GET").
+		Name("verifyEmail")
+
+	r.HandleFunc("/verify",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(authLimit).
+			Resolve(login, "resendVerification")).
+		Methods("POST").
+		Name("verifyResend")
+
+	// Mails a password reset link.
+	r.HandleFunc("/password/forgot",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Resolve(login, "forgotPassword")).
+		Methods("GET").
+		Name("passwordForgot")
+
+	r.HandleFunc("/password/forgot",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(authLimit).
+			Resolve(login, "sendPasswordReset")).
+		Methods("POST").
+		Name("passwordSendReset")
+
+	// Sets a new password with a mailed token.
+	r.HandleFunc("/password/reset/{token}",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Resolve(login, "editPassword")).
+		Methods("GET").
+		Name("passwordEdit")
+
+	r.HandleFunc("/password/reset/{token}",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(authLimit).
+			Resolve(login, "resetPassword")).
+		Methods("POST").
+		Name("passwordReset")
+
 	// Displays a registration form
 	r.HandleFunc("/register",
 		filters.BuildDefaultChain().
@@ -78,10 +160,105 @@ func LoadRoutes(s *Server) *mux.Router {
 	r.HandleFunc("/register",
 		filters.BuildDefaultChain().
 			Chain(filters.AuthChain(false)).
+			Chain(authLimit).
 			Resolve(login, "create")).
 		Methods("POST").
 		Name("loginCreate")
 
+	// Displays the user's passkey and security history.
+	r.HandleFunc("/account",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "index")).
+		Methods("GET").
+		Name("accountIndex")
+
+	// Issues the user a new passkey.
+	r.HandleFunc("/account/passkey",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "resetPasskey")).
+		Methods("POST").
+		Name("accountResetPasskey")
+
+	// Enrolls the user in two-factor authentication.
+	r.HandleFunc("/account/2fa",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "twoFactor")).
+		Methods("GET").
+		Name("accountTwoFactor")
+
+	r.HandleFunc("/account/2fa",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "enableTwoFactor")).
+		Methods("POST").
+		Name("accountEnableTwoFactor")
+
+	r.HandleFunc("/account/2fa/disable",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "disableTwoFactor")).
+		Methods("POST").
+		Name("accountDisableTwoFactor")
+
+	r.HandleFunc("/account/2fa/recovery",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "regenerateRecoveryCodes")).
+		Methods("POST").
+		Name("accountRecoveryCodes")
+
+	// Lists the browsers a user is logged in with.
+	r.HandleFunc("/account/sessions",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "sessions")).
+		Methods("GET").
+		Name("accountSessions")
+
+	r.HandleFunc("/account/sessions/revoke",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "revokeOtherSessions")).
+		Methods("POST").
+		Name("accountRevokeOtherSessions")
+
+	r.HandleFunc("/account/sessions/{id}/revoke",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "revokeSession")).
+		Methods("POST").
+		Name("accountRevokeSession")
+
+	// Displays the invites a user has sent.
+	r.HandleFunc("/account/invites",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "invites")).
+		Methods("GET").
+		Name("accountInvites")
+
+	// Sends an invite.
+	r.HandleFunc("/account/invites",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(account, "createInvite")).
+		Methods("POST").
+		Name("accountCreateInvite")
+
 	// Handle torrent routes:
 	r.HandleFunc("/torrents",
 		filters.BuildDefaultChain().
@@ -91,6 +268,15 @@ func LoadRoutes(s *Server) *mux.Router {
 		Methods("GET").
 		Name("torrentIndex")
 
+	// Searches the catalog. (See `lib/search` for the query syntax.)
+	r.HandleFunc("/torrents/search",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(torrent, "search")).
+		Methods("GET").
+		Name("torrentSearch")
+
 	// (Redirects to /torrents/tv/episodes)
 	r.HandleFunc("/torrents/tv",
 		filters.BuildDefaultChain().
@@ -132,6 +318,14 @@ func LoadRoutes(s *Server) *mux.Router {
 		Methods("POST").
 		Name("torrentCreate")
 
+	r.HandleFunc("/torrents/{torrentId:[0-9]+}",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(torrent, "show")).
+		Methods("GET").
+		Name("torrentShow")
+
 	r.HandleFunc("/torrents/download/{torrentId}",
 		filters.BuildDefaultChain().
 			Chain(filters.AuthChain(false)).
@@ -139,14 +333,78 @@ func LoadRoutes(s *Server) *mux.Router {
 		Methods("GET").
 		Name("torrentDownload")
 
+	r.HandleFunc("/torrents/magnet/{torrentId}",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Resolve(torrent, "magnet")).
+		Methods("GET").
+		Name("torrentMagnet")
+
 	r.HandleFunc("/torrents/delete/{torrentId}",
 		filters.BuildDefaultChain().
 			Chain(filters.AuthChain(false)).
 			Chain(eventChain).
 			Resolve(torrent, "delete")).
-		Methods("GET").
+		Methods("POST").
 		Name("torrentDelete")
 
+	r.HandleFunc("/torrents/disable/{torrentId}",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(torrent, "disable")).
+		Methods("POST").
+		Name("torrentDisable")
+
+	// Tags and categories; the catalog is filtered by either.
+	r.HandleFunc("/torrents/{torrentId}/tags",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(torrent, "tags")).
+		Methods("GET").
+		Name("torrentTags")
+
+	r.HandleFunc("/torrents/{torrentId}/tags",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(torrent, "addTag")).
+		Methods("POST").
+		Name("torrentAddTag")
+
+	r.HandleFunc("/torrents/{torrentId}/tags/{tagId}/{vote}",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(torrent, "voteTag")).
+		Methods("POST").
+		Name("torrentVoteTag")
+
+	r.HandleFunc("/tags",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(torrent, "tagIndex")).
+		Methods("GET").
+		Name("tagIndex")
+
+	r.HandleFunc("/tags/{tag}",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(torrent, "index")).
+		Methods("GET").
+		Name("tagTorrents")
+
+	r.HandleFunc("/categories/{category}",
+		filters.BuildDefaultChain().
+			Chain(filters.AuthChain(false)).
+			Chain(eventChain).
+			Resolve(torrent, "index")).
+		Methods("GET").
+		Name("categoryTorrents")
+
 	// Catch-All: Displays all public assets.
 	r.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/",
 		web.DisableDirectoryListing(http.FileServer(http.Dir("assets/")))))
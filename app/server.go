@@ -6,20 +6,34 @@
 package app
 
 import (
+	"github.com/drbawb/babou/app/filters"
+	"github.com/drbawb/babou/app/models"
 	"github.com/drbawb/babou/bridge"
 	libBabou "github.com/drbawb/babou/lib"
+	session "github.com/drbawb/babou/lib/session"
 
+	context "context"
 	fmt "fmt"
 	log "log"
+	sync "sync"
+	time "time"
 
 	http "net/http"
+
+	sessions "github.com/gorilla/sessions"
 )
 
+// How often expired sessions are deleted.
+const SESSION_PRUNE_INTERVAL = time.Hour
+
 // Parameters for babou's web server
 type Server struct {
 	Port int
 
 	serverIO    chan int              // Output for process monitor
+	quit        chan bool             // Closed on shutdown to stop scheduled jobs
+	quitOnce    *sync.Once            // Closes quit on the first shutdown
+	httpServer  *http.Server          // Drained on shutdown
 	AppBridge   *bridge.Bridge        // Event bridge this server can use to comm. with other trackers.
 	AppSettings *libBabou.AppSettings // Settings this server was started with
 }
@@ -32,8 +46,11 @@ func NewServer(appSettings *libBabou.AppSettings, bridge *bridge.Bridge, serverI
 	newServer.AppSettings = appSettings
 	newServer.Port = appSettings.WebPort
 	newServer.serverIO = serverIO
+	newServer.quit = make(chan bool)
+	newServer.quitOnce = &sync.Once{}
 
 	newServer.AppBridge = bridge
+	newServer.httpServer = &http.Server{Addr: fmt.Sprintf(":%d", newServer.Port)}
 
 	return newServer
 }
@@ -44,14 +61,66 @@ func NewServer(appSettings *libBabou.AppSettings, bridge *bridge.Bridge, serverI
 func (s *Server) Start() {
 	log.Printf("Babou is starting his web server on port: %d", s.Port)
 
+	session.SetTimeouts(s.AppSettings.SessionLifetime, s.AppSettings.SessionIdleTimeout)
+
+	sessionKey := s.AppSettings.SessionKey
+	if len(sessionKey) == 0 && s.AppSettings.SessionStore != libBabou.COOKIE_SESSIONS {
+		sessionKey = []byte(filters.INSECURE_SESSION_KEY)
+	}
+
+	store, err := session.New(s.AppSettings.SessionStore, sessionKey)
+	if err != nil {
+		log.Fatalf("Error setting up the session store: %s \n", err.Error())
+	}
+	filters.SetDefaultStore(store)
+
+	go s.pruneSessions(store)
+
 	go func() {
 		s.loadRoutes()
-		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", s.Port), nil))
+		if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			log.Printf("Web server stopped unexpectedly: %s", err.Error())
+			s.serverIO <- libBabou.WEB_SERVER_ERR
+		}
 	}()
 
 	s.serverIO <- libBabou.WEB_SERVER_STARTED
+}
+
+// Stops accepting requests and waits for the ones in progress to finish.
+// Gives up once the context is done; it is safe to call again.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.quitOnce.Do(func() { close(s.quit) })
 
-	// Handle signals
+	return s.httpServer.Shutdown(ctx)
+}
+
+// Deletes expired sessions every `SESSION_PRUNE_INTERVAL` until the server shuts down.
+// Stores which keep sessions in the browser have nothing to prune.
+func (s *Server) pruneSessions(store sessions.Store) {
+	timer := time.NewTicker(SESSION_PRUNE_INTERVAL)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if pruner, ok := store.(session.Pruner); ok {
+				if pruned, err := pruner.PruneExpired(); err != nil {
+					fmt.Printf("Error pruning http sessions: %s \n", err.Error())
+				} else if pruned > 0 {
+					fmt.Printf("Pruned %d expired http sessions \n", pruned)
+				}
+			}
+
+			if pruned, err := models.PruneSessions(); err != nil {
+				fmt.Printf("Error pruning user sessions: %s \n", err.Error())
+			} else if pruned > 0 {
+				fmt.Printf("Pruned %d expired user sessions \n", pruned)
+			}
+		case <-s.quit:
+			return
+		}
+	}
 }
 
 // Loads muxer from router.go from `app` package.
@@ -11,6 +11,30 @@
 */
 
 $(document).ready(function(){
+	// Collapses [or expands] everything beneath a directory of a torrent's file tree.
+	$('.file-tree').on('click', '.file-tree-toggle', function(evt) {
+		evt.preventDefault();
+
+		var collapsed = !$(this).data('collapsed');
+		$(this).data('collapsed', collapsed);
+		$(this).find('.glyphicon')
+			.toggleClass('glyphicon-folder-open', !collapsed)
+			.toggleClass('glyphicon-folder-close', collapsed);
+
+		var contents = $('.file-tree .tree-dir-' + $(this).data('dir'));
+		if (collapsed) {
+			contents.hide();
+		} else {
+			// nested directories which are still collapsed keep their contents hidden.
+			contents.show();
+			contents.find('.file-tree-toggle').each(function() {
+				if ($(this).data('collapsed')) {
+					$('.file-tree .tree-dir-' + $(this).data('dir')).hide();
+				}
+			});
+		}
+	});
+
 	// If episode-name is clicked load latest episodes.
 	var templateCache = {};
 	templateCache["search_episodes"] = Handlebars.compile($("#t-search-episodes").html());
@@ -2,12 +2,14 @@
 package main
 
 import (
+	context "context"
 	fmt "fmt"
 	os "os"
 	signal "os/signal"
 	syscall "syscall"
 
 	web "github.com/drbawb/babou/app" // The babou application: composed of a server and muxer.
+	models "github.com/drbawb/babou/app/models"
 	tracker "github.com/drbawb/babou/tracker"
 
 	bridge "github.com/drbawb/babou/bridge"
@@ -15,10 +17,10 @@ import (
 
 	libBabou "github.com/drbawb/babou/lib" // Core babou libraries
 	libDb "github.com/drbawb/babou/lib/db"
+	libStore "github.com/drbawb/babou/lib/store"
+	libTorrent "github.com/drbawb/babou/lib/torrent"
 )
 
-var bridgeIO chan bool = make(chan bool)
-
 func main() {
 	//Output welcome message:
 	fmt.Println("babou fast like veyron.")
@@ -26,61 +28,85 @@ func main() {
 	//Parse command line flags
 	appSettings := config.ReadFlags()
 
+	// Setup announce URLs and the key used to sign them.
+	libTorrent.SetAnnounce(appSettings.TrackerHost, appSettings.TrackerPort, appSettings.AnnounceTiers)
+	libTorrent.SetSource(appSettings.TorrentSource)
+	if len(appSettings.TrackerKey) == 0 {
+		fmt.Printf("WARNING: no tracker key is configured; announce URLs are signed with a PUBLIC key! \n")
+	} else if err := libTorrent.SetKeys(
+		appSettings.TrackerKey,
+		appSettings.TrackerPreviousKey,
+		appSettings.TrackerPreviousKeyUntil); err != nil {
+		panic(err.Error())
+	}
+
 	//Trap signals from the parent OS
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go trapSignals(c)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGQUIT, syscall.SIGTERM)
 
 	// Start event bridge
 	var appBridge *bridge.Bridge
-	webServerIO := make(chan int, 0)
-	trackerIO := make(chan int, 0)
+	var webServer *web.Server
+	var trackerServer *tracker.Server
+	webServerIO := make(chan int, 1)
+	trackerIO := make(chan int, 1)
+
+	// Connect to the database.
+	fmt.Printf("Opening database connection ... \n")
+	_, err := libDb.Open(appSettings)
+	if err != nil {
+		panic("database could not be opened: " + err.Error())
+	}
 
-	switch appSettings.Bridge.Transport {
-	case libBabou.LOCAL_TRANSPORT:
-		fmt.Printf("Starting event-bridge \n")
-		appBridge = bridge.NewBridge(appSettings.Bridge)
-	case libBabou.TCP_TRANSPORT:
-		fmt.Printf("Event-bridge listening on TCP \n")
-		appBridge = bridge.NewBridge(appSettings.Bridge)
-	default:
-		panic("Bridge type not impl. yet...")
+	// Open the store which keeps info dicts.
+	torrentStore, err := libStore.New(appSettings.TorrentStore, appSettings.TorrentStorePath)
+	if err != nil {
+		panic("torrent store could not be opened: " + err.Error())
+	}
+	libStore.SetDefault(torrentStore)
+
+	if appSettings.MigrateTorrentsTo != "" || appSettings.CheckTorrents {
+		os.Exit(runTorrentStoreTool(appSettings, torrentStore))
+	}
+
+	fmt.Printf("Starting event-bridge \n")
+	appBridge = bridge.NewBridge(appSettings.Bridge)
+	if appSettings.Debug {
+		appBridge.LogTraffic()
 	}
 
 	for _, peer := range appSettings.BridgePeers {
-		switch peer.Transport {
-		case libBabou.TCP_TRANSPORT:
-			fmt.Printf("Event-bridge listening on TCP \n")
-			tcpPeer := bridge.NewTCPTransport(
-				fmt.Sprintf("%s:%d", peer.Socket, peer.Port))
-
-			appBridge.AddTransport(tcpPeer)
-		default:
-			panic("Bridge type not impl. yet...")
+		if err := appBridge.AddPeer(peer); err != nil {
+			panic("event-bridge could not add peer: " + err.Error())
 		}
 	}
 
-	// Connect to the database.
-	fmt.Printf("Opening database connection ... \n")
-	_, err := libDb.Open(appSettings)
-	if err != nil {
-		panic("database could not be opened: " + err.Error())
+	// Announce this node's role(s) to the rest of the pack.
+	roles := make([]string, 0, 2)
+	if appSettings.WebStack || appSettings.FullStack {
+		roles = append(roles, bridge.ROLE_WEB)
 	}
 
+	if appSettings.TrackerStack || appSettings.FullStack {
+		roles = append(roles, bridge.ROLE_TRACKER)
+	}
+
+	appBridge.Join(roles...)
+
 	// Start instance of web-application [if applicable]
 	if appSettings.FullStack == true || appSettings.WebStack == true {
 		fmt.Printf("Starting web-server \n")
-		server := web.NewServer(appSettings, appBridge, webServerIO)
+		webServer = web.NewServer(appSettings, appBridge, webServerIO)
 
-		go server.Start()
+		go webServer.Start()
 	}
 
 	// Start instance of tracker [if applicable]
 	if appSettings.FullStack == true || appSettings.TrackerStack == true {
 		fmt.Printf("Starting tracker \n")
-		server := tracker.NewServer(appSettings, appBridge, trackerIO)
+		trackerServer = tracker.NewServer(appSettings, appBridge, trackerIO)
 
-		go server.Start()
+		go trackerServer.Start()
 	}
 
 	// Catch useless configurations.
@@ -91,37 +117,133 @@ func main() {
 		os.Exit(2)
 	}
 
-	// Poll server events indefinitely
-	// TODO: Potential deadlock if either coroutine were to terminate.
+	// Poll server events until babou is asked to stop or a server fails.
 	for {
 		select {
 		case webMessage := <-webServerIO:
-			if webMessage == libBabou.WEB_SERVER_STARTED {
+			switch webMessage {
+			case libBabou.WEB_SERVER_STARTED:
 				fmt.Println("Server has started sucessfully")
+			case libBabou.WEB_SERVER_ERR:
+				shutdown(appSettings, signals, webServer, trackerServer, appBridge)
+				os.Exit(1)
 			}
 		case trackerMessage := <-trackerIO:
-			if trackerMessage == libBabou.TRACKER_SERVER_START {
+			switch trackerMessage {
+			case libBabou.TRACKER_SERVER_START:
 				fmt.Println("Tracker has started successfully")
+			case libBabou.TRACKER_SERVER_ERR:
+				shutdown(appSettings, signals, webServer, trackerServer, appBridge)
+				os.Exit(1)
 			}
+		case _ = <-signals:
+			os.Exit(shutdown(appSettings, signals, webServer, trackerServer, appBridge))
 		}
 	}
 }
 
-func trapSignals(c chan os.Signal) {
-	for sig := range c {
-		if sig == syscall.SIGINT || sig == syscall.SIGQUIT || sig == syscall.SIGTERM {
-			// Shutdown gracefully.
-			fmt.Println("\nbabou is packing up his things ...")
-
-			//TODO: Probably block on webserver shutdown [instant]
-			fmt.Println("\nwaiting for webserver to shutdown...")
-			fmt.Println("\nwaiting for tracker to shutdown...")
-			fmt.Println("\nwaiting for event-bridge to close sockets...")
-
-			os.Exit(0)
-		} else if sig == syscall.SIGKILL {
-			// Get out get out get out!!!
-			os.Exit(2)
+// Stops the servers, then the event bridge, then the database.
+//
+// In-flight requests are drained and pending messages are delivered
+// until `AppSettings.ShutdownTimeout` has passed. A second signal
+// exits immediately. Returns the status babou should exit with.
+func shutdown(
+	appSettings *libBabou.AppSettings,
+	signals chan os.Signal,
+	webServer *web.Server,
+	trackerServer *tracker.Server,
+	appBridge *bridge.Bridge,
+) int {
+	fmt.Println("\nbabou is packing up his things ...")
+
+	go func() {
+		<-signals
+		fmt.Println("\nbabou was told to hurry; leaving his things behind!")
+		os.Exit(2)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), appSettings.ShutdownTimeout)
+	defer cancel()
+
+	status := 0
+	if webServer != nil {
+		fmt.Println("\nwaiting for webserver to shutdown...")
+		if err := webServer.Shutdown(ctx); err != nil {
+			fmt.Printf("webserver did not shutdown cleanly: %s \n", err.Error())
+			status = 1
 		}
 	}
+
+	if trackerServer != nil {
+		fmt.Println("\nwaiting for tracker to shutdown...")
+		if err := trackerServer.Shutdown(ctx); err != nil {
+			fmt.Printf("tracker did not shutdown cleanly: %s \n", err.Error())
+			status = 1
+		}
+	}
+
+	fmt.Println("\nwaiting for event-bridge to close sockets...")
+	if err := appBridge.Shutdown(ctx); err != nil {
+		fmt.Printf("event-bridge did not deliver all messages: %s \n", err.Error())
+		status = 1
+	}
+
+	if err := libDb.Close(); err != nil {
+		fmt.Printf("database did not close cleanly: %s \n", err.Error())
+		status = 1
+	}
+
+	return status
+}
+
+// Moves info dicts to another store or checks the ones which are stored.
+// Returns the process' exit status.
+func runTorrentStoreTool(settings *libBabou.AppSettings, torrentStore libStore.TorrentStore) int {
+	if settings.MigrateTorrentsTo != "" {
+		from := settings.TorrentStore
+		if from == "" {
+			from = libBabou.DATABASE_TORRENTS
+		}
+
+		if settings.MigrateTorrentsTo == from {
+			fmt.Printf("Info dicts are already kept by the %s store. \n", from)
+			return 2
+		}
+
+		to, err := libStore.New(settings.MigrateTorrentsTo, settings.TorrentStorePath)
+		if err != nil {
+			fmt.Printf("Error opening the %s store: %s \n", settings.MigrateTorrentsTo, err.Error())
+			return 1
+		}
+
+		moved, err := libStore.Migrate(torrentStore, to)
+		if err != nil {
+			fmt.Printf("Error migrating info dicts: %s \n", err.Error())
+			return 1
+		}
+
+		fmt.Printf("Moved %d info dicts to the %s store; set `torrents.store` to \"%s\" before restarting. \n",
+			moved, settings.MigrateTorrentsTo, settings.MigrateTorrentsTo)
+		torrentStore = to
+	}
+
+	if settings.CheckTorrents {
+		infoHashes, err := models.AllInfoHashes()
+		if err != nil {
+			fmt.Printf("Error listing torrents: %s \n", err.Error())
+			return 1
+		}
+
+		failed := libStore.Check(torrentStore, infoHashes)
+		for infoHash, err := range failed {
+			fmt.Printf("[%s]: %s \n", infoHash, err.Error())
+		}
+
+		fmt.Printf("Checked %d info dicts; %d failed. \n", len(infoHashes), len(failed))
+		if len(failed) > 0 {
+			return 1
+		}
+	}
+
+	return 0
 }
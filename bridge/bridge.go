@@ -1,9 +1,16 @@
 package bridge
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/drbawb/babou/lib"
 )
@@ -16,7 +23,17 @@ type pendingSubscriber struct {
 // Represents the programs bridge to send messages to the other pack members.
 // The default route will discard all messages sent through the bridge.
 type Bridge struct {
-	transports []Transport // other bridges to deliver messages to
+	transports        []Transport    // other bridges to deliver messages to
+	pendingTransports chan Transport // channel of transports waiting to be added to list
+	removedTransports chan Transport // channel of transports waiting to be detached
+	codecs            []Codec        // codecs this bridge will accept from remote senders
+
+	address    string                        // where remote bridges can reach this one [e.g: tcp://host:port]
+	listener   net.Listener                  // nil for the loopback bridge
+	peers      map[string]closeableTransport // transports to remote bridges; by address
+	peersLock  *sync.Mutex                   // protects peers and closed
+	closed     bool                          // set once the bridge has started shutting down
+	membership *Membership                   // nil until this bridge has joined the pack
 
 	inbox  chan *Packet // channel of messages to be read from other transports
 	outbox chan *Packet // channel of messages to be sent to other transports
@@ -24,7 +41,21 @@ type Bridge struct {
 	subscribers        map[string]chan<- *Message // list of subscribers (should only be read from channel)
 	pendingSubscribers chan *pendingSubscriber    // channel of subscribers waiting to be added to list
 
-	quit chan bool // send any value to gracefully shutdown the bridge.
+	stats       *bridgeStats
+	taps        map[*Tap]bool // debug subscribers (should only be read from channel)
+	pendingTaps chan *Tap
+	closedTaps  chan *Tap
+
+	sending       *sync.WaitGroup         // messages handed to transports but not yet accepted by them
+	flushRequests chan chan *flushedSends // asks the dispatcher to empty the outbox and detach remote transports
+}
+
+// The remote transports detached by a flush, and the sends handed to
+// them beforehand. Later sends are counted by a new group; so this one
+// is only waited on.
+type flushedSends struct {
+	transports []Transport
+	sending    *sync.WaitGroup
 }
 
 const (
@@ -37,24 +68,38 @@ const (
 func NewBridge(settings *lib.TransportSettings) *Bridge {
 	bridge := &Bridge{
 		transports:         make([]Transport, 0),
+		pendingTransports:  make(chan Transport),
+		removedTransports:  make(chan Transport),
+		codecs:             lookupCodecs(settings.Codecs),
+		peers:              make(map[string]closeableTransport),
+		peersLock:          &sync.Mutex{},
 		inbox:              make(chan *Packet, BRIDGE_RECV_BUFFER),
 		outbox:             make(chan *Packet, BRIDGE_SEND_BUFFER),
 		pendingSubscribers: make(chan *pendingSubscriber),
-		quit:               make(chan bool),
 		subscribers:        make(map[string]chan<- *Message),
+		stats:              newBridgeStats(),
+		taps:               make(map[*Tap]bool),
+		pendingTaps:        make(chan *Tap),
+		closedTaps:         make(chan *Tap),
+		sending:            &sync.WaitGroup{},
+		flushRequests:      make(chan chan *flushedSends),
 	}
 
 	// Implement all transport types for the default bridge.
+	// (The dispatcher is not running yet; transports are added directly.)
 	switch settings.Transport {
 	case lib.UNIX_TRANSPORT:
-		go bridge.netListen("unix", settings.Socket)
+		bridge.address = peerAddress(settings)
+
+		bridge.netListen("unix", settings.Address())
+		bridge.transports = append(bridge.transports, bridge.NewLocalTransport()) // TODO: only in full-stack.
 	case lib.TCP_TRANSPORT:
-		tcpAddr := fmt.Sprintf("%s:%d", settings.Socket, settings.Port)
+		bridge.address = peerAddress(settings)
 
-		go bridge.netListen("tcp", tcpAddr)
-		bridge.AddTransport(bridge.NewLocalTransport()) // TODO: only in full-stack.
+		bridge.netListen("tcp", settings.Address())
+		bridge.transports = append(bridge.transports, bridge.NewLocalTransport()) // TODO: only in full-stack.
 	case lib.LOCAL_TRANSPORT:
-		bridge.AddTransport(bridge.NewLocalTransport())
+		bridge.transports = append(bridge.transports, bridge.NewLocalTransport())
 	default:
 		fmt.Printf("you have selected an unimplemented bridge type. \n")
 	}
@@ -64,36 +109,237 @@ func NewBridge(settings *lib.TransportSettings) *Bridge {
 	return bridge
 }
 
-// TODO: Recover from connection failure.
+// Adds a transport which will receive every message published on this bridge.
+// Safe to call while the bridge is running.
 func (b *Bridge) AddTransport(transport Transport) {
-	b.transports = append(b.transports, transport)
+	if it, ok := transport.(instrumentedTransport); ok {
+		it.instrument(b.stats)
+	}
+
+	b.pendingTransports <- transport
+}
+
+// Detaches a transport; messages published afterwards are not handed to it.
+func (b *Bridge) removeTransport(transport Transport) {
+	b.removedTransports <- transport
+}
+
+// Connects this bridge to a remote bridge.
+// Peers are only added once; adding a known peer again does nothing.
+func (b *Bridge) AddPeer(settings *lib.TransportSettings) error {
+	address := peerAddress(settings)
+	if address == "" {
+		return errors.New("bridge: peers must be reachable over TCP or a UNIX socket")
+	}
+
+	b.peersLock.Lock()
+	defer b.peersLock.Unlock()
+
+	if b.closed {
+		return errors.New("bridge: cannot add peers while shutting down")
+	}
+
+	if _, ok := b.peers[address]; ok || address == b.address {
+		return nil
+	}
+
+	var transport closeableTransport
+	switch settings.Transport {
+	case lib.TCP_TRANSPORT:
+		transport = NewTCPTransport(settings.Address(), settings.Codecs)
+	case lib.UNIX_TRANSPORT:
+		transport = NewUnixTransport(settings.Address(), settings.Codecs)
+	}
+
+	b.AddTransport(transport)
+	b.peers[address] = transport
+	fmt.Printf("Event-bridge connected to peer: %s \n", address)
+
+	return nil
+}
+
+// Hangs up on the peer at `address` [as formatted by `peerAddress`] and forgets it;
+// so it is connected to again if it is added later. Messages which have not
+// been delivered to it are dropped.
+func (b *Bridge) RemovePeer(address string) {
+	b.peersLock.Lock()
+	transport, ok := b.peers[address]
+	delete(b.peers, address)
+	closed := b.closed
+	b.peersLock.Unlock()
+
+	// a bridge which is shutting down hangs up on its peers itself.
+	if !ok || closed {
+		return
+	}
+
+	b.removeTransport(transport)
+	transport.Close()
+	fmt.Printf("Event-bridge disconnected from peer: %s \n", address)
+}
+
+// Returns the address other bridges can use to reach this one.
+// Empty if this bridge is not listening on a socket.
+func (b *Bridge) Address() string {
+	return b.address
+}
+
+// Announces this node to the pack with the given roles [e.g: web, tracker]
+// and keeps track of the other members from then on.
+func (b *Bridge) Join(roles ...string) *Membership {
+	b.membership = newMembership(b, roles)
+	b.membership.start()
+
+	return b.membership
+}
+
+// Returns the membership view of this bridge; or nil if it has not joined the pack.
+func (b *Bridge) Membership() *Membership {
+	return b.membership
+}
+
+// Formats a transport as an address which can be shared with other nodes.
+// [e.g: tcp://localhost:5000 or unix:///tmp/babou.sock]
+func peerAddress(settings *lib.TransportSettings) string {
+	switch settings.Transport {
+	case lib.TCP_TRANSPORT:
+		return "tcp://" + settings.Address()
+	case lib.UNIX_TRANSPORT:
+		return "unix://" + settings.Address()
+	default:
+		return ""
+	}
+}
+
+// Parses an address created by `peerAddress`
+func parsePeerAddress(address string) (*lib.TransportSettings, error) {
+	parts := strings.SplitN(address, "://", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("bridge: malformed peer address: %s", address)
+	}
+
+	switch parts[0] {
+	case "tcp":
+		host, port, err := net.SplitHostPort(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		portNum, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, err
+		}
+
+		return &lib.TransportSettings{Transport: lib.TCP_TRANSPORT, Socket: host, Port: portNum}, nil
+	case "unix":
+		return &lib.TransportSettings{Transport: lib.UNIX_TRANSPORT, Socket: parts[1]}, nil
+	default:
+		return nil, fmt.Errorf("bridge: unsupported peer address: %s", address)
+	}
 }
 
 // The dispatcher routes messages as our inbox and outbox queues
 // fill up.
 //
-// In addition it serializes access to the subscriber map as
-// local peers subscribe to the event bridge.
+// In addition it serializes access to the subscriber map and the
+// list of transports as they are added to the event bridge.
 func (b *Bridge) dispatch() {
 	for {
 		select {
 		case sub := <-b.pendingSubscribers:
 			b.subscribers[sub.name] = sub.msgChan
+		case tp := <-b.pendingTransports:
+			b.transports = append(b.transports, tp)
+		case tp := <-b.removedTransports:
+			for i, attached := range b.transports {
+				if attached == tp {
+					b.transports = append(b.transports[:i], b.transports[i+1:]...)
+					break
+				}
+			}
+		case tap := <-b.pendingTaps:
+			b.taps[tap] = true
+		case tap := <-b.closedTaps:
+			if b.taps[tap] {
+				delete(b.taps, tap)
+				close(tap.events)
+			}
 		case mpack := <-b.inbox:
+			delivered := 0
 			for name, subscriber := range b.subscribers {
 				if name != mpack.SubscriberName {
 					subscriber <- mpack.Payload
+					delivered++
 				}
 			}
+
+			b.stats.count(mpack.Payload.Type.String(), "", func(c *Counters) {
+				c.Received++
+				if delivered == 0 {
+					c.Dropped++
+				}
+			})
+
+			b.tapPacket(TAP_IN, mpack)
 		case mpack := <-b.outbox:
+			b.send(mpack)
+		case reply := <-b.flushRequests:
+			for len(b.outbox) > 0 {
+				b.send(<-b.outbox)
+			}
+
+			local, remote := make([]Transport, 0), make([]Transport, 0)
 			for _, tp := range b.transports {
-				go tp.Send(mpack)
+				if _, ok := tp.(closeableTransport); ok {
+					remote = append(remote, tp)
+				} else {
+					local = append(local, tp)
+				}
 			}
+
+			b.transports = local
+			reply <- &flushedSends{transports: remote, sending: b.sending}
+			b.sending = &sync.WaitGroup{}
 		}
 	}
 }
 
-// currently only listens on unix socket.
+// Hands a packet to every transport.
+func (b *Bridge) send(mpack *Packet) {
+	for _, tp := range b.transports {
+		b.stats.count("", transportName(tp), func(c *Counters) { c.Sent++ })
+
+		sending := b.sending
+		sending.Add(1)
+		go func(tp Transport) {
+			defer sending.Done()
+			tp.Send(mpack)
+		}(tp)
+	}
+
+	b.tapPacket(TAP_OUT, mpack)
+}
+
+// Shows a packet to every attached tap.
+func (b *Bridge) tapPacket(direction string, mpack *Packet) {
+	if len(b.taps) == 0 {
+		return
+	}
+
+	event := TapEvent{
+		Time:      time.Now(),
+		Direction: direction,
+		Sender:    mpack.SubscriberName,
+		Type:      mpack.Payload.Type.String(),
+		Payload:   mpack.Payload.Payload,
+	}
+
+	for tap := range b.taps {
+		tap.offer(event)
+	}
+}
+
+// Listens for remote bridges on a TCP or UNIX socket.
 func (b *Bridge) netListen(network, addr string) {
 	l, err := net.Listen(network, addr)
 	if err != nil {
@@ -101,40 +347,84 @@ func (b *Bridge) netListen(network, addr string) {
 	}
 
 	fmt.Printf("listening on: %s \n", addr)
+	b.listener = l
+
+	go func() {
+		for {
+			fd, err := l.Accept()
+			if err != nil {
+				if !b.isClosed() {
+					fmt.Printf("error listening for packet: %s \n", err.Error())
+				}
+				break
+			}
 
-	go func(net.Listener) {
-		select {
-		case _ = <-b.quit:
-			_ = l.Close()
-			b.quit <- true
+			go b.handleConn(fd)
 		}
-	}(l)
+	}()
+}
+
+// Reads messages from a remote sender until it hangs up.
+func (b *Bridge) handleConn(fd net.Conn) {
+	defer fd.Close()
+
+	reader := bufio.NewReader(fd)
+	codec, err := acceptCodec(fd, reader, b.codecs)
+	if err == errLegacyPeer {
+		b.readLegacy(reader)
+		return
+	} else if err != nil {
+		fmt.Printf("error negotiating with peer: %s \n", err.Error())
+		return
+	}
 
 	for {
-		fd, err := l.Accept()
-		if err != nil {
-			fmt.Printf("error listening for packet: %s \n", err.Error())
-			break
+		frame, err := readFrame(reader)
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			fmt.Printf("error reading socket: %s \n", err.Error())
+			return
 		}
 
-		msgBuf := make([]byte, 1024)
-		n, err := fd.Read(msgBuf[:])
+		msg, err := codec.Decode(frame)
 		if err != nil {
-			fmt.Printf("error reading socket: %s \n", err.Error())
+			fmt.Printf("error decoding message: %s \n", err.Error())
+			b.stats.count(UNKNOWN_MESSAGE_NAME, b.address, func(c *Counters) { c.DecodeErrors++ })
+			continue
 		}
 
-		fmt.Printf("read %d bytes from socket \n", n)
+		b.stats.count("", b.address, func(c *Counters) { c.Received++ })
+		b.inbox <- &Packet{SubscriberName: "foreign", Payload: msg}
+	}
+}
+
+// Reads the single gob-encoded message sent by a node which predates negotiation.
+func (b *Bridge) readLegacy(reader *bufio.Reader) {
+	msgBuf := make([]byte, 1024)
+	n, err := reader.Read(msgBuf[:])
+	if err != nil {
+		fmt.Printf("error reading socket: %s \n", err.Error())
+	}
 
-		// gob decode message and stuff it into foreign packet
-		packet := &Packet{}
+	fmt.Printf("read %d bytes from socket \n", n)
 
-		msgBuf = msgBuf[0:n]
-		decodedMessage := decodeMsg(bytes.NewBuffer(msgBuf))
-		packet.SubscriberName = "foreign"
-		packet.Payload = &decodedMessage
+	// gob decode message and stuff it into foreign packet
+	packet := &Packet{}
 
-		b.inbox <- packet // send blocked receiver a message
+	msgBuf = msgBuf[0:n]
+	decodedMessage, err := codecRegistry[CODEC_GOB].Decode(msgBuf)
+	if err != nil {
+		fmt.Printf("error decoding message... %s", err.Error())
+		b.stats.count(UNKNOWN_MESSAGE_NAME, b.address, func(c *Counters) { c.DecodeErrors++ })
+		return
 	}
+
+	b.stats.count("", b.address, func(c *Counters) { c.Received++ })
+	packet.SubscriberName = "foreign"
+	packet.Payload = decodedMessage
+
+	b.inbox <- packet // send blocked receiver a message
 }
 
 // Sends a message on a channel.
@@ -151,6 +441,8 @@ func (b *Bridge) Publish(name string, msg *Message) {
 	mpack.SubscriberName = name
 	mpack.Payload = msg
 
+	b.stats.count(msg.Type.String(), "", func(c *Counters) { c.Sent++ })
+
 	b.outbox <- mpack // place packet in our queue of outgoing messages.
 }
 
@@ -181,6 +473,68 @@ func (b *Bridge) Subscribe(name string, c chan<- *Message) {
 	b.pendingSubscribers <- ps
 }
 
-func (b *Bridge) Close() chan bool {
-	return b.quit
+// Shuts the bridge down once its outbox has been delivered.
+//
+// The node leaves the pack, queued messages are handed to the transports,
+// remote transports finish writing what they were given, and the listener is closed.
+// Messages published after this are only delivered locally.
+//
+// Stops waiting for the transports when the context is done.
+func (b *Bridge) Shutdown(ctx context.Context) error {
+	b.peersLock.Lock()
+	if b.closed {
+		b.peersLock.Unlock()
+		return nil
+	}
+
+	b.closed = true
+	b.peersLock.Unlock()
+
+	if b.membership != nil {
+		b.membership.Leave()
+	}
+
+	defer func() {
+		if b.listener != nil {
+			b.listener.Close()
+		}
+	}()
+
+	reply := make(chan *flushedSends, 1)
+	select {
+	case b.flushRequests <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var sends *flushedSends
+	select {
+	case sends = <-reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	flushed := make(chan bool)
+	go func() {
+		sends.sending.Wait()
+		for _, tp := range sends.transports {
+			tp.(closeableTransport).Close()
+		}
+
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Bridge) isClosed() bool {
+	b.peersLock.Lock()
+	defer b.peersLock.Unlock()
+
+	return b.closed
 }
@@ -3,25 +3,190 @@ package bridge
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
 )
 
-func encodeMsg(msg Message) []byte {
+// A codec turns messages into bytes for a remote transport and back again.
+//
+// Codecs are negotiated per connection (see `negotiate.go`) so that a cluster
+// can run a mix of node versions during an upgrade. Every codec is identified
+// by a name which includes its schema version; e.g: `json/1`.
+//
+// Compatibility rules for codecs which carry a schema version:
+//   - Adding a field to a payload does not change the version. Readers
+//     ignore fields they do not know about, and missing fields are zero-valued.
+//   - Renaming, removing, or changing the type or meaning of a field requires
+//     a new version. Nodes should keep offering the old version until every
+//     node in the cluster understands the new one.
+//   - Message types are named on the wire. A message type unknown to the reader
+//     is reported as an error and dropped; it does not break the connection.
+type Codec interface {
+	Name() string
+
+	Encode(msg *Message) ([]byte, error)
+	Decode(data []byte) (*Message, error)
+}
+
+const (
+	CODEC_GOB  string = "gob"    // Go-only; the original format. Breaks when payload structs change.
+	CODEC_JSON string = "json/1" // Language neutral; schema version 1.
+
+	JSON_SCHEMA_VERSION int = 1
+)
+
+// Codecs offered when a bridge or transport has not been configured with any.
+// Listed in order of preference.
+var DEFAULT_CODECS = []string{CODEC_JSON, CODEC_GOB}
+
+var codecRegistry = map[string]Codec{
+	CODEC_GOB:  &GobCodec{},
+	CODEC_JSON: &JSONCodec{Version: JSON_SCHEMA_VERSION},
+}
+
+var ErrUnknownMessageType = errors.New("bridge: unknown message type")
+
+// Makes a codec available to bridges and transports by name.
+// This should be called from an `init()` function.
+func RegisterCodec(codec Codec) {
+	codecRegistry[codec.Name()] = codec
+}
+
+// Resolves a list of codec names in order of preference.
+// Unknown codecs are skipped; an empty list resolves to the `DEFAULT_CODECS`
+func lookupCodecs(names []string) []Codec {
+	if len(names) == 0 {
+		names = DEFAULT_CODECS
+	}
+
+	codecs := make([]Codec, 0, len(names))
+	for _, name := range names {
+		if codec, ok := codecRegistry[name]; ok {
+			codecs = append(codecs, codec)
+		} else {
+			fmt.Printf("bridge: ignoring unknown codec [%s] \n", name)
+		}
+	}
+
+	return codecs
+}
+
+// Encodes messages using `encoding/gob`
+// This is only understood by other `babou` nodes built from the same message structs.
+type GobCodec struct{}
+
+func (gc *GobCodec) Name() string { return CODEC_GOB }
+
+func (gc *GobCodec) Encode(msg *Message) ([]byte, error) {
 	buf := bytes.NewBuffer(make([]byte, 0))
 	encoder := gob.NewEncoder(buf)
 
-	encoder.Encode(msg)
+	if err := encoder.Encode(*msg); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gc *GobCodec) Decode(data []byte) (*Message, error) {
+	decoder := gob.NewDecoder(bytes.NewBuffer(data))
+	msg := &Message{}
+
+	if err := decoder.Decode(msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// Encodes messages as a versioned JSON envelope:
+//
+//	{"v": 1, "type": "delete_torrent", "payload": {"info_hash": "...", "reason": "..."}}
+//
+// Suitable for tools which are not written in Go.
+type JSONCodec struct {
+	Version int
+}
+
+type jsonEnvelope struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func (jc *JSONCodec) Name() string { return fmt.Sprintf("json/%d", jc.Version) }
+
+func (jc *JSONCodec) Encode(msg *Message) ([]byte, error) {
+	name, ok := messageNames[msg.Type]
+	if !ok {
+		return nil, ErrUnknownMessageType
+	}
+
+	envelope := &jsonEnvelope{Version: jc.Version, Type: name}
+	if msg.Payload != nil {
+		payload, err := json.Marshal(msg.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		envelope.Payload = payload
+	}
+
+	return json.Marshal(envelope)
+}
+
+func (jc *JSONCodec) Decode(data []byte) (*Message, error) {
+	envelope := &jsonEnvelope{}
+	if err := json.Unmarshal(data, envelope); err != nil {
+		return nil, err
+	}
+
+	if envelope.Version != jc.Version {
+		return nil, fmt.Errorf("bridge: cannot read json/%d message with %s codec",
+			envelope.Version, jc.Name())
+	}
+
+	msgType, ok := messageTypeNamed(envelope.Type)
+	if !ok {
+		return nil, ErrUnknownMessageType
+	}
+
+	msg := &Message{Type: msgType}
+	newPayload, hasPayload := payloadTypes[msgType]
+	if !hasPayload || len(envelope.Payload) == 0 {
+		return msg, nil
+	}
+
+	// Payloads travel by value; decode into a pointer and dereference it.
+	payload := newPayload()
+	if err := json.Unmarshal(envelope.Payload, payload); err != nil {
+		return nil, err
+	}
+
+	msg.Payload = reflect.ValueOf(payload).Elem().Interface()
+
+	return msg, nil
+}
+
+// Encodes a message for nodes which predate codec negotiation.
+func encodeMsg(msg Message) []byte {
+	encoded, err := codecRegistry[CODEC_GOB].Encode(&msg)
+	if err != nil {
+		fmt.Printf("error encoding message... %s", err.Error())
+	}
 
-	return buf.Bytes()
+	return encoded
 }
 
+// Decodes a message from nodes which predate codec negotiation.
 func decodeMsg(encodedMessage *bytes.Buffer) Message {
-	decoder := gob.NewDecoder(encodedMessage)
-	msg := Message{}
-	err := decoder.Decode(&msg)
+	msg, err := codecRegistry[CODEC_GOB].Decode(encodedMessage.Bytes())
 	if err != nil {
 		fmt.Printf("error decoding message... %s", err.Error())
+		return Message{}
 	}
 
-	return msg
+	return *msg
 }
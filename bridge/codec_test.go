@@ -3,6 +3,7 @@ package bridge
 import (
 	"bytes"
 	"testing"
+	"time"
 )
 
 // Note: if you're testing over a local bridge
@@ -21,6 +22,10 @@ func TestEncodeDecodeAreEquivalent(test *testing.T) {
 		&Message{
 			Type:    TORRENT_STAT_TUPLE,
 			Payload: TorrentStatMessage{}},
+		DisableUser(42, "abcd", "hit and run"),
+		UpdateUserKey(42, "abcd", time.Time{}),
+		DeleteTorrent("deadbeef", "dupe"),
+		DisableTorrent("deadbeef", "no logs"),
 	}
 
 	bytesBuf := bytes.NewBuffer(make([]byte, 0, 1024))
@@ -47,6 +52,63 @@ func TestEncodeDecodeAreEquivalent(test *testing.T) {
 
 }
 
+// Tests that every message type survives the JSON codec with its payload intact.
+func TestJSONCodecRoundTrip(test *testing.T) {
+	codec := codecRegistry[CODEC_JSON]
+	messages := []*Message{
+		DeleteUser(42, "abcd"),
+		DisableUser(42, "abcd", "hit and run"),
+		UpdateUserKey(42, "abcd", time.Time{}),
+		UpdateUserKey(42, "abcd", time.Unix(1382600000, 0).UTC()),
+		DeleteTorrent("deadbeef", "dupe"),
+		DisableTorrent("deadbeef", "no logs"),
+		TorrentStats("deadbeef", 3, 4),
+		&Message{Type: WATCH_USERS},
+	}
+
+	for _, testCase := range messages {
+		encoded, err := codec.Encode(testCase)
+		if err != nil {
+			test.Fatalf("Could not encode %v: %s", testCase.Type, err.Error())
+		}
+
+		received, err := codec.Decode(encoded)
+		if err != nil {
+			test.Fatalf("Could not decode %s: %s", encoded, err.Error())
+		}
+
+		if received.Type != testCase.Type || received.Payload != testCase.Payload {
+			test.Errorf("Received msg[%v] does not match original msg[%v]", received, testCase)
+		}
+	}
+}
+
+// Tests the compatibility rules of a versioned codec.
+func TestJSONCodecCompatibility(test *testing.T) {
+	codec := codecRegistry[CODEC_JSON]
+
+	// Fields added by a newer node are ignored.
+	newer := `{"v":1,"type":"delete_torrent","payload":{"info_hash":"deadbeef","reason":"dupe","staff":"bob"}}`
+	received, err := codec.Decode([]byte(newer))
+	if err != nil {
+		test.Fatalf("Unknown field should have been ignored: %s", err.Error())
+	}
+
+	if received.Payload != (DeleteTorrentMessage{InfoHash: "deadbeef", Reason: "dupe"}) {
+		test.Errorf("Payload was not decoded: %v", received.Payload)
+	}
+
+	// Another schema version is refused.
+	if _, err := codec.Decode([]byte(`{"v":2,"type":"delete_torrent"}`)); err == nil {
+		test.Error("Message from another schema version should not be decoded.")
+	}
+
+	// Unknown message types are refused.
+	if _, err := codec.Decode([]byte(`{"v":1,"type":"launch_missiles"}`)); err != ErrUnknownMessageType {
+		test.Errorf("Expected an unknown message type; got: %v", err)
+	}
+}
+
 // Time how long it takes to create & send a message.
 func BenchmarkEncoder(bench *testing.B) {
 	bench.ResetTimer()
@@ -0,0 +1,289 @@
+package bridge
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	MEMBERSHIP_NAME string = "membership"
+
+	HEARTBEAT_INTERVAL     = 10 * time.Second
+	HEARTBEAT_MISSED_LIMIT = 3
+
+	ROLE_WEB     string = "web"
+	ROLE_TRACKER string = "tracker"
+)
+
+// A node as seen by this bridge.
+type Member struct {
+	NodeId  string
+	Roles   []string
+	Address string // empty if the node cannot be reached directly.
+
+	LastSeen time.Time
+	Alive    bool
+}
+
+func (m *Member) HasRole(role string) bool {
+	for _, r := range m.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Membership tracks the other nodes in the pack.
+//
+// Each node publishes a heartbeat naming its roles, the address of its bridge,
+// and the addresses of the other live nodes it knows about. A node which misses
+// `HEARTBEAT_MISSED_LIMIT` heartbeats in a row is dead: it is forgotten and the
+// local bridge hangs up on it, until it is heard from again.
+//
+// Addresses learned from heartbeats are added as peers of the local bridge, so
+// a new node only needs to be configured with the address of one existing member.
+type Membership struct {
+	Interval    time.Duration // how often this node announces itself
+	MissedLimit int           // heartbeats a member may miss before it is marked dead
+
+	self   NodeMessage
+	bridge *Bridge
+
+	members     map[string]*Member
+	membersLock *sync.RWMutex
+
+	quit      chan bool
+	leaveOnce *sync.Once // leaving twice neither closes quit again nor repeats the announcement
+}
+
+func newMembership(bridge *Bridge, roles []string) *Membership {
+	return &Membership{
+		Interval:    HEARTBEAT_INTERVAL,
+		MissedLimit: HEARTBEAT_MISSED_LIMIT,
+
+		self: NodeMessage{
+			NodeId:  newNodeId(),
+			Roles:   roles,
+			Address: bridge.Address(),
+		},
+		bridge: bridge,
+
+		members:     make(map[string]*Member),
+		membersLock: &sync.RWMutex{},
+
+		quit:      make(chan bool),
+		leaveOnce: &sync.Once{},
+	}
+}
+
+// Generates a random identifier for this node.
+func newNodeId() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// Returns the identifier this node announces itself with.
+func (ms *Membership) NodeId() string {
+	return ms.self.NodeId
+}
+
+func (ms *Membership) start() {
+	inbox := make(chan *Message, BRIDGE_RECV_BUFFER)
+	ms.bridge.Subscribe(MEMBERSHIP_NAME, inbox)
+
+	go ms.receive(inbox)
+	go ms.heartbeat()
+}
+
+// Announces this node immediately and then once every interval.
+// Members which have not been heard from are swept on each tick.
+func (ms *Membership) heartbeat() {
+	ms.announce()
+
+	ticker := time.NewTicker(ms.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ms.announce()
+			ms.sweep(time.Now())
+		case <-ms.quit:
+			return
+		}
+	}
+}
+
+func (ms *Membership) announce() {
+	node := ms.self
+	node.Peers = ms.liveAddresses()
+
+	ms.bridge.Publish(MEMBERSHIP_NAME, &Message{Type: NODE_HEARTBEAT, Payload: node})
+}
+
+// Tells the pack this node is going away and stops sending heartbeats.
+// It is safe to call again.
+func (ms *Membership) Leave() {
+	ms.leaveOnce.Do(func() {
+		close(ms.quit)
+		ms.bridge.Publish(MEMBERSHIP_NAME, &Message{Type: NODE_LEAVE, Payload: ms.self})
+	})
+}
+
+func (ms *Membership) receive(inbox <-chan *Message) {
+	for msg := range inbox {
+		node, ok := msg.Payload.(NodeMessage)
+		if !ok || node.NodeId == ms.self.NodeId {
+			continue
+		}
+
+		switch msg.Type {
+		case NODE_HEARTBEAT:
+			ms.seen(node, time.Now())
+			go ms.discover(node)
+		case NODE_LEAVE:
+			ms.left(node)
+		}
+	}
+}
+
+func (ms *Membership) seen(node NodeMessage, at time.Time) {
+	ms.membersLock.Lock()
+	defer ms.membersLock.Unlock()
+
+	member, ok := ms.members[node.NodeId]
+	if !ok {
+		member = &Member{NodeId: node.NodeId}
+		ms.members[node.NodeId] = member
+	}
+
+	if !member.Alive {
+		fmt.Printf("Node [%s] %v joined the pack at %s \n", node.NodeId, node.Roles, node.Address)
+	}
+
+	member.Roles = node.Roles
+	member.Address = node.Address
+	member.LastSeen = at
+	member.Alive = true
+}
+
+func (ms *Membership) left(node NodeMessage) {
+	ms.membersLock.Lock()
+	member, ok := ms.members[node.NodeId]
+	if ok {
+		fmt.Printf("Node [%s] left the pack \n", node.NodeId)
+		delete(ms.members, node.NodeId)
+	}
+	ms.membersLock.Unlock()
+
+	if ok {
+		ms.forget(member)
+	}
+}
+
+// Forgets members which have missed too many heartbeats.
+func (ms *Membership) sweep(now time.Time) {
+	dead := make([]*Member, 0)
+
+	ms.membersLock.Lock()
+	deadline := now.Add(-ms.Interval * time.Duration(ms.MissedLimit))
+	for nodeId, member := range ms.members {
+		if member.LastSeen.Before(deadline) {
+			fmt.Printf("Node [%s] missed %d heartbeats; marking it dead \n", member.NodeId, ms.MissedLimit)
+			delete(ms.members, nodeId)
+			dead = append(dead, member)
+		}
+	}
+	ms.membersLock.Unlock()
+
+	for _, member := range dead {
+		ms.forget(member)
+	}
+}
+
+// Hangs up on a member which is no longer in the pack; it is connected to
+// again if it rejoins. (Runs outside the receive loop, as `discover` does.)
+func (ms *Membership) forget(member *Member) {
+	if member.Address != "" && member.Address != ms.self.Address {
+		go ms.bridge.RemovePeer(member.Address)
+	}
+}
+
+// Connects to a node and the peers it knows about.
+// (Runs outside the receive loop: adding a transport waits on the bridge's dispatcher.)
+func (ms *Membership) discover(node NodeMessage) {
+	addresses := append([]string{node.Address}, node.Peers...)
+
+	for _, address := range addresses {
+		if address == "" || address == ms.self.Address {
+			continue
+		}
+
+		settings, err := parsePeerAddress(address)
+		if err != nil {
+			fmt.Printf("Ignoring peer from node [%s]: %s \n", node.NodeId, err.Error())
+			continue
+		}
+
+		if err := ms.bridge.AddPeer(settings); err != nil {
+			fmt.Printf("Could not connect to peer [%s]: %s \n", address, err.Error())
+		}
+	}
+}
+
+func (ms *Membership) liveAddresses() []string {
+	ms.membersLock.RLock()
+	defer ms.membersLock.RUnlock()
+
+	addresses := make([]string, 0, len(ms.members))
+	for _, member := range ms.members {
+		if member.Alive && member.Address != "" {
+			addresses = append(addresses, member.Address)
+		}
+	}
+
+	return addresses
+}
+
+// Returns a copy of every node in the pack; ordered by node id.
+func (ms *Membership) Members() []Member {
+	ms.membersLock.RLock()
+	defer ms.membersLock.RUnlock()
+
+	members := make([]Member, 0, len(ms.members))
+	for _, member := range ms.members {
+		members = append(members, *member)
+	}
+
+	sort.Sort(byNodeId(members))
+
+	return members
+}
+
+// Returns the live members which have the given role.
+func (ms *Membership) Live(role string) []Member {
+	live := make([]Member, 0)
+	for _, member := range ms.Members() {
+		if member.Alive && member.HasRole(role) {
+			live = append(live, member)
+		}
+	}
+
+	return live
+}
+
+type byNodeId []Member
+
+func (a byNodeId) Len() int           { return len(a) }
+func (a byNodeId) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byNodeId) Less(i, j int) bool { return a[i].NodeId < a[j].NodeId }
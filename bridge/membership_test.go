@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drbawb/babou/lib"
+)
+
+func newTestMembership() *Membership {
+	bridge := NewBridge(&lib.TransportSettings{Transport: lib.LOCAL_TRANSPORT})
+	return newMembership(bridge, []string{ROLE_WEB})
+}
+
+// Tests that a member is alive until it misses too many heartbeats.
+func TestMembershipSweep(test *testing.T) {
+	ms := newTestMembership()
+	start := time.Now()
+
+	ms.seen(NodeMessage{NodeId: "tracker-1", Roles: []string{ROLE_TRACKER}}, start)
+	ms.seen(NodeMessage{NodeId: "web-1", Roles: []string{ROLE_WEB}}, start)
+
+	ms.sweep(start.Add(ms.Interval))
+	if live := ms.Live(ROLE_TRACKER); len(live) != 1 || live[0].NodeId != "tracker-1" {
+		test.Fatalf("Expected tracker-1 to be the only live tracker; got %v", live)
+	}
+
+	ms.sweep(start.Add(ms.Interval * time.Duration(ms.MissedLimit+1)))
+	if live := ms.Live(ROLE_TRACKER); len(live) != 0 {
+		test.Errorf("Expected no live trackers after missed heartbeats; got %v", live)
+	}
+
+	if members := ms.Members(); len(members) != 0 {
+		test.Errorf("Expected dead members to be forgotten; got %v", members)
+	}
+}
+
+// Tests that a member which leaves is dead until it is heard from again.
+func TestMembershipLeave(test *testing.T) {
+	ms := newTestMembership()
+	node := NodeMessage{NodeId: "tracker-1", Roles: []string{ROLE_TRACKER}}
+
+	ms.seen(node, time.Now())
+	ms.left(node)
+	if live := ms.Live(ROLE_TRACKER); len(live) != 0 {
+		test.Fatalf("Expected tracker to be dead after leaving; got %v", live)
+	}
+
+	ms.seen(node, time.Now())
+	if live := ms.Live(ROLE_TRACKER); len(live) != 1 {
+		test.Errorf("Expected tracker to be alive after rejoining; got %v", live)
+	}
+}
+
+// Tests that leaving the pack twice does not panic.
+func TestMembershipLeaveTwice(test *testing.T) {
+	bridge := NewBridge(&lib.TransportSettings{Transport: lib.LOCAL_TRANSPORT})
+	ms := bridge.Join(ROLE_WEB)
+
+	ms.Leave()
+	ms.Leave()
+}
+
+// Tests that heartbeats published on the bridge are picked up by a joined node,
+// and that a node does not list itself as a member.
+func TestMembershipHeartbeat(test *testing.T) {
+	bridge := NewBridge(&lib.TransportSettings{Transport: lib.LOCAL_TRANSPORT})
+	ms := bridge.Join(ROLE_WEB)
+	defer ms.Leave()
+
+	bridge.Publish("foreign", &Message{
+		Type:    NODE_HEARTBEAT,
+		Payload: NodeMessage{NodeId: "tracker-1", Roles: []string{ROLE_TRACKER}},
+	})
+
+	deadline := time.Now().Add(1 * time.Second)
+	for len(ms.Live(ROLE_TRACKER)) == 0 {
+		if time.Now().After(deadline) {
+			test.Fatalf("Tracker heartbeat was never received")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, member := range ms.Members() {
+		if member.NodeId == ms.NodeId() {
+			test.Errorf("Node should not be a member of its own view of the pack")
+		}
+	}
+}
+
+// Tests that advertised addresses can be turned back into transport settings.
+func TestPeerAddressRoundTrip(test *testing.T) {
+	settings := []*lib.TransportSettings{
+		&lib.TransportSettings{Transport: lib.TCP_TRANSPORT, Socket: "localhost", Port: 5000},
+		&lib.TransportSettings{Transport: lib.UNIX_TRANSPORT, Socket: "/tmp/babou.sock"},
+	}
+
+	for _, expected := range settings {
+		parsed, err := parsePeerAddress(peerAddress(expected))
+		if err != nil {
+			test.Fatalf("Could not parse %s: %s", peerAddress(expected), err.Error())
+		}
+
+		if parsed.Transport != expected.Transport || parsed.Address() != expected.Address() {
+			test.Errorf("Expected %s; got %s", peerAddress(expected), peerAddress(parsed))
+		}
+	}
+
+	if _, err := parsePeerAddress("lo://"); err == nil {
+		test.Errorf("Expected loopback addresses to be rejected")
+	}
+}
+
+// Tests that the bridge hangs up on a peer once it dies, and connects to it
+// again when it rejoins at the same address.
+func TestMembershipPeerRejoins(test *testing.T) {
+	dir, err := ioutil.TempDir("", "babou-bridge")
+	if err != nil {
+		test.Fatalf("Could not create socket dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	remote := NewBridge(&lib.TransportSettings{
+		Transport: lib.UNIX_TRANSPORT,
+		Socket:    filepath.Join(dir, "remote.sock"),
+	})
+	received := make(chan *Message, 10)
+	remote.Subscribe("test", received)
+
+	local := NewBridge(&lib.TransportSettings{Transport: lib.LOCAL_TRANSPORT})
+	ms := newMembership(local, []string{ROLE_WEB})
+
+	node := NodeMessage{NodeId: "tracker-1", Roles: []string{ROLE_TRACKER}, Address: remote.Address()}
+	hasPeer := func() bool {
+		local.peersLock.Lock()
+		defer local.peersLock.Unlock()
+
+		_, ok := local.peers[remote.Address()]
+		return ok
+	}
+
+	start := time.Now()
+	ms.seen(node, start)
+	ms.discover(node)
+	if !hasPeer() {
+		test.Fatalf("Expected the live member to be a peer")
+	}
+
+	ms.sweep(start.Add(ms.Interval * time.Duration(ms.MissedLimit+1)))
+	waitForRemoval(test, hasPeer)
+	if members := ms.Members(); len(members) != 0 {
+		test.Errorf("Expected the dead member to be forgotten; got %v", members)
+	}
+
+	ms.seen(node, time.Now())
+	ms.discover(node)
+	if !hasPeer() {
+		test.Fatalf("Expected the member to be a peer again after rejoining")
+	}
+
+	local.Publish("sender", DeleteTorrent("abcd", "dupe"))
+	select {
+	case msg := <-received:
+		if msg.Type != DELETE_TORRENT {
+			test.Errorf("Expected delete_torrent; got %s", msg.Type)
+		}
+	case <-time.After(1 * time.Second):
+		test.Fatalf("Message was not delivered to the rejoined peer")
+	}
+}
+
+// Polls until the bridge has hung up on the peer.
+func waitForRemoval(test *testing.T, hasPeer func() bool) {
+	deadline := time.Now().Add(1 * time.Second)
+	for hasPeer() {
+		if time.Now().After(deadline) {
+			test.Fatalf("Timed out waiting for the peer to be removed")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
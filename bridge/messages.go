@@ -5,6 +5,8 @@ package bridge
 
 import (
 	"encoding/gob"
+	"fmt"
+	"time"
 )
 
 type MessageType uint8
@@ -24,8 +26,59 @@ const (
 	DISABLE_TORRENT
 
 	TORRENT_STAT_TUPLE
+
+	NODE_HEARTBEAT
+	NODE_LEAVE
 )
 
+// Stable names for each message type.
+// These are used on the wire by codecs which are not tied to Go (see `JSONCodec`)
+// so that the numbering of the constants above is free to change.
+var messageNames = map[MessageType]string{
+	UPDATE_USER_KEY:    "update_user_key",
+	CHANGE_USER_TOKEN:  "change_user_token",
+	WATCH_USERS:        "watch_users",
+	DELETE_USER:        "delete_user",
+	DISABLE_USER:       "disable_user",
+	DELETE_TORRENT:     "delete_torrent",
+	DISABLE_TORRENT:    "disable_torrent",
+	TORRENT_STAT_TUPLE: "torrent_stats",
+	NODE_HEARTBEAT:     "node_heartbeat",
+	NODE_LEAVE:         "node_leave",
+}
+
+// Returns a new (pointer to a) zero payload for each message type
+// that carries one. Used by codecs to decode a payload into the right type.
+var payloadTypes = map[MessageType]func() interface{}{
+	UPDATE_USER_KEY:    func() interface{} { return &UserKeyMessage{} },
+	DELETE_USER:        func() interface{} { return &DeleteUserMessage{} },
+	DISABLE_USER:       func() interface{} { return &DisableUserMessage{} },
+	DELETE_TORRENT:     func() interface{} { return &DeleteTorrentMessage{} },
+	DISABLE_TORRENT:    func() interface{} { return &DisableTorrentMessage{} },
+	TORRENT_STAT_TUPLE: func() interface{} { return &TorrentStatMessage{} },
+	NODE_HEARTBEAT:     func() interface{} { return &NodeMessage{} },
+	NODE_LEAVE:         func() interface{} { return &NodeMessage{} },
+}
+
+func (mt MessageType) String() string {
+	if name, ok := messageNames[mt]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown(%d)", uint8(mt))
+}
+
+// Looks up a message type by its wire name.
+func messageTypeNamed(name string) (MessageType, bool) {
+	for mt, mtName := range messageNames {
+		if mtName == name {
+			return mt, true
+		}
+	}
+
+	return 0, false
+}
+
 type Packet struct {
 	SubscriberName string
 	Payload        *Message
@@ -34,8 +87,12 @@ type Packet struct {
 func init() {
 	gob.Register(Message{})
 	gob.Register(DeleteUserMessage{})
+	gob.Register(DisableUserMessage{})
+	gob.Register(UserKeyMessage{})
 	gob.Register(DeleteTorrentMessage{})
+	gob.Register(DisableTorrentMessage{})
 	gob.Register(TorrentStatMessage{})
+	gob.Register(NodeMessage{})
 
 }
 
@@ -45,19 +102,57 @@ type Message struct {
 	Payload interface{}
 }
 
+// Payloads are always sent by value; this is how `gob` will
+// hand them back to a receiver on a remote transport.
+//
+// User messages carry the user's secret [hex-encoded] since that
+// is how a tracker identifies the peers belonging to a user.
 type DeleteUserMessage struct {
-	UserId int
+	UserId int    `json:"user_id"`
+	Secret string `json:"secret"`
+}
+
+type DisableUserMessage struct {
+	UserId int    `json:"user_id"`
+	Secret string `json:"secret"`
+	Reason string `json:"reason"`
+}
+
+// Sent when a user's announce secret has been replaced.
+// The old secret must no longer be accepted by any tracker.
+type UserKeyMessage struct {
+	UserId     int       `json:"user_id"`
+	OldSecret  string    `json:"old_secret"`
+	GraceUntil time.Time `json:"grace_until"` // zero if the old secret was revoked immediately.
 }
 
 type DeleteTorrentMessage struct {
-	InfoHash string
-	Reason   string
+	InfoHash string `json:"info_hash"`
+	Reason   string `json:"reason"`
 }
 
+type DisableTorrentMessage struct {
+	InfoHash string `json:"info_hash"`
+	Reason   string `json:"reason"`
+}
+
+// The size of a torrent's swarm after an announce.
+// (Snatches are counted by the tracker itself; see `models.RecordSnatch`)
 type TorrentStatMessage struct {
-	InfoHash string
-	Seeding  int
-	Leeching int
+	InfoHash string `json:"info_hash"`
+	Seeding  int    `json:"seeding"`
+	Leeching int    `json:"leeching"`
+}
+
+// Announces a node to the rest of the pack.
+//
+// Address is where the node's bridge can be reached [e.g: tcp://host:port]
+// and Peers lists the addresses of the other live nodes it knows about.
+type NodeMessage struct {
+	NodeId  string   `json:"node_id"`
+	Roles   []string `json:"roles"`
+	Address string   `json:"address"`
+	Peers   []string `json:"peers"`
 }
 
 // Creates a torrent-stat tuple
@@ -66,7 +161,7 @@ func TorrentStats(
 	seeding,
 	leeching int) *Message {
 
-	payload := &TorrentStatMessage{
+	payload := TorrentStatMessage{
 		InfoHash: infoHash,
 		Seeding:  seeding,
 		Leeching: leeching,
@@ -78,17 +173,42 @@ func TorrentStats(
 }
 
 // Instructs trackers to remove a user from their cache ASAP
-func DeleteUser(userId int) {
-	wrapper := Message{Type: DELETE_USER}
-	payload := DeleteUserMessage{UserId: userId}
+func DeleteUser(userId int, secret string) *Message {
+	payload := DeleteUserMessage{UserId: userId, Secret: secret}
+	wrapper := &Message{Type: DELETE_USER, Payload: payload}
 
-	wrapper.Payload = payload
+	return wrapper
+}
+
+// Instructs trackers to stop serving a user who has been banned.
+func DisableUser(userId int, secret, reason string) *Message {
+	payload := DisableUserMessage{UserId: userId, Secret: secret, Reason: reason}
+	wrapper := &Message{Type: DISABLE_USER, Payload: payload}
+
+	return wrapper
+}
+
+// Instructs trackers to stop accepting a user's previous secret
+// once its grace period has ended. (Immediately if `graceUntil` is zero.)
+func UpdateUserKey(userId int, oldSecret string, graceUntil time.Time) *Message {
+	payload := UserKeyMessage{UserId: userId, OldSecret: oldSecret, GraceUntil: graceUntil}
+	wrapper := &Message{Type: UPDATE_USER_KEY, Payload: payload}
+
+	return wrapper
 }
 
 // Instructs trackers to remove a torrent from their cache ASAP
-func DeleteTorrent(torrentHash string) {
-	wrapper := Message{Type: DELETE_TORRENT}
-	payload := DeleteTorrentMessage{InfoHash: torrentHash}
+func DeleteTorrent(torrentHash, reason string) *Message {
+	payload := DeleteTorrentMessage{InfoHash: torrentHash, Reason: reason}
+	wrapper := &Message{Type: DELETE_TORRENT, Payload: payload}
+
+	return wrapper
+}
 
-	wrapper.Payload = payload
+// Instructs trackers to stop serving a torrent that has been disabled.
+func DisableTorrent(torrentHash, reason string) *Message {
+	payload := DisableTorrentMessage{InfoHash: torrentHash, Reason: reason}
+	wrapper := &Message{Type: DISABLE_TORRENT, Payload: payload}
+
+	return wrapper
 }
@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Wire protocol for stream (TCP, UNIX) transports:
+//
+// The sender opens a connection and offers the codecs it can write,
+// in order of preference:
+//
+//	BABOU/1 json/1 gob\n
+//
+// The listener answers with the first offered codec it can read:
+//
+//	OK json/1\n
+//
+// or `ERR <reason>\n` before closing the connection. Every message that follows
+// is a frame: a 4-byte big-endian length followed by that many bytes of encoded message.
+//
+// Nodes which predate negotiation write a single gob-encoded message per connection.
+// A listener recognizes them by the missing handshake, and a sender falls back to
+// that format if the listener does not answer the handshake in time.
+const (
+	HANDSHAKE_MAGIC string = "BABOU/1"
+
+	NEGOTIATE_TIMEOUT = 2 * time.Second
+	MAX_FRAME_SIZE    = 1 << 20
+)
+
+var errLegacyPeer = errors.New("bridge: peer does not support codec negotiation")
+
+// Offers codecs to a listener and returns the one it selected.
+// Returns `errLegacyPeer` if the listener never answered.
+func negotiateCodec(conn net.Conn, reader *bufio.Reader, offered []Codec) (Codec, error) {
+	conn.SetDeadline(time.Now().Add(NEGOTIATE_TIMEOUT))
+	defer conn.SetDeadline(time.Time{})
+
+	names := make([]string, 0, len(offered))
+	for _, codec := range offered {
+		names = append(names, codec.Name())
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s %s\n", HANDSHAKE_MAGIC, strings.Join(names, " ")); err != nil {
+		return nil, err
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, errLegacyPeer
+		}
+
+		return nil, err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 2 && fields[0] == "OK" {
+		for _, codec := range offered {
+			if codec.Name() == fields[1] {
+				return codec, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("bridge: negotiation refused: %s", strings.TrimSpace(line))
+}
+
+// Answers a sender's handshake with the first offered codec that is supported.
+// Returns `errLegacyPeer` if the sender did not start with a handshake; in which
+// case nothing has been consumed from the reader.
+func acceptCodec(conn net.Conn, reader *bufio.Reader, supported []Codec) (Codec, error) {
+	conn.SetDeadline(time.Now().Add(NEGOTIATE_TIMEOUT))
+	defer conn.SetDeadline(time.Time{})
+
+	magic, err := reader.Peek(len(HANDSHAKE_MAGIC))
+	if err != nil && len(magic) == 0 {
+		return nil, err
+	} else if string(magic) != HANDSHAKE_MAGIC {
+		return nil, errLegacyPeer
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range strings.Fields(line)[1:] {
+		for _, codec := range supported {
+			if codec.Name() == name {
+				_, err := fmt.Fprintf(conn, "OK %s\n", name)
+				return codec, err
+			}
+		}
+	}
+
+	fmt.Fprintf(conn, "ERR no common codec\n")
+	return nil, fmt.Errorf("bridge: no common codec in [%s]", strings.TrimSpace(line))
+}
+
+// Writes a length-prefixed message.
+func writeFrame(w io.Writer, body []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(body))); err != nil {
+		return err
+	}
+
+	_, err := w.Write(body)
+	return err
+}
+
+// Reads a length-prefixed message.
+func readFrame(r io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	if length > MAX_FRAME_SIZE {
+		return nil, fmt.Errorf("bridge: frame of %d bytes exceeds limit", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
@@ -0,0 +1,112 @@
+package bridge
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+// Runs the listener's half of a handshake over an in-memory connection.
+func acceptOverPipe(supported []Codec) (net.Conn, chan Codec) {
+	client, server := net.Pipe()
+	accepted := make(chan Codec, 1)
+
+	go func() {
+		codec, _ := acceptCodec(server, bufio.NewReader(server), supported)
+		accepted <- codec
+	}()
+
+	return client, accepted
+}
+
+// Tests that both sides agree on the sender's most preferred codec that the listener supports.
+func TestNegotiationPicksSharedCodec(test *testing.T) {
+	client, accepted := acceptOverPipe(lookupCodecs([]string{CODEC_GOB}))
+	defer client.Close()
+
+	codec, err := negotiateCodec(client, bufio.NewReader(client), lookupCodecs(nil))
+	if err != nil {
+		test.Fatalf("Negotiation failed: %s", err.Error())
+	}
+
+	if codec.Name() != CODEC_GOB || (<-accepted).Name() != CODEC_GOB {
+		test.Errorf("Expected both sides to use %s; sender chose %s", CODEC_GOB, codec.Name())
+	}
+}
+
+// Tests that negotiation fails when there is no codec in common.
+func TestNegotiationWithoutSharedCodec(test *testing.T) {
+	client, accepted := acceptOverPipe(lookupCodecs([]string{CODEC_GOB}))
+	defer client.Close()
+
+	if _, err := negotiateCodec(client, bufio.NewReader(client), lookupCodecs([]string{CODEC_JSON})); err == nil {
+		test.Error("Negotiation should have been refused.")
+	}
+
+	if <-accepted != nil {
+		test.Error("Listener should not have accepted a codec.")
+	}
+}
+
+// Tests that a listener hands a sender which predates negotiation to the legacy reader.
+func TestListenerDetectsLegacySender(test *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go client.Write(encodeMsg(*DeleteTorrent("deadbeef", "dupe")))
+
+	reader := bufio.NewReader(server)
+	if _, err := acceptCodec(server, reader, lookupCodecs(nil)); err != errLegacyPeer {
+		test.Fatalf("Expected a legacy sender; got: %v", err)
+	}
+
+	// Nothing should have been consumed from the legacy message.
+	bridge := &Bridge{inbox: make(chan *Packet, 1)}
+	bridge.readLegacy(reader)
+
+	packet := <-bridge.inbox
+	if packet.Payload.Payload != (DeleteTorrentMessage{InfoHash: "deadbeef", Reason: "dupe"}) {
+		test.Errorf("Legacy message was not decoded: %v", packet.Payload)
+	}
+}
+
+// Tests that a sender falls back to the legacy format when the listener
+// does not answer the handshake.
+func TestSenderFallsBackToLegacyListener(test *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Fatalf("Could not listen: %s", err.Error())
+	}
+	defer l.Close()
+
+	// Legacy listener: reads one message per connection and never replies.
+	received := make(chan []byte, 2)
+	go func() {
+		for {
+			fd, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			msgBuf := make([]byte, 1024)
+			n, _ := fd.Read(msgBuf)
+			received <- msgBuf[:n]
+		}
+	}()
+
+	transport := newStreamTransport("tcp", l.Addr().String(), nil)
+	if err := transport.deliver(DeleteUser(42, "abcd")); err != nil {
+		test.Fatalf("Delivery failed: %s", err.Error())
+	}
+
+	<-received // the handshake
+	select {
+	case msgBuf := <-received:
+		if _, err := codecRegistry[CODEC_GOB].Decode(msgBuf); err != nil {
+			test.Errorf("Legacy listener could not read the message: %s", err.Error())
+		}
+	case <-time.After(NEGOTIATE_TIMEOUT):
+		test.Error("Message was never delivered in the legacy format.")
+	}
+}
@@ -0,0 +1,89 @@
+package bridge
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drbawb/babou/lib"
+)
+
+// Tests that messages queued before shutdown reach a remote bridge,
+// and that a bridge which is shutting down refuses new peers.
+func TestShutdownFlushesOutbox(test *testing.T) {
+	dir, err := ioutil.TempDir("", "babou-bridge")
+	if err != nil {
+		test.Fatalf("Could not create socket dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	remoteSettings := &lib.TransportSettings{
+		Transport: lib.UNIX_TRANSPORT,
+		Socket:    filepath.Join(dir, "remote.sock"),
+	}
+
+	remote := NewBridge(remoteSettings)
+	received := make(chan *Message, 1)
+	remote.Subscribe("test", received)
+
+	sender := NewBridge(&lib.TransportSettings{Transport: lib.LOCAL_TRANSPORT})
+	if err := sender.AddPeer(remoteSettings); err != nil {
+		test.Fatalf("Could not add peer: %s", err.Error())
+	}
+
+	sender.Publish("test", DeleteTorrent("abcd", "dupe"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := sender.Shutdown(ctx); err != nil {
+		test.Fatalf("Shutdown did not finish: %s", err.Error())
+	}
+
+	select {
+	case msg := <-received:
+		if msg.Type != DELETE_TORRENT {
+			test.Errorf("Expected delete_torrent; got %s", msg.Type)
+		}
+	case <-time.After(1 * time.Second):
+		test.Fatalf("Message queued before shutdown was never delivered")
+	}
+
+	if err := sender.AddPeer(remoteSettings); err == nil {
+		test.Errorf("Expected peers to be refused after shutdown")
+	}
+
+	remote.Shutdown(ctx)
+}
+
+// Tests that messages published while the bridge shuts down are still
+// delivered locally; run with -race to catch sends counted during the wait.
+func TestPublishDuringShutdown(test *testing.T) {
+	b := NewBridge(&lib.TransportSettings{Transport: lib.LOCAL_TRANSPORT})
+	received := make(chan *Message, 100)
+	b.Subscribe("test", received)
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 50; i++ {
+			b.Publish("sender", DeleteTorrent("abcd", "dupe"))
+		}
+		close(done)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := b.Shutdown(ctx); err != nil {
+		test.Fatalf("Shutdown did not finish: %s", err.Error())
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		test.Fatalf("Publishing blocked after shutdown")
+	}
+}
@@ -0,0 +1,142 @@
+package bridge
+
+import (
+	"sort"
+	"sync"
+)
+
+// Counts messages as they pass through a bridge.
+//
+// Sent: published on this bridge [per message type], or handed to a transport [per transport].
+// Received: delivered to this bridge's inbox [per message type], or read from a listener [per transport].
+// Dropped: received with no subscriber to deliver it to, or not delivered by a transport.
+// DecodeErrors: could not be read from a remote bridge.
+type Counters struct {
+	Sent         uint64
+	Received     uint64
+	Dropped      uint64
+	DecodeErrors uint64
+}
+
+// A point-in-time copy of a bridge's counters and queues.
+type Stats struct {
+	InboxDepth     int
+	InboxCapacity  int
+	OutboxDepth    int
+	OutboxCapacity int
+
+	Messages   []NamedCounters // ordered by name
+	Transports []NamedCounters // ordered by name
+}
+
+type NamedCounters struct {
+	Name string
+	Counters
+}
+
+// Message type used for messages which could not be decoded far enough
+// to learn their type.
+const UNKNOWN_MESSAGE_NAME string = "unknown"
+
+type bridgeStats struct {
+	lock *sync.Mutex
+
+	messages   map[string]*Counters
+	transports map[string]*Counters
+}
+
+func newBridgeStats() *bridgeStats {
+	return &bridgeStats{
+		lock:       &sync.Mutex{},
+		messages:   make(map[string]*Counters),
+		transports: make(map[string]*Counters),
+	}
+}
+
+// Applies `fn` to the counters of a message type and (optionally) a transport.
+// An empty transport name only updates the message type.
+func (bs *bridgeStats) count(msgType, transport string, fn func(*Counters)) {
+	if bs == nil {
+		return
+	}
+
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	if msgType != "" {
+		fn(counterFor(bs.messages, msgType))
+	}
+
+	if transport != "" {
+		fn(counterFor(bs.transports, transport))
+	}
+}
+
+func counterFor(counters map[string]*Counters, name string) *Counters {
+	c, ok := counters[name]
+	if !ok {
+		c = &Counters{}
+		counters[name] = c
+	}
+
+	return c
+}
+
+func (bs *bridgeStats) snapshot() ([]NamedCounters, []NamedCounters) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	return sortedCounters(bs.messages), sortedCounters(bs.transports)
+}
+
+func sortedCounters(counters map[string]*Counters) []NamedCounters {
+	named := make([]NamedCounters, 0, len(counters))
+	for name, c := range counters {
+		named = append(named, NamedCounters{Name: name, Counters: *c})
+	}
+
+	sort.Sort(byCounterName(named))
+
+	return named
+}
+
+type byCounterName []NamedCounters
+
+func (a byCounterName) Len() int           { return len(a) }
+func (a byCounterName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byCounterName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+// Returns the bridge's counters and the current depth of its queues.
+func (b *Bridge) Stats() *Stats {
+	messages, transports := b.stats.snapshot()
+
+	return &Stats{
+		InboxDepth:     len(b.inbox),
+		InboxCapacity:  cap(b.inbox),
+		OutboxDepth:    len(b.outbox),
+		OutboxCapacity: cap(b.outbox),
+
+		Messages:   messages,
+		Transports: transports,
+	}
+}
+
+// Transports which report the outcome of each delivery to the bridge.
+type instrumentedTransport interface {
+	Transport
+	instrument(stats *bridgeStats)
+}
+
+// Returns a name for a transport suitable for the bridge's counters.
+func transportName(tp Transport) string {
+	switch t := tp.(type) {
+	case *LocalTransport:
+		return "local"
+	case *TCPTransport:
+		return "tcp://" + t.socketAddr
+	case *UnixTransport:
+		return "unix://" + t.socketAddr
+	default:
+		return "other"
+	}
+}
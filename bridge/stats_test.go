@@ -0,0 +1,75 @@
+package bridge
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drbawb/babou/lib"
+)
+
+func findCounters(counters []NamedCounters, name string) Counters {
+	for _, c := range counters {
+		if c.Name == name {
+			return c.Counters
+		}
+	}
+
+	return Counters{}
+}
+
+// Tests that messages are counted by type and transport, and that
+// messages nobody subscribed to are counted as dropped.
+func TestBridgeCounters(test *testing.T) {
+	bridge := NewBridge(&lib.TransportSettings{Transport: lib.LOCAL_TRANSPORT})
+	tap := bridge.Tap(10)
+	defer tap.Close()
+
+	bridge.Publish("test", DeleteTorrent("abcd", "dupe"))
+
+	// the tap sees the message leave and come back through the loopback.
+	for _, direction := range []string{TAP_OUT, TAP_IN} {
+		select {
+		case event := <-tap.Events():
+			if event.Direction != direction || event.Type != "delete_torrent" {
+				test.Fatalf("Expected %s delete_torrent; got %s", direction, event)
+			}
+		case <-time.After(1 * time.Second):
+			test.Fatalf("Tap did not see the message go %s", direction)
+		}
+	}
+
+	stats := bridge.Stats()
+	expected := Counters{Sent: 1, Received: 1, Dropped: 1}
+	if actual := findCounters(stats.Messages, "delete_torrent"); actual != expected {
+		test.Errorf("Expected %+v; got %+v", expected, actual)
+	}
+
+	if actual := findCounters(stats.Transports, "local"); actual.Sent != 1 {
+		test.Errorf("Expected one message handed to the loopback; got %+v", actual)
+	}
+
+	if stats.OutboxCapacity != BRIDGE_SEND_BUFFER {
+		test.Errorf("Expected outbox capacity of %d; got %d", BRIDGE_SEND_BUFFER, stats.OutboxCapacity)
+	}
+}
+
+// Tests that a recorder keeps only the most recent events, newest first.
+func TestRecorderRing(test *testing.T) {
+	recorder := &Recorder{
+		tap:    &Tap{events: make(chan TapEvent, 5)},
+		lock:   &sync.RWMutex{},
+		events: make([]TapEvent, 3),
+	}
+
+	for _, sender := range []string{"a", "b", "c", "d"} {
+		recorder.tap.events <- TapEvent{Sender: sender}
+	}
+	close(recorder.tap.events)
+	recorder.record()
+
+	recent := recorder.Recent()
+	if len(recent) != 3 || recent[0].Sender != "d" || recent[2].Sender != "b" {
+		test.Errorf("Expected events d, c, b; got %v", recent)
+	}
+}
@@ -0,0 +1,156 @@
+package bridge
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	TAP_IN  string = "in"  // a message delivered to this bridge's subscribers
+	TAP_OUT string = "out" // a message published on this bridge
+)
+
+// A message as seen by a tap.
+type TapEvent struct {
+	Time      time.Time
+	Direction string // TAP_IN or TAP_OUT
+	Sender    string // name of the subscriber which published the message; "foreign" if remote.
+	Type      string
+	Payload   interface{}
+}
+
+func (te TapEvent) String() string {
+	return fmt.Sprintf("%s [%s] %s from %s: %+v",
+		te.Time.Format(time.RFC3339), te.Direction, te.Type, te.Sender, te.Payload)
+}
+
+// A debugging subscriber which sees all traffic through a bridge.
+//
+// Unlike a subscriber a tap never slows the bridge down: if its buffer
+// is full the event is discarded and counted as missed.
+type Tap struct {
+	bridge *Bridge
+	events chan TapEvent
+
+	missedLock *sync.Mutex
+	missed     uint64
+}
+
+// Attaches a tap to the bridge which buffers up to `buffer` events.
+func (b *Bridge) Tap(buffer int) *Tap {
+	tap := &Tap{
+		bridge:     b,
+		events:     make(chan TapEvent, buffer),
+		missedLock: &sync.Mutex{},
+	}
+
+	b.pendingTaps <- tap
+
+	return tap
+}
+
+// Events seen by the tap. Closed once the tap has been detached.
+func (t *Tap) Events() <-chan TapEvent {
+	return t.events
+}
+
+// Number of events discarded because the tap was not drained in time.
+func (t *Tap) Missed() uint64 {
+	t.missedLock.Lock()
+	defer t.missedLock.Unlock()
+
+	return t.missed
+}
+
+// Detaches the tap from the bridge.
+func (t *Tap) Close() {
+	t.bridge.closedTaps <- t
+}
+
+// Called by the dispatcher; must not block.
+func (t *Tap) offer(event TapEvent) {
+	select {
+	case t.events <- event:
+	default:
+		t.missedLock.Lock()
+		t.missed++
+		t.missedLock.Unlock()
+	}
+}
+
+// Prints all traffic through the bridge to stdout.
+func (b *Bridge) LogTraffic() {
+	tap := b.Tap(BRIDGE_RECV_BUFFER)
+
+	go func() {
+		for event := range tap.Events() {
+			fmt.Printf("[bridge] %s \n", event)
+		}
+	}()
+}
+
+// Keeps the most recent events seen by a tap.
+type Recorder struct {
+	tap *Tap
+
+	lock   *sync.RWMutex
+	events []TapEvent // ring buffer
+	next   int
+	full   bool
+}
+
+// Records the last `size` messages through the bridge.
+func (b *Bridge) Record(size int) *Recorder {
+	if size < 1 {
+		size = 1
+	}
+
+	recorder := &Recorder{
+		tap:    b.Tap(BRIDGE_RECV_BUFFER),
+		lock:   &sync.RWMutex{},
+		events: make([]TapEvent, size),
+	}
+
+	go recorder.record()
+
+	return recorder
+}
+
+func (r *Recorder) record() {
+	for event := range r.tap.Events() {
+		r.lock.Lock()
+		r.events[r.next] = event
+		r.next = (r.next + 1) % len(r.events)
+		r.full = r.full || r.next == 0
+		r.lock.Unlock()
+	}
+}
+
+// Returns the recorded events; most recent first.
+func (r *Recorder) Recent() []TapEvent {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	count := r.next
+	if r.full {
+		count = len(r.events)
+	}
+
+	recent := make([]TapEvent, 0, count)
+	for i := 1; i <= count; i++ {
+		recent = append(recent, r.events[(r.next-i+len(r.events))%len(r.events)])
+	}
+
+	return recent
+}
+
+// Number of events the recorder missed because it fell behind.
+func (r *Recorder) Missed() uint64 {
+	return r.tap.Missed()
+}
+
+// Stops recording.
+func (r *Recorder) Close() {
+	r.tap.Close()
+}
@@ -1,7 +1,10 @@
 package bridge
 
 import (
+	"bufio"
 	"fmt"
+	"sync"
+	"time"
 
 	"net"
 )
@@ -12,20 +15,49 @@ const (
 	TRANSPORT_NOT_AVAILABLE TransportError = iota
 )
 
+// How long a sender talks to a peer in the legacy format before
+// trying to negotiate again. (The peer may have been upgraded.)
+const LEGACY_RECHECK = 1 * time.Minute
+
 type Transport interface {
 	Send(msg *Packet) // Sends a message to the specified socket
 }
 
-type UnixTransport struct {
+// Transports which hold a connection open between messages.
+// Close delivers any message already accepted by Send and then hangs up;
+// messages sent afterwards are dropped. Closing twice has no effect.
+type closeableTransport interface {
+	Transport
+	Close()
+}
+
+// Delivers messages to a remote bridge over a stream socket.
+// The connection is kept open between messages and its codec is negotiated
+// whenever it is (re)opened.
+type streamTransport struct {
+	network    string
 	socketAddr string
 
-	queue chan *Packet // TODO: could repurpose as send buffer in future.
+	codecs []Codec       // codecs offered to the peer, in order of preference
+	queue  chan *Packet  // TODO: could repurpose as send buffer in future.
+	conn   net.Conn      // nil until the first message is sent
+	reader *bufio.Reader // reads the peer's handshake replies
+	codec  Codec         // negotiated for the current connection
+
+	legacyUntil time.Time // peer predates negotiation; use raw gob until then
+
+	stats    *bridgeStats // counts failed deliveries; nil until added to a bridge.
+	stop     chan bool    // closed to stop accepting messages
+	stopOnce *sync.Once
+	done     chan bool // closed once the queue has stopped and the connection is closed
 }
 
-type TCPTransport struct {
-	socketAddr string
+type UnixTransport struct {
+	*streamTransport
+}
 
-	queue chan *Packet // TODO: could repurpose as send buffer in future.
+type TCPTransport struct {
+	*streamTransport
 }
 
 type LocalTransport struct {
@@ -45,62 +77,140 @@ func (lt *LocalTransport) Send(msg *Packet) {
 	lt.queue <- msg
 }
 
-func NewUnixTransport(socketAddr string) *UnixTransport {
-	transport := &UnixTransport{socketAddr: socketAddr, queue: make(chan *Packet)}
+// Creates a transport to the bridge listening at `socketAddr`
+// The codecs are offered in order; an empty list uses the `DEFAULT_CODECS`
+func NewUnixTransport(socketAddr string, codecs []string) *UnixTransport {
+	return &UnixTransport{newStreamTransport("unix", socketAddr, codecs)}
+}
+
+// Creates a transport to the bridge listening at `socketAddr` [host:port]
+// The codecs are offered in order; an empty list uses the `DEFAULT_CODECS`
+func NewTCPTransport(socketAddr string, codecs []string) *TCPTransport {
+	return &TCPTransport{newStreamTransport("tcp", socketAddr, codecs)}
+}
+
+func newStreamTransport(network, socketAddr string, codecs []string) *streamTransport {
+	transport := &streamTransport{
+		network:    network,
+		socketAddr: socketAddr,
+		codecs:     lookupCodecs(codecs),
+		queue:      make(chan *Packet),
+		stop:       make(chan bool),
+		stopOnce:   &sync.Once{},
+		done:       make(chan bool),
+	}
+
 	go transport.processQueue()
 
 	return transport
 }
 
-func (ut *UnixTransport) Send(msg *Packet) {
-	ut.queue <- msg
+func (st *streamTransport) Send(msg *Packet) {
+	select {
+	case st.queue <- msg:
+	case <-st.stop:
+		st.stats.count(msg.Payload.Type.String(), st.network+"://"+st.socketAddr,
+			func(c *Counters) { c.Dropped++ })
+	}
 }
 
-func (ut *UnixTransport) processQueue() {
+func (st *streamTransport) processQueue() {
 	for {
 		select {
-		case msg := <-ut.queue:
-			c, err := net.Dial("unix", ut.socketAddr)
-			if err != nil {
-				fmt.Printf("Trouble calling peer[%s]: %s", ut.socketAddr, err.Error())
-				continue
-			}
+		case msg := <-st.queue:
+			if err := st.deliver(msg.Payload); err != nil {
+				fmt.Printf("Trouble sending payload to peer[%s]: %s \n", st.socketAddr, err.Error())
 
-			defer c.Close()
-			_, err = c.Write(encodeMsg(*msg.Payload))
-			if err != nil {
-				fmt.Printf("Trouble sending payload to peer[%s]: %s", ut.socketAddr, err.Error())
+				st.stats.count(msg.Payload.Type.String(), st.network+"://"+st.socketAddr,
+					func(c *Counters) { c.Dropped++ })
 			}
+		case <-st.stop:
+			st.disconnect()
+			close(st.done)
+			return
 		}
 	}
 }
 
-func NewTCPTransport(socketAddr string) *TCPTransport {
-	transport := &TCPTransport{socketAddr: socketAddr, queue: make(chan *Packet)}
-	go transport.processQueue()
-
-	return transport
+func (st *streamTransport) Close() {
+	st.stopOnce.Do(func() { close(st.stop) })
+	<-st.done
 }
 
-func (tcp *TCPTransport) Send(msg *Packet) {
-	tcp.queue <- msg
+func (st *streamTransport) instrument(stats *bridgeStats) {
+	st.stats = stats
 }
 
-func (tcp *TCPTransport) processQueue() {
-	for {
-		select {
-		case msg := <-tcp.queue:
-			c, err := net.Dial("tcp", tcp.socketAddr)
-			if err != nil {
-				fmt.Printf("Trouble calling peer[%s]: %s", tcp.socketAddr, err.Error())
-				continue
-			}
+// Writes a message on the current connection; opening a new one if needed.
+// A broken connection is retried once on a fresh connection.
+func (st *streamTransport) deliver(msg *Message) error {
+	if time.Now().Before(st.legacyUntil) {
+		return st.deliverLegacy(msg)
+	}
 
-			defer c.Close()
-			_, err = c.Write(encodeMsg(*msg.Payload))
-			if err != nil {
-				fmt.Printf("Trouble sending payload to peer[%s]: %s", tcp.socketAddr, err.Error())
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if st.conn == nil {
+			if err = st.connect(); err == errLegacyPeer {
+				st.legacyUntil = time.Now().Add(LEGACY_RECHECK)
+				return st.deliverLegacy(msg)
+			} else if err != nil {
+				return err
 			}
 		}
+
+		var body []byte
+		if body, err = st.codec.Encode(msg); err != nil {
+			return err // won't get any better on a new connection.
+		}
+
+		st.conn.SetWriteDeadline(time.Now().Add(NEGOTIATE_TIMEOUT))
+		if err = writeFrame(st.conn, body); err == nil {
+			return nil
+		}
+
+		st.disconnect()
+	}
+
+	return err
+}
+
+// Dials the peer and negotiates a codec.
+func (st *streamTransport) connect() error {
+	conn, err := net.DialTimeout(st.network, st.socketAddr, NEGOTIATE_TIMEOUT)
+	if err != nil {
+		return err
 	}
+
+	reader := bufio.NewReader(conn)
+	codec, err := negotiateCodec(conn, reader, st.codecs)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	st.conn, st.reader, st.codec = conn, reader, codec
+
+	return nil
+}
+
+func (st *streamTransport) disconnect() {
+	if st.conn != nil {
+		st.conn.Close()
+	}
+
+	st.conn, st.reader, st.codec = nil, nil, nil
+}
+
+// Sends a single gob-encoded message on its own connection.
+// This is the only format understood by nodes which predate negotiation.
+func (st *streamTransport) deliverLegacy(msg *Message) error {
+	c, err := net.DialTimeout(st.network, st.socketAddr, NEGOTIATE_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = c.Write(encodeMsg(*msg))
+	return err
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Banned users and disabled torrents are kept around for the staff's records;
+// the tracker simply refuses to serve them.
+var sqlUp string = `
+	ALTER TABLE users
+	ADD COLUMN is_banned boolean NOT NULL DEFAULT false;
+
+	ALTER TABLE torrents
+	ADD COLUMN is_disabled boolean NOT NULL DEFAULT false;
+`
+
+var sqlDown string = `
+	ALTER TABLE users
+	DROP COLUMN is_banned;
+
+	ALTER TABLE torrents
+	DROP COLUMN is_disabled;
+`
+
+// Up is executed when this migration is applied
+func Up_20131021183012(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131021183012(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
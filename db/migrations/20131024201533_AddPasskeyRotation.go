@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// A user's previous secret stays valid until `previous_secret_expires`
+// so they have time to download their .torrent files again.
+//
+// Security events are an append-only history of changes to a user's credentials.
+var sqlUp string = `
+	ALTER TABLE users
+	ADD COLUMN previous_secret bytea,
+	ADD COLUMN previous_secret_expires timestamp;
+
+	CREATE TABLE security_events (
+		event_id serial PRIMARY KEY,
+		user_id integer NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		action varchar(64) NOT NULL,
+		detail text,
+		remote_addr varchar(64),
+		created_at timestamp NOT NULL DEFAULT now()
+	);
+
+	CREATE INDEX security_events_user_id_idx ON security_events(user_id);
+`
+
+var sqlDown string = `
+	DROP TABLE security_events;
+
+	ALTER TABLE users
+	DROP COLUMN previous_secret,
+	DROP COLUMN previous_secret_expires;
+`
+
+// Up is executed when this migration is applied
+func Up_20131024201533(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131024201533(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Users are granted permissions through their roles.
+// The catalog of permissions is kept in sync with `app/models/role.go`
+//
+// Every existing user is given the `user` role; administrators
+// are given the `admin` role which replaces the `is_admin` flag.
+var sqlUp string = `
+	CREATE TABLE roles (
+		role_id serial PRIMARY KEY,
+		name varchar(64) NOT NULL UNIQUE,
+		description text
+	);
+
+	CREATE TABLE permissions (
+		permission_id serial PRIMARY KEY,
+		name varchar(64) NOT NULL UNIQUE,
+		description text
+	);
+
+	CREATE TABLE role_permissions (
+		role_id integer NOT NULL REFERENCES roles(role_id) ON DELETE CASCADE,
+		permission_id integer NOT NULL REFERENCES permissions(permission_id) ON DELETE CASCADE,
+		PRIMARY KEY (role_id, permission_id)
+	);
+
+	CREATE TABLE user_roles (
+		user_id integer NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		role_id integer NOT NULL REFERENCES roles(role_id) ON DELETE CASCADE,
+		PRIMARY KEY (user_id, role_id)
+	);
+
+	INSERT INTO roles(name, description) VALUES
+		('user', 'Can browse and download torrents.'),
+		('uploader', 'Can upload torrents.'),
+		('moderator', 'Can disable or delete any torrent and view peers.'),
+		('admin', 'Can do anything.');
+
+	INSERT INTO permissions(name, description) VALUES
+		('browse', 'View the torrent listings.'),
+		('download', 'Download .torrent files.'),
+		('upload', 'Upload new torrents.'),
+		('moderate-torrents', 'Disable any torrent.'),
+		('delete-any-torrent', 'Delete any torrent.'),
+		('view-peers', 'See the peers of a torrent.'),
+		('admin-panel', 'Open the administration panel.'),
+		('manage-users', 'Ban, delete, and reset the passkeys of users.'),
+		('manage-roles', 'Grant and revoke roles.'),
+		('view-cluster', 'See the nodes and traffic of the event bridge.');
+
+	INSERT INTO role_permissions(role_id, permission_id)
+	SELECT r.role_id, p.permission_id FROM roles r, permissions p
+	WHERE (r.name = 'user' AND p.name IN ('browse', 'download'))
+	OR (r.name = 'uploader' AND p.name IN ('browse', 'download', 'upload'))
+	OR (r.name = 'moderator' AND p.name IN
+		('browse', 'download', 'upload', 'moderate-torrents', 'delete-any-torrent', 'view-peers', 'admin-panel'))
+	OR (r.name = 'admin');
+
+	INSERT INTO user_roles(user_id, role_id)
+	SELECT u.user_id, r.role_id FROM users u, roles r
+	WHERE r.name = 'user' OR (r.name = 'admin' AND u.is_admin);
+
+	ALTER TABLE users
+	DROP COLUMN is_admin;
+`
+
+var sqlDown string = `
+	ALTER TABLE users
+	ADD COLUMN is_admin boolean DEFAULT false;
+
+	UPDATE users SET is_admin = true
+	WHERE user_id IN (SELECT ur.user_id FROM user_roles ur
+		JOIN roles r ON r.role_id = ur.role_id
+		WHERE r.name = 'admin');
+
+	DROP TABLE user_roles;
+	DROP TABLE role_permissions;
+	DROP TABLE permissions;
+	DROP TABLE roles;
+`
+
+// Up is executed when this migration is applied
+func Up_20131026150210(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131026150210(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Users spend their `invites` to send an invite code to an email address.
+// Each user remembers who invited them; this forms the invite tree.
+var sqlUp string = `
+	ALTER TABLE users
+	ADD COLUMN invites integer NOT NULL DEFAULT 0,
+	ADD COLUMN invited_by integer REFERENCES users(user_id) ON DELETE SET NULL;
+
+	CREATE INDEX users_invited_by_idx ON users(invited_by);
+
+	CREATE TABLE invites (
+		invite_id serial PRIMARY KEY,
+		code varchar(64) NOT NULL UNIQUE,
+		email varchar(255) NOT NULL,
+		inviter_id integer NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		invitee_id integer REFERENCES users(user_id) ON DELETE SET NULL,
+		created_at timestamp NOT NULL DEFAULT now(),
+		expires_at timestamp NOT NULL,
+		used_at timestamp
+	);
+
+	CREATE INDEX invites_inviter_id_idx ON invites(inviter_id);
+`
+
+var sqlDown string = `
+	DROP TABLE invites;
+
+	ALTER TABLE users
+	DROP COLUMN invited_by,
+	DROP COLUMN invites;
+`
+
+// Up is executed when this migration is applied
+func Up_20131027193044(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131027193044(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
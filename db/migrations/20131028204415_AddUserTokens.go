@@ -0,0 +1,52 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Single-use tokens mailed to users; e.g: to verify an email address or reset a password.
+// Only a hash of the token is stored.
+//
+// Users who registered before email verification existed are considered verified.
+var sqlUp string = `
+	ALTER TABLE users
+	ADD COLUMN email_verified boolean NOT NULL DEFAULT false;
+
+	UPDATE users SET email_verified = true;
+
+	CREATE TABLE user_tokens (
+		token_id serial PRIMARY KEY,
+		user_id integer NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		purpose varchar(32) NOT NULL,
+		token_hash bytea NOT NULL UNIQUE,
+		created_at timestamp NOT NULL DEFAULT now(),
+		expires_at timestamp NOT NULL,
+		used_at timestamp
+	);
+
+	CREATE INDEX user_tokens_user_id_idx ON user_tokens(user_id);
+`
+
+var sqlDown string = `
+	DROP TABLE user_tokens;
+
+	ALTER TABLE users
+	DROP COLUMN email_verified;
+`
+
+// Up is executed when this migration is applied
+func Up_20131028204415(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131028204415(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// A user's TOTP secret is stored once they start enrolling; it is only
+// checked at login once `totp_enabled` is set. `totp_last_counter` is the
+// last time-step a code was accepted for so that codes cannot be replayed.
+//
+// Recovery codes are stored as hashes and can each be used once.
+// Roles can require their users to enroll.
+var sqlUp string = `
+	ALTER TABLE users
+	ADD COLUMN totp_secret bytea,
+	ADD COLUMN totp_enabled boolean NOT NULL DEFAULT false,
+	ADD COLUMN totp_last_counter bigint NOT NULL DEFAULT 0;
+
+	CREATE TABLE recovery_codes (
+		code_id serial PRIMARY KEY,
+		user_id integer NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		code_hash bytea NOT NULL,
+		used_at timestamp
+	);
+
+	CREATE INDEX recovery_codes_user_id_idx ON recovery_codes(user_id);
+
+	ALTER TABLE roles
+	ADD COLUMN requires_2fa boolean NOT NULL DEFAULT false;
+`
+
+var sqlDown string = `
+	ALTER TABLE roles
+	DROP COLUMN requires_2fa;
+
+	DROP TABLE recovery_codes;
+
+	ALTER TABLE users
+	DROP COLUMN totp_secret,
+	DROP COLUMN totp_enabled,
+	DROP COLUMN totp_last_counter;
+`
+
+// Up is executed when this migration is applied
+func Up_20131029211837(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131029211837(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
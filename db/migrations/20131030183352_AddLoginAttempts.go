@@ -0,0 +1,41 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Every login attempt is recorded so that failed attempts can be
+// throttled by username and by address; staff can review failures.
+var sqlUp string = `
+	CREATE TABLE login_attempts (
+		attempt_id serial PRIMARY KEY,
+		username varchar(255) NOT NULL,
+		remote_addr varchar(255) NOT NULL,
+		succeeded boolean NOT NULL,
+		created_at timestamp NOT NULL DEFAULT now()
+	);
+
+	CREATE INDEX login_attempts_username_idx ON login_attempts(username, created_at);
+	CREATE INDEX login_attempts_remote_addr_idx ON login_attempts(remote_addr, created_at);
+`
+
+var sqlDown string = `
+	DROP TABLE login_attempts;
+`
+
+// Up is executed when this migration is applied
+func Up_20131030183352(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131030183352(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Sessions expire on the server: `http_sessions` records when each session
+// was created and last saved so that expired sessions can be refused and pruned.
+//
+// `sessions` now has a row for each login [rather than each user] so that
+// users can see where they are logged in and log out other devices.
+var sqlUp string = `
+	ALTER TABLE http_sessions
+	ADD COLUMN created_at timestamp NOT NULL DEFAULT now(),
+	ADD COLUMN updated_at timestamp NOT NULL DEFAULT now();
+
+	CREATE INDEX http_sessions_updated_at_idx ON http_sessions(updated_at);
+
+	ALTER TABLE sessions
+	ADD COLUMN last_seen_ip inet,
+	ADD COLUMN user_agent text,
+	ADD COLUMN created_at timestamp NOT NULL DEFAULT now(),
+	ADD COLUMN last_seen_at timestamp NOT NULL DEFAULT now();
+
+	CREATE INDEX sessions_user_id_idx ON sessions(user_id);
+`
+
+var sqlDown string = `
+	DROP INDEX sessions_user_id_idx;
+
+	ALTER TABLE sessions
+	DROP COLUMN last_seen_ip,
+	DROP COLUMN user_agent,
+	DROP COLUMN created_at,
+	DROP COLUMN last_seen_at;
+
+	DROP INDEX http_sessions_updated_at_idx;
+
+	ALTER TABLE http_sessions
+	DROP COLUMN created_at,
+	DROP COLUMN updated_at;
+`
+
+// Up is executed when this migration is applied
+func Up_20131031202518(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131031202518(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
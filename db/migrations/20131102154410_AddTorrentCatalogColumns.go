@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// The catalog can be sorted by name, upload date, size, seeders, and snatches.
+//
+// `size` is the total length of the torrent's files; it is filled in when a
+// torrent is uploaded [torrents uploaded before this migration report 0.]
+// `seeders`, `leechers`, and `snatches` are written by the web server as the
+// trackers report them over the event bridge.
+var sqlUp string = `
+	ALTER TABLE torrents
+	ADD COLUMN created_at timestamp NOT NULL DEFAULT now(),
+	ADD COLUMN size bigint NOT NULL DEFAULT 0,
+	ADD COLUMN seeders integer NOT NULL DEFAULT 0,
+	ADD COLUMN leechers integer NOT NULL DEFAULT 0,
+	ADD COLUMN snatches integer NOT NULL DEFAULT 0;
+
+	CREATE INDEX torrents_name_idx ON torrents(name, torrent_id);
+	CREATE INDEX torrents_created_at_idx ON torrents(created_at, torrent_id);
+	CREATE INDEX torrents_size_idx ON torrents(size, torrent_id);
+	CREATE INDEX torrents_seeders_idx ON torrents(seeders, torrent_id);
+	CREATE INDEX torrents_snatches_idx ON torrents(snatches, torrent_id);
+	CREATE INDEX torrents_info_hash_idx ON torrents(info_hash);
+`
+
+var sqlDown string = `
+	DROP INDEX torrents_info_hash_idx;
+	DROP INDEX torrents_snatches_idx;
+	DROP INDEX torrents_seeders_idx;
+	DROP INDEX torrents_size_idx;
+	DROP INDEX torrents_created_at_idx;
+	DROP INDEX torrents_name_idx;
+
+	ALTER TABLE torrents
+	DROP COLUMN created_at,
+	DROP COLUMN size,
+	DROP COLUMN seeders,
+	DROP COLUMN leechers,
+	DROP COLUMN snatches;
+`
+
+// Up is executed when this migration is applied
+func Up_20131102154410(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131102154410(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
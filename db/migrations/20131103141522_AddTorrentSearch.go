@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Full-text search over the catalog.
+//
+// Each torrent has a `search_vector` which is kept up to date by triggers.
+// It is weighted so that matches on a torrent's title rank highest:
+//
+//	A: the torrent's name along with its series and episode names
+//	B: the names of the files in the torrent, its format and resolution
+//	C: the album and release descriptions from `attributes`
+//
+// `search_text` is the same document as plain text; it is used to match
+// phrases, which a tsquery cannot express before PostgreSQL 9.6.
+//
+// Triggers on `attributes` and `attributes_bundle` reset a torrent's vector
+// to NULL; the trigger on `torrents` then rebuilds it.
+var sqlUp string = `
+	ALTER TABLE torrents
+	ADD COLUMN file_list text NOT NULL DEFAULT '',
+	ADD COLUMN search_text text NOT NULL DEFAULT '',
+	ADD COLUMN search_vector tsvector;
+
+	CREATE INDEX torrents_search_vector_idx ON torrents USING gin(search_vector);
+
+	-- Scene names separate words with dots, dashes, and underscores.
+	CREATE FUNCTION search_normalize(text) RETURNS text AS $$
+		SELECT lower(btrim(regexp_replace(COALESCE($1, ''), '[._()\[\]{}\s-]+', ' ', 'g')))
+	$$ LANGUAGE sql IMMUTABLE;
+
+	CREATE FUNCTION torrents_search_update() RETURNS trigger AS $$
+	DECLARE
+		bundle_category varchar;
+		bundle hstore;
+		series hstore;
+		title text;
+		detail text;
+		description text;
+	BEGIN
+		SELECT b.category, b.bundle, p.bundle INTO bundle_category, bundle, series
+		FROM attributes_bundle b
+		LEFT JOIN attributes_bundle p ON p.attributes_bundle_id = b.parent_id
+		WHERE b.attributes_bundle_id = NEW.attributes_bundle_id;
+
+		IF bundle_category = 'series' THEN
+			series := bundle;
+		END IF;
+
+		SELECT string_agg(concat_ws(' ', a.album_name, a.album_description, a.release_description), ' ')
+		INTO description
+		FROM attributes a WHERE a.torrent_id = NEW.torrent_id;
+
+		title := search_normalize(concat_ws(' ', NEW.name, series -> 'name',
+			CASE WHEN bundle_category = 'episode' THEN bundle -> 'name' END));
+		detail := search_normalize(concat_ws(' ', NEW.file_list, bundle -> 'format', bundle -> 'resolution'));
+		description := search_normalize(description);
+
+		NEW.search_text := concat_ws(' ', title, detail, description);
+		NEW.search_vector :=
+			setweight(to_tsvector('english', title), 'A') ||
+			setweight(to_tsvector('english', detail), 'B') ||
+			setweight(to_tsvector('english', description), 'C');
+
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql;
+
+	CREATE TRIGGER torrents_search_update
+	BEFORE INSERT OR UPDATE OF name, file_list, attributes_bundle_id, search_vector ON torrents
+	FOR EACH ROW EXECUTE PROCEDURE torrents_search_update();
+
+	CREATE FUNCTION attributes_search_update() RETURNS trigger AS $$
+	BEGIN
+		UPDATE torrents SET search_vector = NULL WHERE torrent_id = NEW.torrent_id;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql;
+
+	CREATE TRIGGER attributes_search_update
+	AFTER INSERT OR UPDATE ON attributes
+	FOR EACH ROW EXECUTE PROCEDURE attributes_search_update();
+
+	CREATE FUNCTION attributes_bundle_search_update() RETURNS trigger AS $$
+	BEGIN
+		UPDATE torrents SET search_vector = NULL
+		WHERE attributes_bundle_id = NEW.attributes_bundle_id
+		OR attributes_bundle_id IN (
+			SELECT attributes_bundle_id FROM attributes_bundle WHERE parent_id = NEW.attributes_bundle_id
+		);
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql;
+
+	CREATE TRIGGER attributes_bundle_search_update
+	AFTER UPDATE ON attributes_bundle
+	FOR EACH ROW EXECUTE PROCEDURE attributes_bundle_search_update();
+
+	UPDATE torrents SET search_vector = NULL;
+`
+
+var sqlDown string = `
+	DROP TRIGGER attributes_bundle_search_update ON attributes_bundle;
+	DROP FUNCTION attributes_bundle_search_update();
+
+	DROP TRIGGER attributes_search_update ON attributes;
+	DROP FUNCTION attributes_search_update();
+
+	DROP TRIGGER torrents_search_update ON torrents;
+	DROP FUNCTION torrents_search_update();
+	DROP FUNCTION search_normalize(text);
+
+	DROP INDEX torrents_search_vector_idx;
+
+	ALTER TABLE torrents
+	DROP COLUMN file_list,
+	DROP COLUMN search_text,
+	DROP COLUMN search_vector;
+`
+
+// Up is executed when this migration is applied
+func Up_20131103141522(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131103141522(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
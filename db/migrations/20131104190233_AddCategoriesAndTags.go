@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Categories are defined by the staff; every torrent may belong to one.
+//
+// Tags are free-form and added by users. A new tag is pending until it has
+// been approved by a moderator; pending tags are shown on their torrents but
+// are not listed for browsing. A tag may be an alias of another: torrents are
+// always tagged with the tag it is an alias of.
+//
+// Users vote on the tags of each torrent. A tag whose score falls too low is
+// removed from the torrent. (See `app/models/tag.go`)
+var sqlUp string = `
+	CREATE TABLE categories (
+		category_id serial PRIMARY KEY,
+		name varchar(64) NOT NULL UNIQUE,
+		slug varchar(64) NOT NULL UNIQUE,
+		description text,
+		position integer NOT NULL DEFAULT 0
+	);
+
+	INSERT INTO categories(name, slug, position) VALUES
+		('Television', 'tv', 1),
+		('Movies', 'movies', 2),
+		('Music', 'music', 3),
+		('Software', 'software', 4),
+		('Other', 'other', 5);
+
+	ALTER TABLE torrents
+	ADD COLUMN category_id integer REFERENCES categories(category_id) ON DELETE SET NULL;
+
+	CREATE INDEX torrents_category_id_idx ON torrents(category_id);
+
+	CREATE TABLE tags (
+		tag_id serial PRIMARY KEY,
+		name varchar(64) NOT NULL UNIQUE,
+		alias_of integer REFERENCES tags(tag_id) ON DELETE CASCADE,
+		is_approved boolean NOT NULL DEFAULT false,
+		created_by integer REFERENCES users(user_id) ON DELETE SET NULL,
+		created_at timestamp NOT NULL DEFAULT now()
+	);
+
+	CREATE TABLE torrent_tags (
+		torrent_id integer NOT NULL REFERENCES torrents(torrent_id) ON DELETE CASCADE,
+		tag_id integer NOT NULL REFERENCES tags(tag_id) ON DELETE CASCADE,
+		added_by integer REFERENCES users(user_id) ON DELETE SET NULL,
+		created_at timestamp NOT NULL DEFAULT now(),
+		PRIMARY KEY (torrent_id, tag_id)
+	);
+
+	CREATE INDEX torrent_tags_tag_id_idx ON torrent_tags(tag_id);
+
+	CREATE TABLE tag_votes (
+		torrent_id integer NOT NULL,
+		tag_id integer NOT NULL,
+		user_id integer NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		vote smallint NOT NULL CHECK (vote IN (-1, 1)),
+		PRIMARY KEY (torrent_id, tag_id, user_id),
+		FOREIGN KEY (torrent_id, tag_id) REFERENCES torrent_tags(torrent_id, tag_id) ON DELETE CASCADE
+	);
+
+	INSERT INTO permissions(name, description) VALUES
+		('tag-torrents', 'Add tags to torrents and vote on them.'),
+		('moderate-tags', 'Approve, alias, and delete tags.'),
+		('manage-categories', 'Create and delete categories.');
+
+	INSERT INTO role_permissions(role_id, permission_id)
+	SELECT r.role_id, p.permission_id FROM roles r, permissions p
+	WHERE (p.name = 'tag-torrents' AND r.name IN ('user', 'uploader', 'moderator', 'admin'))
+	OR (p.name = 'moderate-tags' AND r.name IN ('moderator', 'admin'))
+	OR (p.name = 'manage-categories' AND r.name = 'admin');
+`
+
+var sqlDown string = `
+	DELETE FROM permissions WHERE name IN ('tag-torrents', 'moderate-tags', 'manage-categories');
+
+	DROP TABLE tag_votes;
+	DROP TABLE torrent_tags;
+	DROP TABLE tags;
+
+	DROP INDEX torrents_category_id_idx;
+
+	ALTER TABLE torrents
+	DROP COLUMN category_id;
+
+	DROP TABLE categories;
+`
+
+// Up is executed when this migration is applied
+func Up_20131104190233(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131104190233(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// The files in each torrent; in the order they appear in its info dict.
+//
+// Paths are relative to the torrent's directory and their components are
+// joined with "/". A single-file torrent has one file named after the torrent.
+//
+// Torrents uploaded before this migration have no rows; their files are
+// read from `info_bencoded` until they are written. (See `app/models/torrent_file.go`)
+var sqlUp string = `
+	CREATE TABLE torrent_files (
+		torrent_id integer NOT NULL REFERENCES torrents(torrent_id) ON DELETE CASCADE,
+		position integer NOT NULL,
+		path text NOT NULL,
+		length bigint NOT NULL,
+		PRIMARY KEY (torrent_id, position)
+	);
+`
+
+var sqlDown string = `
+	DROP TABLE torrent_files;
+`
+
+// Up is executed when this migration is applied
+func Up_20131105201547(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131105201547(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// The user who uploaded each torrent; shown on the torrent's page.
+//
+// Note that `created_by` is the program which created the metainfo file,
+// not a user. Torrents uploaded before this migration have no uploader.
+var sqlUp string = `
+	ALTER TABLE torrents
+	ADD COLUMN uploaded_by integer REFERENCES users(user_id) ON DELETE SET NULL;
+`
+
+var sqlDown string = `
+	ALTER TABLE torrents
+	DROP COLUMN uploaded_by;
+`
+
+// Up is executed when this migration is applied
+func Up_20131106183012(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131106183012(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// BitTorrent v2 [BEP 52] and hybrid torrents.
+//
+// `info_hash_v2` is the SHA-256 of a v2 torrent's info dict [64 hex chars];
+// it is empty for v1 torrents. A v2-only torrent's `info_hash` is its
+// truncated v2 hash, which is what clients announce. Hybrid torrents may
+// be announced with either hash; so truncated v2 hashes are indexed.
+//
+// `piece_layers` holds the bencoded `piece layers` of v2 torrents; they are
+// outside of the info dict but clients need them to verify large files.
+var sqlUp string = `
+	ALTER TABLE torrents
+	ADD COLUMN info_hash_v2 varchar(64) NOT NULL DEFAULT '',
+	ADD COLUMN piece_layers bytea;
+
+	CREATE INDEX torrents_info_hash_v2_idx ON torrents(substr(info_hash_v2, 1, 40))
+	WHERE info_hash_v2 <> '';
+`
+
+var sqlDown string = `
+	DROP INDEX torrents_info_hash_v2_idx;
+
+	ALTER TABLE torrents
+	DROP COLUMN info_hash_v2,
+	DROP COLUMN piece_layers;
+`
+
+// Up is executed when this migration is applied
+func Up_20131107210455(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131107210455(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// `metainfo_bencoded` holds a torrent's bencoded top-level dict without its
+// info dict, piece layers, or trackers. Keys babou does not model [e.g: `url-list`]
+// are kept there so that torrents are served the way they were uploaded.
+//
+// It is NULL for torrents uploaded before it was added.
+var sqlUp string = `
+	ALTER TABLE torrents ADD COLUMN metainfo_bencoded bytea;
+`
+
+var sqlDown string = `
+	ALTER TABLE torrents DROP COLUMN metainfo_bencoded;
+`
+
+// Up is executed when this migration is applied
+func Up_20131108174520(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131108174520(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Each user is counted once per torrent they snatch; no matter how many
+// times, or from how many clients, they announce that they completed it.
+// `torrents.snatches` is only incremented when a row is added here.
+var sqlUp string = `
+	CREATE TABLE torrent_snatches(
+		torrent_id integer NOT NULL REFERENCES torrents(torrent_id) ON DELETE CASCADE,
+		user_id integer NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		snatched_at timestamp NOT NULL DEFAULT now(),
+
+		PRIMARY KEY(torrent_id, user_id)
+	);
+`
+
+var sqlDown string = `
+	DROP TABLE torrent_snatches;
+`
+
+// Up is executed when this migration is applied
+func Up_20131109153010(txn *sql.Tx) {
+	_, err := txn.Exec(sqlUp)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
+
+// Down is executed when this migration is rolled back
+func Down_20131109153010(txn *sql.Tx) {
+	_, err := txn.Exec(sqlDown)
+	if err != nil {
+		fmt.Printf("error commiting txn: %s\n", err.Error())
+	}
+}
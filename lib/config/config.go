@@ -1,12 +1,16 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"strings"
 
 	"errors"
 	"flag"
+	"time"
 
 	"fmt"
 
@@ -23,10 +27,62 @@ type ServerConfig struct {
 	Port       int    `json:"port"`
 }
 
+type SiteConfig struct {
+	ServerConfig
+
+	BaseURL string `json:"base_url"` // Where users reach the site; used for links in mail. [e.g: https://example.com]
+
+	PasskeyGraceHours int    `json:"passkey_grace_hours"` // How long a reset passkey keeps working.
+	Registration      string `json:"registration"`        // Who may register. [open, invite, closed]
+	Source            string `json:"source"`              // The `source` tag of uploaded torrents. [see: lib/torrent]
+
+	SessionStore         string `json:"session_store"`          // Where sessions are kept. [database, memory, cookie]
+	SessionKey           string `json:"session_key"`            // Signs session cookies; required by the cookie store.
+	SessionKeyFile       string `json:"session_key_file"`       // Read the session key from a file instead.
+	SessionLifetimeHours int    `json:"session_lifetime_hours"` // How long a login lasts.
+	SessionIdleHours     int    `json:"session_idle_hours"`     // How long a login lasts without being used.
+}
+
+type TrackerConfig struct {
+	ServerConfig
+
+	Announce [][]string        `json:"announce"` // Tiers of announce URL templates. [see: lib/torrent]
+	Key      *TrackerKeyConfig `json:"key"`
+}
+
+// The key used to sign announce secrets. Keys can be given inline or read from a file.
+//
+// To rotate a key: move the current key to `previous`, set a new current key,
+// and set `previous_until` to the end of the grace window. Announces signed with
+// the previous key are accepted until then.
+type TrackerKeyConfig struct {
+	Current string `json:"current"`
+	File    string `json:"file"`
+
+	Previous      string `json:"previous"`
+	PreviousFile  string `json:"previous_file"`
+	PreviousUntil string `json:"previous_until"` // RFC 3339 [e.g: 2013-11-01T00:00:00Z]
+}
+
+// How the site sends mail. [e.g: password resets]
+type MailConfig struct {
+	Transport string `json:"transport"` // [smtp, file, log]
+	From      string `json:"from"`
+
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	Path string `json:"path"`
+}
+
 type BridgePeer struct {
-	Transport     string `json:"transport"` //  Socket Type. //TODO: TRANSPORT_TYPE
-	SocketAddress string `json:"listen"`    // Address for the socket to send or receive.
+	Transport     string `json:"transport"` // Socket Type. [tcp, unix, lo]
+	SocketAddress string `json:"listen"`    // Address [or path of a UNIX socket] to send or receive.
 	Port          int    `json:"port"`      // Port or suffix [PID,PORT,ETC.] of the remote socket.
+
+	Codecs []string `json:"codecs"` // Message codecs in order of preference. [e.g: "json/1", "gob"]
 }
 
 type BridgeConfig struct {
@@ -34,12 +90,117 @@ type BridgeConfig struct {
 	Peers       []*BridgePeer `json:"peers"`
 }
 
+// Where the info dicts of uploaded torrents are kept. [see: lib/store]
+type TorrentStoreConfig struct {
+	Store string `json:"store"` // [database, filesystem]
+	Path  string `json:"path"`  // The directory of the filesystem store.
+}
+
 // The JSON configuration for the components of the babou stack.
 type Config struct {
-	Database  *DatabaseConfig `json:"db"`
-	WebServer *ServerConfig   `json:"site"`
-	Tracker   *ServerConfig   `json:"tracker"`
-	Events    *BridgeConfig   `json:"events"`
+	Database  *DatabaseConfig     `json:"db"`
+	WebServer *SiteConfig         `json:"site"`
+	Tracker   *TrackerConfig      `json:"tracker"`
+	Events    *BridgeConfig       `json:"events"`
+	Mail      *MailConfig         `json:"mail"`
+	Torrents  *TorrentStoreConfig `json:"torrents"`
+
+	ShutdownTimeout int `json:"shutdown_timeout"` // Seconds to wait for in-flight work when stopping.
+}
+
+// Returns the URL links to the site are built from; without a trailing slash.
+// Sites which do not configure one are reached at their domain and port over HTTP.
+func (sc *SiteConfig) baseURL() (string, error) {
+	if sc.BaseURL != "" {
+		parsed, err := url.Parse(sc.BaseURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return "", errors.New(fmt.Sprintf("The site's base URL must be an absolute http(s) URL: %s", sc.BaseURL))
+		}
+
+		return strings.TrimRight(sc.BaseURL, "/"), nil
+	}
+
+	if sc.DomainName == "" {
+		return "", errors.New("The site needs a `base_url` or `domain` to build links in mail.")
+	}
+
+	if sc.Port == 0 || sc.Port == 80 {
+		return "http://" + sc.DomainName, nil
+	}
+
+	return fmt.Sprintf("http://%s:%d", sc.DomainName, sc.Port), nil
+}
+
+// Reads the tracker's address, announce templates and keys into the settings.
+// The web server builds announce URLs from them; so they are read whenever the
+// tracker is configured, not only on nodes which start it.
+func (tc *TrackerConfig) readAnnounce(settings *libBabou.AppSettings) error {
+	if tc == nil {
+		return nil
+	}
+
+	settings.TrackerHost = tc.DomainName
+	settings.TrackerPort = tc.Port
+	settings.AnnounceTiers = tc.Announce
+
+	if tc.Key == nil {
+		return nil
+	}
+
+	var err error
+	if settings.TrackerKey, err = readKey(tc.Key.Current, tc.Key.File); err != nil {
+		return err
+	}
+
+	if settings.TrackerPreviousKey, err = readKey(tc.Key.Previous, tc.Key.PreviousFile); err != nil {
+		return err
+	}
+
+	if len(settings.TrackerPreviousKey) > 0 {
+		settings.TrackerPreviousKeyUntil, err = time.Parse(time.RFC3339, tc.Key.PreviousUntil)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Error reading end of the previous tracker key's grace window: %s",
+				err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// Returns a key given inline; or the contents of a key file without surrounding whitespace.
+func readKey(inline, path string) ([]byte, error) {
+	if inline != "" || path == "" {
+		return []byte(inline), nil
+	}
+
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error reading key [%s]: %s", path, err.Error()))
+	}
+
+	return bytes.TrimSpace(key), nil
+}
+
+// Converts a bridge's JSON configuration to the settings used by the bridge.
+func (bp *BridgePeer) transportSettings() (*libBabou.TransportSettings, error) {
+	settings := &libBabou.TransportSettings{
+		Socket: bp.SocketAddress,
+		Port:   bp.Port,
+		Codecs: bp.Codecs,
+	}
+
+	switch bp.Transport {
+	case "tcp":
+		settings.Transport = libBabou.TCP_TRANSPORT
+	case "unix":
+		settings.Transport = libBabou.UNIX_TRANSPORT
+	case "lo", "local", "":
+		settings.Transport = libBabou.LOCAL_TRANSPORT
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown event-bridge transport: %s", bp.Transport))
+	}
+
+	return settings, nil
 }
 
 /*
@@ -81,22 +242,98 @@ func parseConfig(settings *libBabou.AppSettings) error {
 			err.Error()))
 	}
 
+	// Stacks chosen on the command line are the only ones started;
+	// otherwise each configured section starts its stack.
+	stacksChosen := settings.WebStack || settings.TrackerStack
+
+	settings.PasskeyGrace = libBabou.DEFAULT_PASSKEY_GRACE
+	settings.Registration = libBabou.REGISTRATION_OPEN
+
 	// Start the web-server if it is configured.
 	if parsedConfig.WebServer != nil {
 		settings.WebHost = parsedConfig.WebServer.DomainName
 		settings.WebPort = parsedConfig.WebServer.Port
+		settings.TorrentSource = parsedConfig.WebServer.Source
 
-		settings.WebStack = true
+		baseURL, err := parsedConfig.WebServer.baseURL()
+		if err != nil {
+			return err
+		}
+		settings.WebBaseURL = baseURL
+
+		if parsedConfig.WebServer.PasskeyGraceHours > 0 {
+			settings.PasskeyGrace = time.Duration(parsedConfig.WebServer.PasskeyGraceHours) * time.Hour
+		}
+
+		switch store := libBabou.SessionStore(parsedConfig.WebServer.SessionStore); store {
+		case libBabou.DATABASE_SESSIONS, libBabou.MEMORY_SESSIONS, libBabou.COOKIE_SESSIONS, "":
+			settings.SessionStore = store
+		default:
+			return errors.New(fmt.Sprintf("Unknown session store: %s", store))
+		}
+
+		sessionKey, err := readKey(parsedConfig.WebServer.SessionKey, parsedConfig.WebServer.SessionKeyFile)
+		if err != nil {
+			return err
+		}
+		settings.SessionKey = sessionKey
+
+		if settings.SessionStore == libBabou.COOKIE_SESSIONS && len(settings.SessionKey) == 0 {
+			return errors.New("The cookie session store requires a session key.")
+		}
+
+		settings.SessionLifetime = time.Duration(parsedConfig.WebServer.SessionLifetimeHours) * time.Hour
+		settings.SessionIdleTimeout = time.Duration(parsedConfig.WebServer.SessionIdleHours) * time.Hour
+
+		switch mode := libBabou.RegistrationMode(parsedConfig.WebServer.Registration); mode {
+		case libBabou.REGISTRATION_OPEN, libBabou.REGISTRATION_INVITE, libBabou.REGISTRATION_CLOSED:
+			settings.Registration = mode
+		case "": // keep the default.
+		default:
+			return errors.New(fmt.Sprintf("Unknown registration mode: %s", mode))
+		}
+
+		if !stacksChosen {
+			settings.WebStack = true
+		}
 	}
 
-	// Start the tracker if it is configured.
-	if parsedConfig.Tracker != nil {
-		settings.TrackerHost = parsedConfig.Tracker.DomainName
-		settings.TrackerPort = parsedConfig.Tracker.Port
+	if err := parsedConfig.Tracker.readAnnounce(settings); err != nil {
+		return err
+	}
 
+	// Start the tracker if it is configured.
+	if parsedConfig.Tracker != nil && !stacksChosen {
 		settings.TrackerStack = true
 	}
 
+	if parsedConfig.Mail != nil {
+		settings.Mail = &libBabou.MailSettings{
+			Transport: libBabou.MailTransport(parsedConfig.Mail.Transport),
+			From:      parsedConfig.Mail.From,
+			Host:      parsedConfig.Mail.Host,
+			Port:      parsedConfig.Mail.Port,
+			Username:  parsedConfig.Mail.Username,
+			Password:  parsedConfig.Mail.Password,
+			Path:      parsedConfig.Mail.Path,
+		}
+	}
+
+	if parsedConfig.Torrents != nil {
+		switch store := libBabou.TorrentStore(parsedConfig.Torrents.Store); store {
+		case libBabou.DATABASE_TORRENTS, libBabou.FILESYSTEM_TORRENTS, "":
+			settings.TorrentStore = store
+		default:
+			return errors.New(fmt.Sprintf("Unknown torrent store: %s", store))
+		}
+
+		settings.TorrentStorePath = parsedConfig.Torrents.Path
+	}
+
+	if settings.TorrentStore == libBabou.FILESYSTEM_TORRENTS && settings.TorrentStorePath == "" {
+		return errors.New("The filesystem torrent store requires a path.")
+	}
+
 	// Open a connection pool for the database.
 	if parsedConfig.Database != nil {
 		settings.DbOpen = parsedConfig.Database.ConnectionParams
@@ -106,22 +343,29 @@ func parseConfig(settings *libBabou.AppSettings) error {
 
 	settings.FullStack = (settings.WebStack && settings.TrackerStack)
 
-	//TODO: Setup bridge from config file.
+	settings.ShutdownTimeout = libBabou.DEFAULT_SHUTDOWN_TIMEOUT
+	if parsedConfig.ShutdownTimeout > 0 {
+		settings.ShutdownTimeout = time.Duration(parsedConfig.ShutdownTimeout) * time.Second
+	}
+
 	// Setup loopback event bridge and begin discovery process
 	// for configured neighbors.
-	settings.Bridge = &libBabou.TransportSettings{}
-	settings.Bridge.Transport = libBabou.TCP_TRANSPORT
-	settings.Bridge.Socket = parsedConfig.Events.LocalBridge.SocketAddress
-	settings.Bridge.Port = parsedConfig.Events.LocalBridge.Port
+	if parsedConfig.Events == nil {
+		parsedConfig.Events = &BridgeConfig{LocalBridge: BridgePeer{Transport: "lo"}}
+	}
+
+	settings.Bridge, err = parsedConfig.Events.LocalBridge.transportSettings()
+	if err != nil {
+		return err
+	}
 
 	settings.BridgePeers = make(
 		[]*libBabou.TransportSettings, 0, len(parsedConfig.Events.Peers))
 
 	for _, peer := range parsedConfig.Events.Peers {
-		peerTransport := &libBabou.TransportSettings{
-			Socket:    peer.SocketAddress,
-			Port:      peer.Port,
-			Transport: libBabou.TCP_TRANSPORT,
+		peerTransport, err := peer.transportSettings()
+		if err != nil {
+			return err
 		}
 
 		settings.BridgePeers = append(
@@ -135,7 +379,8 @@ func ReadFlags() *libBabou.AppSettings {
 	appSettings := &libBabou.AppSettings{}
 	var help, debug, webStack, trackStack, fullStack *bool
 	var webPort, trackPort *int
-	var configPath *string
+	var configPath, migrateTorrents *string
+	var checkTorrents *bool
 
 	help = flag.Bool("help", false, "Prints usage instructions for `babou`.")
 	debug = flag.Bool("debug", false,
@@ -154,6 +399,11 @@ func ReadFlags() *libBabou.AppSettings {
 		"Sets the tracker's listening port number. -1 to use configuration file's port.")
 
 	configPath = flag.String("config-path", "config/dev.json", "Pathname to your JSON configuration file.")
+
+	migrateTorrents = flag.String("migrate-torrents", "",
+		"Moves every info dict from the configured torrent store to this one [database, filesystem] and exits.")
+	checkTorrents = flag.Bool("check-torrents", false,
+		"Re-hashes every stored info dict against its torrent's info hash and exits.")
 	flag.Parse()
 
 	appSettings.Debug = *debug
@@ -167,6 +417,9 @@ func ReadFlags() *libBabou.AppSettings {
 
 	appSettings.ConfigPath = *configPath
 
+	appSettings.MigrateTorrentsTo = libBabou.TorrentStore(*migrateTorrents)
+	appSettings.CheckTorrents = *checkTorrents
+
 	if *help {
 		flag.Usage()
 		os.Exit(0)
@@ -11,6 +11,9 @@ import (
 
 	"database/sql"
 	_ "github.com/pbnjay/pq"
+
+	"fmt"
+	"time"
 )
 
 var currentConn *babouDb = nil
@@ -63,3 +66,22 @@ func ExecuteFn(dba DbAction) error {
 	dbaErr := dba(currentConn.database)
 	return dbaErr
 }
+
+// Formats a duration as a PostgreSQL interval, so that timestamp columns are
+// compared with the database's clock. [e.g: `WHERE last_seen_at < now() - $1::interval`]
+func Interval(d time.Duration) string {
+	return fmt.Sprintf("%d microseconds", d.Nanoseconds()/int64(time.Microsecond))
+}
+
+// Closes the connection pool once the queries in progress have finished.
+// The database can be opened again afterwards.
+func Close() error {
+	if currentConn == nil {
+		return errors.New("There is no open database connection.")
+	}
+
+	err := currentConn.database.Close()
+	currentConn = nil
+
+	return err
+}
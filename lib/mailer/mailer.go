@@ -0,0 +1,155 @@
+// Package mailer sends email on behalf of the site.
+//
+// Mail is sent through a `Mailer`; babou ships with an SMTP mailer for
+// production and a log mailer which writes messages to a file or the console
+// for development and tests.
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	lib "github.com/drbawb/babou/lib"
+)
+
+// An email message. The body is sent as plain text.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Sends messages.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// Returns the mailer described by the settings.
+// The log mailer writing to stdout is used if no mailer is configured.
+func New(settings *lib.MailSettings) (Mailer, error) {
+	if settings == nil {
+		return NewLogMailer(os.Stdout, ""), nil
+	}
+
+	switch settings.Transport {
+	case lib.SMTP_MAIL:
+		return NewSMTPMailer(settings.Host, settings.Port, settings.Username, settings.Password, settings.From), nil
+	case lib.FILE_MAIL:
+		file, err := os.OpenFile(settings.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewLogMailer(file, settings.From), nil
+	case lib.LOG_MAIL:
+		return NewLogMailer(os.Stdout, settings.From), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("Unknown mail transport: %s", settings.Transport))
+}
+
+// Formats a message as it is sent over the wire. [RFC 5322]
+func (msg *Message) Bytes(from string, date time.Time) []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", stripNewlines(msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	fmt.Fprintf(buf, "\r\n")
+
+	body := strings.Replace(msg.Body, "\r\n", "\n", -1)
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	return buf.Bytes()
+}
+
+// Header values cannot span lines; otherwise a subject could inject headers.
+func stripNewlines(in string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(in)
+}
+
+func (msg *Message) validate() error {
+	if len(msg.To) == 0 {
+		return errors.New("mailer: a message needs at least one recipient")
+	}
+
+	for _, to := range msg.To {
+		if !strings.Contains(to, "@") || strings.ContainsAny(to, "\r\n") {
+			return errors.New(fmt.Sprintf("mailer: invalid recipient [%s]", to))
+		}
+	}
+
+	return nil
+}
+
+// Sends mail through an SMTP server.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// Returns a mailer which relays through the SMTP server at host:port.
+// If a username is given the mailer authenticates with PLAIN auth; which
+// `net/smtp` only allows over TLS or to localhost.
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	mailer := &SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		from: from,
+	}
+
+	if username != "" {
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return mailer
+}
+
+func (sm *SMTPMailer) Send(msg *Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(sm.addr, sm.auth, sm.from, msg.To, msg.Bytes(sm.from, time.Now()))
+}
+
+// Writes mail to a log instead of sending it.
+type LogMailer struct {
+	out  io.Writer
+	from string
+	lock *sync.Mutex
+}
+
+// Returns a mailer which writes each message to `out`
+func NewLogMailer(out io.Writer, from string) *LogMailer {
+	if from == "" {
+		from = "babou@localhost"
+	}
+
+	return &LogMailer{out: out, from: from, lock: &sync.Mutex{}}
+}
+
+func (lm *LogMailer) Send(msg *Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	if _, err := fmt.Fprintf(lm.out, "---- mail ----\r\n%s\r\n---- end ----\r\n", msg.Bytes(lm.from, time.Now())); err != nil {
+		return err
+	}
+
+	return nil
+}
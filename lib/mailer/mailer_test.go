@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that a message is formatted with headers and CRLF line endings,
+// and that a subject cannot inject headers.
+func TestMessageBytes(test *testing.T) {
+	msg := &Message{
+		To:      []string{"a@example.com", "b@example.com"},
+		Subject: "hello\r\nBcc: evil@example.com",
+		Body:    "line one\nline two",
+	}
+
+	out := string(msg.Bytes("babou@example.com", time.Unix(1382600000, 0).UTC()))
+
+	for _, expected := range []string{
+		"From: babou@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: hello  Bcc: evil@example.com\r\n",
+		"Date: Thu, 24 Oct 2013 07:33:20 +0000\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(out, expected) {
+			test.Errorf("Expected message to contain %q; got %q", expected, out)
+		}
+	}
+}
+
+// Tests that the log mailer writes messages and rejects bad recipients.
+func TestLogMailer(test *testing.T) {
+	out := &bytes.Buffer{}
+	mailer := NewLogMailer(out, "")
+
+	if err := mailer.Send(&Message{To: []string{"user@example.com"}, Subject: "hi", Body: "token"}); err != nil {
+		test.Fatalf("Unexpected error sending mail: %s", err.Error())
+	}
+
+	if !strings.Contains(out.String(), "From: babou@localhost") || !strings.Contains(out.String(), "token") {
+		test.Errorf("Expected the message in the log; got %q", out.String())
+	}
+
+	for _, to := range [][]string{nil, []string{"nobody"}, []string{"a@example.com\r\nBcc: b@example.com"}} {
+		if err := mailer.Send(&Message{To: to}); err == nil {
+			test.Errorf("Expected an error sending to %q", to)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package ratelimit counts requests and failed logins so that they can be throttled.
+//
+// A `Limiter` allows a fixed number of hits per key [usually an address]
+// within a sliding window; it is kept in memory by each web server.
+//
+// `NextAttempt` implements the backoff used for failed logins: a few
+// failures are free, then each failure doubles the wait before the next
+// attempt, until the key is locked out entirely for a while.
+package ratelimit
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	FREE_ATTEMPTS    int           = 3  // failures allowed before any delay.
+	LOCKOUT_ATTEMPTS int           = 10 // failures before a key is locked out.
+	LOCKOUT_DURATION time.Duration = 15 * time.Minute
+
+	// Failures older than this are forgotten.
+	FAILURE_WINDOW time.Duration = time.Hour
+)
+
+// Returns the earliest time another attempt should be allowed after
+// `failures` failed attempts; the latest of which happened at `last`.
+// Returns the zero time if there is no need to wait.
+func NextAttempt(failures int, last time.Time) time.Time {
+	if failures < FREE_ATTEMPTS {
+		return time.Time{}
+	}
+
+	if failures >= LOCKOUT_ATTEMPTS {
+		return last.Add(LOCKOUT_DURATION)
+	}
+
+	return last.Add(time.Second << uint(failures-FREE_ATTEMPTS))
+}
+
+// Returns true if `failures` is enough to lock out a key.
+func IsLockout(failures int) bool {
+	return failures >= LOCKOUT_ATTEMPTS
+}
+
+// Allows `limit` hits per key within a sliding window.
+// A Limiter is safe to share between goroutines.
+type Limiter struct {
+	limit  int
+	window time.Duration
+
+	lock      sync.Mutex
+	hits      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+// Records a hit for `key` if it is under its limit.
+// Otherwise returns false along with how long until the key may try again.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	return l.allowAt(key, time.Now())
+}
+
+func (l *Limiter) allowAt(key string, now time.Time) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sweep(now)
+
+	hits := expire(l.hits[key], now.Add(-l.window))
+	if len(hits) >= l.limit {
+		l.hits[key] = hits
+		return false, hits[0].Add(l.window).Sub(now)
+	}
+
+	l.hits[key] = append(hits, now)
+	return true, 0
+}
+
+// Forgets keys which have no hits within the window.
+// Runs at most once per window so that memory is bounded by recent traffic.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+
+	for key, hits := range l.hits {
+		if len(expire(hits, now.Add(-l.window))) == 0 {
+			delete(l.hits, key)
+		}
+	}
+
+	l.lastSweep = now
+}
+
+// Drops hits [which are in order] that happened before `since`
+func expire(hits []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && !hits[i].After(since) {
+		i++
+	}
+
+	return hits[i:]
+}
+
+// Returns the host portion of an address; the address itself if it has no port.
+func Host(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+
+	return remoteAddr
+}
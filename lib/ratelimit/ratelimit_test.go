@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterWindow(test *testing.T) {
+	limiter := NewLimiter(2, time.Minute)
+	start := time.Unix(1000, 0)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allowAt("a", start); !ok {
+			test.Fatalf("Hit %d should have been allowed", i)
+		}
+	}
+
+	ok, wait := limiter.allowAt("a", start.Add(10*time.Second))
+	if ok {
+		test.Fatalf("Third hit should have been refused")
+	} else if wait != 50*time.Second {
+		test.Errorf("Expected to wait 50s; got %s", wait)
+	}
+
+	if ok, _ := limiter.allowAt("b", start); !ok {
+		test.Errorf("Keys should be limited independently")
+	}
+
+	if ok, _ := limiter.allowAt("a", start.Add(time.Minute+time.Second)); !ok {
+		test.Errorf("Hits should be allowed once the window has passed")
+	}
+}
+
+func TestLimiterSweep(test *testing.T) {
+	limiter := NewLimiter(1, time.Minute)
+	start := time.Unix(1000, 0)
+
+	limiter.allowAt("a", start)
+	limiter.allowAt("b", start.Add(2*time.Minute))
+
+	if _, ok := limiter.hits["a"]; ok {
+		test.Errorf("Stale keys should have been swept")
+	}
+}
+
+func TestNextAttempt(test *testing.T) {
+	last := time.Unix(1000, 0)
+
+	if next := NextAttempt(FREE_ATTEMPTS-1, last); !next.IsZero() {
+		test.Errorf("The first failures should not be delayed; got %s", next)
+	}
+
+	if next := NextAttempt(FREE_ATTEMPTS, last); next != last.Add(time.Second) {
+		test.Errorf("Expected a 1s delay; got %s", next.Sub(last))
+	}
+
+	if next := NextAttempt(FREE_ATTEMPTS+3, last); next != last.Add(8*time.Second) {
+		test.Errorf("Expected an 8s delay; got %s", next.Sub(last))
+	}
+
+	if next := NextAttempt(LOCKOUT_ATTEMPTS, last); next != last.Add(LOCKOUT_DURATION) {
+		test.Errorf("Expected a lockout; got %s", next.Sub(last))
+	}
+}
@@ -0,0 +1,218 @@
+// Parses the queries users type into the catalog's search box.
+//
+// A query is a list of terms separated by whitespace:
+//
+//	wire             matches torrents which mention "wire"
+//	"the wire"       matches torrents which mention the phrase "the wire"
+//	-sample          excludes torrents which mention "sample"
+//	format:mkv       matches torrents whose format is "mkv"
+//	-format:avi      excludes torrents whose format is "avi"
+//	series:"the wire"
+//
+// Only the fields passed to `Parse` are recognized; any other `name:value`
+// is searched for as an ordinary term. How terms are matched is left to the
+// caller; see `models.SearchTorrents`
+package search
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// The most terms a query may have; the rest are ignored.
+const MAX_TERMS int = 16
+
+// Scene names separate words with dots, dashes, and underscores.
+// This must match the database's `search_normalize` function.
+var separators = regexp.MustCompile(`[._()\[\]{}\s-]+`)
+
+// A word, phrase, or field filter.
+type Term struct {
+	Text     string
+	Field    string // empty unless this term filters a field.
+	IsPhrase bool
+	Excluded bool
+}
+
+// A parsed search query.
+type Query struct {
+	Terms []Term
+}
+
+// Parses a query; `fields` are the names of the fields it may filter.
+func Parse(input string, fields ...string) *Query {
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[strings.ToLower(field)] = true
+	}
+
+	query := &Query{Terms: make([]Term, 0)}
+	scan := &scanner{input: []rune(input)}
+	for len(query.Terms) < MAX_TERMS {
+		scan.skipSpace()
+		if scan.done() {
+			break
+		}
+
+		term := Term{}
+		if scan.peek() == '-' {
+			term.Excluded = true
+			scan.pos++
+		}
+
+		if scan.peek() == '"' {
+			term.Text, term.IsPhrase = scan.quoted(), true
+		} else {
+			term.Text = scan.word()
+
+			if i := strings.Index(term.Text, ":"); i > 0 && known[strings.ToLower(term.Text[:i])] {
+				term.Field = strings.ToLower(term.Text[:i])
+				term.Text = term.Text[i+1:]
+
+				if term.Text == "" && scan.peek() == '"' {
+					term.Text, term.IsPhrase = scan.quoted(), true
+				}
+			}
+		}
+
+		term.Text = strings.Join(strings.Fields(term.Text), " ")
+		if term.Text == "" {
+			continue
+		}
+
+		query.Terms = append(query.Terms, term)
+	}
+
+	return query
+}
+
+// True if the query has no terms.
+func (q *Query) IsEmpty() bool {
+	return len(q.Terms) == 0
+}
+
+// Returns the words and phrases [not field filters] a result must match.
+func (q *Query) Included() []string {
+	return q.texts(func(term Term) bool { return term.Field == "" && !term.Excluded })
+}
+
+// Returns the phrases [not field filters] a result must contain verbatim.
+func (q *Query) Phrases() []string {
+	return q.texts(func(term Term) bool { return term.Field == "" && term.IsPhrase && !term.Excluded })
+}
+
+// Returns the field filters.
+func (q *Query) Filters() []Term {
+	filters := make([]Term, 0)
+	for _, term := range q.Terms {
+		if term.Field != "" {
+			filters = append(filters, term)
+		}
+	}
+
+	return filters
+}
+
+// Returns a copy of the query in which every word and phrase filters `field`
+func (q *Query) Within(field string) *Query {
+	within := &Query{Terms: make([]Term, len(q.Terms))}
+	for i, term := range q.Terms {
+		if term.Field == "" {
+			term.Field = field
+		}
+
+		within.Terms[i] = term
+	}
+
+	return within
+}
+
+// Formats the query so that it parses back into the same terms.
+func (q *Query) String() string {
+	terms := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		text := term.Text
+		if term.IsPhrase || strings.IndexFunc(text, unicode.IsSpace) >= 0 {
+			text = `"` + text + `"`
+		}
+
+		if term.Field != "" {
+			text = term.Field + ":" + text
+		}
+
+		if term.Excluded {
+			text = "-" + text
+		}
+
+		terms = append(terms, text)
+	}
+
+	return strings.Join(terms, " ")
+}
+
+func (q *Query) texts(matches func(Term) bool) []string {
+	texts := make([]string, 0)
+	for _, term := range q.Terms {
+		if matches(term) {
+			texts = append(texts, term.Text)
+		}
+	}
+
+	return texts
+}
+
+// Lower-cases text and replaces separators with spaces so that it can be
+// compared with the plain text the database indexes.
+func Normalize(text string) string {
+	return strings.TrimSpace(separators.ReplaceAllString(strings.ToLower(text), " "))
+}
+
+type scanner struct {
+	input []rune
+	pos   int
+}
+
+func (s *scanner) done() bool {
+	return s.pos >= len(s.input)
+}
+
+func (s *scanner) peek() rune {
+	if s.done() {
+		return 0
+	}
+
+	return s.input[s.pos]
+}
+
+func (s *scanner) skipSpace() {
+	for !s.done() && unicode.IsSpace(s.peek()) {
+		s.pos++
+	}
+}
+
+// Reads up to the next space; or the end of the input.
+func (s *scanner) word() string {
+	start := s.pos
+	for !s.done() && !unicode.IsSpace(s.peek()) && !(s.peek() == '"' && s.pos > start && s.input[s.pos-1] == ':') {
+		s.pos++
+	}
+
+	return string(s.input[start:s.pos])
+}
+
+// Reads a quoted phrase; an unterminated quote runs to the end of the input.
+func (s *scanner) quoted() string {
+	s.pos++ // opening quote
+	start := s.pos
+	for !s.done() && s.peek() != '"' {
+		s.pos++
+	}
+
+	phrase := string(s.input[start:s.pos])
+	if !s.done() {
+		s.pos++ // closing quote
+	}
+
+	return phrase
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests that words, phrases, exclusions, and field filters are recognized.
+func TestParse(test *testing.T) {
+	query := Parse(`  wire "the  wire" -sample format:MKV -format:avi series:"the wire" bogus:field -"bad rip"`,
+		"format", "series")
+
+	expected := []Term{
+		Term{Text: "wire"},
+		Term{Text: "the wire", IsPhrase: true},
+		Term{Text: "sample", Excluded: true},
+		Term{Text: "MKV", Field: "format"},
+		Term{Text: "avi", Field: "format", Excluded: true},
+		Term{Text: "the wire", Field: "series", IsPhrase: true},
+		Term{Text: "bogus:field"},
+		Term{Text: "bad rip", IsPhrase: true, Excluded: true},
+	}
+
+	if !reflect.DeepEqual(query.Terms, expected) {
+		test.Fatalf("Unexpected terms:\n%+v\nexpected:\n%+v", query.Terms, expected)
+	}
+
+	if included := query.Included(); !reflect.DeepEqual(included, []string{"wire", "the wire", "bogus:field"}) {
+		test.Errorf("Unexpected included terms: %v", included)
+	}
+
+	if phrases := query.Phrases(); !reflect.DeepEqual(phrases, []string{"the wire"}) {
+		test.Errorf("Unexpected phrases: %v", phrases)
+	}
+
+	if filters := query.Filters(); len(filters) != 3 {
+		test.Errorf("Expected 3 field filters; got %+v", filters)
+	}
+
+	if reparsed := Parse(query.String(), "format", "series"); !reflect.DeepEqual(reparsed, query) {
+		test.Errorf("Expected %q to parse back into the same terms; got %+v", query.String(), reparsed.Terms)
+	}
+}
+
+// Tests that stray quotes and dashes do not produce empty terms.
+func TestParseMalformed(test *testing.T) {
+	if query := Parse(`- "" "unterminated`); len(query.Terms) != 1 || query.Terms[0].Text != "unterminated" {
+		test.Errorf("Unexpected terms: %+v", query.Terms)
+	}
+
+	if query := Parse("   "); !query.IsEmpty() {
+		test.Errorf("Expected an empty query; got %+v", query.Terms)
+	}
+}
+
+func TestWithin(test *testing.T) {
+	query := Parse(`wire -format:avi`, "format").Within("series")
+	if query.Terms[0].Field != "series" || query.Terms[1].Field != "format" {
+		test.Errorf("Expected words to filter the series; got %+v", query.Terms)
+	}
+}
+
+func TestNormalize(test *testing.T) {
+	if normalized := Normalize("The.Wire.S01E01.[720p]-GROUP"); normalized != "the wire s01e01 720p group" {
+		test.Errorf("Unexpected normalized text: %q", normalized)
+	}
+}
@@ -0,0 +1,104 @@
+package session
+
+import (
+	http "net/http"
+	strconv "strconv"
+	time "time"
+
+	securecookie "github.com/gorilla/securecookie"
+	sessions "github.com/gorilla/sessions"
+)
+
+// Keeps sessions entirely in a cookie; nothing is stored on the server.
+//
+// The cookie is signed [and encrypted if an encryption key is given] so it
+// cannot be forged; but a deleted session cannot be revoked on the server.
+// Sessions are limited to the 4KB a browser will store in a cookie.
+type CookieStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+// What the cookie holds.
+type cookiePayload struct {
+	Values    map[interface{}]interface{}
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+func NewCookieStore(keyPairs ...[]byte) *CookieStore {
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(0) // expiry is checked against the payload's timestamps instead.
+		}
+	}
+
+	return &CookieStore{
+		Codecs: codecs,
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: int(CurrentTimeouts().Lifetime.Seconds()),
+		},
+	}
+}
+
+// Fetches a session for a given name after it has been added to the registry.
+func (cs *CookieStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(cs, name)
+}
+
+// New returns a new session for the given name w/o adding it to the registry.
+func (cs *CookieStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(cs, name)
+	options := *cs.Options
+	session.Options = &options
+	session.IsNew = true
+
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+
+	payload := &cookiePayload{}
+	if err := securecookie.DecodeMulti(name, c.Value, payload, cs.Codecs...); err != nil {
+		return session, err
+	}
+
+	createdAt, updatedAt := time.Unix(payload.CreatedAt, 0), time.Unix(payload.UpdatedAt, 0)
+	if CurrentTimeouts().Expired(createdAt, updatedAt, time.Now()) {
+		return session, nil
+	}
+
+	// nothing is stored on the server; so the ID carries the session's creation time instead.
+	session.ID = strconv.FormatInt(payload.CreatedAt, 10)
+	session.Values = payload.Values
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Writes the session's values to its cookie.
+// A session with a negative MaxAge is deleted.
+func (cs *CookieStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	now := time.Now().Unix()
+	createdAt, err := strconv.ParseInt(session.ID, 10, 64)
+	if err != nil {
+		createdAt = now
+		session.ID = strconv.FormatInt(createdAt, 10)
+	}
+
+	payload := &cookiePayload{Values: session.Values, CreatedAt: createdAt, UpdatedAt: now}
+	encoded, err := securecookie.EncodeMulti(session.Name(), payload, cs.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
@@ -0,0 +1,133 @@
+package session
+
+import (
+	base32 "encoding/base32"
+	errors "errors"
+	http "net/http"
+	strings "strings"
+	time "time"
+
+	securecookie "github.com/gorilla/securecookie"
+	sessions "github.com/gorilla/sessions"
+)
+
+var errNoRecord = errors.New("session: no such session")
+
+// A session's encoded values as kept by a store.
+type record struct {
+	data      string
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// Somewhere to keep sessions by ID.
+type records interface {
+	load(id string) (*record, error) // errNoRecord if there is no such session.
+	save(id, data string) error      // creates the session or updates its data and last use.
+	delete(id string) error
+}
+
+// A store which keeps only a random session ID in the cookie; the
+// session's values are kept on the server by `records`
+type idStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+
+	records records
+}
+
+func newIdStore(records records, keyPairs ...[]byte) *idStore {
+	return &idStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: int(CurrentTimeouts().Lifetime.Seconds()),
+		},
+		records: records,
+	}
+}
+
+// Fetches a session for a given name after it has been added to the registry.
+func (s *idStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a new session for the given name w/o adding it to the registry.
+func (s *idStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	var err error
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+		if err == nil {
+			err = s.load(session)
+			if err == nil {
+				session.IsNew = false
+			} else if err == ErrSessionExpired || err == errNoRecord {
+				// start over with a new ID; expired sessions will be pruned.
+				session.ID = ""
+				err = nil
+			}
+		}
+	}
+
+	return session, err
+}
+
+// Saves the session's values and sets the cookie holding its ID.
+// A session with a negative MaxAge is deleted.
+func (s *idStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.records.delete(session.ID); err != nil {
+				return err
+			}
+		}
+
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		// Generate a random session ID key suitable for storage in the DB
+		session.ID = strings.TrimRight(
+			base32.StdEncoding.EncodeToString(
+				securecookie.GenerateRandomKey(32)), "=")
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	if err := s.records.save(session.ID, encoded); err != nil {
+		return err
+	}
+
+	// Keep the session ID key in a cookie so it can be looked up later.
+	encoded, err = securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Fetches a session by ID and decodes its content into session.Values
+func (s *idStore) load(session *sessions.Session) error {
+	rec, err := s.records.load(session.ID)
+	if err != nil {
+		return err
+	}
+
+	// expired sessions are pruned later; until then they are treated as missing.
+	if CurrentTimeouts().Expired(rec.createdAt, rec.updatedAt, time.Now()) {
+		return ErrSessionExpired
+	}
+
+	return securecookie.DecodeMulti(session.Name(), rec.data, &session.Values, s.Codecs...)
+}
@@ -0,0 +1,129 @@
+package session
+
+import (
+	list "container/list"
+	sync "sync"
+	time "time"
+)
+
+// The number of sessions a memory store keeps by default.
+const DEFAULT_MEMORY_CAPACITY int = 10000
+
+// Keeps sessions in this process.
+//
+// Sessions are lost when the process exits and are not shared with other
+// instances of `babou`; so this store suits single-node deployments and tests.
+// Once the store is full the least recently used session is forgotten.
+type MemoryStore struct {
+	*idStore
+	lru *lruRecords
+}
+
+func NewMemoryStore(capacity int, keyPairs ...[]byte) *MemoryStore {
+	lru := &lruRecords{
+		capacity: capacity,
+		order:    list.New(),
+		byId:     make(map[string]*list.Element),
+	}
+
+	return &MemoryStore{idStore: newIdStore(lru, keyPairs...), lru: lru}
+}
+
+// Returns the number of sessions in the store.
+func (ms *MemoryStore) Len() int {
+	ms.lru.lock.Lock()
+	defer ms.lru.lock.Unlock()
+
+	return ms.lru.order.Len()
+}
+
+// Deletes every session which has expired; returns the number deleted.
+func (ms *MemoryStore) PruneExpired() (int64, error) {
+	return ms.lru.pruneExpired(CurrentTimeouts(), time.Now()), nil
+}
+
+type lruEntry struct {
+	id  string
+	rec record
+}
+
+// Records ordered from most to least recently used.
+type lruRecords struct {
+	capacity int
+
+	lock  sync.Mutex
+	order *list.List
+	byId  map[string]*list.Element
+}
+
+func (lr *lruRecords) load(id string) (*record, error) {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+
+	element, ok := lr.byId[id]
+	if !ok {
+		return nil, errNoRecord
+	}
+
+	lr.order.MoveToFront(element)
+	rec := element.Value.(*lruEntry).rec // a copy; callers cannot change the store.
+
+	return &rec, nil
+}
+
+func (lr *lruRecords) save(id, data string) error {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+
+	now := time.Now()
+	if element, ok := lr.byId[id]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.rec.data, entry.rec.updatedAt = data, now
+		lr.order.MoveToFront(element)
+		return nil
+	}
+
+	entry := &lruEntry{id: id, rec: record{data: data, createdAt: now, updatedAt: now}}
+	lr.byId[id] = lr.order.PushFront(entry)
+
+	for lr.capacity > 0 && lr.order.Len() > lr.capacity {
+		oldest := lr.order.Back()
+		lr.order.Remove(oldest)
+		delete(lr.byId, oldest.Value.(*lruEntry).id)
+	}
+
+	return nil
+}
+
+func (lr *lruRecords) delete(id string) error {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+
+	if element, ok := lr.byId[id]; ok {
+		lr.order.Remove(element)
+		delete(lr.byId, id)
+	}
+
+	return nil
+}
+
+func (lr *lruRecords) pruneExpired(timeouts Timeouts, now time.Time) int64 {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+
+	var pruned int64
+	for element := lr.order.Front(); element != nil; {
+		next := element.Next()
+
+		entry := element.Value.(*lruEntry)
+		if timeouts.Expired(entry.rec.createdAt, entry.rec.updatedAt, now) {
+			lr.order.Remove(element)
+			delete(lr.byId, entry.id)
+			pruned++
+		}
+
+		element = next
+	}
+
+	return pruned
+}
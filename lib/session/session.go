@@ -0,0 +1,100 @@
+// Implementations of the gorilla/sessions#Store interface for `babou`
+//
+// Three stores are available; see `New` for choosing one by name:
+//
+//	database  sessions are kept in PostgreSQL and can be read by any instance
+//	          of `babou` which shares the database and session key.
+//	memory    sessions are kept in this process; for single-node deployments and tests.
+//	cookie    sessions are kept in a signed and encrypted cookie; nothing is stored
+//	          on the server. A session key must be configured.
+//
+// Every store expires sessions on the server according to the current `Timeouts`
+package session
+
+import (
+	sha256 "crypto/sha256"
+	errors "errors"
+	fmt "fmt"
+	sync "sync"
+	time "time"
+
+	lib "github.com/drbawb/babou/lib"
+
+	sessions "github.com/gorilla/sessions"
+)
+
+const (
+	DEFAULT_LIFETIME     = 30 * 24 * time.Hour
+	DEFAULT_IDLE_TIMEOUT = 7 * 24 * time.Hour
+)
+
+var ErrSessionExpired = errors.New("session: this session has expired")
+
+// Stores which keep sessions on the server can delete the ones which have expired.
+type Pruner interface {
+	PruneExpired() (int64, error) // returns the number of sessions deleted.
+}
+
+// Returns the store named by `storeType`; an empty type is the database store.
+// `keyPairs` are passed to securecookie; the cookie store requires them.
+func New(storeType lib.SessionStore, keyPairs ...[]byte) (sessions.Store, error) {
+	switch storeType {
+	case lib.DATABASE_SESSIONS, "":
+		return NewDatabaseStore(keyPairs...), nil
+	case lib.MEMORY_SESSIONS:
+		return NewMemoryStore(DEFAULT_MEMORY_CAPACITY, keyPairs...), nil
+	case lib.COOKIE_SESSIONS:
+		if len(keyPairs) == 0 || len(keyPairs[0]) == 0 {
+			return nil, errors.New("session: the cookie store requires a session key")
+		}
+
+		// the cookie holds the session's values; so they are encrypted as well as signed.
+		if len(keyPairs) == 1 {
+			blockKey := sha256.Sum256(append([]byte("babou-session-encryption:"), keyPairs[0]...))
+			keyPairs = append(keyPairs, blockKey[:])
+		}
+
+		return NewCookieStore(keyPairs...), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("session: unknown session store [%s]", storeType))
+}
+
+// How long sessions last on the server; regardless of what the browser does with the cookie.
+type Timeouts struct {
+	Lifetime    time.Duration // A session expires this long after it was created.
+	IdleTimeout time.Duration // A session expires when it has not been used for this long.
+}
+
+var timeouts = &Timeouts{Lifetime: DEFAULT_LIFETIME, IdleTimeout: DEFAULT_IDLE_TIMEOUT}
+var timeoutsLock = &sync.RWMutex{}
+
+// Sets how long sessions last; zero durations keep the defaults.
+func SetTimeouts(lifetime, idleTimeout time.Duration) {
+	if lifetime <= 0 {
+		lifetime = DEFAULT_LIFETIME
+	}
+
+	if idleTimeout <= 0 {
+		idleTimeout = DEFAULT_IDLE_TIMEOUT
+	}
+
+	timeoutsLock.Lock()
+	defer timeoutsLock.Unlock()
+
+	timeouts = &Timeouts{Lifetime: lifetime, IdleTimeout: idleTimeout}
+}
+
+// Returns how long sessions last.
+func CurrentTimeouts() Timeouts {
+	timeoutsLock.RLock()
+	defer timeoutsLock.RUnlock()
+
+	return *timeouts
+}
+
+// Returns true if a session created at `createdAt` and last used at
+// `lastUsedAt` has expired by `now`
+func (t Timeouts) Expired(createdAt, lastUsedAt, now time.Time) bool {
+	return now.Sub(createdAt) > t.Lifetime || now.Sub(lastUsedAt) > t.IdleTimeout
+}
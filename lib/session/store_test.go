@@ -0,0 +1,231 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/drbawb/babou/lib"
+	"github.com/drbawb/babou/lib/db"
+
+	sessions "github.com/gorilla/sessions"
+)
+
+const testSessionName = "user"
+
+var testKeys = [][]byte{[]byte("0123456789abcdef0123456789abcdef"), []byte("fedcba9876543210fedcba9876543210")}
+
+// Every store must pass the conformance suite.
+func TestMemoryStore(test *testing.T) {
+	runConformance(test, func() sessions.Store { return NewMemoryStore(DEFAULT_MEMORY_CAPACITY, testKeys...) })
+}
+
+func TestCookieStore(test *testing.T) {
+	runConformance(test, func() sessions.Store { return NewCookieStore(testKeys...) })
+}
+
+// The database store needs a migrated database: set BABOU_TEST_DB to its connection string.
+func TestDatabaseStore(test *testing.T) {
+	dsn := os.Getenv("BABOU_TEST_DB")
+	if dsn == "" {
+		test.Skip("BABOU_TEST_DB is not set")
+	}
+
+	if _, err := db.Open(&lib.AppSettings{DbOpen: dsn}); err != nil {
+		test.Fatalf("Error opening the test database: %s", err.Error())
+	}
+
+	runConformance(test, func() sessions.Store { return NewDatabaseStore(testKeys...) })
+}
+
+func runConformance(test *testing.T, newStore func() sessions.Store) {
+	cases := []struct {
+		name string
+		run  func(*testing.T, sessions.Store)
+	}{
+		{"new session", testNewSession},
+		{"round trip", testRoundTrip},
+		{"tampered cookie", testTamperedCookie},
+		{"unsaved changes", testUnsavedChanges},
+		{"idle timeout", testIdleTimeout},
+		{"delete", testDelete},
+	}
+
+	for _, c := range cases {
+		test.Run(c.name, func(test *testing.T) {
+			c.run(test, newStore())
+		})
+	}
+}
+
+// Loads the session a request carrying `cookies` would see.
+func load(test *testing.T, store sessions.Store, cookies []*http.Cookie) *sessions.Session {
+	request, _ := http.NewRequest("GET", "http://localhost/", nil)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	session, _ := store.New(request, testSessionName)
+	if session == nil {
+		test.Fatalf("The store returned no session")
+	}
+
+	return session
+}
+
+// Saves a session and returns the cookies sent to the browser.
+func save(test *testing.T, store sessions.Store, session *sessions.Session) []*http.Cookie {
+	request, _ := http.NewRequest("GET", "http://localhost/", nil)
+	recorder := httptest.NewRecorder()
+
+	if err := store.Save(request, recorder, session); err != nil {
+		test.Fatalf("Error saving session: %s", err.Error())
+	}
+
+	return recorder.Result().Cookies()
+}
+
+func testNewSession(test *testing.T, store sessions.Store) {
+	session := load(test, store, nil)
+	if !session.IsNew || len(session.Values) != 0 {
+		test.Errorf("A request without a cookie should get a new, empty session")
+	}
+}
+
+func testRoundTrip(test *testing.T, store sessions.Store) {
+	session := load(test, store, nil)
+	session.Values["user_id"] = 42
+	session.AddFlash("hello")
+
+	cookies := save(test, store, session)
+	if len(cookies) != 1 || cookies[0].Name != testSessionName {
+		test.Fatalf("Expected a single session cookie; got %v", cookies)
+	}
+
+	loaded := load(test, store, cookies)
+	if loaded.IsNew {
+		test.Errorf("A saved session should not be new")
+	}
+
+	if userId, _ := loaded.Values["user_id"].(int); userId != 42 {
+		test.Errorf("Expected user_id 42; got %v", loaded.Values["user_id"])
+	}
+
+	if flashes := loaded.Flashes(); len(flashes) != 1 || flashes[0] != "hello" {
+		test.Errorf("Expected the flash to survive; got %v", flashes)
+	}
+
+	// saving again keeps the session working.
+	cookies = save(test, store, loaded)
+	if again := load(test, store, cookies); again.IsNew || len(again.Flashes()) != 0 {
+		test.Errorf("A consumed flash should stay consumed")
+	}
+}
+
+func testTamperedCookie(test *testing.T, store sessions.Store) {
+	session := load(test, store, nil)
+	session.Values["user_id"] = 42
+
+	cookies := save(test, store, session)
+	cookies[0].Value = cookies[0].Value[:len(cookies[0].Value)-4] + "AAAA"
+
+	loaded := load(test, store, cookies)
+	if !loaded.IsNew || loaded.Values["user_id"] != nil {
+		test.Errorf("A tampered cookie should get a new, empty session")
+	}
+}
+
+func testUnsavedChanges(test *testing.T, store sessions.Store) {
+	session := load(test, store, nil)
+	session.Values["user_id"] = 42
+	cookies := save(test, store, session)
+
+	loaded := load(test, store, cookies)
+	loaded.Values["user_id"] = 7 // never saved.
+
+	if again := load(test, store, cookies); again.Values["user_id"] != 42 {
+		test.Errorf("Changes which were not saved should not be visible; got %v", again.Values["user_id"])
+	}
+}
+
+func testIdleTimeout(test *testing.T, store sessions.Store) {
+	previous := CurrentTimeouts()
+	defer SetTimeouts(previous.Lifetime, previous.IdleTimeout)
+
+	session := load(test, store, nil)
+	session.Values["user_id"] = 42
+	cookies := save(test, store, session)
+
+	// timestamps may be kept to the second.
+	SetTimeouts(time.Hour, time.Second)
+	time.Sleep(2100 * time.Millisecond)
+
+	loaded := load(test, store, cookies)
+	if !loaded.IsNew || loaded.Values["user_id"] != nil {
+		test.Errorf("An idle session should have expired")
+	}
+}
+
+func testDelete(test *testing.T, store sessions.Store) {
+	session := load(test, store, nil)
+	session.Values["user_id"] = 42
+	cookies := save(test, store, session)
+
+	loaded := load(test, store, cookies)
+	loaded.Options.MaxAge = -1
+	deleted := save(test, store, loaded)
+
+	if len(deleted) != 1 || deleted[0].MaxAge >= 0 {
+		test.Errorf("Deleting a session should expire its cookie; got %v", deleted)
+	}
+
+	// server-side stores forget the session; the cookie store cannot.
+	if _, ok := store.(*CookieStore); !ok {
+		if again := load(test, store, cookies); !again.IsNew {
+			test.Errorf("A deleted session should not be loaded again")
+		}
+	}
+}
+
+func TestMemoryStoreEviction(test *testing.T) {
+	store := NewMemoryStore(2, testKeys...)
+
+	first := save(test, store, load(test, store, nil))
+	save(test, store, load(test, store, nil))
+
+	load(test, store, first) // the first session is now the most recently used.
+	save(test, store, load(test, store, nil))
+
+	if store.Len() != 2 {
+		test.Errorf("Expected 2 sessions; got %d", store.Len())
+	}
+
+	if load(test, store, first).IsNew {
+		test.Errorf("The most recently used session should not have been evicted")
+	}
+}
+
+func TestNewCookieStore(test *testing.T) {
+	if _, err := New(lib.COOKIE_SESSIONS); err == nil {
+		test.Errorf("The cookie store should require a session key")
+	}
+
+	store, err := New(lib.COOKIE_SESSIONS, []byte("a session key"))
+	if err != nil {
+		test.Fatalf("Error creating cookie store: %s", err.Error())
+	}
+
+	session := load(test, store, nil)
+	session.Values["secret"] = "plaintext"
+	cookies := save(test, store, session)
+
+	if loaded := load(test, store, cookies); loaded.Values["secret"] != "plaintext" {
+		test.Errorf("Expected the value to round trip; got %v", loaded.Values["secret"])
+	}
+
+	if plain := NewCookieStore([]byte("a session key")); !load(test, plain, cookies).IsNew {
+		test.Errorf("Cookies from `New` should be encrypted; a signing-only store decoded one")
+	}
+}
@@ -1,7 +1,15 @@
 package lib
 
+import (
+	"fmt"
+	"time"
+)
+
 const (
 	TRACKER_ANNOUNCE_INTERVAL int = 300
+
+	DEFAULT_SHUTDOWN_TIMEOUT = 10 * time.Second
+	DEFAULT_PASSKEY_GRACE    = 24 * time.Hour
 )
 
 // Available bridge transports.
@@ -15,6 +23,15 @@ const (
 	LOCAL_TRANSPORT               = iota
 )
 
+// Who may create an account.
+type RegistrationMode string
+
+const (
+	REGISTRATION_OPEN   RegistrationMode = "open"   // anyone may register.
+	REGISTRATION_INVITE RegistrationMode = "invite" // an invite code is required.
+	REGISTRATION_CLOSED RegistrationMode = "closed" // nobody may register.
+)
+
 type AppSettings struct {
 	Debug bool // Print debug messages
 
@@ -26,13 +43,77 @@ type AppSettings struct {
 	TrackerPort int // Port the track-stack will listen on
 
 	WebHost     string // Hostname of the web-server, used for generating URLs
+	WebBaseURL  string // Where users reach the site [e.g: https://example.com]; links in mail are built from it.
 	TrackerHost string //Hostname of tracker, used for generating URLs.
 
+	AnnounceTiers           [][]string // Announce URL templates grouped into tiers; empty for the default.
+	TrackerKey              []byte     // Signs announce secrets; empty for the insecure default.
+	TrackerPreviousKey      []byte     // Key being rotated out; accepted until TrackerPreviousKeyUntil.
+	TrackerPreviousKeyUntil time.Time
+
+	PasskeyGrace time.Duration    // How long a user's old passkey keeps working after they reset it.
+	Registration RegistrationMode // Who may create an account.
+
+	TorrentSource string // Tags uploaded torrents so their info hashes are unique to this site; empty to keep the uploader's.
+
+	SessionStore       SessionStore  // Where sessions are kept; empty for the database.
+	SessionKey         []byte        // Signs session cookies; required by the cookie store.
+	SessionLifetime    time.Duration // How long a login lasts; zero for the default.
+	SessionIdleTimeout time.Duration // How long a login lasts without being used; zero for the default.
+
+	Mail *MailSettings // How to send mail; nil to log mail to the console.
+
+	TorrentStore     TorrentStore // Where info dicts are kept; empty for the database.
+	TorrentStorePath string       // The directory of the filesystem store.
+
+	MigrateTorrentsTo TorrentStore // Move every info dict to this store and exit.
+	CheckTorrents     bool         // Re-hash every stored info dict and exit.
+
 	Bridge      *TransportSettings   // Local bridge
 	BridgePeers []*TransportSettings // Remote bridges
 
 	DbOpen     string
 	ConfigPath string
+
+	ShutdownTimeout time.Duration // How long to wait for requests and messages in flight before exiting.
+}
+
+// Where sessions are kept. [see: lib/session]
+type SessionStore string
+
+const (
+	DATABASE_SESSIONS SessionStore = "database" // shared by every node using the database.
+	MEMORY_SESSIONS   SessionStore = "memory"   // kept by this process; for a single node.
+	COOKIE_SESSIONS   SessionStore = "cookie"   // kept in the browser; requires a session key.
+)
+
+// Where the info dicts of torrents are kept. [see: lib/store]
+type TorrentStore string
+
+const (
+	DATABASE_TORRENTS   TorrentStore = "database"   // on their torrent's row.
+	FILESYSTEM_TORRENTS TorrentStore = "filesystem" // in a directory; named by their info hash.
+)
+
+// Ways to send mail. [see: lib/mailer]
+type MailTransport string
+
+const (
+	SMTP_MAIL MailTransport = "smtp" // relay through an SMTP server.
+	FILE_MAIL MailTransport = "file" // append messages to a file.
+	LOG_MAIL  MailTransport = "log"  // print messages to the console.
+)
+
+type MailSettings struct {
+	Transport MailTransport
+	From      string // Address mail is sent from.
+
+	Host     string // SMTP server; if applicable
+	Port     int
+	Username string
+	Password string
+
+	Path string // File to write to; if applicable
 }
 
 type TransportSettings struct {
@@ -40,4 +121,19 @@ type TransportSettings struct {
 
 	Socket string // if applicable
 	Port   int    // if applicable
+
+	Codecs []string // message codecs in order of preference; empty for the bridge's defaults.
+}
+
+// Returns the address of the socket in the form expected by `net.Dial`
+// Empty for the loopback transport.
+func (ts *TransportSettings) Address() string {
+	switch ts.Transport {
+	case TCP_TRANSPORT:
+		return fmt.Sprintf("%s:%d", ts.Socket, ts.Port)
+	case UNIX_TRANSPORT:
+		return ts.Socket
+	default:
+		return ""
+	}
 }
@@ -0,0 +1,110 @@
+package store
+
+import (
+	sql "database/sql"
+	errors "errors"
+
+	dbLib "github.com/drbawb/babou/lib/db"
+)
+
+// Keeps info dicts on their torrent's row in PostgreSQL. [`torrents.info_bencoded`]
+// A torrent must be written before its info dict can be kept.
+type DatabaseStore struct{}
+
+func NewDatabaseStore() *DatabaseStore {
+	return &DatabaseStore{}
+}
+
+func (ds *DatabaseStore) Put(infoHash string, info []byte) error {
+	fn := func(dbConn *sql.DB) error {
+		txn, err := dbConn.Begin()
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback() // no-op once committed.
+
+		if err := ds.PutTx(txn, infoHash, info); err != nil {
+			return err
+		}
+
+		return txn.Commit()
+	}
+
+	return dbLib.ExecuteFn(fn)
+}
+
+// Keeps the info dict within `txn`; its torrent may be written earlier in the same transaction.
+func (ds *DatabaseStore) PutTx(txn *sql.Tx, infoHash string, info []byte) error {
+	if err := Verify(infoHash, info); err != nil {
+		return err
+	}
+
+	result, err := txn.Exec(`UPDATE "torrents" SET info_bencoded = $2 WHERE info_hash = $1`, infoHash, info)
+	if err != nil {
+		return err
+	}
+
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return errors.New("store: no torrent has this info hash; the database store keeps info dicts on their torrent")
+	}
+
+	return nil
+}
+
+func (ds *DatabaseStore) Get(infoHash string) ([]byte, error) {
+	var info []byte
+	fn := func(dbConn *sql.DB) error {
+		return dbConn.QueryRow(`SELECT info_bencoded FROM "torrents" WHERE info_hash = $1`, infoHash).Scan(&info)
+	}
+
+	if err := dbLib.ExecuteFn(fn); err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	} else if len(info) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return info, nil
+}
+
+func (ds *DatabaseStore) Delete(infoHash string) error {
+	fn := func(dbConn *sql.DB) error {
+		_, err := dbConn.Exec(`UPDATE "torrents" SET info_bencoded = NULL WHERE info_hash = $1`, infoHash)
+		return err
+	}
+
+	return dbLib.ExecuteFn(fn)
+}
+
+func (ds *DatabaseStore) InfoHashes() ([]string, error) {
+	infoHashes := make([]string, 0)
+	fn := func(dbConn *sql.DB) error {
+		rows, err := dbConn.Query(`SELECT info_hash FROM "torrents"
+			WHERE info_bencoded IS NOT NULL AND length(info_bencoded) > 0
+			ORDER BY info_hash`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var infoHash string
+			if err := rows.Scan(&infoHash); err != nil {
+				return err
+			}
+
+			infoHashes = append(infoHashes, infoHash)
+		}
+
+		return rows.Err()
+	}
+
+	if err := dbLib.ExecuteFn(fn); err != nil {
+		return nil, err
+	}
+
+	return infoHashes, nil
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	hex "encoding/hex"
+	errors "errors"
+	fmt "fmt"
+	ioutil "io/ioutil"
+	os "os"
+	filepath "path/filepath"
+	sort "sort"
+)
+
+// Keeps info dicts in a directory. Each info dict is named by its info hash
+// and kept in a subdirectory named by the hash's first byte; e.g: `ab/abcdef...`
+//
+// Files are written to a temporary name and renamed; so a reader never sees
+// an info dict which is partially written.
+type FileStore struct {
+	root string
+}
+
+// Opens [and creates, if needed] the store kept in the directory `root`
+func NewFileStore(root string) (*FileStore, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{root: root}, nil
+}
+
+func (fs *FileStore) Put(infoHash string, info []byte) error {
+	path, err := fs.path(infoHash)
+	if err != nil {
+		return err
+	}
+
+	if err := Verify(infoHash, info); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), infoHash+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name()) // no-op once renamed.
+
+	if _, err := temp.Write(info); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+func (fs *FileStore) Get(infoHash string) ([]byte, error) {
+	path, err := fs.path(infoHash)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return info, err
+}
+
+func (fs *FileStore) Delete(infoHash string) error {
+	path, err := fs.path(infoHash)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (fs *FileStore) InfoHashes() ([]string, error) {
+	infoHashes := make([]string, 0)
+	walk := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() && isInfoHash(info.Name()) {
+			infoHashes = append(infoHashes, info.Name())
+		}
+
+		return nil
+	}
+
+	if err := filepath.Walk(fs.root, walk); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(infoHashes)
+	return infoHashes, nil
+}
+
+// Returns where the info dict of `infoHash` is kept.
+// Info hashes are checked so that they cannot name a file outside of the store.
+func (fs *FileStore) path(infoHash string) (string, error) {
+	if !isInfoHash(infoHash) {
+		return "", errors.New(fmt.Sprintf("store: [%s] is not an info hash", infoHash))
+	}
+
+	return filepath.Join(fs.root, infoHash[:2], infoHash), nil
+}
+
+// Info hashes are 20 bytes; encoded as 40 lowercase hex characters.
+func isInfoHash(name string) bool {
+	decoded, err := hex.DecodeString(name)
+	return err == nil && len(decoded) == 20 && hex.EncodeToString(decoded) == name
+}
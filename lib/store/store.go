@@ -0,0 +1,148 @@
+// Stores for the info dicts of uploaded torrents.
+//
+// Info dicts are kept by their torrent's info hash. Two stores are available;
+// see `New` for choosing one by name:
+//
+//	database    info dicts are kept on their torrent's row [`torrents.info_bencoded`]
+//	filesystem  info dicts are kept in a directory; each file is named by its info hash.
+//
+// Every store checks that an info dict hashes to its info hash before keeping it.
+// Use `Migrate` to move info dicts from one store to another and `Check` to
+// re-hash the ones which are stored.
+package store
+
+import (
+	sha1 "crypto/sha1"
+	sha256 "crypto/sha256"
+	sql "database/sql"
+	hex "encoding/hex"
+	errors "errors"
+	fmt "fmt"
+	sync "sync"
+
+	lib "github.com/drbawb/babou/lib"
+)
+
+var (
+	ErrNotFound     = errors.New("store: no info dict is stored for this info hash")
+	ErrHashMismatch = errors.New("store: the info dict does not match its info hash")
+)
+
+// Keeps the bencoded info dicts of torrents by their info hash.
+type TorrentStore interface {
+	Put(infoHash string, info []byte) error // returns ErrHashMismatch if `info` is not the info hash's dict.
+	Get(infoHash string) ([]byte, error)    // returns ErrNotFound if the info dict is not stored.
+	Delete(infoHash string) error           // deleting an info dict which is not stored is not an error.
+
+	InfoHashes() ([]string, error) // every info hash with a stored info dict.
+}
+
+// A store which keeps info dicts in the database can keep one within the
+// transaction that writes its torrent; the dict and its row are then
+// written or rolled back together.
+type TxStore interface {
+	TorrentStore
+	PutTx(txn *sql.Tx, infoHash string, info []byte) error
+}
+
+// Returns the store named by `storeType`; an empty type is the database store.
+// The filesystem store keeps info dicts in the directory `path`
+func New(storeType lib.TorrentStore, path string) (TorrentStore, error) {
+	switch storeType {
+	case lib.DATABASE_TORRENTS, "":
+		return NewDatabaseStore(), nil
+	case lib.FILESYSTEM_TORRENTS:
+		if path == "" {
+			return nil, errors.New("store: the filesystem store requires a path")
+		}
+
+		return NewFileStore(path)
+	}
+
+	return nil, errors.New(fmt.Sprintf("store: unknown torrent store [%s]", storeType))
+}
+
+var defaultStore TorrentStore = NewDatabaseStore()
+var defaultLock = &sync.RWMutex{}
+
+// Sets the store used by the site and tracker.
+func SetDefault(store TorrentStore) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+
+	defaultStore = store
+}
+
+// Returns the store used by the site and tracker; the database store unless another was set.
+func Default() TorrentStore {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+
+	return defaultStore
+}
+
+// Tests that `info` hashes to `infoHash`: the SHA-1 of v1 and hybrid torrents'
+// info dicts, or the truncated SHA-256 of v2 torrents'. [see: lib/torrent]
+func Verify(infoHash string, info []byte) error {
+	v1 := sha1.Sum(info)
+	if hex.EncodeToString(v1[:]) == infoHash {
+		return nil
+	}
+
+	v2 := sha256.Sum256(info)
+	if hex.EncodeToString(v2[:sha1.Size]) == infoHash {
+		return nil
+	}
+
+	return ErrHashMismatch
+}
+
+// Copies every info dict from one store to another; then deletes them from
+// the store they were copied from. Nothing is deleted unless every info dict
+// was copied. The stores must not share their storage [e.g: the same directory]
+// or the info dicts will be deleted from both.
+// Returns the number of info dicts which were moved.
+func Migrate(from, to TorrentStore) (int, error) {
+	infoHashes, err := from.InfoHashes()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, infoHash := range infoHashes {
+		info, err := from.Get(infoHash)
+		if err != nil {
+			return 0, errors.New(fmt.Sprintf("store: error reading [%s]: %s", infoHash, err.Error()))
+		}
+
+		if err := to.Put(infoHash, info); err != nil {
+			return 0, errors.New(fmt.Sprintf("store: error copying [%s]: %s", infoHash, err.Error()))
+		}
+	}
+
+	for _, infoHash := range infoHashes {
+		if err := from.Delete(infoHash); err != nil {
+			return 0, errors.New(fmt.Sprintf("store: error deleting [%s]: %s", infoHash, err.Error()))
+		}
+	}
+
+	return len(infoHashes), nil
+}
+
+// Re-hashes the stored info dict of each info hash.
+// Returns the info hashes which failed; with ErrNotFound, ErrHashMismatch,
+// or the error encountered reading them.
+func Check(store TorrentStore, infoHashes []string) map[string]error {
+	failed := make(map[string]error)
+	for _, infoHash := range infoHashes {
+		info, err := store.Get(infoHash)
+		if err == nil {
+			err = Verify(infoHash, info)
+		}
+
+		if err != nil {
+			failed[infoHash] = err
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	sha1 "crypto/sha1"
+	sha256 "crypto/sha256"
+	hex "encoding/hex"
+	ioutil "io/ioutil"
+	os "os"
+	filepath "path/filepath"
+	"testing"
+)
+
+var testInfo = []byte("d6:lengthi1024e4:name5:album12:piece lengthi16384e6:pieces20:xxxxxxxxxxxxxxxxxxxxe")
+
+func testInfoHash() string {
+	hash := sha1.Sum(testInfo)
+	return hex.EncodeToString(hash[:])
+}
+
+func newTestFileStore(test *testing.T) *FileStore {
+	root, err := ioutil.TempDir("", "babou-store")
+	if err != nil {
+		test.Fatalf("Error creating a directory for the store: %s", err.Error())
+	}
+
+	fs, err := NewFileStore(root)
+	if err != nil {
+		test.Fatalf("Error opening the store: %s", err.Error())
+	}
+
+	return fs
+}
+
+func TestVerify(test *testing.T) {
+	if err := Verify(testInfoHash(), testInfo); err != nil {
+		test.Errorf("Expected the v1 info hash to match; got: %s", err.Error())
+	}
+
+	v2 := sha256.Sum256(testInfo)
+	if err := Verify(hex.EncodeToString(v2[:20]), testInfo); err != nil {
+		test.Errorf("Expected the truncated v2 info hash to match; got: %s", err.Error())
+	}
+
+	if err := Verify(testInfoHash(), append(testInfo, 'x')); err != ErrHashMismatch {
+		test.Errorf("Expected a modified info dict to be rejected; got: %v", err)
+	}
+}
+
+func TestFileStore(test *testing.T) {
+	fs := newTestFileStore(test)
+	defer os.RemoveAll(fs.root)
+
+	infoHash := testInfoHash()
+	if _, err := fs.Get(infoHash); err != ErrNotFound {
+		test.Errorf("Expected an empty store to have nothing; got: %v", err)
+	}
+
+	if err := fs.Put(infoHash, []byte("d4:name5:othere")); err != ErrHashMismatch {
+		test.Errorf("Expected the wrong info dict to be rejected; got: %v", err)
+	}
+
+	if err := fs.Put(infoHash, testInfo); err != nil {
+		test.Fatalf("Error storing the info dict: %s", err.Error())
+	}
+
+	if info, err := fs.Get(infoHash); err != nil || string(info) != string(testInfo) {
+		test.Errorf("Expected the stored info dict; got %q, %v", info, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(fs.root, infoHash[:2], infoHash)); err != nil {
+		test.Errorf("Expected the info dict to be named by its info hash; got: %s", err.Error())
+	}
+
+	if infoHashes, err := fs.InfoHashes(); err != nil || len(infoHashes) != 1 || infoHashes[0] != infoHash {
+		test.Errorf("Expected one info hash; got %v, %v", infoHashes, err)
+	}
+
+	if _, err := fs.Get("../../etc/passwd"); err == nil || err == ErrNotFound {
+		test.Errorf("Expected a path to be rejected as an info hash; got: %v", err)
+	}
+
+	if err := fs.Delete(infoHash); err != nil {
+		test.Errorf("Error deleting the info dict: %s", err.Error())
+	}
+
+	if err := fs.Delete(infoHash); err != nil {
+		test.Errorf("Expected deleting a missing info dict to succeed; got: %s", err.Error())
+	}
+}
+
+func TestMigrateAndCheck(test *testing.T) {
+	from, to := newTestFileStore(test), newTestFileStore(test)
+	defer os.RemoveAll(from.root)
+	defer os.RemoveAll(to.root)
+
+	infoHash := testInfoHash()
+	if err := from.Put(infoHash, testInfo); err != nil {
+		test.Fatalf("Error storing the info dict: %s", err.Error())
+	}
+
+	if moved, err := Migrate(from, to); err != nil || moved != 1 {
+		test.Fatalf("Expected one info dict to be moved; got %d, %v", moved, err)
+	}
+
+	if _, err := from.Get(infoHash); err != ErrNotFound {
+		test.Errorf("Expected the info dict to be deleted from the old store; got: %v", err)
+	}
+
+	missing := "0000000000000000000000000000000000000000"
+	if failed := Check(to, []string{infoHash, missing}); len(failed) != 1 || failed[missing] != ErrNotFound {
+		test.Errorf("Expected only the missing info dict to fail; got %v", failed)
+	}
+
+	// corrupt the stored info dict behind the store's back.
+	if err := ioutil.WriteFile(filepath.Join(to.root, infoHash[:2], infoHash), []byte("de"), 0600); err != nil {
+		test.Fatalf("Error corrupting the info dict: %s", err.Error())
+	}
+
+	if failed := Check(to, []string{infoHash}); failed[infoHash] != ErrHashMismatch {
+		test.Errorf("Expected the corrupt info dict to fail; got %v", failed)
+	}
+}
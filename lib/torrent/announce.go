@@ -0,0 +1,94 @@
+package torrent
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Announce URLs are built from templates which may use the placeholders:
+//
+//	{host}   the tracker's hostname        {port}  the tracker's port
+//	{secret} the user's hex-encoded secret {hash}  the secret's signature
+//
+// Templates are grouped into tiers as described by BEP 12: clients try every
+// URL in the first tier before moving on to the next. Any scheme a client
+// understands may be used; e.g: http://, https://, or udp://
+const DEFAULT_ANNOUNCE_TEMPLATE string = "http://{host}:{port}/{secret}/{hash}/announce"
+
+// The tracker's address when none is configured.
+const (
+	DEFAULT_ANNOUNCE_HOST string = "localhost"
+	DEFAULT_ANNOUNCE_PORT int    = 4200
+)
+
+type announceConfig struct {
+	tiers [][]string
+	host  string
+	port  int
+}
+
+var announce = &announceConfig{
+	tiers: [][]string{[]string{DEFAULT_ANNOUNCE_TEMPLATE}},
+	host:  DEFAULT_ANNOUNCE_HOST,
+	port:  DEFAULT_ANNOUNCE_PORT,
+}
+var announceLock = &sync.RWMutex{}
+
+// Sets the tracker's address and the templates used to build announce URLs.
+// An empty list of tiers uses the `DEFAULT_ANNOUNCE_TEMPLATE`; an empty host
+// or a port which is not positive keeps the default host or port.
+func SetAnnounce(host string, port int, tiers [][]string) {
+	if len(tiers) == 0 {
+		tiers = [][]string{[]string{DEFAULT_ANNOUNCE_TEMPLATE}}
+	}
+
+	if host == "" {
+		host = DEFAULT_ANNOUNCE_HOST
+	}
+
+	if port <= 0 {
+		port = DEFAULT_ANNOUNCE_PORT
+	}
+
+	announceLock.Lock()
+	defer announceLock.Unlock()
+
+	announce = &announceConfig{tiers: tiers, host: host, port: port}
+}
+
+// Returns the announce URLs for a user grouped by tier.
+func AnnounceTiers(secret, hash []byte) [][]string {
+	announceLock.RLock()
+	defer announceLock.RUnlock()
+
+	replacer := strings.NewReplacer(
+		"{host}", announce.host,
+		"{port}", strconv.Itoa(announce.port),
+		"{secret}", hex.EncodeToString(secret),
+		"{hash}", hex.EncodeToString(hash),
+	)
+
+	tiers := make([][]string, 0, len(announce.tiers))
+	for _, tier := range announce.tiers {
+		urls := make([]string, 0, len(tier))
+		for _, template := range tier {
+			urls = append(urls, replacer.Replace(template))
+		}
+
+		tiers = append(tiers, urls)
+	}
+
+	return tiers
+}
+
+// Returns a user's primary announce URL. (The first URL of the first tier.)
+func AnnounceURL(secret, hash []byte) string {
+	tiers := AnnounceTiers(secret, hash)
+	if len(tiers) == 0 || len(tiers[0]) == 0 {
+		return ""
+	}
+
+	return tiers[0][0]
+}
@@ -0,0 +1,117 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An entry in a torrent's file tree; either a directory or a file.
+//
+// The tree is flattened in the order it should be displayed: each directory
+// is followed by its contents. Directories are numbered so that a page can
+// collapse everything beneath one.
+type TreeEntry struct {
+	Name   string
+	Path   string
+	Depth  int
+	IsDir  bool
+	Length int64 // directories: the total length of the files beneath them.
+
+	DirId   int   // zero for files.
+	Parents []int // the DirIds of the directories containing this entry.
+}
+
+// The entry's length for display; e.g: "4.7 GiB"
+func (e *TreeEntry) DisplaySize() string {
+	return FormatSize(e.Length)
+}
+
+// CSS classes naming each directory containing this entry; e.g: "tree-dir-1 tree-dir-3"
+func (e *TreeEntry) ParentClasses() string {
+	classes := make([]string, 0, len(e.Parents))
+	for _, dirId := range e.Parents {
+		classes = append(classes, fmt.Sprintf("tree-dir-%d", dirId))
+	}
+
+	return strings.Join(classes, " ")
+}
+
+type treeNode struct {
+	entry    *TreeEntry
+	children map[string]*treeNode
+}
+
+// Arranges the files of a torrent into a tree. Within each directory
+// the subdirectories are listed first; then the files. Both are sorted by name.
+//
+// Returns an error if a path is both a file and a directory. [e.g: "a" and "a/b"]
+// `Validate` rejects such torrents; but ones stored before it did may have them.
+func FileTree(files []File) ([]*TreeEntry, error) {
+	root := &treeNode{entry: &TreeEntry{IsDir: true}, children: make(map[string]*treeNode)}
+
+	for _, file := range files {
+		node := root
+		components := strings.Split(file.Path, "/")
+		for i, name := range components {
+			isDir := i < len(components)-1
+
+			child, ok := node.children[name]
+			if ok && child.entry.IsDir != isDir {
+				return nil, errors.New(fmt.Sprintf("The path [%s] is both a file and a directory.", child.entry.Path))
+			} else if !ok {
+				child = &treeNode{entry: &TreeEntry{
+					Name:  name,
+					Path:  strings.Join(components[:i+1], "/"),
+					Depth: i,
+					IsDir: isDir,
+				}}
+
+				if child.entry.IsDir {
+					child.children = make(map[string]*treeNode)
+				}
+
+				node.children[name] = child
+			}
+
+			child.entry.Length += file.Length
+			node = child
+		}
+	}
+
+	entries := make([]*TreeEntry, 0, len(files))
+	var walk func(node *treeNode, parents []int)
+	walk = func(node *treeNode, parents []int) {
+		children := make([]*treeNode, 0, len(node.children))
+		for _, child := range node.children {
+			children = append(children, child)
+		}
+
+		sort.Sort(byDirectoryThenName(children))
+		for _, child := range children {
+			child.entry.Parents = parents
+			entries = append(entries, child.entry)
+
+			if child.entry.IsDir {
+				child.entry.DirId = len(entries)
+				walk(child, append(parents[:len(parents):len(parents)], child.entry.DirId))
+			}
+		}
+	}
+
+	walk(root, []int{})
+	return entries, nil
+}
+
+type byDirectoryThenName []*treeNode
+
+func (nodes byDirectoryThenName) Len() int      { return len(nodes) }
+func (nodes byDirectoryThenName) Swap(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] }
+func (nodes byDirectoryThenName) Less(i, j int) bool {
+	if nodes[i].entry.IsDir != nodes[j].entry.IsDir {
+		return nodes[i].entry.IsDir
+	}
+
+	return nodes[i].entry.Name < nodes[j].entry.Name
+}
@@ -0,0 +1,63 @@
+package torrent
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests that directories are listed before the files they contain and sum their lengths.
+func TestFileTree(test *testing.T) {
+	tree, err := FileTree([]File{
+		File{Path: "disc 2/b.flac", Length: 20},
+		File{Path: "cover.jpg", Length: 1},
+		File{Path: "disc 1/a.flac", Length: 10},
+		File{Path: "disc 1/scans/front.png", Length: 5},
+	})
+	if err != nil {
+		test.Fatalf("Error building the tree: %s", err.Error())
+	}
+
+	paths := make([]string, 0, len(tree))
+	for _, entry := range tree {
+		paths = append(paths, entry.Path)
+	}
+
+	expected := []string{"disc 1", "disc 1/scans", "disc 1/scans/front.png", "disc 1/a.flac",
+		"disc 2", "disc 2/b.flac", "cover.jpg"}
+	if !reflect.DeepEqual(paths, expected) {
+		test.Fatalf("Unexpected order: %v", paths)
+	}
+
+	if disc := tree[0]; !disc.IsDir || disc.Length != 15 || disc.DirId == 0 {
+		test.Errorf("Unexpected directory entry: %+v", disc)
+	}
+
+	if front := tree[2]; front.Depth != 2 || front.ParentClasses() != "tree-dir-1 tree-dir-2" {
+		test.Errorf("Unexpected nested file: %+v (%s)", front, front.ParentClasses())
+	}
+
+	if cover := tree[6]; cover.IsDir || len(cover.Parents) != 0 {
+		test.Errorf("Unexpected top-level file: %+v", cover)
+	}
+}
+
+func TestFileTreeSingleFile(test *testing.T) {
+	tree, err := FileTree([]File{File{Path: "movie.mkv", Length: 100}})
+	if err != nil || len(tree) != 1 || tree[0].IsDir || tree[0].Length != 100 {
+		test.Errorf("Unexpected tree: %+v", tree)
+	}
+}
+
+// Tests that a path which is both a file and a directory is an error; in either order.
+func TestFileTreeConflict(test *testing.T) {
+	orders := [][]File{
+		[]File{File{Path: "a", Length: 1}, File{Path: "a/b", Length: 1}},
+		[]File{File{Path: "a/b", Length: 1}, File{Path: "a", Length: 1}},
+	}
+
+	for _, files := range orders {
+		if tree, err := FileTree(files); err == nil {
+			test.Errorf("Expected %v to be rejected; got %+v", files, tree)
+		}
+	}
+}
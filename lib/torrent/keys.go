@@ -0,0 +1,92 @@
+package torrent
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The key babou shipped with before keys were configurable.
+// It is public knowledge; it is only used when no key has been configured.
+const INSECURE_DEFAULT_KEY string = "f75778f7425be4db0369d09af37a6c2b9ab3dea0e53e7bd57412e4b060e607f7"
+
+// Keys used to sign announce secrets.
+//
+// Secrets are always signed with the current key. While a key is being rotated
+// the previous key is also accepted until its grace window has passed; after
+// that .torrent files signed with the previous key must be downloaded again.
+type trackerKeys struct {
+	current []byte
+
+	previous      []byte
+	previousUntil time.Time
+}
+
+var keys = &trackerKeys{current: []byte(INSECURE_DEFAULT_KEY)}
+var keysLock = &sync.RWMutex{}
+
+// Replaces the keys used to sign and verify announce secrets.
+// The previous key may be nil if no key is being rotated out.
+func SetKeys(current, previous []byte, previousUntil time.Time) error {
+	if len(current) == 0 {
+		return fmt.Errorf("torrent: a tracker key is required")
+	}
+
+	keysLock.Lock()
+	defer keysLock.Unlock()
+
+	keys = &trackerKeys{current: current, previous: previous, previousUntil: previousUntil}
+
+	return nil
+}
+
+// Signs a user's secret with the current key.
+func SignSecret(secret []byte) []byte {
+	keysLock.RLock()
+	defer keysLock.RUnlock()
+
+	return sign(keys.current, secret)
+}
+
+func sign(key, secret []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(secret)
+
+	return mac.Sum(nil)
+}
+
+// Compares a message (the secret) and an HMAC of that message
+// against the tracker's key.
+//
+// This ensures that the .torrent file originated from this tracker and
+// is linked to an active user account.
+// The secret and hash are hex-encoded as they appear in an announce URL.
+func CheckHmac(secret, hash string) bool {
+	return checkHmacAt(secret, hash, time.Now())
+}
+
+func checkHmacAt(secret, hash string, now time.Time) bool {
+	secretBytes, err := hex.DecodeString(secret)
+	if err != nil {
+		return false
+	}
+
+	hashBytes, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+
+	keysLock.RLock()
+	defer keysLock.RUnlock()
+
+	if hmac.Equal(hashBytes, sign(keys.current, secretBytes)) {
+		return true
+	}
+
+	return len(keys.previous) > 0 &&
+		now.Before(keys.previousUntil) &&
+		hmac.Equal(hashBytes, sign(keys.previous, secretBytes))
+}
@@ -0,0 +1,72 @@
+package torrent
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+// Tests that the previous key is only accepted during its grace window.
+func TestKeyRotation(test *testing.T) {
+	defer SetKeys([]byte(INSECURE_DEFAULT_KEY), nil, time.Time{})
+
+	secret := []byte("secret")
+	SetKeys([]byte("old key"), nil, time.Time{})
+	oldHash := hex.EncodeToString(SignSecret(secret))
+
+	rotatedAt := time.Now()
+	SetKeys([]byte("new key"), []byte("old key"), rotatedAt.Add(1*time.Hour))
+	newHash := hex.EncodeToString(SignSecret(secret))
+
+	if !checkHmacAt(hex.EncodeToString(secret), newHash, rotatedAt) {
+		test.Errorf("Expected secrets signed with the current key to be accepted")
+	}
+
+	if !checkHmacAt(hex.EncodeToString(secret), oldHash, rotatedAt) {
+		test.Errorf("Expected secrets signed with the previous key to be accepted during the grace window")
+	}
+
+	if checkHmacAt(hex.EncodeToString(secret), oldHash, rotatedAt.Add(2*time.Hour)) {
+		test.Errorf("Expected secrets signed with the previous key to be refused after the grace window")
+	}
+
+	if CheckHmac("not hex", newHash) {
+		test.Errorf("Expected malformed secrets to be refused")
+	}
+}
+
+// Tests that announce templates are filled in for each tier.
+func TestAnnounceTiers(test *testing.T) {
+	defer SetAnnounce(DEFAULT_ANNOUNCE_HOST, DEFAULT_ANNOUNCE_PORT, nil)
+
+	SetAnnounce("tracker.example.com", 4000, [][]string{
+		[]string{"https://{host}/{secret}/{hash}/announce", "udp://{host}:{port}/{secret}/{hash}/announce"},
+		[]string{DEFAULT_ANNOUNCE_TEMPLATE},
+	})
+
+	tiers := AnnounceTiers([]byte{0xab}, []byte{0xcd})
+	if len(tiers) != 2 || len(tiers[0]) != 2 {
+		test.Fatalf("Expected tiers of 2 and 1 URLs; got %v", tiers)
+	}
+
+	if tiers[0][1] != "udp://tracker.example.com:4000/ab/cd/announce" {
+		test.Errorf("Unexpected UDP announce URL: %s", tiers[0][1])
+	}
+
+	if url := AnnounceURL([]byte{0xab}, []byte{0xcd}); url != "https://tracker.example.com/ab/cd/announce" {
+		test.Errorf("Expected the first URL of the first tier; got %s", url)
+	}
+}
+
+// Tests that a node without a tracker configured keeps the default address.
+func TestAnnounceDefaults(test *testing.T) {
+	defer SetAnnounce(DEFAULT_ANNOUNCE_HOST, DEFAULT_ANNOUNCE_PORT, nil)
+
+	for _, port := range []int{0, -1} {
+		SetAnnounce("", port, nil)
+
+		if url := AnnounceURL([]byte{0xab}, []byte{0xcd}); url != "http://localhost:4200/ab/cd/announce" {
+			test.Errorf("Expected the default announce URL for port %d; got %s", port, url)
+		}
+	}
+}
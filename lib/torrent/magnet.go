@@ -0,0 +1,53 @@
+package torrent
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The multihash prefix of a SHA-256 digest: the function code [0x12] and length [0x20].
+const SHA256_MULTIHASH_PREFIX string = "1220"
+
+// Builds a magnet link [BEP 9] for a torrent.
+//
+// v1 and hybrid torrents are identified by `urn:btih`; v2 and hybrid torrents
+// by `urn:btmh` [BEP 52]. `infoHashV2` is the full v2 info hash; it is empty
+// for v1 torrents, and a v2-only torrent's `infoHash` [its truncated v2 hash]
+// is left out. Every tracker is listed as a `tr` in the order given.
+func MagnetURI(infoHash, infoHashV2, name string, length int64, trackers []string) string {
+	params := make([]string, 0, 4+len(trackers))
+
+	if infoHashV2 == "" || !strings.HasPrefix(infoHashV2, infoHash) {
+		params = append(params, "xt=urn:btih:"+infoHash)
+	}
+
+	if infoHashV2 != "" {
+		params = append(params, "xt=urn:btmh:"+SHA256_MULTIHASH_PREFIX+infoHashV2)
+	}
+
+	if name != "" {
+		params = append(params, "dn="+url.QueryEscape(name))
+	}
+
+	if length > 0 {
+		params = append(params, "xl="+strconv.FormatInt(length, 10))
+	}
+
+	for _, tracker := range trackers {
+		params = append(params, "tr="+url.QueryEscape(tracker))
+	}
+
+	return "magnet:?" + strings.Join(params, "&")
+}
+
+// Returns a user's announce URLs as a single list; tier by tier.
+// Magnet links cannot describe tiers; clients try each tracker in turn.
+func AnnounceURLs(secret, hash []byte) []string {
+	urls := make([]string, 0)
+	for _, tier := range AnnounceTiers(secret, hash) {
+		urls = append(urls, tier...)
+	}
+
+	return urls
+}
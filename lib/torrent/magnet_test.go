@@ -0,0 +1,29 @@
+package torrent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMagnetURI(test *testing.T) {
+	v1 := strings.Repeat("ab", 20)
+	v2 := strings.Repeat("cd", 32)
+
+	magnet := MagnetURI(v1, "", "an album & more", 1024, []string{"http://tracker.example/s/h/announce"})
+	expected := "magnet:?xt=urn:btih:" + v1 + "&dn=an+album+%26+more&xl=1024" +
+		"&tr=http%3A%2F%2Ftracker.example%2Fs%2Fh%2Fannounce"
+	if magnet != expected {
+		test.Errorf("Expected a v1 magnet of %s; got %s", expected, magnet)
+	}
+
+	hybrid := MagnetURI(v1, v2, "album", 0, nil)
+	if hybrid != "magnet:?xt=urn:btih:"+v1+"&xt=urn:btmh:1220"+v2+"&dn=album" {
+		test.Errorf("Expected a hybrid magnet to have both hashes; got %s", hybrid)
+	}
+
+	// a v2-only torrent's info hash is its truncated v2 hash.
+	v2Only := MagnetURI(v2[:40], v2, "album", 0, nil)
+	if v2Only != "magnet:?xt=urn:btmh:1220"+v2+"&dn=album" {
+		test.Errorf("Expected a v2 magnet to only have its v2 hash; got %s", v2Only)
+	}
+}
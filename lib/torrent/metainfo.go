@@ -11,7 +11,7 @@ import (
 
 	"errors"
 	fmt "fmt"
-	"mime/multipart"
+	"strings"
 
 	bencode "github.com/zeebo/bencode"
 )
@@ -26,63 +26,128 @@ const (
 // A torrent includes a [decoded] copy of the metainfo file
 // as well as a list of active peers that is periodically culled.
 type Torrent struct {
-	InfoHash string
-	Info     *TorrentFile
-	peers    *PeerMap
+	InfoHash   string
+	InfoHashV2 string // the full v2 info hash of v2 and hybrid torrents; see `v2.go`
+	Info       *TorrentFile
+	peers      *PeerMap
 }
 
 // Represents a `babou` torrent.
-// We don't care about other fields so they will be discarded from uploaded torrents.
+// Keys babou does not model [e.g: `url-list`] are kept in `Extra` so that
+// a torrent is written back out the way it was uploaded. (Except for its trackers.)
 type TorrentFile struct {
-	Announce     string                 `bencode:"announce"`
-	Comment      string                 `bencode:"comment"`
-	CreatedBy    string                 `bencode:"created by"`
-	CreationDate int64                  `bencode:"creation date"`
-	Encoding     string                 `bencode:"encoding"`
-	Info         map[string]interface{} `bencode:"info"`
+	Announce     string                 `bencode:"announce,omitempty"`
+	AnnounceList [][]string             `bencode:"announce-list,omitempty"`
+	Comment      string                 `bencode:"comment,omitempty"`
+	CreatedBy    string                 `bencode:"created by,omitempty"`
+	CreationDate int64                  `bencode:"creation date,omitempty"`
+	Encoding     string                 `bencode:"encoding,omitempty"`
+	Info         map[string]interface{} `bencode:"info,omitempty"`
+	PieceLayers  map[string]string      `bencode:"piece layers,omitempty"` // v2 only; see `v2.go`
+
+	Extra map[string]interface{} `bencode:"-"` // every other top-level key; as it was decoded.
 }
 
-// Writes a new torrent to be used by the tracker for maintaining peer lists.
-func NewTorrent(file *TorrentFile) *Torrent {
-	out := &Torrent{peers: NewPeerMap()}
-	out.Info = file
+// The top-level keys modeled by `TorrentFile`
+var metainfoKeys = []string{"announce", "announce-list", "comment", "created by",
+	"creation date", "encoding", "info", "piece layers"}
 
-	return out
+// Top-level keys which point clients at peers other than babou's tracker.
+// They are stripped from uploaded torrents along with `announce` and `announce-list`
+var peerSourceKeys = []string{"nodes"}
+
+// `TorrentFile` without its bencode methods.
+type metainfo TorrentFile
+
+// Decodes the modeled keys into their fields and keeps the rest in `Extra`
+func (t *TorrentFile) UnmarshalBencode(data []byte) error {
+	if err := bencode.DecodeBytes(data, (*metainfo)(t)); err != nil {
+		return err
+	}
+
+	extra := make(map[string]interface{})
+	if err := bencode.DecodeBytes(data, &extra); err != nil {
+		return err
+	}
+
+	for _, key := range metainfoKeys {
+		delete(extra, key)
+	}
+
+	t.Extra = nil
+	if len(extra) > 0 {
+		t.Extra = extra
+	}
+
+	return nil
 }
 
-// Reads a torrent-file from the filesystem.
-// TODO: Model will create torrent-file; obsoleting this.
-func ReadFile(file multipart.File) *Torrent {
-	fmt.Printf("reading file...")
+// Encodes the modeled fields along with the keys in `Extra`
+// The modeled fields win if a key is in both.
+func (t TorrentFile) MarshalBencode() ([]byte, error) {
+	modeled, err := bencode.EncodeBytes(metainfo(t))
+	if err != nil || len(t.Extra) == 0 {
+		return modeled, err
+	}
 
-	torrent := &Torrent{Info: &TorrentFile{}, peers: NewPeerMap()}
+	dict := make(map[string]bencode.RawMessage)
+	if err := bencode.DecodeBytes(modeled, &dict); err != nil {
+		return nil, err
+	}
 
-	decoder := bencode.NewDecoder(file)
-	err := decoder.Decode(torrent.Info)
-	if err != nil {
-		fmt.Printf("error decoding torrent file: %s", err.Error())
+	for key, value := range t.Extra {
+		if _, ok := dict[key]; ok {
+			continue
+		}
+
+		encoded, err := bencode.EncodeBytes(value)
+		if err != nil {
+			return nil, err
+		}
+
+		dict[key] = encoded
 	}
 
-	metainfo := torrent.Info
-	torrent.Info.Info["private"] = 1
+	return bencode.EncodeBytes(dict)
+}
+
+// Removes every tracker [and DHT node] from the torrent.
+// babou adds its own trackers when the torrent is downloaded; see `WriteFile`
+func (t *TorrentFile) StripTrackers() {
+	t.Announce = ""
+	t.AnnounceList = nil
+
+	for _, key := range peerSourceKeys {
+		delete(t.Extra, key)
+	}
+}
 
-	fmt.Printf("info[] hash: %x \n", metainfo.EncodeInfo())
-	fmt.Printf("# of pieces (hashes): %d \n", len(metainfo.Info["pieces"].(string))/20)
+// Writes a new torrent to be used by the tracker for maintaining peer lists.
+func NewTorrent(file *TorrentFile) *Torrent {
+	out := &Torrent{peers: NewPeerMap()}
+	out.Info = file
 
-	return torrent
+	return out
 }
 
 // Converts torrent to SUPRA-PRIVATE torrent
 //
 // Sets the private flag to 1 and embeds the supplied secret and hash
-// for authentication purposes.
+// for authentication purposes. Announce URLs are built from the templates
+// passed to `SetAnnounce`
 //
 // This torrent file SHOULD NOT be shared between users or statistics collection
 // and anti-abuse mechanisms will be skewed for that user.
 func (t *TorrentFile) WriteFile(secret, hash []byte) ([]byte, error) {
 	fmt.Printf("writing file...")
 
-	t.Announce = fmt.Sprintf("http://tracker.fatalsyntax.com:4200/%s/%s/announce", hex.EncodeToString(secret), hex.EncodeToString(hash))
+	t.StripTrackers()
+	tiers := AnnounceTiers(secret, hash)
+	t.Announce = AnnounceURL(secret, hash)
+	if len(tiers) > 1 || (len(tiers) == 1 && len(tiers[0]) > 1) {
+		t.AnnounceList = tiers // clients which understand BEP 12 ignore `announce`
+	}
+
 	t.Encoding = "UTF-8"
 	infoBuffer := bytes.NewBuffer(make([]byte, 0))
 	encoder := bencode.NewEncoder(infoBuffer)
@@ -317,6 +382,110 @@ func (t *TorrentFile) BencodeInfoDict() ([]byte, error) {
 	return infoBuffer.Bytes(), err
 }
 
+// Returns a bencoded version of the torrent's top-level dict without
+// its info dict or piece layers; which are stored on their own.
+func (t *TorrentFile) BencodeMetainfo() ([]byte, error) {
+	outer := *t
+	outer.Info = nil
+	outer.PieceLayers = nil
+
+	return bencode.EncodeBytes(outer)
+}
+
+// Decodes a top-level dict written by `BencodeMetainfo`
+func DecodeMetainfo(bencodedMetainfo []byte) (*TorrentFile, error) {
+	file := &TorrentFile{}
+	if err := bencode.DecodeBytes(bencodedMetainfo, file); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// A file described by a torrent's info dict.
+type File struct {
+	Path   string `json:"path"` // relative to the torrent's directory; components are joined with "/"
+	Length int64  `json:"length"`
+}
+
+// Returns the files described by the info dict.
+// Single-file torrents have a `length`; multi-file torrents list theirs in `files`
+// and v2 torrents in their `file tree`. The padding files of hybrid torrents are skipped.
+func (t *TorrentFile) Files() []File {
+	if t.IsV2() && !t.IsV1() {
+		return t.v2Files()
+	}
+
+	if length, ok := bencodeInt(t.Info["length"]); ok {
+		name, _ := t.Info["name"].(string)
+		return []File{File{Path: name, Length: length}}
+	}
+
+	entries, _ := t.Info["files"].([]interface{})
+	files := make([]File, 0, len(entries))
+	for _, entry := range entries {
+		fileDict, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if attr, _ := fileDict["attr"].(string); strings.Contains(attr, "p") {
+			continue // padding
+		}
+
+		components, _ := fileDict["path"].([]interface{})
+		path := make([]string, 0, len(components))
+		for _, component := range components {
+			if name, ok := component.(string); ok {
+				path = append(path, name)
+			}
+		}
+
+		length, _ := bencodeInt(fileDict["length"])
+		files = append(files, File{Path: strings.Join(path, "/"), Length: length})
+	}
+
+	return files
+}
+
+// Returns the total length [in bytes] of the files described by the info dict.
+func (t *TorrentFile) TotalLength() int64 {
+	var total int64
+	for _, file := range t.Files() {
+		total += file.Length
+	}
+
+	return total
+}
+
+// Formats a number of bytes with binary units; e.g: "4.7 GiB"
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Integers are decoded as int64; but a dict built by hand may use an int.
+func bencodeInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+
+	return 0, false
+}
+
 func DecodeInfoDict(bencodedInfo []byte) (map[string]interface{}, error) {
 	decodedMap := make(map[string]interface{})
 
@@ -0,0 +1,125 @@
+package torrent
+
+import (
+	"bytes"
+	"testing"
+
+	bencode "github.com/zeebo/bencode"
+)
+
+// Tests that single and multi-file torrents list their files.
+func TestFiles(test *testing.T) {
+	single := &TorrentFile{Info: map[string]interface{}{"length": int64(1024)}}
+	if length := single.TotalLength(); length != 1024 {
+		test.Errorf("Expected a single-file torrent to be 1024 bytes; got %d", length)
+	}
+
+	multi := &TorrentFile{Info: map[string]interface{}{
+		"files": []interface{}{
+			map[string]interface{}{"length": int64(1000), "path": []interface{}{"disc 1", "a.flac"}},
+			map[string]interface{}{"length": 24, "path": []interface{}{"b.cue"}},
+		},
+	}}
+	if length := multi.TotalLength(); length != 1024 {
+		test.Errorf("Expected a multi-file torrent to be 1024 bytes; got %d", length)
+	}
+
+	if files := multi.Files(); len(files) != 2 || files[0].Path != "disc 1/a.flac" || files[1].Path != "b.cue" {
+		test.Errorf("Unexpected files: %+v", files)
+	}
+}
+
+func TestFormatSize(test *testing.T) {
+	sizes := map[int64]string{
+		0:                  "0 B",
+		1023:               "1023 B",
+		1024:               "1.0 KiB",
+		1536:               "1.5 KiB",
+		5 * 1024 * 1024:    "5.0 MiB",
+		4700 * 1024 * 1024: "4.6 GiB",
+	}
+
+	for size, expected := range sizes {
+		if formatted := FormatSize(size); formatted != expected {
+			test.Errorf("Expected %d bytes to be formatted as %s; got %s", size, expected, formatted)
+		}
+	}
+}
+
+// Tests that keys babou does not model survive decoding and encoding.
+func TestMetainfoRoundTrip(test *testing.T) {
+	original, err := bencode.EncodeBytes(map[string]interface{}{
+		"comment":  "ripped by someone",
+		"url-list": []interface{}{"http://mirror.example/album/"},
+		"x-custom": map[string]interface{}{"nested": int64(7)},
+		"info":     validInfo(),
+	})
+	if err != nil {
+		test.Fatalf("Error encoding metainfo: %s", err.Error())
+	}
+
+	file := &TorrentFile{}
+	if err := bencode.DecodeBytes(original, file); err != nil {
+		test.Fatalf("Error decoding metainfo: %s", err.Error())
+	}
+
+	if file.Comment != "ripped by someone" || len(file.Extra) != 2 {
+		test.Errorf("Expected a comment and two unknown keys; got %+v", file)
+	}
+
+	encoded, err := bencode.EncodeBytes(file)
+	if err != nil {
+		test.Fatalf("Error encoding torrent file: %s", err.Error())
+	}
+
+	if !bytes.Equal(original, encoded) {
+		test.Errorf("Expected metainfo to round-trip; got %q", encoded)
+	}
+
+	stored, err := file.BencodeMetainfo()
+	if err != nil {
+		test.Fatalf("Error encoding top-level dict: %s", err.Error())
+	}
+
+	loaded, err := DecodeMetainfo(stored)
+	if err != nil {
+		test.Fatalf("Error decoding top-level dict: %s", err.Error())
+	}
+
+	if loaded.Info != nil || loaded.Comment != file.Comment || len(loaded.Extra) != 2 {
+		test.Errorf("Expected the top-level dict without its info; got %+v", loaded)
+	}
+}
+
+// Tests that a downloaded torrent only announces to babou.
+func TestWriteFileReplacesTrackers(test *testing.T) {
+	file := &TorrentFile{
+		Announce:     "http://other.example/announce",
+		AnnounceList: [][]string{[]string{"http://other.example/announce"}, []string{"udp://other.example:80"}},
+		Info:         validInfo(),
+		Extra:        map[string]interface{}{"nodes": []interface{}{}, "url-list": "http://mirror.example/"},
+	}
+
+	first, err := file.WriteFile([]byte("secret"), []byte("hash"))
+	if err != nil {
+		test.Fatalf("Error writing torrent file: %s", err.Error())
+	}
+
+	written := &TorrentFile{}
+	if err := bencode.DecodeBytes(first, written); err != nil {
+		test.Fatalf("Error decoding written torrent: %s", err.Error())
+	}
+
+	if written.Announce != AnnounceURL([]byte("secret"), []byte("hash")) || written.AnnounceList != nil {
+		test.Errorf("Expected only babou's tracker; got %s %v", written.Announce, written.AnnounceList)
+	}
+
+	if _, ok := written.Extra["nodes"]; ok || written.Extra["url-list"] != "http://mirror.example/" {
+		test.Errorf("Expected DHT nodes to be stripped and web seeds kept; got %v", written.Extra)
+	}
+
+	second, _ := written.WriteFile([]byte("secret"), []byte("hash"))
+	if !bytes.Equal(first, second) {
+		test.Errorf("Expected writing a torrent to be deterministic.")
+	}
+}
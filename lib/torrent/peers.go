@@ -1,10 +1,6 @@
 package torrent
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-
-	"encoding/hex"
 	"errors"
 	"net"
 	"strconv"
@@ -147,29 +143,3 @@ func (p *Peer) UpdateStats(uploaded, downloaded, left string) error {
 
 	return nil
 }
-
-// Compares a message (the secret) and an HMAC of that message
-// against a secret-key.
-//
-// This ensures that the .torrent file originated from this tracker and
-// is linked to an active user account.
-//
-//  The secret and hash are []byte arrays and stored as such.
-//  They must be deserialized
-func CheckHmac(secret, hash string) bool {
-	//TODO: taken from users model. should be config param.
-	sharedKey := []byte("f75778f7425be4db0369d09af37a6c2b9ab3dea0e53e7bd57412e4b060e607f7")
-	secretBytes, err := hex.DecodeString(secret)
-	hashBytes, err := hex.DecodeString(hash)
-
-	if err != nil {
-		return false
-	}
-
-	mac := hmac.New(sha256.New, sharedKey)
-	mac.Write(secretBytes)
-
-	outVal := hmac.Equal(hashBytes, mac.Sum(nil))
-
-	return outVal
-}
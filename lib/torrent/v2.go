@@ -0,0 +1,245 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	bencode "github.com/zeebo/bencode"
+)
+
+// BitTorrent v2 [BEP 52]
+//
+// A v2 torrent describes its files with a `file tree` and hashes each file
+// separately: a file's `pieces root` is the root of a merkle tree whose
+// leaves are 16 KiB blocks. The layer of that tree for the torrent's piece
+// length is stored outside of the info dict in `piece layers`.
+//
+// A hybrid torrent is both a v1 and a v2 torrent: its info dict has `pieces`
+// and a `files` list [padded so that files start on piece boundaries] along
+// with a `file tree` describing the same files.
+//
+// A v2 torrent is identified by the SHA-256 of its info dict; clients
+// truncate it to 20 bytes when they talk to trackers.
+const (
+	META_VERSION_2   int64 = 2
+	MIN_PIECE_LENGTH int64 = 16 * 1024 // v2 piece lengths are at least one block.
+
+	HASH_V2_LENGTH        = sha256.Size
+	TRUNCATED_HASH_LENGTH = 20 // the length of info hashes sent to trackers; in bytes.
+)
+
+// Tests if the info dict describes a v1 torrent. [Hybrid torrents are both.]
+func (t *TorrentFile) IsV1() bool {
+	_, ok := t.Info["pieces"]
+	return ok
+}
+
+// Tests if the info dict describes a v2 torrent. [Hybrid torrents are both.]
+func (t *TorrentFile) IsV2() bool {
+	version, _ := bencodeInt(t.Info["meta version"])
+	return version == META_VERSION_2
+}
+
+// Tests if the info dict describes both a v1 and a v2 torrent.
+func (t *TorrentFile) IsHybrid() bool {
+	return t.IsV1() && t.IsV2()
+}
+
+// Returns the SHA-256 of the info dict [the v2 info hash] as a string
+// [two chars per byte]; or an empty string if this is not a v2 torrent.
+func (t *TorrentFile) EncodeInfoV2ToString() string {
+	if !t.IsV2() {
+		return ""
+	}
+
+	infoBuffer := bytes.NewBuffer(make([]byte, 0))
+	if err := bencode.NewEncoder(infoBuffer).Encode(t.Info); err != nil {
+		fmt.Printf("error encoding torrent file: %s", err.Error())
+	}
+
+	hash := sha256.Sum256(infoBuffer.Bytes())
+	return hex.EncodeToString(hash[:])
+}
+
+// Returns the hash which identifies this torrent as a string [two chars per byte]
+//
+// This is the v1 info hash for v1 and hybrid torrents; v2 torrents are
+// identified by their truncated v2 info hash since that is what clients announce.
+func (t *TorrentFile) InfoHash() string {
+	if t.IsV1() {
+		return t.EncodeInfoToString()
+	}
+
+	return TruncateHash(t.EncodeInfoV2ToString())
+}
+
+// Truncates a [hex encoded] v2 info hash to the length clients send to trackers.
+func TruncateHash(hashV2 string) string {
+	if len(hashV2) > TRUNCATED_HASH_LENGTH*2 {
+		return hashV2[:TRUNCATED_HASH_LENGTH*2]
+	}
+
+	return hashV2
+}
+
+// Returns the files described by a v2 `file tree`; sorted by path.
+func (t *TorrentFile) v2Files() []File {
+	files := make([]File, 0)
+	walkFileTree(t.Info["file tree"], nil, func(path []string, file map[string]interface{}) string {
+		length, _ := bencodeInt(file["length"])
+		files = append(files, File{Path: strings.Join(path, "/"), Length: length})
+		return ""
+	})
+
+	return files
+}
+
+// Visits each file in a `file tree` in order. The visitor returns a reason
+// the file is invalid; or an empty string. Reasons the tree itself is
+// invalid are returned along with the visitor's.
+func walkFileTree(node interface{}, path []string, visit func([]string, map[string]interface{}) string) []string {
+	dir, ok := node.(map[string]interface{})
+	if !ok || len(dir) == 0 {
+		return []string{fmt.Sprintf("The directory [%s] in the file tree is empty.", strings.Join(path, "/"))}
+	}
+
+	names := make([]string, 0, len(dir))
+	for name := range dir {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reasons := make([]string, 0)
+	for _, name := range names {
+		child := append(path[:len(path):len(path)], name)
+		if reason := invalidPathComponent(name); reason != "" {
+			reasons = append(reasons, fmt.Sprintf("The path [%s] %s.", strings.Join(child, "/"), reason))
+			continue
+		}
+
+		// a file is a dict with a single empty key.
+		if entry, ok := dir[name].(map[string]interface{}); ok && len(entry) == 1 {
+			if file, ok := entry[""].(map[string]interface{}); ok {
+				if reason := visit(child, file); reason != "" {
+					reasons = append(reasons, reason)
+				}
+
+				continue
+			}
+		}
+
+		reasons = append(reasons, walkFileTree(dir[name], child, visit)...)
+	}
+
+	return reasons
+}
+
+// Validates the `file tree` of a v2 torrent along with its `piece layers`
+func (t *TorrentFile) validateV2(pieceLength int64) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	if pieceLength < MIN_PIECE_LENGTH {
+		errs = append(errs, fmt.Sprintf("The piece length of a v2 torrent must be at least %s.",
+			FormatSize(MIN_PIECE_LENGTH)))
+		return errs
+	}
+
+	if _, ok := t.Info["file tree"]; !ok {
+		return append(errs, "The torrent is missing its `file tree`.")
+	}
+
+	layers := 0
+	numFiles := 0
+	reasons := walkFileTree(t.Info["file tree"], nil, func(path []string, file map[string]interface{}) string {
+		numFiles++
+		length, ok := bencodeInt(file["length"])
+		if !ok || length < 0 {
+			return fmt.Sprintf("The file [%s] has an invalid length.", strings.Join(path, "/"))
+		} else if length == 0 {
+			return ""
+		}
+
+		root, ok := file["pieces root"].(string)
+		if !ok || len(root) != HASH_V2_LENGTH {
+			return fmt.Sprintf("The file [%s] is missing its `pieces root`.", strings.Join(path, "/"))
+		}
+
+		// files no larger than a piece are verified by their root alone.
+		if length <= pieceLength {
+			return ""
+		}
+
+		layers++
+		expected := int((length + pieceLength - 1) / pieceLength)
+		if layer, ok := t.PieceLayers[root]; !ok || len(layer) != expected*HASH_V2_LENGTH {
+			return fmt.Sprintf("The `piece layers` are missing the hashes of [%s].", strings.Join(path, "/"))
+		}
+
+		return ""
+	})
+
+	if numFiles > MAX_FILES {
+		return append(errs, fmt.Sprintf("Torrents may contain at most %d files.", MAX_FILES))
+	}
+
+	errs = append(errs, reasons...)
+	if len(errs) == 0 && len(t.PieceLayers) != layers {
+		errs = append(errs, "The `piece layers` contain hashes of files which are not in the torrent.")
+	}
+
+	return errs
+}
+
+// Tests that the v1 and v2 halves of a hybrid torrent describe the same files.
+func (t *TorrentFile) validateHybrid() ValidationErrors {
+	v1 := t.Files()
+	v2 := t.v2Files()
+	sort.Sort(byPath(v1))
+	sort.Sort(byPath(v2))
+
+	if len(v1) != len(v2) {
+		return ValidationErrors{"The v1 and v2 parts of this hybrid torrent list different files."}
+	}
+
+	for i := range v1 {
+		if v1[i] != v2[i] {
+			return ValidationErrors{fmt.Sprintf(
+				"The v1 and v2 parts of this hybrid torrent disagree about [%s].", v2[i].Path)}
+		}
+	}
+
+	return nil
+}
+
+type byPath []File
+
+func (files byPath) Len() int           { return len(files) }
+func (files byPath) Swap(i, j int)      { files[i], files[j] = files[j], files[i] }
+func (files byPath) Less(i, j int) bool { return files[i].Path < files[j].Path }
+
+// Returns the torrent's bencoded `piece layers`; or nil if it has none.
+func (t *TorrentFile) BencodePieceLayers() ([]byte, error) {
+	if len(t.PieceLayers) == 0 {
+		return nil, nil
+	}
+
+	layersBuffer := bytes.NewBuffer(make([]byte, 0))
+	if err := bencode.NewEncoder(layersBuffer).Encode(t.PieceLayers); err != nil {
+		return nil, err
+	}
+
+	return layersBuffer.Bytes(), nil
+}
+
+// Decodes `piece layers` stored by `BencodePieceLayers`
+func DecodePieceLayers(bencodedLayers []byte) (map[string]string, error) {
+	layers := make(map[string]string)
+	if err := bencode.DecodeBytes(bencodedLayers, &layers); err != nil {
+		return nil, err
+	}
+
+	return layers, nil
+}
@@ -0,0 +1,90 @@
+package torrent
+
+import (
+	"strings"
+	"testing"
+)
+
+// A v2 file of `length` bytes with a [fake] pieces root.
+func v2File(length int64, root string) map[string]interface{} {
+	return map[string]interface{}{"": map[string]interface{}{
+		"length":      length,
+		"pieces root": strings.Repeat(root, HASH_V2_LENGTH),
+	}}
+}
+
+func v2Info() *TorrentFile {
+	return &TorrentFile{
+		Info: map[string]interface{}{
+			"name":         "album",
+			"meta version": int64(2),
+			"piece length": int64(16384),
+			"file tree": map[string]interface{}{
+				"b.cue":  v2File(100, "b"),
+				"disc 1": map[string]interface{}{"a.flac": v2File(20000, "a")},
+			},
+		},
+		PieceLayers: map[string]string{strings.Repeat("a", HASH_V2_LENGTH): strings.Repeat("x", 2*HASH_V2_LENGTH)},
+	}
+}
+
+func TestValidateV2(test *testing.T) {
+	torrent := v2Info()
+	if errs := torrent.Validate(); errs != nil {
+		test.Fatalf("Expected a valid v2 torrent; got %v", errs)
+	}
+
+	if files := torrent.Files(); len(files) != 2 || files[1].Path != "disc 1/a.flac" || torrent.TotalLength() != 20100 {
+		test.Errorf("Unexpected files: %+v", files)
+	}
+
+	if torrent.IsV1() || !torrent.IsV2() || len(torrent.EncodeInfoV2ToString()) != 64 {
+		test.Errorf("Expected a v2-only torrent with a SHA-256 info hash.")
+	}
+
+	if hash := torrent.InfoHash(); hash != TruncateHash(torrent.EncodeInfoV2ToString()) || len(hash) != 40 {
+		test.Errorf("Expected a v2 torrent to be identified by its truncated hash; got %s", hash)
+	}
+
+	torrent.PieceLayers = nil
+	if errs := torrent.Validate(); len(errs) == 0 {
+		test.Errorf("Expected a v2 torrent without its piece layers to be rejected.")
+	}
+}
+
+// Tests that both halves of a hybrid torrent must describe the same files.
+func TestValidateHybrid(test *testing.T) {
+	torrent := v2Info()
+	torrent.Info["pieces"] = strings.Repeat("x", 3*20)
+	torrent.Info["files"] = []interface{}{
+		map[string]interface{}{"length": int64(100), "path": []interface{}{"b.cue"}},
+		map[string]interface{}{"length": int64(16284), "path": []interface{}{".pad", "16284"}, "attr": "p"},
+		map[string]interface{}{"length": int64(20000), "path": []interface{}{"disc 1", "a.flac"}},
+	}
+
+	if errs := torrent.Validate(); errs != nil {
+		test.Fatalf("Expected a valid hybrid torrent; got %v", errs)
+	}
+
+	if !torrent.IsHybrid() || len(torrent.InfoHash()) != 40 || torrent.InfoHash() == TruncateHash(torrent.EncodeInfoV2ToString()) {
+		test.Errorf("Expected a hybrid torrent to be identified by its v1 hash.")
+	}
+
+	torrent.Info["files"].([]interface{})[0].(map[string]interface{})["length"] = int64(99)
+	if errs := torrent.Validate(); len(errs) == 0 {
+		test.Errorf("Expected a hybrid torrent whose halves disagree to be rejected.")
+	}
+}
+
+func TestPieceLayersRoundTrip(test *testing.T) {
+	torrent := v2Info()
+	encoded, err := torrent.BencodePieceLayers()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	layers, err := DecodePieceLayers(encoded)
+	if err != nil || len(layers) != 1 || layers[strings.Repeat("a", HASH_V2_LENGTH)] != strings.Repeat("x", 2*HASH_V2_LENGTH) {
+		test.Errorf("Expected the piece layers to survive encoding; got %v (%v)", layers, err)
+	}
+}
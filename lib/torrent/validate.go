@@ -0,0 +1,292 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	bencode "github.com/zeebo/bencode"
+)
+
+// Limits on uploaded metainfo files.
+const (
+	MAX_METAINFO_SIZE int64 = 10 * 1024 * 1024 // the largest .torrent file accepted; in bytes.
+	MAX_PIECE_LENGTH  int64 = 64 * 1024 * 1024
+	MAX_FILES         int   = 100000
+)
+
+// The `source` tag added to the info dict of uploaded torrents.
+var source string
+var sourceLock = &sync.RWMutex{}
+
+// Sets the `source` tag added to uploaded torrents. Tagging them gives each
+// torrent an info hash unique to this site; so a torrent cross-seeded from
+// another tracker does not share its swarm. An empty tag keeps the uploader's.
+func SetSource(tag string) {
+	sourceLock.Lock()
+	defer sourceLock.Unlock()
+
+	source = tag
+}
+
+// Returns the `source` tag added to uploaded torrents.
+func Source() string {
+	sourceLock.RLock()
+	defer sourceLock.RUnlock()
+
+	return source
+}
+
+// The reasons a metainfo file was rejected. Each reason is suitable
+// for showing to the user who uploaded it.
+type ValidationErrors []string
+
+func (errs ValidationErrors) Error() string {
+	return strings.Join(errs, " ")
+}
+
+// Reads and validates an uploaded metainfo file.
+//
+// Returns `ValidationErrors` if the file is not a well-formed torrent.
+// A torrent which was read is marked private, tagged with the site's
+// `source`, and stripped of its trackers.
+func ReadFile(file io.Reader) (*Torrent, error) {
+	metainfo, err := ioutil.ReadAll(io.LimitReader(file, MAX_METAINFO_SIZE+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(metainfo)) > MAX_METAINFO_SIZE {
+		return nil, ValidationErrors{fmt.Sprintf(
+			"Torrent files may be at most %s.", FormatSize(MAX_METAINFO_SIZE))}
+	}
+
+	torrent := &Torrent{Info: &TorrentFile{}, peers: NewPeerMap()}
+	decoder := bencode.NewDecoder(bytes.NewReader(metainfo))
+	if err := decoder.Decode(torrent.Info); err != nil {
+		return nil, ValidationErrors{"This is not a valid torrent file; it could not be decoded."}
+	} else if decoder.BytesParsed() != len(metainfo) {
+		return nil, ValidationErrors{"This is not a valid torrent file; it has data after its end."}
+	}
+
+	if errs := torrent.Info.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+
+	torrent.Info.Info["private"] = 1
+	if tag := Source(); tag != "" {
+		torrent.Info.Info["source"] = tag
+	}
+
+	torrent.Info.StripTrackers()
+	torrent.InfoHash = torrent.Info.InfoHash()
+	torrent.InfoHashV2 = torrent.Info.EncodeInfoV2ToString()
+
+	return torrent, nil
+}
+
+// Tests that the info dict describes a torrent which can be served:
+// its pieces, piece length, name, and file lengths and paths are checked.
+// v2 and hybrid torrents are checked as described in `v2.go`
+// Returns nil if the torrent is valid.
+func (t *TorrentFile) Validate() ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if t.Info == nil {
+		return ValidationErrors{"The torrent file is missing its `info` dictionary."}
+	}
+
+	if _, ok := t.Info["meta version"]; ok && !t.IsV2() {
+		return ValidationErrors{"The torrent's `meta version` is not supported."}
+	}
+
+	isV1, isV2 := t.IsV1(), t.IsV2()
+	if !isV1 && !isV2 {
+		fail("The torrent is missing its `pieces`.")
+	}
+
+	name, ok := t.Info["name"].(string)
+	if !ok || name == "" {
+		fail("The torrent is missing its name.")
+	} else if reason := invalidPathComponent(name); reason != "" {
+		fail("The torrent's name %s.", reason)
+	}
+
+	pieceLength, ok := bencodeInt(t.Info["piece length"])
+	if !ok {
+		fail("The torrent is missing its `piece length`.")
+	} else if pieceLength <= 0 || pieceLength > MAX_PIECE_LENGTH || pieceLength&(pieceLength-1) != 0 {
+		fail("The torrent's piece length must be a power of two no larger than %s.", FormatSize(MAX_PIECE_LENGTH))
+	} else if isV2 {
+		errs = append(errs, t.validateV2(pieceLength)...)
+	}
+
+	pieces, _ := t.Info["pieces"].(string)
+	if isV1 {
+		if len(pieces) == 0 {
+			fail("The torrent is missing its `pieces`.")
+		} else if len(pieces)%20 != 0 {
+			fail("The torrent's `pieces` are not a list of SHA-1 hashes.")
+		}
+
+		_, isSingle := t.Info["length"]
+		_, isMulti := t.Info["files"]
+		switch {
+		case isSingle && isMulti:
+			fail("The torrent cannot have both a `length` and a list of `files`.")
+		case isSingle:
+			if length, ok := bencodeInt(t.Info["length"]); !ok || length < 0 {
+				fail("The torrent's length is invalid.")
+			}
+		case isMulti:
+			errs = append(errs, validateFiles(t.Info["files"])...)
+		default:
+			fail("The torrent is missing its `length` or list of `files`.")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if t.TotalLength() <= 0 {
+		return ValidationErrors{"The torrent does not contain any data."}
+	}
+
+	// v1 pieces span padding files too.
+	if isV1 {
+		total := t.v1Length()
+		if expected := (total + pieceLength - 1) / pieceLength; int64(len(pieces)/20) != expected {
+			fail("The torrent has %d pieces; %d are needed for its files.", len(pieces)/20, expected)
+		}
+	}
+
+	if isV1 && isV2 {
+		errs = append(errs, t.validateHybrid()...)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// Returns the length of the data hashed by the v1 `pieces`; including padding.
+func (t *TorrentFile) v1Length() int64 {
+	if length, ok := bencodeInt(t.Info["length"]); ok {
+		return length
+	}
+
+	var total int64
+	entries, _ := t.Info["files"].([]interface{})
+	for _, entry := range entries {
+		if fileDict, ok := entry.(map[string]interface{}); ok {
+			length, _ := bencodeInt(fileDict["length"])
+			total += length
+		}
+	}
+
+	return total
+}
+
+func validateFiles(entry interface{}) ValidationErrors {
+	entries, ok := entry.([]interface{})
+	if !ok || len(entries) == 0 {
+		return ValidationErrors{"The torrent's list of `files` is empty."}
+	} else if len(entries) > MAX_FILES {
+		return ValidationErrors{fmt.Sprintf("Torrents may contain at most %d files.", MAX_FILES)}
+	}
+
+	errs := make(ValidationErrors, 0)
+	seen := make(map[string]bool, len(entries))
+	dirs := make(map[string]bool)
+	for i, entry := range entries {
+		fileDict, ok := entry.(map[string]interface{})
+		if !ok {
+			errs = append(errs, fmt.Sprintf("File #%d is not a dictionary.", i+1))
+			continue
+		}
+
+		if length, ok := bencodeInt(fileDict["length"]); !ok || length < 0 {
+			errs = append(errs, fmt.Sprintf("File #%d has an invalid length.", i+1))
+		}
+
+		components, _ := fileDict["path"].([]interface{})
+		if len(components) == 0 {
+			errs = append(errs, fmt.Sprintf("File #%d is missing its path.", i+1))
+			continue
+		}
+
+		path := make([]string, 0, len(components))
+		for _, component := range components {
+			name, ok := component.(string)
+			if !ok {
+				name = ""
+			}
+
+			if reason := invalidPathComponent(name); reason != "" {
+				errs = append(errs, fmt.Sprintf("The path of file #%d %s.", i+1, reason))
+				break
+			}
+
+			path = append(path, name)
+		}
+
+		if len(path) != len(components) {
+			continue
+		}
+
+		// padding files [BEP 47] are never written; so may share a name.
+		if attr, _ := fileDict["attr"].(string); strings.Contains(attr, "p") {
+			continue
+		}
+
+		joined := strings.Join(path, "/")
+		if seen[joined] {
+			errs = append(errs, fmt.Sprintf("The file [%s] is listed more than once.", joined))
+		}
+		seen[joined] = true
+
+		for j := 1; j < len(path); j++ {
+			dirs[strings.Join(path[:j], "/")] = true
+		}
+	}
+
+	// a path cannot be a file and the directory of another file. [e.g: "a" and "a/b"]
+	conflicts := make([]string, 0)
+	for joined := range seen {
+		if dirs[joined] {
+			conflicts = append(conflicts, joined)
+		}
+	}
+
+	sort.Strings(conflicts)
+	for _, joined := range conflicts {
+		errs = append(errs, fmt.Sprintf("The file [%s] is also the directory of another file.", joined))
+	}
+
+	return errs
+}
+
+// Returns why a component of a path cannot be written safely by a client;
+// or an empty string if it can be.
+func invalidPathComponent(name string) string {
+	switch {
+	case name == "":
+		return "has an empty component"
+	case name == "." || name == "..":
+		return "refers to a parent directory"
+	case strings.ContainsAny(name, "/\\"):
+		return "contains a directory separator [or is absolute]"
+	case strings.ContainsRune(name, 0):
+		return "contains a NUL character"
+	}
+
+	return ""
+}
@@ -0,0 +1,124 @@
+package torrent
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	bencode "github.com/zeebo/bencode"
+)
+
+func encodeMetainfo(test *testing.T, info map[string]interface{}) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	if err := bencode.NewEncoder(buf).Encode(map[string]interface{}{"announce": "http://example", "info": info}); err != nil {
+		test.Fatalf("Error encoding metainfo: %s", err.Error())
+	}
+
+	return buf
+}
+
+func validInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"name":         "album",
+		"piece length": int64(16384),
+		"pieces":       strings.Repeat("x", 40),
+		"files": []interface{}{
+			map[string]interface{}{"length": int64(20000), "path": []interface{}{"disc 1", "a.flac"}},
+			map[string]interface{}{"length": int64(100), "path": []interface{}{"b.cue"}},
+		},
+	}
+}
+
+func TestReadFile(test *testing.T) {
+	torrent, err := ReadFile(encodeMetainfo(test, validInfo()))
+	if err != nil {
+		test.Fatalf("Expected a valid torrent; got: %s", err.Error())
+	}
+
+	if torrent.Info.Info["private"] != 1 || len(torrent.InfoHash) != 40 {
+		test.Errorf("Expected a private torrent with an info hash; got %+v", torrent)
+	}
+
+	if torrent.Info.Announce != "" {
+		test.Errorf("Expected the uploaded tracker to be stripped; got %s", torrent.Info.Announce)
+	}
+
+	SetSource("BABOU")
+	defer SetSource("")
+	tagged, err := ReadFile(encodeMetainfo(test, validInfo()))
+	if err != nil {
+		test.Fatalf("Expected a valid torrent; got: %s", err.Error())
+	}
+
+	if tagged.Info.Info["source"] != "BABOU" || tagged.InfoHash == torrent.InfoHash {
+		test.Errorf("Expected the source tag to change the info hash; got %+v", tagged.Info.Info)
+	}
+
+	if _, err := ReadFile(strings.NewReader("d4:infod")); err == nil {
+		test.Errorf("Expected truncated bencode to be rejected.")
+	}
+
+	trailing := encodeMetainfo(test, validInfo())
+	trailing.WriteString("garbage")
+	if _, err := ReadFile(trailing); err == nil {
+		test.Errorf("Expected trailing data to be rejected.")
+	}
+}
+
+// Tests that each kind of invalid info dict is reported.
+func TestValidate(test *testing.T) {
+	cases := map[string]func(info map[string]interface{}){
+		"pieces":       func(info map[string]interface{}) { delete(info, "pieces") },
+		"hashes":       func(info map[string]interface{}) { info["pieces"] = "short" },
+		"piece count":  func(info map[string]interface{}) { info["pieces"] = strings.Repeat("x", 60) },
+		"piece length": func(info map[string]interface{}) { info["piece length"] = int64(1000) },
+		"parent path": func(info map[string]interface{}) {
+			info["files"] = []interface{}{map[string]interface{}{"length": int64(1), "path": []interface{}{"..", "etc"}}}
+		},
+		"absolute path": func(info map[string]interface{}) {
+			info["files"] = []interface{}{map[string]interface{}{"length": int64(1), "path": []interface{}{"/etc/passwd"}}}
+		},
+		"duplicate path": func(info map[string]interface{}) {
+			file := map[string]interface{}{"length": int64(10000), "path": []interface{}{"a"}}
+			info["files"] = []interface{}{file, file}
+		},
+		"file and directory": func(info map[string]interface{}) {
+			info["files"] = []interface{}{
+				map[string]interface{}{"length": int64(10000), "path": []interface{}{"a", "b"}},
+				map[string]interface{}{"length": int64(10000), "path": []interface{}{"a"}},
+			}
+		},
+		"negative length": func(info map[string]interface{}) {
+			delete(info, "files")
+			info["length"] = int64(-1)
+		},
+	}
+
+	for name, corrupt := range cases {
+		info := validInfo()
+		corrupt(info)
+
+		if errs := (&TorrentFile{Info: info}).Validate(); len(errs) == 0 {
+			test.Errorf("Expected an invalid torrent [%s] to be rejected.", name)
+		}
+	}
+}
+
+// Tests that a file cannot also be the directory of another file; in either order.
+func TestValidateFileAndDirectory(test *testing.T) {
+	for _, paths := range [][]interface{}{
+		[]interface{}{[]interface{}{"a"}, []interface{}{"a", "b"}},
+		[]interface{}{[]interface{}{"a", "b", "c"}, []interface{}{"a", "b"}},
+	} {
+		info := validInfo()
+		info["files"] = []interface{}{
+			map[string]interface{}{"length": int64(10000), "path": paths[0]},
+			map[string]interface{}{"length": int64(10000), "path": paths[1]},
+		}
+
+		errs := (&TorrentFile{Info: info}).Validate()
+		if len(errs) != 1 || !strings.Contains(errs[0], "also the directory") {
+			test.Errorf("Expected %v to be rejected as a file and a directory; got %v", paths, errs)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package totp implements time-based one-time passwords. [RFC 6238]
+//
+// Codes are six digits derived from HMAC-SHA1 over 30 second steps; the
+// parameters every common authenticator app uses by default.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DIGITS      int           = 6
+	STEP        time.Duration = 30 * time.Second
+	SECRET_SIZE int           = 20 // bytes; the size of an HMAC-SHA1 key.
+
+	// Codes from this many steps before or after the current step are
+	// accepted; to allow for clocks that have drifted.
+	SKEW int64 = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Returns a new random secret.
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, SECRET_SIZE)
+	if n, err := rand.Read(secret); n != len(secret) || err != nil {
+		return nil, errors.New("totp: error generating a secret")
+	}
+
+	return secret, nil
+}
+
+// Encodes a secret as base32; the form users type into an authenticator app.
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// Returns the otpauth:// URI an authenticator app can enroll from. [usually as a QR code]
+func URI(issuer, account string, secret []byte) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+
+	params := url.Values{}
+	params.Set("secret", EncodeSecret(secret))
+	params.Set("issuer", issuer)
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
+
+// Returns the step a time falls in.
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(STEP/time.Second)
+}
+
+// Returns the code for a time.
+func Code(secret []byte, t time.Time) string {
+	return codeAt(secret, Counter(t), DIGITS)
+}
+
+// Checks a code against the steps around `t`
+// Returns the step the code matched so callers can refuse to accept
+// the same code twice; or false if it did not match.
+func Verify(secret []byte, code string, t time.Time) (int64, bool) {
+	code = strings.Replace(strings.TrimSpace(code), " ", "", -1)
+	if len(code) != DIGITS {
+		return 0, false
+	}
+
+	current := Counter(t)
+	for counter := current - SKEW; counter <= current+SKEW; counter++ {
+		if hmac.Equal([]byte(codeAt(secret, counter, DIGITS)), []byte(code)) {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+// HOTP with dynamic truncation. [RFC 4226, section 5.3]
+func codeAt(secret []byte, counter int64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulus := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulus *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulus)
+}
@@ -0,0 +1,63 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA1 test vectors from RFC 6238, appendix B.
+func TestRFCVectors(test *testing.T) {
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+
+	for unix, expected := range vectors {
+		if actual := codeAt(secret, Counter(time.Unix(unix, 0)), 8); actual != expected {
+			test.Errorf("At %d expected %s; got %s", unix, expected, actual)
+		}
+
+		// six digit codes are the low digits of the same value.
+		if actual := Code(secret, time.Unix(unix, 0)); actual != expected[2:] {
+			test.Errorf("At %d expected %s; got %s", unix, expected[2:], actual)
+		}
+	}
+}
+
+// Tests that codes from adjacent steps are accepted and others are not.
+func TestVerifySkew(test *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+
+	for _, offset := range []time.Duration{-STEP, 0, STEP} {
+		counter, ok := Verify(secret, Code(secret, now.Add(offset)), now)
+		if !ok || counter != Counter(now.Add(offset)) {
+			test.Errorf("Expected the code %s away to be accepted", offset)
+		}
+	}
+
+	for _, code := range []string{Code(secret, now.Add(2*STEP)), "12345", "abcdef", ""} {
+		if _, ok := Verify(secret, code, now); ok {
+			test.Errorf("Expected code %q to be rejected", code)
+		}
+	}
+}
+
+func TestURI(test *testing.T) {
+	uri := URI("babou", "some user", []byte("12345678901234567890"))
+
+	expected := "otpauth://totp/babou:some%20user?issuer=babou&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if uri != expected {
+		test.Errorf("Expected %s; got %s", expected, uri)
+	}
+
+	if strings.Contains(EncodeSecret([]byte("a")), "=") {
+		test.Errorf("Expected secrets without padding")
+	}
+}
@@ -56,6 +56,13 @@ type ViewableContext interface {
 	GetViewHelpers() []interface{}
 }
 
+// Contexts which protect forms with a hidden field. (e.g: a CSRF token)
+// If they are passed to a RenderWith method every {{#FormFor}} will include the field.
+type FormTokenContext interface {
+	ViewableContext
+	FormToken() (name, value string)
+}
+
 // An action takes a map of request-parameters from the middleware
 // or router and turns it into a servicable HTTP result.
 type Action func() *Result
@@ -80,6 +87,10 @@ type RedirectPath struct {
 
 	ControllerName string
 	ActionName     string
+
+	Params []string // Variables of the route as key/value pairs. [e.g: "id", "1"]
+
+	URL string // or: a URL outside of the router. [e.g: a magnet link]
 }
 
 // Includes parameters from URLEncoded POST and GET data.
@@ -0,0 +1,234 @@
+package web
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Listings are paged with the query parameters:
+//
+//	page      the page to show; starting at 1
+//	per_page  how many rows are on a page [at most MAX_PAGE_SIZE]
+//	sort      one of the columns the listing can be sorted by
+//	order     `asc` or `desc`
+//	after     the ID of the last row on the previous page
+//
+// Numbered pages use an offset so a user can jump anywhere in a listing.
+// The "Next" link also carries `after` so that a listing which supports
+// keyset paging can seek straight to the next page no matter how deep
+// the user has paged.
+const (
+	DEFAULT_PAGE_SIZE int = 50
+	MAX_PAGE_SIZE     int = 200
+	PAGER_WINDOW      int = 3 // pages linked on either side of the current page.
+)
+
+// The page of a listing requested by a user.
+type Pagination struct {
+	Page       int
+	PerPage    int
+	Total      int // rows in the whole listing; set by the controller.
+	Sort       string
+	Descending bool
+	After      int
+
+	path   string
+	sorts  []string
+	lastId int
+	kept   url.Values
+}
+
+// A link to one page of a listing.
+// Gaps stand in for the pages which are not linked.
+type PageLink struct {
+	Number    int
+	URL       string
+	IsCurrent bool
+	IsGap     bool
+}
+
+// A link which sorts a listing by one of its columns.
+// Following the link for the current column reverses the order.
+type SortLink struct {
+	Name       string
+	URL        string
+	IsCurrent  bool
+	Descending bool
+}
+
+// Reads the requested page from a request's parameters.
+//
+// `path` is the listing's URL; links to other pages are built from it.
+// `sorts` are the columns the listing may be sorted by. The first column is
+// used when the request does not ask for one of them. Listings are sorted in
+// descending order unless `order=asc` is requested.
+func Paginate(path string, params map[string]string, sorts ...string) *Pagination {
+	p := &Pagination{
+		Page:       1,
+		PerPage:    DEFAULT_PAGE_SIZE,
+		Descending: params["order"] != "asc",
+		path:       path,
+		sorts:      sorts,
+		kept:       url.Values{},
+	}
+
+	if page, err := strconv.Atoi(params["page"]); err == nil && page > 0 {
+		p.Page = page
+	}
+
+	if perPage, err := strconv.Atoi(params["per_page"]); err == nil && perPage > 0 {
+		p.PerPage = perPage
+	}
+
+	if p.PerPage > MAX_PAGE_SIZE {
+		p.PerPage = MAX_PAGE_SIZE
+	}
+
+	if after, err := strconv.Atoi(params["after"]); err == nil && after > 0 && p.Page > 1 {
+		p.After = after
+	}
+
+	for _, sort := range sorts {
+		if params["sort"] == sort {
+			p.Sort = sort
+		}
+	}
+
+	if p.Sort == "" && len(sorts) > 0 {
+		p.Sort = sorts[0]
+	}
+
+	return p
+}
+
+// Keeps a parameter [e.g: a search query] in the links to other pages.
+func (p *Pagination) Keep(key, value string) {
+	p.kept.Set(key, value)
+}
+
+// The number of rows before this page.
+func (p *Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// Records the ID of the last row on this page so that the "Next" link can
+// seek past it. Listings which do not support keyset paging need not call this.
+func (p *Pagination) SetLastId(id int) {
+	p.lastId = id
+}
+
+// The number of pages in the listing; there is always at least one.
+func (p *Pagination) Pages() int {
+	if p.Total <= 0 {
+		return 1
+	}
+
+	return (p.Total + p.PerPage - 1) / p.PerPage
+}
+
+func (p *Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p *Pagination) HasNext() bool {
+	return p.Page < p.Pages()
+}
+
+func (p *Pagination) PrevURL() string {
+	return p.pageURL(p.Page-1, 0)
+}
+
+func (p *Pagination) NextURL() string {
+	return p.pageURL(p.Page+1, p.lastId)
+}
+
+// Links to the first and last page as well as those near the current page.
+func (p *Pagination) Links() []*PageLink {
+	pages := p.Pages()
+	first, last := p.Page-PAGER_WINDOW, p.Page+PAGER_WINDOW
+	if first < 1 {
+		first = 1
+	}
+
+	if last > pages {
+		last = pages
+	}
+
+	links := make([]*PageLink, 0, last-first+5)
+	if first > 1 {
+		links = append(links, p.link(1))
+		if first > 2 {
+			links = append(links, &PageLink{IsGap: true})
+		}
+	}
+
+	for page := first; page <= last; page++ {
+		links = append(links, p.link(page))
+	}
+
+	if last < pages {
+		if last < pages-1 {
+			links = append(links, &PageLink{IsGap: true})
+		}
+		links = append(links, p.link(pages))
+	}
+
+	return links
+}
+
+// Links which sort the listing by each of its columns; starting from page one.
+func (p *Pagination) SortLinks() []*SortLink {
+	links := make([]*SortLink, 0, len(p.sorts))
+	for _, sort := range p.sorts {
+		link := &SortLink{Name: sort, IsCurrent: sort == p.Sort, Descending: true}
+		if link.IsCurrent {
+			link.Descending = p.Descending
+		}
+
+		link.URL = p.buildURL(1, 0, sort, link.IsCurrent && p.Descending)
+		links = append(links, link)
+	}
+
+	return links
+}
+
+func (p *Pagination) link(page int) *PageLink {
+	return &PageLink{Number: page, URL: p.pageURL(page, 0), IsCurrent: page == p.Page}
+}
+
+func (p *Pagination) pageURL(page, after int) string {
+	return p.buildURL(page, after, p.Sort, !p.Descending)
+}
+
+func (p *Pagination) buildURL(page, after int, sort string, ascending bool) string {
+	query := url.Values{}
+	for key, values := range p.kept {
+		query[key] = values
+	}
+
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	}
+
+	if after > 0 && page > 1 {
+		query.Set("after", strconv.Itoa(after))
+	}
+
+	if p.PerPage != DEFAULT_PAGE_SIZE {
+		query.Set("per_page", strconv.Itoa(p.PerPage))
+	}
+
+	if sort != "" {
+		query.Set("sort", sort)
+	}
+
+	if ascending {
+		query.Set("order", "asc")
+	}
+
+	if len(query) == 0 {
+		return p.path
+	}
+
+	return p.path + "?" + query.Encode()
+}
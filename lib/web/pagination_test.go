@@ -0,0 +1,81 @@
+package web
+
+import (
+	"testing"
+)
+
+// Tests that requested pages are read from the params and clamped.
+func TestPaginate(test *testing.T) {
+	p := Paginate("/torrents", map[string]string{}, "date", "name")
+	if p.Page != 1 || p.PerPage != DEFAULT_PAGE_SIZE || p.Sort != "date" || !p.Descending {
+		test.Errorf("Expected the first page sorted by date; got %+v", p)
+	}
+
+	p = Paginate("/torrents", map[string]string{
+		"page":     "3",
+		"per_page": "1000",
+		"sort":     "name",
+		"order":    "asc",
+		"after":    "42",
+	}, "date", "name")
+
+	if p.Page != 3 || p.PerPage != MAX_PAGE_SIZE || p.Sort != "name" || p.Descending || p.After != 42 {
+		test.Errorf("Expected the third page sorted by name; got %+v", p)
+	}
+
+	if offset := p.Offset(); offset != 2*MAX_PAGE_SIZE {
+		test.Errorf("Expected an offset of %d; got %d", 2*MAX_PAGE_SIZE, offset)
+	}
+
+	p = Paginate("/torrents", map[string]string{"sort": "bogus", "after": "42"}, "date")
+	if p.Sort != "date" || p.After != 0 {
+		test.Errorf("Expected unknown sorts and a cursor on the first page to be ignored; got %+v", p)
+	}
+}
+
+// Tests the links to neighbouring pages.
+func TestPaginationLinks(test *testing.T) {
+	p := Paginate("/torrents", map[string]string{"page": "10"}, "date")
+	p.Total = 20 * DEFAULT_PAGE_SIZE
+	p.SetLastId(7)
+
+	if p.Pages() != 20 || !p.HasPrev() || !p.HasNext() {
+		test.Errorf("Expected page 10 of 20; got %d pages", p.Pages())
+	}
+
+	if url := p.NextURL(); url != "/torrents?after=7&page=11&sort=date" {
+		test.Errorf("Unexpected next page URL: %s", url)
+	}
+
+	if url := p.PrevURL(); url != "/torrents?page=9&sort=date" {
+		test.Errorf("Unexpected previous page URL: %s", url)
+	}
+
+	// 1 ... 7 8 9 [10] 11 12 13 ... 20
+	links := p.Links()
+	if len(links) != 11 || links[0].Number != 1 || !links[1].IsGap ||
+		!links[5].IsCurrent || !links[9].IsGap || links[10].Number != 20 {
+		test.Errorf("Unexpected page links: %+v", links)
+	}
+
+	last := Paginate("/torrents", map[string]string{"page": "20"}, "date")
+	last.Total = p.Total
+	if last.HasNext() {
+		test.Errorf("Expected no page after the last page")
+	}
+}
+
+// Tests that following the current sort reverses its order.
+func TestSortLinks(test *testing.T) {
+	p := Paginate("/torrents", map[string]string{"page": "2"}, "date", "name")
+	p.Keep("q", "wire")
+
+	links := p.SortLinks()
+	if links[0].URL != "/torrents?order=asc&q=wire&sort=date" || !links[0].IsCurrent {
+		test.Errorf("Expected the current sort to reverse its order; got %s", links[0].URL)
+	}
+
+	if links[1].URL != "/torrents?q=wire&sort=name" || links[1].IsCurrent {
+		test.Errorf("Expected other sorts to start descending; got %s", links[1].URL)
+	}
+}
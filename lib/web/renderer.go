@@ -153,8 +153,18 @@ func renderWith(viewsRoot, templateName, controllerName, actionName string, filt
 		Yield: yieldFn,
 	}
 
-	expandedFilterHelpers = append(expandedFilterHelpers, viewData, getHelpers(), getFormHelpers())
+	helpers := getHelpers()
+	expandedFilterHelpers = append(expandedFilterHelpers, viewData, helpers, getFormHelpers())
 	for i := 0; i < len(filterHelpers); i++ {
+		if v, ok := filterHelpers[i].(FormTokenContext); ok {
+			if name, value := v.FormToken(); name != "" {
+				hiddenField := HiddenField(name, value)
+				helpers.FormFor = func(params []string, data string) string {
+					return buildForm(params, data, hiddenField)
+				}
+			}
+		}
+
 		v, ok := filterHelpers[i].(ViewableContext)
 		if ok {
 			expandedFilterHelpers = append(expandedFilterHelpers, v.GetViewHelpers()...)
@@ -296,6 +306,11 @@ func FileFor(params []string, data string) string {
 //    {{/FormFor}}
 // Where the register.template can now use any of the Form helpers.
 func BuildForm(params []string, data string) string {
+	return buildForm(params, data, "")
+}
+
+// Builds a form which includes `hiddenFields` right after its opening tag.
+func buildForm(params []string, data, hiddenFields string) string {
 	var controllerName string
 	var httpMethod string
 	var formId string
@@ -342,7 +357,13 @@ func BuildForm(params []string, data string) string {
 	// Render inner-content with Form context
 
 	formBody := mustache.Render(data, getFormHelpers())
-	return fmt.Sprintf("%s\n%s\n%s", openTag, formBody, closeTag)
+	return fmt.Sprintf("%s\n%s%s\n%s", openTag, hiddenFields, formBody, closeTag)
+}
+
+// Generates a hidden input with an escaped name and value.
+func HiddenField(name, value string) string {
+	return fmt.Sprintf("<input type=\"hidden\" name=\"%s\" value=\"%s\" />",
+		EscapeString(name), EscapeString(value))
 }
 
 // Generates a label for a form field
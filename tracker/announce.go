@@ -13,9 +13,10 @@ import (
 	"encoding/hex"
 
 	"bytes"
-	//"fmt"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
 // This block defines several preset responses for common failures.
@@ -48,7 +49,6 @@ func init() {
 // Handles announce from a client.
 // Some TODOs:
 //  * Bail out early if secret/hash or request is obviously malformed. (Not from a well-behaved torrent client.)
-//  * Cache users and their secrets. (Presumably if they have started one torrent they will start many more.)
 //  * Intelligent peer-list generation.
 //  * Set `Content-Length` ?
 func announceHandle(w http.ResponseWriter, r *http.Request, s *Server) {
@@ -59,10 +59,10 @@ func announceHandle(w http.ResponseWriter, r *http.Request, s *Server) {
 
 	hexHash := hex.EncodeToString([]byte(params.All["info_hash"]))
 
-	torrent, ok := s.torrentExists(hexHash)
+	torrent, torrentOk := s.torrentExists(hexHash)
 
-	user := &models.User{}
-	if err := user.SelectSecret(params.All["secret"]); err != nil {
+	user, ok := s.userExists(params.All["secret"])
+	if !ok {
 		w.Write(failureResponses[RESP_USER_NOT_FOUND])
 
 		return
@@ -76,7 +76,7 @@ func announceHandle(w http.ResponseWriter, r *http.Request, s *Server) {
 
 	// TODO: tracker request log.
 
-	if !ok {
+	if !torrentOk {
 		w.Write(failureResponses[RESP_TORRENT_NOT_FOUND])
 		return
 	}
@@ -93,7 +93,10 @@ func announceHandle(w http.ResponseWriter, r *http.Request, s *Server) {
 
 	// Defer writes outside of response
 	// (Just in case we block on DB access or have to contend for the peer list's mutex)
+	s.pendingStats.Add(1)
 	go func() {
+		defer s.pendingStats.Done()
+
 		if params.All["event"] == "stopped" {
 			// TODO: remove peer method
 			torrent.WritePeers(func(peerMap map[string]*libTorrent.Peer) {
@@ -110,6 +113,13 @@ func announceHandle(w http.ResponseWriter, r *http.Request, s *Server) {
 			torrent.UpdateStatsFor(params.All["peer_id"], "0", "0", params.All["left"])
 		}
 
+		// Snatches are counted here, once per user, rather than by each web node.
+		if params.All["event"] == "completed" {
+			if _, err := models.RecordSnatch(torrent.InfoHash, user.UserId); err != nil {
+				fmt.Printf("Error recording snatch of %s by user %d: %s \n", torrent.InfoHash, user.UserId, err.Error())
+			}
+		}
+
 		// Send stats over event bridge.
 		stats := libBridge.TorrentStatMessage{}
 		stats.InfoHash = torrent.InfoHash
@@ -122,7 +132,7 @@ func announceHandle(w http.ResponseWriter, r *http.Request, s *Server) {
 		// TODO: Reaper needs to send this event
 		// when a peer is removed.
 
-		s.eventBridge.Publish("tracker", message)
+		s.eventBridge.Publish(TRACKER_EVENT_NAME, message)
 
 	}()
 }
@@ -139,39 +149,108 @@ func encodeResponseMap(responseMap map[string]interface{}) io.Reader {
 // Checks if the torrent exists in cache. Otherwise attempts to fill
 // cache from the database.
 //
+// Disabled torrents are never cached. Hybrid torrents are cached by both
+// their v1 hash and their truncated v2 hash. A torrent evicted while it
+// was being loaded is loaded again; so it is never cached stale.
+//
 // TODO:
 // * Cache-filler should probably have some sort of timeout per torrent.
 // * Cache-filler should check that `info_hash` is not obviously malformed.
 // * Distributed/coordinated cache fills? [ref: groupcache]
 func (s *Server) torrentExists(infoHash string) (*libTorrent.Torrent, bool) {
-	torrent := s.torrentCache[infoHash]
+	for {
+		s.cacheLock.RLock()
+		torrent := s.torrentCache[infoHash]
+		evicts := s.torrentEvicts
+		s.cacheLock.RUnlock()
+
+		if torrent != nil {
+			// Cache hit
+			return torrent, true
+		}
 
-	if torrent == nil {
 		// Cache miss
-
 		dbTorrent := &models.Torrent{}
-		if err := dbTorrent.SelectHash(infoHash); err != nil {
-			// Check DB for torrent
+		if err := dbTorrent.SelectHash(infoHash); err != nil || dbTorrent.IsDisabled {
 			return nil, false
-		} else {
+		}
+
+		prepareTorrent, err := dbTorrent.LoadTorrent()
+		if err != nil {
 			// Attempt to lib.Torrent{} from database model failed.
-			prepareTorrent, err := dbTorrent.LoadTorrent()
-			if err != nil {
+			return nil, false
+		}
+
+		trackerTorrent := libTorrent.NewTorrent(prepareTorrent)
+		trackerTorrent.InfoHash = dbTorrent.InfoHash
+		trackerTorrent.InfoHashV2 = dbTorrent.InfoHashV2
+
+		if cached, ok := s.cacheTorrent(trackerTorrent, evicts); ok {
+			return cached, true
+		}
+	}
+}
+
+// Caches a torrent loaded from the database and returns the cached torrent.
+// Returns false without caching it if a torrent has been evicted since the
+// eviction count `evicts` was read; the load may have raced its deletion.
+func (s *Server) cacheTorrent(torrent *libTorrent.Torrent, evicts uint64) (*libTorrent.Torrent, bool) {
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
+
+	if s.torrentEvicts != evicts {
+		return nil, false
+	}
+
+	// Another announce may have filled the cache while we were
+	// talking to the database; keep theirs so no peers are lost.
+	if cached := s.torrentCache[torrent.InfoHash]; cached != nil {
+		return cached, true
+	}
+
+	// peers of a hybrid torrent share one swarm; whichever hash they announce.
+	s.torrentCache[torrent.InfoHash] = torrent
+	if torrent.InfoHashV2 != "" {
+		s.torrentCache[libTorrent.TruncateHash(torrent.InfoHashV2)] = torrent
+	}
+
+	return torrent, true
+}
+
+// Checks if a user with the given secret exists in cache. Otherwise
+// attempts to fill the cache from the database.
+//
+// Users are removed from this cache by events from the web application,
+// or once the secret they were cached by has expired. A secret evicted while
+// it was being looked up is looked up again; so it is never cached stale.
+func (s *Server) userExists(secret string) (*models.User, bool) {
+	for {
+		s.cacheLock.RLock()
+		user := s.userCache[secret]
+		evicts := s.userEvicts
+		s.cacheLock.RUnlock()
+
+		if user != nil {
+			if !user.SecretExpires.IsZero() && time.Now().After(user.SecretExpires) {
+				s.evictUser(secret)
 				return nil, false
 			}
 
-			trackerTorrent := libTorrent.NewTorrent(prepareTorrent)
-			trackerTorrent.InfoHash = dbTorrent.InfoHash
-			s.torrentCache[infoHash] = trackerTorrent
+			return user, true
+		}
 
-			return s.torrentCache[infoHash], true
+		user = &models.User{}
+		if err := user.SelectSecret(secret); err != nil {
+			return nil, false
 		}
 
-		// All torrent cache-filling strategies have failed.
-		return nil, false
-	} else {
-		// Cache hit
+		s.cacheLock.Lock()
+		if s.userEvicts == evicts {
+			s.userCache[secret] = user
+			s.cacheLock.Unlock()
 
-		return torrent, true
+			return user, true
+		}
+		s.cacheLock.Unlock()
 	}
 }
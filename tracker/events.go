@@ -0,0 +1,143 @@
+package tracker
+
+import (
+	bridge "github.com/drbawb/babou/bridge"
+	libTorrent "github.com/drbawb/babou/lib/torrent"
+
+	"fmt"
+	"time"
+)
+
+const (
+	TRACKER_EVENT_NAME   string = "tracker"
+	TRACKER_EVENT_BUFFER int    = 10
+)
+
+// Subscribes the tracker to the event bridge.
+// Messages from the web application are handled in the order they arrive.
+func (s *Server) listenForEvents() {
+	messages := make(chan *bridge.Message, TRACKER_EVENT_BUFFER)
+	s.eventBridge.Subscribe(TRACKER_EVENT_NAME, messages)
+
+	go func() {
+		for msg := range messages {
+			s.handleWebEvent(msg)
+		}
+	}()
+}
+
+// Keeps the tracker's caches consistent with changes made by the web application.
+// Each event is logged by the case which handles it; heartbeats are not logged.
+func (s *Server) handleWebEvent(message *bridge.Message) {
+	switch message.Type {
+	case bridge.DELETE_TORRENT:
+		if v, ok := message.Payload.(bridge.DeleteTorrentMessage); ok {
+			fmt.Printf("Removing torrent: %s from cache; deleted because %s \n", v.InfoHash, v.Reason)
+			s.evictTorrent(v.InfoHash)
+		}
+	case bridge.DISABLE_TORRENT:
+		if v, ok := message.Payload.(bridge.DisableTorrentMessage); ok {
+			fmt.Printf("Removing torrent: %s from cache; disabled because %s \n", v.InfoHash, v.Reason)
+			s.evictTorrent(v.InfoHash)
+		}
+	case bridge.DELETE_USER:
+		if v, ok := message.Payload.(bridge.DeleteUserMessage); ok {
+			fmt.Printf("Removing user: %d from cache; account deleted \n", v.UserId)
+			s.evictUserSecrets(v.UserId, v.Secret)
+		}
+	case bridge.DISABLE_USER:
+		if v, ok := message.Payload.(bridge.DisableUserMessage); ok {
+			fmt.Printf("Removing user: %d from cache; banned because %s \n", v.UserId, v.Reason)
+			s.evictUserSecrets(v.UserId, v.Secret)
+		}
+	case bridge.UPDATE_USER_KEY:
+		if v, ok := message.Payload.(bridge.UserKeyMessage); ok {
+			if time.Now().Before(v.GraceUntil) {
+				fmt.Printf("Old secret for user: %d expires at %s \n", v.UserId, v.GraceUntil)
+				s.expireUser(v.OldSecret, v.GraceUntil)
+			} else {
+				fmt.Printf("Invalidating old secret for user: %d \n", v.UserId)
+				s.evictUser(v.OldSecret)
+			}
+		}
+	case bridge.NODE_HEARTBEAT, bridge.NODE_LEAVE:
+		// membership is tracked by the bridge itself.
+	default:
+		fmt.Printf("Message dropped; unknown message type [%v] \n", message)
+	}
+}
+
+// Removes a torrent and all of its peers from the cache.
+// The torrent will be reloaded from the database if it is announced again.
+//
+// Hybrid torrents are cached by both of their hashes; both are removed.
+func (s *Server) evictTorrent(infoHash string) {
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
+
+	s.torrentEvicts++
+
+	if cached := s.torrentCache[infoHash]; cached != nil {
+		delete(s.torrentCache, libTorrent.TruncateHash(cached.InfoHashV2))
+	}
+
+	delete(s.torrentCache, infoHash)
+}
+
+// Marks a user's cached secret as expiring; the user is evicted the
+// first time they announce with it after that.
+func (s *Server) expireUser(secret string, expires time.Time) {
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
+
+	s.userEvicts++
+
+	user := s.userCache[secret]
+	if user == nil {
+		delete(s.userCache, secret) // will be reloaded with its expiry.
+		return
+	}
+
+	expiring := *user
+	expiring.SecretExpires = expires
+	s.userCache[secret] = &expiring
+}
+
+// Forgets every secret cached for a user; their current secret and one
+// still in its grace period. Drops every peer that announced with them.
+func (s *Server) evictUserSecrets(userId int, secret string) {
+	secrets := []string{secret}
+
+	s.cacheLock.RLock()
+	for cached, user := range s.userCache {
+		if user != nil && user.UserId == userId && cached != secret {
+			secrets = append(secrets, cached)
+		}
+	}
+	s.cacheLock.RUnlock()
+
+	for _, secret := range secrets {
+		s.evictUser(secret)
+	}
+}
+
+// Forgets a user's secret and drops every peer that announced with it.
+func (s *Server) evictUser(secret string) {
+	s.cacheLock.Lock()
+	delete(s.userCache, secret)
+	s.userEvicts++
+	s.cacheLock.Unlock()
+
+	s.cacheLock.RLock()
+	defer s.cacheLock.RUnlock()
+
+	for _, torrent := range s.torrentCache {
+		torrent.WritePeers(func(peerMap map[string]*libTorrent.Peer) {
+			for peerId, peer := range peerMap {
+				if peer.Secret == secret {
+					delete(peerMap, peerId)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drbawb/babou/app/models"
+	"github.com/drbawb/babou/bridge"
+	"github.com/drbawb/babou/lib"
+	"github.com/drbawb/babou/lib/torrent"
+)
+
+const (
+	EVENT_TEST_TIMEOUT = 2 * time.Second
+	EVENT_TEST_SENDER  = "web-test"
+)
+
+// Creates a tracker subscribed to a bridge using the local transport.
+func setupEventTest() (*Server, *bridge.Bridge) {
+	eventBridge := bridge.NewBridge(&lib.TransportSettings{Transport: lib.LOCAL_TRANSPORT})
+	s := NewServer(&lib.AppSettings{}, eventBridge, make(chan int))
+	s.listenForEvents()
+
+	return s, eventBridge
+}
+
+// Polls until the condition holds or the test times out.
+func waitFor(test *testing.T, condition func() bool) {
+	deadline := time.Now().Add(EVENT_TEST_TIMEOUT)
+	for !condition() {
+		if time.Now().After(deadline) {
+			test.Fatal("Timed out waiting for the tracker to handle an event.")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Counts the peers on a torrent that announced with a given secret.
+func peersWithSecret(t *torrent.Torrent, secret string) int {
+	count := 0
+	t.ReadPeers(func(peerMap map[string]*torrent.Peer) {
+		for _, peer := range peerMap {
+			if peer.Secret == secret {
+				count++
+			}
+		}
+	})
+
+	return count
+}
+
+// Tests that deleted and disabled torrents are evicted from the tracker's cache.
+func TestTorrentEventsEvictCache(test *testing.T) {
+	s, eventBridge := setupEventTest()
+
+	s.torrentCache["deleted"] = MockTorrent()
+	s.torrentCache["disabled"] = MockTorrent()
+	s.torrentCache["innocent"] = MockTorrent()
+
+	eventBridge.Publish(EVENT_TEST_SENDER, bridge.DeleteTorrent("deleted", "dupe"))
+	eventBridge.Publish(EVENT_TEST_SENDER, bridge.DisableTorrent("disabled", "no logs"))
+
+	waitFor(test, func() bool {
+		s.cacheLock.RLock()
+		defer s.cacheLock.RUnlock()
+
+		return s.torrentCache["deleted"] == nil && s.torrentCache["disabled"] == nil
+	})
+
+	if s.torrentCache["innocent"] == nil {
+		test.Error("Torrent was evicted without being deleted or disabled.")
+	}
+}
+
+// Tests that banning, deleting, or resetting a user drops their peers
+// from every torrent and forgets their secret.
+func TestUserEventsDropPeers(test *testing.T) {
+	s, eventBridge := setupEventTest()
+
+	first, second := MockTorrent(), MockTorrent()
+	s.torrentCache["first"], s.torrentCache["second"] = first, second
+
+	for _, t := range []*torrent.Torrent{first, second} {
+		t.AddPeer("banned", "[::1]:1337", "1337", "bannedsecret")
+		t.AddPeer("deleted", "[::1]:1337", "1337", "deletedsecret")
+		t.AddPeer("reset", "[::1]:1337", "1337", "oldsecret")
+		t.AddPeer("innocent", "[::1]:1337", "1337", "innocentsecret")
+	}
+
+	s.userCache["oldsecret"] = nil
+
+	eventBridge.Publish(EVENT_TEST_SENDER, bridge.DisableUser(1, "bannedsecret", "hit and run"))
+	eventBridge.Publish(EVENT_TEST_SENDER, bridge.DeleteUser(2, "deletedsecret"))
+	eventBridge.Publish(EVENT_TEST_SENDER, bridge.UpdateUserKey(3, "oldsecret", time.Time{}))
+
+	waitFor(test, func() bool {
+		for _, t := range []*torrent.Torrent{first, second} {
+			if peersWithSecret(t, "bannedsecret")+
+				peersWithSecret(t, "deletedsecret")+
+				peersWithSecret(t, "oldsecret") > 0 {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	for _, t := range []*torrent.Torrent{first, second} {
+		if peersWithSecret(t, "innocentsecret") != 1 {
+			test.Error("Peer was dropped for a user that was not affected by any event.")
+		}
+	}
+
+	s.cacheLock.RLock()
+	defer s.cacheLock.RUnlock()
+	if _, ok := s.userCache["oldsecret"]; ok {
+		test.Error("Old secret is still cached after the user's key was updated.")
+	}
+}
+
+// Tests that a secret with a grace period keeps its peers until it expires.
+func TestUserKeyGracePeriod(test *testing.T) {
+	s, eventBridge := setupEventTest()
+
+	t := MockTorrent()
+	s.torrentCache["torrent"] = t
+	t.AddPeer("rotating", "[::1]:1337", "1337", "oldsecret")
+
+	s.userCache["oldsecret"] = &models.User{UserId: 3}
+
+	graceUntil := time.Now().Add(1 * time.Hour)
+	eventBridge.Publish(EVENT_TEST_SENDER, bridge.UpdateUserKey(3, "oldsecret", graceUntil))
+
+	waitFor(test, func() bool {
+		s.cacheLock.RLock()
+		defer s.cacheLock.RUnlock()
+
+		user := s.userCache["oldsecret"]
+		return user != nil && user.SecretExpires.Equal(graceUntil)
+	})
+
+	if peersWithSecret(t, "oldsecret") != 1 {
+		test.Error("Peer was dropped before the old secret's grace period ended.")
+	}
+
+	// once the grace period has passed the next announce evicts the user.
+	s.expireUser("oldsecret", time.Now().Add(-1*time.Second))
+	if _, ok := s.userExists("oldsecret"); ok {
+		test.Error("Expired secret was still accepted.")
+	}
+
+	if peersWithSecret(t, "oldsecret") != 0 {
+		test.Error("Peers were not dropped once the old secret expired.")
+	}
+}
+
+// Tests that banning a user whose old secret is still in its grace period
+// forgets both of their secrets.
+func TestBanEvictsBothSecrets(test *testing.T) {
+	s, eventBridge := setupEventTest()
+
+	t := MockTorrent()
+	s.torrentCache["torrent"] = t
+	t.AddPeer("current", "[::1]:1337", "1337", "newsecret")
+	t.AddPeer("rotating", "[::1]:1337", "1337", "oldsecret")
+	t.AddPeer("innocent", "[::1]:1337", "1337", "innocentsecret")
+
+	s.userCache["newsecret"] = &models.User{UserId: 3}
+	s.userCache["oldsecret"] = &models.User{UserId: 3, SecretExpires: time.Now().Add(1 * time.Hour)}
+	s.userCache["innocentsecret"] = &models.User{UserId: 4}
+
+	eventBridge.Publish(EVENT_TEST_SENDER, bridge.DisableUser(3, "newsecret", "hit and run"))
+
+	waitFor(test, func() bool {
+		return peersWithSecret(t, "newsecret")+peersWithSecret(t, "oldsecret") == 0
+	})
+
+	s.cacheLock.RLock()
+	defer s.cacheLock.RUnlock()
+
+	if len(s.userCache) != 1 || s.userCache["innocentsecret"] == nil {
+		test.Errorf("Expected only the innocent user to stay cached; cache: %v", s.userCache)
+	}
+
+	if peersWithSecret(t, "innocentsecret") != 1 {
+		test.Error("Peer was dropped for a user that was not banned.")
+	}
+}
+
+// Tests that a torrent deleted while it was being loaded is not cached
+// once the load finishes.
+func TestEvictDuringTorrentLoad(test *testing.T) {
+	s, eventBridge := setupEventTest()
+
+	// the load begins ...
+	s.cacheLock.RLock()
+	evicts := s.torrentEvicts
+	s.cacheLock.RUnlock()
+
+	// ... the torrent is deleted ...
+	eventBridge.Publish(EVENT_TEST_SENDER, bridge.DeleteTorrent("deleted", "dupe"))
+	waitFor(test, func() bool {
+		s.cacheLock.RLock()
+		defer s.cacheLock.RUnlock()
+
+		return s.torrentEvicts != evicts
+	})
+
+	// ... and the load finishes with the row it read beforehand.
+	loaded := MockTorrent()
+	loaded.InfoHash = "deleted"
+	if _, ok := s.cacheTorrent(loaded, evicts); ok {
+		test.Error("Torrent loaded before its eviction was accepted.")
+	}
+
+	if s.torrentCache["deleted"] != nil {
+		test.Error("Deleted torrent was cached again.")
+	}
+
+	// a load which began after the eviction is cached.
+	if cached, ok := s.cacheTorrent(loaded, s.torrentEvicts); !ok || cached != loaded {
+		test.Error("Torrent loaded after the eviction was not cached.")
+	}
+}
+
+// Tests that a hybrid torrent is evicted by both of its hashes.
+func TestEvictHybridTorrent(test *testing.T) {
+	s, _ := setupEventTest()
+
+	hybrid := MockTorrent()
+	hybrid.InfoHash = "v1"
+	hybrid.InfoHashV2 = "0123456789012345678901234567890123456789abcdefabcdefabcdefabcdef"
+	s.torrentCache["v1"] = hybrid
+	s.torrentCache[torrent.TruncateHash(hybrid.InfoHashV2)] = hybrid
+
+	s.evictTorrent("v1")
+	if len(s.torrentCache) != 0 {
+		test.Errorf("Expected both hashes to be evicted; cache: %v", s.torrentCache)
+	}
+}
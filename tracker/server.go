@@ -4,14 +4,17 @@
 package tracker
 
 import (
+	models "github.com/drbawb/babou/app/models"
 	bridge "github.com/drbawb/babou/bridge"
 	libBabou "github.com/drbawb/babou/lib"
 	libTorrent "github.com/drbawb/babou/lib/torrent"
 	tasks "github.com/drbawb/babou/tracker/tasks"
 
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -19,9 +22,18 @@ import (
 type Server struct {
 	Port int
 
-	serverIO     chan int
-	torrentCache map[string]*libTorrent.Torrent
-	peerReaper   *tasks.PeerReaper
+	serverIO      chan int
+	torrentCache  map[string]*libTorrent.Torrent
+	torrentEvicts uint64                  // counts evicted torrents; a load which began before one is not cached
+	userCache     map[string]*models.User // users keyed by their hex-encoded secret
+	userEvicts    uint64                  // counts changes to cached secrets; a lookup which began before one is not cached
+	cacheLock     *sync.RWMutex           // protects both caches and their eviction counts
+	peerReaper    *tasks.PeerReaper
+
+	httpServer   *http.Server
+	pendingStats *sync.WaitGroup // announces whose stats have not been published yet
+	quit         chan bool       // closed to stop the peer reaper
+	quitOnce     *sync.Once      // closes quit on the first shutdown
 
 	eventBridge *bridge.Bridge
 }
@@ -30,51 +42,81 @@ type Server struct {
 func NewServer(appSettings *libBabou.AppSettings, eventBridge *bridge.Bridge, serverIO chan int) *Server {
 	newServer := &Server{
 		torrentCache: make(map[string]*libTorrent.Torrent),
+		userCache:    make(map[string]*models.User),
+		cacheLock:    &sync.RWMutex{},
+		pendingStats: &sync.WaitGroup{},
+		quit:         make(chan bool),
+		quitOnce:     &sync.Once{},
 	}
 
 	newServer.Port = appSettings.TrackerPort
 	newServer.serverIO = serverIO
 	newServer.peerReaper = &tasks.PeerReaper{} //TODO: constructor.
 	newServer.eventBridge = eventBridge
+	newServer.httpServer = &http.Server{Addr: fmt.Sprintf(":%d", newServer.Port)}
 
 	return newServer
 }
 
 func (s *Server) Start() {
-	router := LoadRoutes(s)
+	s.httpServer.Handler = LoadRoutes(s)
+	s.listenForEvents()
 
 	go func() {
 		// start with custom muxer.
-		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", s.Port), router))
+		if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			log.Printf("Tracker stopped unexpectedly: %s", err.Error())
+			s.serverIO <- libBabou.TRACKER_SERVER_ERR
+		}
 	}()
 
 	//TODO: task scheduler of some kind.
 	go func() {
 		tenMinutes := time.Duration(10) * time.Minute
 		timer := time.NewTicker(tenMinutes)
+		defer timer.Stop()
 
 		for {
 			select {
 			case _ = <-timer.C:
 				//TODO: rate limit ...
 				fmt.Printf("\n reaping peers . . . \n")
+				s.cacheLock.RLock()
 				for _, v := range s.torrentCache {
 					s.peerReaper.ReapTorrent(v)
 				}
+				s.cacheLock.RUnlock()
+			case <-s.quit:
+				return
 			}
 		}
 
 	}()
+
+	s.serverIO <- libBabou.TRACKER_SERVER_START
 }
 
-func handleWebEvent(message *bridge.Message) {
-	fmt.Printf("Received [%v] from bridge \n", message)
-	switch message.Type {
-	case bridge.DELETE_TORRENT:
-		v := message.Payload.(*bridge.DeleteTorrentMessage)
-		fmt.Printf("Removing torrent: %s from cache; deleted because %s \n", v.InfoHash, v.Reason)
-	default:
-		fmt.Printf("Message dropped; unknown message type \n")
+// Stops accepting announces, waits for the ones in progress to finish,
+// and for their stats to be handed to the event bridge.
+// Gives up once the context is done; it is safe to call again.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.quitOnce.Do(func() { close(s.quit) })
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	flushed := make(chan bool)
+	go func() {
+		s.pendingStats.Wait()
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 